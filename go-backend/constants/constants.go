@@ -13,11 +13,116 @@ const (
 
 // Authentication constants
 const (
-	// JWTExpirationHours is how long a JWT token is valid
-	JWTExpirationHours = 72 * time.Hour
+	// AccessTokenExpiration is how long a JWT access token is valid
+	AccessTokenExpiration = 15 * time.Minute
+
+	// RefreshTokenExpiration is how long a refresh token can be exchanged for a new token pair
+	RefreshTokenExpiration = 30 * 24 * time.Hour
+
+	// RefreshTokenBytes is the number of random bytes in a refresh token
+	RefreshTokenBytes = 32
+
+	// TokenCleanupInterval is how often expired refresh tokens and revocations are purged
+	TokenCleanupInterval = 6 * time.Hour
 
 	// MinPasswordLength is the minimum required password length
 	MinPasswordLength = 8
+
+	// AccountDeletionConfirmation must be sent as 'confirm' to /me/delete
+	AccountDeletionConfirmation = "DELETE"
+
+	// EmailVerificationTokenExpiration is how long an email verification link stays valid
+	EmailVerificationTokenExpiration = 48 * time.Hour
+
+	// PasswordResetTokenExpiration is how long a password reset link stays valid
+	PasswordResetTokenExpiration = 1 * time.Hour
+
+	// EmailTokenBytes is the number of random bytes in an email verification or password reset token
+	EmailTokenBytes = 32
+
+	// TwoFactorChallengeExpiration is how long the token from a password login stays valid for
+	// completing two-factor authentication
+	TwoFactorChallengeExpiration = 5 * time.Minute
+
+	// TwoFactorClaim marks tokens from a password login that still need a second factor; its value is TwoFactorPending
+	TwoFactorClaim   = "mfa"
+	TwoFactorPending = "pending"
+
+	// TOTPIssuer names the account in authenticator apps
+	TOTPIssuer = "MySpendo"
+
+	// TOTPSkewSteps is how many 30-second steps of clock drift are tolerated either way
+	TOTPSkewSteps = 1
+
+	// RecoveryCodeCount is how many one-time recovery codes are issued when two-factor authentication is enabled
+	RecoveryCodeCount = 10
+
+	// RecoveryCodeBytes is the number of random bytes in a recovery code
+	RecoveryCodeBytes = 10
+
+	// RecentSignInWindow is how recently an account without a password must have signed in to
+	// delete itself or turn off two-factor authentication
+	RecentSignInWindow = 10 * time.Minute
+
+	// OIDCLoginExpiration is how long a single sign-on login can take at the identity provider
+	OIDCLoginExpiration = 10 * time.Minute
+
+	// OIDCStateBytes is the number of random bytes in the state and nonce of a single sign-on login
+	OIDCStateBytes = 32
+
+	// OIDCTimeout bounds each request to the identity provider
+	OIDCTimeout = 10 * time.Second
+
+	// PersonalTokenPrefix starts every personal access token, so they can be told apart from session JWTs
+	PersonalTokenPrefix = "msp_"
+
+	// PersonalTokenBytes is the number of random bytes in a personal access token
+	PersonalTokenBytes = 32
+
+	// DefaultPersonalTokenDays is how long a personal access token is valid unless another lifetime is chosen
+	DefaultPersonalTokenDays = 90
+
+	// MaxPersonalTokenDays is the longest lifetime of a personal access token
+	MaxPersonalTokenDays = 365
+
+	// MaxPersonalTokens is how many personal access tokens a user can have
+	MaxPersonalTokens = 50
+
+	// PersonalTokenUseInterval is how often a token's last-used time is updated while it is in use
+	PersonalTokenUseInterval = 1 * time.Minute
+
+	// LedgerInvitationExpiration is how long an invitation to join a ledger stays valid
+	LedgerInvitationExpiration = 7 * 24 * time.Hour
+)
+
+// Personal access token scopes; each grants the endpoints listed in API.md
+const (
+	ScopeTransactionsRead   = "transactions:read"
+	ScopeTransactionsWrite  = "transactions:write"
+	ScopeCategoriesRead     = "categories:read"
+	ScopeCategoriesWrite    = "categories:write"
+	ScopeBudgetsRead        = "budgets:read"
+	ScopeBudgetsWrite       = "budgets:write"
+	ScopeRecurringRead      = "recurring:read"
+	ScopeRecurringWrite     = "recurring:write"
+	ScopeReportsRead        = "reports:read"
+	ScopeNotificationsRead  = "notifications:read"
+	ScopeNotificationsWrite = "notifications:write"
+)
+
+// Background jobs
+const (
+	// BudgetPeriodCloseInterval is how often ended budget periods are recorded in budget_periods
+	BudgetPeriodCloseInterval = 6 * time.Hour
+
+	// BudgetAlertCheckInterval is how often every user's budgets are checked for alert thresholds
+	BudgetAlertCheckInterval = 1 * time.Hour
+
+	// BudgetAlertQueueSize is how many on-demand budget alert checks can wait for the job
+	BudgetAlertQueueSize = 256
+
+	// NotificationTimeout bounds the delivery of one notification across all channels
+	NotificationTimeout = 30 * time.Second
 )
 
 // Database timeouts
@@ -46,6 +151,24 @@ const (
 	// MaxCategoryNameLength is the maximum length for category names
 	MaxCategoryNameLength = 100
 
+	// MaxLedgerNameLength is the maximum length for ledger names
+	MaxLedgerNameLength = 100
+
+	// MaxLedgersPerUser is how many ledgers a user can create
+	MaxLedgersPerUser = 20
+
+	// MaxSplitParticipants is how many members one expense can be split between
+	MaxSplitParticipants = 50
+
+	// MaxSplitShares is the most shares one participant can have in an expense split by shares
+	MaxSplitShares = 1000
+
+	// MaxAccountNameLength is the maximum length for account names
+	MaxAccountNameLength = 100
+
+	// MaxAccountsPerLedger is how many accounts a ledger can have
+	MaxAccountsPerLedger = 100
+
 	// MaxDescriptionLength is the maximum length for descriptions
 	MaxDescriptionLength = 500
 
@@ -54,6 +177,61 @@ const (
 
 	// DefaultPaginationLimit is the default number of records per page
 	DefaultPaginationLimit = 20
+
+	// MaxExchangeRateRows is the maximum number of rows accepted in one exchange rate import
+	MaxExchangeRateRows = 10000
+
+	// MaxExchangeRateUploadBytes is the maximum size of an exchange rate CSV upload
+	MaxExchangeRateUploadBytes = 2 << 20 // 2 MB
+
+	// MaxImportRows is the maximum number of rows in one bank statement import
+	MaxImportRows = 5000
+
+	// MaxImportUploadBytes is the maximum size of a bank statement upload or commit request
+	MaxImportUploadBytes = 5 << 20 // 5 MB
+
+	// MaxRulePatternLength is the maximum length of a categorization rule pattern
+	MaxRulePatternLength = 200
+
+	// MaxMonthStartDay is the latest day of the month a user's budget month can start on,
+	// so that every month has that day
+	MaxMonthStartDay = 28
+
+	// MaxBudgetHistoryPeriods is how many completed periods are recorded per budget when catching up
+	MaxBudgetHistoryPeriods = 120
+
+	// DefaultBudgetPerformancePeriods is how many periods /budget/performance returns by default
+	DefaultBudgetPerformancePeriods = 6
+
+	// MaxBudgetPerformancePeriods is the most periods /budget/performance returns
+	MaxBudgetPerformancePeriods = 60
+
+	// MaxRuleApplyTransactions is the maximum number of transaction IDs in one rule re-run
+	MaxRuleApplyTransactions = 1000
+
+	// DefaultForecastDays is how many days /forecast projects by default
+	DefaultForecastDays = 90
+
+	// MaxForecastDays is the longest /forecast projection
+	MaxForecastDays = 365
+
+	// ForecastLookbackDays is how many past days the forecast averages discretionary spending over
+	ForecastLookbackDays = 90
+)
+
+// Category defaults
+const (
+	// UncategorizedCategoryName is the category that receives transactions no rule matched
+	UncategorizedCategoryName = "Uncategorized"
+
+	// SettlementCategoryName is the category of the transactions recording a settlement
+	SettlementCategoryName = "Settlements"
+)
+
+// Currency defaults
+const (
+	// DefaultCurrency is the base currency for new users and for data created before multi-currency support
+	DefaultCurrency = "USD"
 )
 
 // Pre-allocation capacities (for memory optimization)
@@ -92,6 +270,12 @@ const (
 	MaxRecurringIterations = 3650 // ~10 years of daily transactions
 )
 
+// Migration constants
+const (
+	// MigrationLockID is the PostgreSQL advisory lock ID held while migrations run
+	MigrationLockID = 987654321
+)
+
 // Database connection pool settings
 const (
 	// MaxOpenConnections is the maximum number of open database connections
@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+var (
+	// ErrAccountNotFound is returned when an account doesn't exist or belongs to another ledger.
+	ErrAccountNotFound = errors.New("account not found or unauthorized")
+	// ErrAccountExists is returned when the ledger already has an account with that name.
+	ErrAccountExists = errors.New("account_exists")
+	// ErrTooManyAccounts is returned once a ledger has constants.MaxAccountsPerLedger accounts.
+	ErrTooManyAccounts = errors.New("too_many_accounts")
+	// ErrAccountCurrency is returned when a transaction or recurring rule is in a different currency than its account.
+	ErrAccountCurrency = errors.New("currency doesn't match the account's currency")
+	// ErrAccountHasTransfers is returned when deleting an account that transfers still go from or to.
+	ErrAccountHasTransfers = errors.New("account_has_transfers")
+	// ErrTransferNotFound is returned when a transfer doesn't exist or belongs to another ledger.
+	ErrTransferNotFound = errors.New("transfer not found or unauthorized")
+)
+
+// accountBalance works out the balance of an account (aliased a): its opening balance, plus income
+// and less expenses paid from it, less transfers out and plus transfers in.
+const accountBalance = `a.opening_balance
+	+ COALESCE((SELECT SUM(CASE WHEN c.type = 'income' THEN t.amount ELSE -t.amount END)
+	            FROM transactions t JOIN categories c ON c.id = t.category_id
+	            WHERE t.account_id = a.id), 0)
+	- COALESCE((SELECT SUM(x.amount) FROM transfers x WHERE x.from_account_id = a.id), 0)
+	+ COALESCE((SELECT SUM(x.to_amount) FROM transfers x WHERE x.to_account_id = a.id), 0)`
+
+// accountColumns selects an account (aliased a) with its balance, for scanAccount.
+const accountColumns = `a.id, a.ledger_id, a.user_id, a.name, a.type, a.currency, a.opening_balance, ` + accountBalance + `, a.created_at`
+
+func scanAccount(row interface{ Scan(...any) error }) (models.Account, error) {
+	var a models.Account
+	var createdAt time.Time
+	err := row.Scan(&a.ID, &a.LedgerID, &a.UserID, &a.Name, &a.Type, &a.Currency, &a.OpeningBalance, &a.Balance, &createdAt)
+	if err != nil {
+		return a, err
+	}
+	a.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	return a, nil
+}
+
+// ValidAccountType reports whether t is one of models.AccountTypes.
+func ValidAccountType(t string) bool {
+	for _, at := range models.AccountTypes {
+		if at == t {
+			return true
+		}
+	}
+	return false
+}
+
+// AddAccount creates an account in a.LedgerID, recorded by a.UserID. An empty Currency defaults to
+// the user's base currency; any other currency must have an exchange rate to it (ErrNoExchangeRate
+// otherwise). Returns ErrAccountExists if the ledger already has an account with that name and
+// ErrTooManyAccounts once it has constants.MaxAccountsPerLedger of them.
+func AddAccount(ctx context.Context, db *sql.DB, a models.Account) (models.Account, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	if a.Currency == "" {
+		currency, err := GetBaseCurrency(ctx, db, a.UserID)
+		if err != nil {
+			return a, err
+		}
+		a.Currency = currency
+	}
+	if err := ensureConvertible(ctx, db, a.LedgerID, a.UserID, a.Currency, time.Now().UTC().Format("2006-01-02")); err != nil {
+		return a, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return a, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serializes account creation per ledger, so the limit holds under concurrent requests
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM ledgers WHERE id = $1 FOR UPDATE", a.LedgerID); err != nil {
+		return a, fmt.Errorf("failed to lock ledger: %w", err)
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM accounts WHERE ledger_id = $1", a.LedgerID).Scan(&count); err != nil {
+		return a, fmt.Errorf("failed to count accounts: %w", err)
+	}
+	if count >= constants.MaxAccountsPerLedger {
+		return a, ErrTooManyAccounts
+	}
+
+	var createdAt time.Time
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO accounts (ledger_id, user_id, name, type, currency, opening_balance)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, created_at`,
+		a.LedgerID, a.UserID, a.Name, a.Type, a.Currency, a.OpeningBalance).Scan(&a.ID, &createdAt)
+	if err != nil {
+		if utils.IsPgError(err, utils.PgUniqueViolation) {
+			return a, ErrAccountExists
+		}
+		return a, fmt.Errorf("failed to insert account: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return a, fmt.Errorf("failed to commit account: %w", err)
+	}
+	a.Balance = a.OpeningBalance
+	a.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+
+	utils.LogInfo("Account created", "ledgerID", a.LedgerID, "accountID", a.ID, "type", a.Type)
+	return a, nil
+}
+
+// ListAccounts returns the ledger's accounts with their current balances, sorted by name.
+func ListAccounts(ctx context.Context, db *sql.DB, ledgerID int) ([]models.Account, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+accountColumns+`
+		 FROM accounts a
+		 WHERE a.ledger_id = $1
+		 ORDER BY LOWER(a.name)`, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// NetWorth adds up the balances of the ledger's accounts in the base currency of userID, at today's
+// exchange rates. Returns ErrNoExchangeRate if an account's currency can't be converted.
+func NetWorth(ctx context.Context, db *sql.DB, ledgerID, userID int) (models.Money, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var total models.Money
+	err := db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(convert_currency(`+accountBalance+`, a.currency, u.base_currency, CURRENT_DATE)), 0)
+		 FROM accounts a
+		 JOIN users u ON u.id = $2
+		 WHERE a.ledger_id = $1`, ledgerID, userID).Scan(&total)
+	if err != nil {
+		if utils.IsPgError(err, utils.PgNoDataFound) {
+			return 0, ErrNoExchangeRate
+		}
+		return 0, fmt.Errorf("failed to query net worth: %w", err)
+	}
+	return total, nil
+}
+
+// UpdateAccount renames an account and changes its type and opening balance. Its currency can't be
+// changed, since its transactions are in that currency. Returns ErrAccountNotFound if the account
+// isn't in the ledger and ErrAccountExists if another account already has the name.
+func UpdateAccount(ctx context.Context, db *sql.DB, ledgerID, accountID int, name, accountType string, openingBalance models.Money) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		`UPDATE accounts SET name = $3, type = $4, opening_balance = $5
+		 WHERE id = $1 AND ledger_id = $2`,
+		accountID, ledgerID, name, accountType, openingBalance)
+	if err != nil {
+		if utils.IsPgError(err, utils.PgUniqueViolation) {
+			return ErrAccountExists
+		}
+		return fmt.Errorf("failed to update account: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+// RemoveAccount deletes an account of the ledger (not to be confused with DeleteAccount, which deletes a
+// user). Its transactions and recurring rules are kept without an account. Returns ErrAccountNotFound
+// if the account isn't in the ledger, or ErrAccountHasTransfers if transfers still go from or to it:
+// deleting them would change the balance of the other account, so they have to be deleted first.
+func RemoveAccount(ctx context.Context, db *sql.DB, ledgerID, accountID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		"DELETE FROM accounts WHERE id = $1 AND ledger_id = $2", accountID, ledgerID)
+	if err != nil {
+		return removeAccountError(err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+// removeAccountError maps an error from deleting an account: the foreign keys of transfers refuse
+// to let an account they reference go.
+func removeAccountError(err error) error {
+	if utils.IsPgError(err, utils.PgForeignKeyViolation) {
+		return ErrAccountHasTransfers
+	}
+	return fmt.Errorf("failed to delete account: %w", err)
+}
+
+// accountCurrency returns the currency of an account in the ledger, or ErrAccountNotFound.
+func accountCurrency(ctx context.Context, q queryer, ledgerID, accountID int) (string, error) {
+	var currency string
+	err := q.QueryRowContext(ctx,
+		"SELECT currency FROM accounts WHERE id = $1 AND ledger_id = $2", accountID, ledgerID).Scan(&currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrAccountNotFound
+		}
+		return "", fmt.Errorf("failed to query account: %w", err)
+	}
+	return currency, nil
+}
+
+// accountTransactionCurrency checks that a transaction or recurring rule in currency can be paid
+// from or into an account of the ledger, and returns the currency to record it in: the account's
+// currency when currency is empty. Returns ErrAccountNotFound or ErrAccountCurrency otherwise.
+func accountTransactionCurrency(ctx context.Context, q queryer, ledgerID, accountID int, currency string) (string, error) {
+	accountCurrency, err := accountCurrency(ctx, q, ledgerID, accountID)
+	if err != nil {
+		return "", err
+	}
+	if currency != "" && currency != accountCurrency {
+		return "", ErrAccountCurrency
+	}
+	return accountCurrency, nil
+}
+
+// AccountRegister returns an account with its transactions and transfers up to to (all when empty),
+// newest first, each with the account's running balance after it. Entries before from are left out
+// but still count towards the balances. Returns ErrAccountNotFound if the account isn't in the ledger.
+func AccountRegister(ctx context.Context, db *sql.DB, ledgerID, accountID int, from, to string) (models.Account, []models.AccountEntry, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	account, err := scanAccount(db.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM accounts a WHERE a.id = $1 AND a.ledger_id = $2`, accountID, ledgerID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return account, nil, ErrAccountNotFound
+		}
+		return account, nil, fmt.Errorf("failed to query account: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT kind, id, date, description, counterpart, amount
+		 FROM (
+			SELECT 'transaction' AS kind, t.id, t.date, t.description, c.name AS counterpart,
+				CASE WHEN c.type = 'income' THEN t.amount ELSE -t.amount END AS amount, t.created_at
+			FROM transactions t JOIN categories c ON c.id = t.category_id
+			WHERE t.account_id = $1
+			UNION ALL
+			SELECT 'transfer', x.id, x.date, x.description, o.name, -x.amount, x.created_at
+			FROM transfers x JOIN accounts o ON o.id = x.to_account_id
+			WHERE x.from_account_id = $1
+			UNION ALL
+			SELECT 'transfer', x.id, x.date, x.description, o.name, x.to_amount, x.created_at
+			FROM transfers x JOIN accounts o ON o.id = x.from_account_id
+			WHERE x.to_account_id = $1
+		 ) entries
+		 WHERE $2 = '' OR date <= $2::date
+		 ORDER BY date, created_at, kind, id`, accountID, to)
+	if err != nil {
+		return account, nil, fmt.Errorf("failed to query account register: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]models.AccountEntry, 0, constants.TypicalTransactionCount)
+	for rows.Next() {
+		var e models.AccountEntry
+		var date time.Time
+		if err := rows.Scan(&e.Kind, &e.ID, &date, &e.Description, &e.Counterpart, &e.Amount); err != nil {
+			return account, nil, fmt.Errorf("failed to scan account entry: %w", err)
+		}
+		e.Date = date.Format("2006-01-02")
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return account, nil, fmt.Errorf("error iterating account register: %w", err)
+	}
+	return account, runningBalances(account.OpeningBalance, entries, from), nil
+}
+
+// runningBalances sets the balance after each of entries, which are in date order, starting from the
+// opening balance. It returns the entries on or after from (all when empty), newest first.
+func runningBalances(opening models.Money, entries []models.AccountEntry, from string) []models.AccountEntry {
+	balance := opening
+	for i := range entries {
+		balance += entries[i].Amount
+		entries[i].Balance = balance
+	}
+
+	register := make([]models.AccountEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0 && entries[i].Date >= from; i-- {
+		register = append(register, entries[i])
+	}
+	return register
+}
+
+// AddTransfer records money moved between two accounts of t.LedgerID, recorded by t.UserID. A zero
+// ToAmount is the amount converted to the to account's currency with the rate on the transfer's date
+// (ErrNoExchangeRate if there is none). Returns ErrAccountNotFound if either account isn't in the ledger.
+func AddTransfer(ctx context.Context, db *sql.DB, t models.Transfer) (models.Transfer, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	fromCurrency, err := accountCurrency(ctx, db, t.LedgerID, t.FromAccountID)
+	if err != nil {
+		return t, err
+	}
+	toCurrency, err := accountCurrency(ctx, db, t.LedgerID, t.ToAccountID)
+	if err != nil {
+		return t, err
+	}
+	if t.ToAmount == 0 {
+		if fromCurrency == toCurrency {
+			t.ToAmount = t.Amount
+		} else {
+			err := db.QueryRowContext(ctx,
+				"SELECT convert_currency($1, $2, $3, $4::date)", t.Amount, fromCurrency, toCurrency, t.Date).Scan(&t.ToAmount)
+			if err != nil {
+				if utils.IsPgError(err, utils.PgNoDataFound) {
+					return t, ErrNoExchangeRate
+				}
+				return t, fmt.Errorf("failed to convert transfer amount: %w", err)
+			}
+		}
+	}
+
+	var date, createdAt time.Time
+	err = db.QueryRowContext(ctx,
+		`INSERT INTO transfers (ledger_id, user_id, from_account_id, to_account_id, amount, to_amount, description, date)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 RETURNING id, date, created_at,
+			(SELECT name FROM accounts WHERE id = $3), (SELECT name FROM accounts WHERE id = $4)`,
+		t.LedgerID, t.UserID, t.FromAccountID, t.ToAccountID, t.Amount, t.ToAmount, t.Description, t.Date).
+		Scan(&t.ID, &date, &createdAt, &t.FromAccount, &t.ToAccount)
+	if err != nil {
+		return t, fmt.Errorf("failed to insert transfer: %w", err)
+	}
+	t.Date = date.Format("2006-01-02")
+	t.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+
+	utils.LogInfo("Transfer recorded", "ledgerID", t.LedgerID, "transferID", t.ID, "from", t.FromAccountID, "to", t.ToAccountID)
+	return t, nil
+}
+
+// ListTransfers returns the ledger's transfers, newest first; with an accountID above 0, only those
+// into or out of that account.
+func ListTransfers(ctx context.Context, db *sql.DB, ledgerID, accountID int) ([]models.Transfer, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT x.id, x.ledger_id, x.user_id, x.from_account_id, f.name, x.to_account_id, o.name,
+			x.amount, x.to_amount, x.description, x.date, x.created_at
+		 FROM transfers x
+		 JOIN accounts f ON f.id = x.from_account_id
+		 JOIN accounts o ON o.id = x.to_account_id
+		 WHERE x.ledger_id = $1 AND ($2 = 0 OR $2 IN (x.from_account_id, x.to_account_id))
+		 ORDER BY x.date DESC, x.id DESC`, ledgerID, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transfers: %w", err)
+	}
+	defer rows.Close()
+
+	transfers := []models.Transfer{}
+	for rows.Next() {
+		var t models.Transfer
+		var date, createdAt time.Time
+		if err := rows.Scan(&t.ID, &t.LedgerID, &t.UserID, &t.FromAccountID, &t.FromAccount, &t.ToAccountID, &t.ToAccount,
+			&t.Amount, &t.ToAmount, &t.Description, &date, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan transfer: %w", err)
+		}
+		t.Date = date.Format("2006-01-02")
+		t.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		transfers = append(transfers, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// DeleteTransfer removes a transfer. Returns ErrTransferNotFound if it isn't in the ledger.
+func DeleteTransfer(ctx context.Context, db *sql.DB, ledgerID, transferID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		"DELETE FROM transfers WHERE id = $1 AND ledger_id = $2", transferID, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete transfer: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTransferNotFound
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+func TestRunningBalances(t *testing.T) {
+	entries := func() []models.AccountEntry {
+		return []models.AccountEntry{
+			{Kind: models.EntryTransaction, ID: 1, Date: "2026-03-01", Amount: 250000},
+			{Kind: models.EntryTransaction, ID: 2, Date: "2026-03-02", Amount: -4550},
+			{Kind: models.EntryTransfer, ID: 1, Date: "2026-03-05", Amount: -100000},
+			{Kind: models.EntryTransaction, ID: 3, Date: "2026-03-05", Amount: -1200},
+		}
+	}
+
+	got := runningBalances(10000, entries(), "")
+	want := []models.AccountEntry{
+		{Kind: models.EntryTransaction, ID: 3, Date: "2026-03-05", Amount: -1200, Balance: 154250},
+		{Kind: models.EntryTransfer, ID: 1, Date: "2026-03-05", Amount: -100000, Balance: 155450},
+		{Kind: models.EntryTransaction, ID: 2, Date: "2026-03-02", Amount: -4550, Balance: 255450},
+		{Kind: models.EntryTransaction, ID: 1, Date: "2026-03-01", Amount: 250000, Balance: 260000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("all entries: got %+v, want %+v", got, want)
+	}
+
+	// Entries before from are left out but still count towards the balances
+	got = runningBalances(10000, entries(), "2026-03-02")
+	if !reflect.DeepEqual(got, want[:3]) {
+		t.Errorf("from: got %+v, want %+v", got, want[:3])
+	}
+
+	// A credit card starts in debt and goes further into it
+	got = runningBalances(-50000, []models.AccountEntry{{Date: "2026-03-01", Amount: -2500}}, "")
+	if len(got) != 1 || got[0].Balance != -52500 {
+		t.Errorf("negative opening balance: got %+v", got)
+	}
+
+	if got := runningBalances(10000, nil, ""); len(got) != 0 {
+		t.Errorf("no entries: got %+v", got)
+	}
+}
+
+func TestValidAccountType(t *testing.T) {
+	for _, accountType := range models.AccountTypes {
+		if !ValidAccountType(accountType) {
+			t.Errorf("ValidAccountType(%q) = false", accountType)
+		}
+	}
+	for _, accountType := range []string{"", "Cash", "loan"} {
+		if ValidAccountType(accountType) {
+			t.Errorf("ValidAccountType(%q) = true", accountType)
+		}
+	}
+}
+
+func TestRemoveAccountError(t *testing.T) {
+	// Deleting an account a transfer references fails on the transfer's foreign key
+	fkErr := &pgconn.PgError{Code: utils.PgForeignKeyViolation, ConstraintName: "transfers_from_account_id_fkey"}
+	if err := removeAccountError(fmt.Errorf("exec: %w", fkErr)); err != ErrAccountHasTransfers {
+		t.Errorf("foreign key violation: got %v, want ErrAccountHasTransfers", err)
+	}
+
+	other := errors.New("connection reset")
+	if err := removeAccountError(other); err == ErrAccountHasTransfers || !errors.Is(err, other) {
+		t.Errorf("other error: got %v, want it wrapped", err)
+	}
+}
@@ -12,11 +12,10 @@ import (
 	"github.com/vidya381/myspendo-backend/utils"
 )
 
-// AddBudget creates a new budget for a user
+// AddBudget creates a new budget in budget.LedgerID, following the calendar and currency of budget.UserID
 func AddBudget(ctx context.Context, db *sql.DB, budget models.Budget) error {
-	period := budget.Period
-	if period != "monthly" && period != "yearly" {
-		return fmt.Errorf("period must be monthly or yearly")
+	if err := ValidateBudgetPeriod(budget); err != nil {
+		return err
 	}
 
 	// Validate alert threshold
@@ -27,10 +26,27 @@ func AddBudget(ctx context.Context, db *sql.DB, budget models.Budget) error {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
+	// Weekly periods run Monday to Sunday unless the budget says otherwise
+	var startDate, endDate *string
+	if budget.StartDate != "" {
+		startDate = &budget.StartDate
+	} else if budget.Period == BudgetPeriodWeekly || budget.Period == BudgetPeriodBiweekly {
+		today, err := UserToday(ctx, db, budget.UserID)
+		if err != nil {
+			return err
+		}
+		monday := weekStart(today).Format("2006-01-02")
+		startDate = &monday
+	}
+	if budget.EndDate != "" {
+		endDate = &budget.EndDate
+	}
+
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO budgets (user_id, category_id, amount, period, alert_threshold)
-		 VALUES ($1, $2, $3, $4, $5)`,
-		budget.UserID, budget.CategoryID, budget.Amount, period, budget.AlertThreshold)
+		`INSERT INTO budgets (user_id, category_id, amount, period, start_date, end_date, alert_threshold, rollover, ledger_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		budget.UserID, budget.CategoryID, budget.Amount, budget.Period, startDate, endDate, budget.AlertThreshold, budget.Rollover,
+		budget.LedgerID)
 	if err != nil {
 		// Check for duplicate key constraint violation (PostgreSQL error code 23505)
 		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "23505") {
@@ -41,56 +57,51 @@ func AddBudget(ctx context.Context, db *sql.DB, budget models.Budget) error {
 	return nil
 }
 
-// ListBudgets retrieves all budgets for a user with current spending
-func ListBudgets(ctx context.Context, db *sql.DB, userID int) ([]models.Budget, error) {
+// ListBudgets retrieves all budgets in a ledger with spending in their current period.
+// Budget amounts and spending are in the base currency of the user who created the budget. Completed
+// periods are closed first, so rollover budgets include the amount carried over from the previous period.
+func ListBudgets(ctx context.Context, db *sql.DB, ledgerID int) ([]models.Budget, error) {
+	// Periods follow the calendar of the creator's time zone
+	now := time.Now()
+
+	if _, err := CloseBudgetPeriods(ctx, db, ledgerID, now); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
-	// Use UTC for all date calculations to avoid timezone issues
-	now := time.Now().UTC()
-	currentMonthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
-	currentMonthEnd := currentMonthStart.AddDate(0, 1, 0).Add(-time.Second)
-	currentYearStart := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
-	currentYearEnd := currentYearStart.AddDate(1, 0, 0).Add(-time.Second)
-
-	// Single query with lateral join to calculate spending for all budgets at once
-	query := `
-		SELECT
+	rows, err := db.QueryContext(ctx,
+		`SELECT
 			b.id,
+			b.ledger_id,
 			b.user_id,
 			b.category_id,
 			b.amount,
 			b.period,
+			b.start_date,
+			b.end_date,
+			u.month_start_day,
+			u.timezone,
 			b.alert_threshold,
+			b.rollover,
 			b.created_at,
 			COALESCE(c.name, 'Overall') as category_name,
-			COALESCE(spending.total, 0) as current_spending
+			last_period.period_end,
+			-- Rollover budgets carry in what remained of the last closed period
+			CASE WHEN b.rollover THEN COALESCE(last_period.remaining, 0) ELSE 0 END as carried_over
 		FROM budgets b
+		JOIN users u ON u.id = b.user_id
 		LEFT JOIN categories c ON b.category_id = c.id
 		LEFT JOIN LATERAL (
-			SELECT COALESCE(SUM(t.amount), 0) as total
-			FROM transactions t
-			JOIN categories cat ON t.category_id = cat.id
-			WHERE t.user_id = b.user_id
-				AND (
-					-- Category-specific budget
-					(b.category_id > 0 AND t.category_id = b.category_id) OR
-					-- Overall budget (all expenses)
-					(b.category_id = 0 AND cat.type = 'expense')
-				)
-				AND (
-					-- Monthly period
-					(b.period = 'monthly' AND t.date >= $2 AND t.date <= $3) OR
-					-- Yearly period
-					(b.period = 'yearly' AND t.date >= $4 AND t.date <= $5)
-				)
-		) spending ON true
-		WHERE b.user_id = $1
-		ORDER BY b.created_at DESC`
-
-	rows, err := db.QueryContext(ctx, query, userID,
-		currentMonthStart.Format("2006-01-02"), currentMonthEnd.Format("2006-01-02"),
-		currentYearStart.Format("2006-01-02"), currentYearEnd.Format("2006-01-02"))
+			SELECT bp.period_end, bp.planned + bp.carried_in - bp.actual as remaining
+			FROM budget_periods bp
+			WHERE bp.budget_id = b.id
+			ORDER BY bp.period_start DESC
+			LIMIT 1
+		) last_period ON true
+		WHERE b.ledger_id = $1
+		ORDER BY b.created_at DESC`, ledgerID)
 	if err != nil {
 		return nil, err
 	}
@@ -98,30 +109,108 @@ func ListBudgets(ctx context.Context, db *sql.DB, userID int) ([]models.Budget,
 
 	// Pre-allocate for typical number of budgets
 	budgets := make([]models.Budget, 0, constants.TypicalBudgetCount)
+	var ids, categoryIDs, creatorIDs []int
+	var starts, ends []time.Time
 	for rows.Next() {
 		var b models.Budget
+		var startDate, endDate, lastEnd sql.NullTime
+		var monthStartDay int
+		var timezone string
 		var createdAt time.Time
-		err := rows.Scan(&b.ID, &b.UserID, &b.CategoryID, &b.Amount, &b.Period,
-			&b.AlertThreshold, &createdAt, &b.CategoryName, &b.CurrentSpending)
+		err := rows.Scan(&b.ID, &b.LedgerID, &b.UserID, &b.CategoryID, &b.Amount, &b.Period, &startDate, &endDate, &monthStartDay,
+			&timezone, &b.AlertThreshold, &b.Rollover, &createdAt, &b.CategoryName, &lastEnd, &b.CarriedOver)
 		if err != nil {
 			return nil, err
 		}
 		b.CreatedAt = createdAt.Format("2006-01-02")
+		if startDate.Valid {
+			b.StartDate = startDate.Time.Format("2006-01-02")
+		}
+		if endDate.Valid {
+			b.EndDate = endDate.Time.Format("2006-01-02")
+		}
+		b.Available = b.Amount + b.CarriedOver
+
+		start, end := newBudgetSchedule(b.Period, startDate, endDate, monthStartDay).periodBounds(utils.DateIn(now, utils.LocationOrUTC(timezone)))
+		// Like closeBudget: after a month start day change the current period begins where
+		// the recorded history ends
+		if lastEnd.Valid && !lastEnd.Time.Before(start) && lastEnd.Time.Before(end) {
+			start = truncateDay(lastEnd.Time).AddDate(0, 0, 1)
+		}
+		b.PeriodStart, b.PeriodEnd = start.Format("2006-01-02"), end.Format("2006-01-02")
+
 		budgets = append(budgets, b)
+		ids = append(ids, b.ID)
+		categoryIDs = append(categoryIDs, b.CategoryID)
+		creatorIDs = append(creatorIDs, b.UserID)
+		starts = append(starts, start)
+		ends = append(ends, end)
 	}
 
 	// Check for any error that occurred during iteration
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if len(budgets) == 0 {
+		return budgets, nil
+	}
+
+	// Each budget has its own current period and currency, so spending for all of them is calculated
+	// in one query over (budget, category, period, creator) rows. category_tree maps every category to itself
+	// and all of its descendants, so a category budget includes spending in its subcategories.
+	spendingRows, err := db.QueryContext(ctx,
+		`WITH RECURSIVE category_tree(root_id, category_id) AS (
+			SELECT id, id FROM categories WHERE ledger_id = $1
+			UNION ALL
+			SELECT ct.root_id, c.id FROM category_tree ct JOIN categories c ON c.parent_id = ct.category_id
+		),
+		windows AS (
+			SELECT * FROM unnest($2::int[], $3::int[], $4::date[], $5::date[], $6::int[])
+				AS w(budget_id, category_id, period_start, period_end, user_id)
+		)
+		SELECT w.budget_id, COALESCE(SUM(convert_currency(t.amount, t.currency, u.base_currency, t.date)), 0)
+		FROM windows w
+		JOIN transactions t ON t.ledger_id = $1 AND t.date BETWEEN w.period_start AND w.period_end
+		JOIN categories cat ON t.category_id = cat.id
+		JOIN users u ON u.id = w.user_id
+		WHERE
+			-- Category-specific budget (including subcategories)
+			(w.category_id > 0 AND t.category_id IN (
+				SELECT ct.category_id FROM category_tree ct WHERE ct.root_id = w.category_id
+			)) OR
+			-- Overall budget (all expenses)
+			(w.category_id = 0 AND cat.type = 'expense')
+		GROUP BY w.budget_id`,
+		ledgerID, ids, categoryIDs, starts, ends, creatorIDs)
+	if err != nil {
+		return nil, conversionError("failed to query budget spending", err)
+	}
+	defer spendingRows.Close()
+
+	spending := make(map[int]models.Money, len(budgets))
+	for spendingRows.Next() {
+		var id int
+		var total models.Money
+		if err := spendingRows.Scan(&id, &total); err != nil {
+			return nil, conversionError("failed to scan budget spending", err)
+		}
+		spending[id] = total
+	}
+	if err := spendingRows.Err(); err != nil {
+		return nil, conversionError("error iterating budget spending", err)
+	}
+	for i := range budgets {
+		budgets[i].CurrentSpending = spending[budgets[i].ID]
+	}
 
 	return budgets, nil
 }
 
-// UpdateBudget modifies an existing budget's amount and alert threshold.
-// Verifies that the budget belongs to the user before updating.
-// Returns an error if the budget doesn't exist or belongs to another user.
-func UpdateBudget(ctx context.Context, db *sql.DB, userID, budgetID int, amount float64, alertThreshold int) error {
+// UpdateBudget modifies an existing budget's amount, alert threshold and, if rollover is non-nil,
+// whether it rolls over. Closed periods keep the amount that was planned at the time.
+// Verifies that the budget is in the ledger before updating.
+// Returns an error if the budget doesn't exist or belongs to another ledger.
+func UpdateBudget(ctx context.Context, db *sql.DB, ledgerID, budgetID int, amount models.Money, alertThreshold int, rollover *bool) error {
 	if alertThreshold < constants.MinAlertThreshold || alertThreshold > constants.MaxAlertThreshold {
 		return fmt.Errorf("alert threshold must be between %d and %d", constants.MinAlertThreshold, constants.MaxAlertThreshold)
 	}
@@ -129,11 +218,16 @@ func UpdateBudget(ctx context.Context, db *sql.DB, userID, budgetID int, amount
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
+	// Close ended periods first so they are recorded with the amount that applied to them
+	if _, err := CloseBudgetPeriods(ctx, db, ledgerID, time.Now()); err != nil {
+		return err
+	}
+
 	result, err := db.ExecContext(ctx,
 		`UPDATE budgets
-		 SET amount = $1, alert_threshold = $2
-		 WHERE id = $3 AND user_id = $4`,
-		amount, alertThreshold, budgetID, userID)
+		 SET amount = $1, alert_threshold = $2, rollover = COALESCE($5, rollover)
+		 WHERE id = $3 AND ledger_id = $4`,
+		amount, alertThreshold, budgetID, ledgerID, rollover)
 	if err != nil {
 		return fmt.Errorf("failed to update budget: %w", err)
 	}
@@ -143,14 +237,14 @@ func UpdateBudget(ctx context.Context, db *sql.DB, userID, budgetID int, amount
 }
 
 // DeleteBudget removes a budget from the database.
-// Returns an error if the budget doesn't exist or belongs to another user.
-func DeleteBudget(ctx context.Context, db *sql.DB, budgetID, userID int) error {
+// Returns an error if the budget doesn't exist or belongs to another ledger.
+func DeleteBudget(ctx context.Context, db *sql.DB, budgetID, ledgerID int) error {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
 	result, err := db.ExecContext(ctx,
-		`DELETE FROM budgets WHERE id = $1 AND user_id = $2`,
-		budgetID, userID)
+		`DELETE FROM budgets WHERE id = $1 AND ledger_id = $2`,
+		budgetID, ledgerID)
 	if err != nil {
 		return fmt.Errorf("failed to delete budget: %w", err)
 	}
@@ -161,20 +255,21 @@ func DeleteBudget(ctx context.Context, db *sql.DB, budgetID, userID int) error {
 
 // GetBudgetAlerts retrieves all budgets that have exceeded their alert threshold percentage.
 // Returns only budgets where current spending is at or above the configured alert level.
-func GetBudgetAlerts(ctx context.Context, db *sql.DB, userID int) ([]models.Budget, error) {
-	budgets, err := ListBudgets(ctx, db, userID)
+// Rollover budgets are measured against the available amount, including what was carried over;
+// one whose carry-over has used up the whole period is always alerted.
+func GetBudgetAlerts(ctx context.Context, db *sql.DB, ledgerID int) ([]models.Budget, error) {
+	budgets, err := ListBudgets(ctx, db, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	today, err := creatorsToday(ctx, db, budgets)
 	if err != nil {
 		return nil, err
 	}
 
 	var alerts []models.Budget
 	for _, b := range budgets {
-		// Skip if budget amount is zero to prevent division by zero
-		if b.Amount == 0 {
-			continue
-		}
-		percentage := (b.CurrentSpending / b.Amount) * float64(constants.MaxAlertThreshold)
-		if percentage >= float64(b.AlertThreshold) {
+		if len(budgetThresholdsReached(b, today[b.UserID])) > 0 {
 			alerts = append(alerts, b)
 		}
 	}
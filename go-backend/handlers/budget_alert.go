@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// BudgetExceededThreshold is the threshold recorded when spending reaches the whole available amount.
+const BudgetExceededThreshold = constants.MaxAlertThreshold
+
+// budgetThresholdsReached returns the thresholds the budget's current spending has reached on
+// today (YYYY-MM-DD): its alert threshold and, once the available amount is used up,
+// BudgetExceededThreshold. A custom budget only alerts while its date range is running.
+func budgetThresholdsReached(b models.Budget, today string) []int {
+	if today < b.PeriodStart || today > b.PeriodEnd {
+		return nil
+	}
+
+	var reached []int
+	if b.Available <= 0 {
+		// Skip zero budgets to prevent division by zero; an overspent rollover is already over
+		if b.Rollover && b.Available < 0 {
+			reached = append(reached, b.AlertThreshold)
+			if b.AlertThreshold != BudgetExceededThreshold {
+				reached = append(reached, BudgetExceededThreshold)
+			}
+		}
+		return reached
+	}
+
+	// Compare in integer cents: spending/available >= threshold/100
+	if b.CurrentSpending.MulInt(constants.MaxAlertThreshold) >= b.Available.MulInt(int64(b.AlertThreshold)) {
+		reached = append(reached, b.AlertThreshold)
+	}
+	if b.AlertThreshold != BudgetExceededThreshold && b.CurrentSpending >= b.Available {
+		reached = append(reached, BudgetExceededThreshold)
+	}
+	return reached
+}
+
+// BudgetAlertEvent is a budget threshold reached for the first time in the budget's current period.
+type BudgetAlertEvent struct {
+	Budget    models.Budget
+	Threshold int // the budget's alert threshold, or BudgetExceededThreshold
+}
+
+// creatorsToday returns today's date (YYYY-MM-DD) for the creator of each budget, keyed by user ID.
+// A budget's periods follow its creator's time zone.
+func creatorsToday(ctx context.Context, db *sql.DB, budgets []models.Budget) (map[int]string, error) {
+	today := make(map[int]string)
+	for _, b := range budgets {
+		if _, ok := today[b.UserID]; ok {
+			continue
+		}
+		day, err := UserToday(ctx, db, b.UserID)
+		if err != nil {
+			return nil, err
+		}
+		today[b.UserID] = day.Format("2006-01-02")
+	}
+	return today, nil
+}
+
+// RecordBudgetAlerts returns the thresholds the ledger's budgets have newly reached in their
+// current period and records them as fired, so each threshold fires at most once per period
+// even when several instances evaluate the same ledger.
+func RecordBudgetAlerts(ctx context.Context, db *sql.DB, ledgerID int) ([]BudgetAlertEvent, error) {
+	budgets, err := ListBudgets(ctx, db, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	today, err := creatorsToday(ctx, db, budgets)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var events []BudgetAlertEvent
+	for _, b := range budgets {
+		for _, threshold := range budgetThresholdsReached(b, today[b.UserID]) {
+			result, err := db.ExecContext(ctx,
+				`INSERT INTO budget_alerts_fired (budget_id, period_start, threshold)
+				 VALUES ($1, $2, $3)
+				 ON CONFLICT DO NOTHING`,
+				b.ID, b.PeriodStart, threshold)
+			if err != nil {
+				return events, fmt.Errorf("failed to record budget alert: %w", err)
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				events = append(events, BudgetAlertEvent{Budget: b, Threshold: threshold})
+			}
+		}
+	}
+	return events, nil
+}
+
+// LedgersWithBudgets returns the IDs of all ledgers that have at least one budget.
+func LedgersWithBudgets(ctx context.Context, db *sql.DB) ([]int, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT ledger_id FROM budgets ORDER BY ledger_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budget ledgers: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan budget ledger: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate budget ledgers: %w", err)
+	}
+	return ids, nil
+}
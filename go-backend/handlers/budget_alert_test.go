@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+func TestBudgetThresholdsReached(t *testing.T) {
+	base := models.Budget{AlertThreshold: 80, PeriodStart: "2025-03-01", PeriodEnd: "2025-03-31"}
+	budget := func(available, spent models.Money, rollover bool) models.Budget {
+		b := base
+		b.Available, b.CurrentSpending, b.Rollover = available, spent, rollover
+		return b
+	}
+
+	tests := []struct {
+		name   string
+		budget models.Budget
+		today  string
+		want   []int
+	}{
+		{name: "below threshold", budget: budget(50000, 39999, false), today: "2025-03-15", want: nil},
+		{name: "at threshold", budget: budget(50000, 40000, false), today: "2025-03-15", want: []int{80}},
+		{name: "used up", budget: budget(50000, 50000, false), today: "2025-03-15", want: []int{80, 100}},
+		{name: "zero budget", budget: budget(0, 100, false), today: "2025-03-15", want: nil},
+		{name: "overspent rollover", budget: budget(-2000, 0, true), today: "2025-03-15", want: []int{80, 100}},
+		{name: "outside custom range", budget: budget(50000, 60000, false), today: "2025-04-01", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := budgetThresholdsReached(tt.budget, tt.today); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	full := budget(50000, 50000, false)
+	full.AlertThreshold = 100
+	if got := budgetThresholdsReached(full, "2025-03-15"); !reflect.DeepEqual(got, []int{100}) {
+		t.Errorf("threshold 100 should fire once, got %v", got)
+	}
+}
@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// ErrBudgetNotFound is returned when a budget doesn't exist or belongs to another ledger.
+var ErrBudgetNotFound = errors.New("budget not found or unauthorized")
+
+// Budget periods
+const (
+	BudgetPeriodWeekly    = "weekly"
+	BudgetPeriodBiweekly  = "biweekly"
+	BudgetPeriodMonthly   = "monthly"
+	BudgetPeriodQuarterly = "quarterly"
+	BudgetPeriodYearly    = "yearly"
+	BudgetPeriodCustom    = "custom" // a single period from StartDate to EndDate
+)
+
+// ValidateBudgetPeriod checks a budget's period and the dates it needs: an optional start date
+// (the first day of any period) for weekly and biweekly budgets, a start and end date for custom
+// ones, and no dates otherwise. Custom budgets cannot roll over.
+func ValidateBudgetPeriod(b models.Budget) error {
+	switch b.Period {
+	case BudgetPeriodWeekly, BudgetPeriodBiweekly:
+		if b.EndDate != "" {
+			return fmt.Errorf("end_date is only used with custom periods")
+		}
+		if b.StartDate != "" && !isDate(b.StartDate) {
+			return fmt.Errorf("start_date must be a valid date (YYYY-MM-DD)")
+		}
+	case BudgetPeriodCustom:
+		if !isDate(b.StartDate) || !isDate(b.EndDate) {
+			return fmt.Errorf("custom periods need a valid start_date and end_date (YYYY-MM-DD)")
+		}
+		if b.EndDate < b.StartDate {
+			return fmt.Errorf("end_date must not be before start_date")
+		}
+		if b.Rollover {
+			return fmt.Errorf("custom periods cannot roll over")
+		}
+	case BudgetPeriodMonthly, BudgetPeriodQuarterly, BudgetPeriodYearly:
+		if b.StartDate != "" || b.EndDate != "" {
+			return fmt.Errorf("start_date and end_date are only used with weekly, biweekly or custom periods")
+		}
+	default:
+		return fmt.Errorf("period must be weekly, biweekly, monthly, quarterly, yearly or custom")
+	}
+	return nil
+}
+
+func isDate(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+// budgetSchedule lays out a budget's periods.
+type budgetSchedule struct {
+	period        string
+	anchor        time.Time // weekly/biweekly: first day of any period; custom: first day of the range
+	end           time.Time // custom: last day of the range
+	monthStartDay int       // monthly/quarterly/yearly: day of the month periods begin on
+}
+
+// newBudgetSchedule builds the schedule for a budget row; startDate and endDate are the
+// budget's nullable start_date and end_date columns.
+func newBudgetSchedule(period string, startDate, endDate sql.NullTime, monthStartDay int) budgetSchedule {
+	s := budgetSchedule{period: period, monthStartDay: monthStartDay}
+	if startDate.Valid {
+		s.anchor = truncateDay(startDate.Time)
+	}
+	if endDate.Valid {
+		s.end = truncateDay(endDate.Time)
+	}
+	if s.monthStartDay < 1 {
+		s.monthStartDay = 1
+	}
+	return s
+}
+
+// truncateDay returns midnight UTC of t's calendar day.
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// weekStart returns the Monday of the week containing day, the default anchor for weekly budgets.
+func weekStart(day time.Time) time.Time {
+	d := truncateDay(day)
+	return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+}
+
+// periodStart returns the first day of the period containing day.
+// A custom budget has a single period, whatever day is.
+func (s budgetSchedule) periodStart(day time.Time) time.Time {
+	d := truncateDay(day)
+	switch s.period {
+	case BudgetPeriodWeekly, BudgetPeriodBiweekly:
+		length := s.periodDays()
+		days := int(d.Sub(s.anchor).Hours() / 24)
+		n := days / length
+		if days%length < 0 {
+			n-- // round towards the past for days before the anchor
+		}
+		return s.anchor.AddDate(0, 0, n*length)
+	case BudgetPeriodCustom:
+		return s.anchor
+	}
+
+	// Monthly periods begin on monthStartDay, in the previous month before that day
+	month := time.Date(d.Year(), d.Month(), s.monthStartDay, 0, 0, 0, 0, time.UTC)
+	if d.Day() < s.monthStartDay {
+		month = month.AddDate(0, -1, 0)
+	}
+	switch s.period {
+	case BudgetPeriodQuarterly:
+		return time.Date(month.Year(), month.Month()-(month.Month()-1)%3, s.monthStartDay, 0, 0, 0, 0, time.UTC)
+	case BudgetPeriodYearly:
+		return time.Date(month.Year(), 1, s.monthStartDay, 0, 0, 0, 0, time.UTC)
+	}
+	return month
+}
+
+// periodDays is the length of a weekly or biweekly period.
+func (s budgetSchedule) periodDays() int {
+	if s.period == BudgetPeriodBiweekly {
+		return 14
+	}
+	return 7
+}
+
+// nextPeriodStart returns the first day of the period after the one starting at start.
+func (s budgetSchedule) nextPeriodStart(start time.Time) time.Time {
+	switch s.period {
+	case BudgetPeriodWeekly, BudgetPeriodBiweekly:
+		return start.AddDate(0, 0, s.periodDays())
+	case BudgetPeriodQuarterly:
+		return start.AddDate(0, 3, 0)
+	case BudgetPeriodYearly:
+		return start.AddDate(1, 0, 0)
+	case BudgetPeriodCustom:
+		return s.end.AddDate(0, 0, 1)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// periodBounds returns the first and last day (inclusive) of the period containing day.
+func (s budgetSchedule) periodBounds(day time.Time) (start, end time.Time) {
+	start = s.periodStart(day)
+	return start, s.nextPeriodStart(start).AddDate(0, 0, -1)
+}
+
+// completedPeriods returns the start of every period that begins on or after from and has
+// ended before today, oldest first, keeping only the most recent limit periods.
+func (s budgetSchedule) completedPeriods(from, today time.Time, limit int) []time.Time {
+	today = truncateDay(today)
+	if s.period == BudgetPeriodCustom {
+		if s.end.Before(today) && !s.end.Before(truncateDay(from)) {
+			return []time.Time{s.anchor}
+		}
+		return nil
+	}
+
+	current := s.periodStart(today)
+	var starts []time.Time
+	for start := s.periodStart(from); start.Before(current); start = s.nextPeriodStart(start) {
+		starts = append(starts, start)
+	}
+	if len(starts) > limit {
+		starts = starts[len(starts)-limit:]
+	}
+	return starts
+}
+
+// budgetSpending returns what the ledger spent between from and to (inclusive) against a budget:
+// the category and its subcategories, or all expenses for an overall budget (categoryID 0).
+// Amounts are converted to the base currency of userID, the budget's creator.
+func budgetSpending(ctx context.Context, q queryer, ledgerID, userID, categoryID int, from, to string) (models.Money, error) {
+	var total models.Money
+	err := q.QueryRowContext(ctx,
+		`WITH RECURSIVE category_tree(category_id) AS (
+			SELECT id FROM categories WHERE id = $2 AND ledger_id = $1
+			UNION ALL
+			SELECT c.id FROM categories c JOIN category_tree ct ON c.parent_id = ct.category_id
+		)
+		SELECT COALESCE(SUM(convert_currency(t.amount, t.currency, u.base_currency, t.date)), 0)
+		FROM transactions t
+		JOIN categories cat ON cat.id = t.category_id
+		JOIN users u ON u.id = $5
+		WHERE t.ledger_id = $1
+			AND t.date BETWEEN $3 AND $4
+			AND (($2 > 0 AND t.category_id IN (SELECT category_id FROM category_tree))
+				OR ($2 = 0 AND cat.type = 'expense'))`,
+		ledgerID, categoryID, from, to, userID).Scan(&total)
+	if err != nil {
+		return 0, conversionError("failed to calculate budget spending", err)
+	}
+	return total, nil
+}
+
+// CloseBudgetPeriods records every completed period that is missing from budget_periods for the
+// ledger's budgets (all ledgers when ledgerID is 0), starting from the period the budget was created in.
+// Each period's carry-in is the previous period's remaining amount for rollover budgets and 0
+// otherwise. Budgets follow the calendar of the user who created them: a period is complete once
+// now has passed its last day in that user's time zone.
+// It is idempotent and safe to run concurrently. Returns the number of periods recorded.
+func CloseBudgetPeriods(ctx context.Context, db *sql.DB, ledgerID int, now time.Time) (int, error) {
+	return closeBudgetPeriods(ctx, db, ledgerID, 0, now)
+}
+
+// CloseUserBudgetPeriods is CloseBudgetPeriods for the budgets the user created, in every ledger.
+func CloseUserBudgetPeriods(ctx context.Context, db *sql.DB, userID int, now time.Time) (int, error) {
+	return closeBudgetPeriods(ctx, db, 0, userID, now)
+}
+
+// closeBudgetPeriods closes the budgets matching both filters; 0 matches any ledger or creator.
+func closeBudgetPeriods(ctx context.Context, db *sql.DB, ledgerID, userID int, now time.Time) (int, error) {
+	budgets, err := openBudgets(ctx, db, ledgerID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	for _, b := range budgets {
+		n, err := closeBudget(ctx, db, b, utils.DateIn(now, b.loc))
+		closed += n
+		if err != nil {
+			return closed, err
+		}
+	}
+	return closed, nil
+}
+
+// openBudget is a budget with the point from which its periods still need closing.
+type openBudget struct {
+	id, ledgerID, categoryID int
+	userID                   int    // the budget's creator, whose calendar and currency it follows
+	name                     string // category name, or "Overall"
+	amount                   models.Money
+	schedule                 budgetSchedule
+	loc                      *time.Location // the user's time zone
+	rollover                 bool
+	from                     time.Time    // first day not yet covered by budget_periods
+	continues                bool         // from directly follows a recorded period
+	carry                    models.Money // remaining amount of the last closed period
+}
+
+func openBudgets(ctx context.Context, db *sql.DB, ledgerID, userID int) ([]openBudget, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT b.id, b.ledger_id, b.user_id, b.category_id, COALESCE(c.name, 'Overall'), b.amount, b.period, b.start_date, b.end_date,
+		        u.month_start_day, u.timezone, b.rollover, b.created_at, last.period_end, COALESCE(last.planned + last.carried_in - last.actual, 0)
+		 FROM budgets b
+		 JOIN users u ON u.id = b.user_id
+		 LEFT JOIN categories c ON c.id = b.category_id
+		 LEFT JOIN LATERAL (
+			SELECT period_end, planned, carried_in, actual FROM budget_periods
+			WHERE budget_id = b.id ORDER BY period_start DESC LIMIT 1
+		 ) last ON true
+		 WHERE ($1 = 0 OR b.ledger_id = $1) AND ($2 = 0 OR b.user_id = $2)`,
+		ledgerID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budgets: %w", err)
+	}
+	defer rows.Close()
+
+	var budgets []openBudget
+	for rows.Next() {
+		var b openBudget
+		var period string
+		var startDate, endDate, lastEnd sql.NullTime
+		var monthStartDay int
+		var timezone string
+		var createdAt time.Time
+		if err := rows.Scan(&b.id, &b.ledgerID, &b.userID, &b.categoryID, &b.name, &b.amount, &period, &startDate, &endDate,
+			&monthStartDay, &timezone, &b.rollover, &createdAt, &lastEnd, &b.carry); err != nil {
+			return nil, fmt.Errorf("failed to scan budget: %w", err)
+		}
+		b.schedule = newBudgetSchedule(period, startDate, endDate, monthStartDay)
+		b.loc = utils.LocationOrUTC(timezone)
+		switch {
+		case lastEnd.Valid:
+			b.from = lastEnd.Time.UTC().AddDate(0, 0, 1)
+			b.continues = true
+		case period == BudgetPeriodCustom:
+			// A custom range may have started, or even ended, before the budget was created
+			b.from = b.schedule.anchor
+		default:
+			b.from = utils.DateIn(createdAt, b.loc)
+		}
+		budgets = append(budgets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate budgets: %w", err)
+	}
+	return budgets, nil
+}
+
+// closeBudget records the budget's completed periods from b.from onwards.
+func closeBudget(ctx context.Context, db *sql.DB, b openBudget, today time.Time) (int, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	closed := 0
+	carry := b.carry
+	starts := b.schedule.completedPeriods(b.from, today, constants.MaxBudgetHistoryPeriods)
+	for i, start := range starts {
+		_, end := b.schedule.periodBounds(start)
+		// After the user's month start day changes, the first new period may overlap the last
+		// recorded one; it then starts where the recorded history ends.
+		if b.continues && start.Before(b.from) {
+			start = b.from
+		}
+		from, to := start.Format("2006-01-02"), end.Format("2006-01-02")
+
+		actual, err := budgetSpending(ctx, db, b.ledgerID, b.userID, b.categoryID, from, to)
+		if err != nil {
+			return closed, err
+		}
+		carriedIn := models.Money(0)
+		if b.rollover {
+			carriedIn = carry
+		}
+
+		result, err := db.ExecContext(ctx,
+			`INSERT INTO budget_periods (budget_id, user_id, period_start, period_end, planned, carried_in, actual)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)
+			 ON CONFLICT (budget_id, period_start) DO NOTHING`,
+			b.id, b.userID, from, to, b.amount, carriedIn, actual)
+		if err != nil {
+			return closed, fmt.Errorf("failed to record budget period: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		if n > 0 {
+			closed++
+		}
+		carry = b.amount + carriedIn - actual
+
+		// Tell the user about the period that just ended, not about older ones caught up on
+		if n > 0 && i == len(starts)-1 && carry < 0 {
+			notifyBudgetOverspent(ctx, db, b, from, to, actual, b.amount+carriedIn)
+		}
+	}
+	return closed, nil
+}
+
+// notifyBudgetOverspent adds an inbox entry for a budget period that ended over budget.
+// Failures are logged; the period is recorded regardless.
+func notifyBudgetOverspent(ctx context.Context, db *sql.DB, b openBudget, from, to string, actual, available models.Money) {
+	title := fmt.Sprintf("%s budget ended over budget", b.name)
+	body := fmt.Sprintf("You spent %s of %s available from %s to %s, %s over budget.",
+		actual, available, from, to, actual-available)
+	if b.rollover {
+		body += " The overspent amount is carried into the next period."
+	}
+	err := AddNotification(ctx, db, b.userID, models.NotificationBudgetOverspent, title, body, map[string]any{
+		"budget_id":    b.id,
+		"category_id":  b.categoryID,
+		"period_start": from,
+		"period_end":   to,
+		"actual":       actual,
+		"available":    available,
+	})
+	if err != nil {
+		slog.Error("Budget periods: error adding notification", "error", err, "budget_id", b.id)
+	}
+}
+
+// BudgetPerformance is a budget's planned vs actual history, oldest period first.
+// The last period is the current one (InProgress).
+type BudgetPerformance struct {
+	BudgetID          int                   `json:"budget_id"`
+	CategoryID        int                   `json:"category_id"`
+	CategoryName      string                `json:"category_name"`
+	Period            string                `json:"period"`
+	Rollover          bool                  `json:"rollover"`
+	Periods           []models.BudgetPeriod `json:"periods"`
+	TotalPlanned      models.Money          `json:"total_planned"`
+	TotalActual       models.Money          `json:"total_actual"`
+	OverBudgetPeriods int                   `json:"over_budget_periods"`
+}
+
+// GetBudgetPerformance returns planned vs actual spending over the last n periods (including the
+// current one) for one budget, or for all of the ledger's budgets when budgetID is 0.
+// Returns ErrBudgetNotFound if budgetID isn't in the ledger.
+func GetBudgetPerformance(ctx context.Context, db *sql.DB, ledgerID, budgetID, n int) ([]BudgetPerformance, error) {
+	budgets, err := ListBudgets(ctx, db, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT budget_id, to_char(period_start, 'YYYY-MM-DD'), to_char(period_end, 'YYYY-MM-DD'), planned, carried_in, actual
+		 FROM (
+			SELECT bp.*, ROW_NUMBER() OVER (PARTITION BY budget_id ORDER BY period_start DESC) AS rn
+			FROM budget_periods bp
+			JOIN budgets b ON b.id = bp.budget_id
+			WHERE b.ledger_id = $1 AND ($2 = 0 OR bp.budget_id = $2)
+		 ) recent
+		 WHERE rn < $3
+		 ORDER BY budget_id, period_start`,
+		ledgerID, budgetID, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budget history: %w", err)
+	}
+	defer rows.Close()
+
+	history := map[int][]models.BudgetPeriod{}
+	for rows.Next() {
+		var id int
+		var p models.BudgetPeriod
+		if err := rows.Scan(&id, &p.PeriodStart, &p.PeriodEnd, &p.Planned, &p.CarriedIn, &p.Actual); err != nil {
+			return nil, fmt.Errorf("failed to scan budget period: %w", err)
+		}
+		history[id] = append(history[id], p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate budget history: %w", err)
+	}
+
+	reports := []BudgetPerformance{}
+	for _, b := range budgets {
+		if budgetID != 0 && b.ID != budgetID {
+			continue
+		}
+		periods := append(history[b.ID], models.BudgetPeriod{
+			PeriodStart: b.PeriodStart,
+			PeriodEnd:   b.PeriodEnd,
+			Planned:     b.Amount,
+			CarriedIn:   b.CarriedOver,
+			Actual:      b.CurrentSpending,
+			InProgress:  true,
+		})
+		reports = append(reports, summarizeBudgetPeriods(b, periods))
+	}
+	if budgetID != 0 && len(reports) == 0 {
+		return nil, ErrBudgetNotFound
+	}
+	return reports, nil
+}
+
+// summarizeBudgetPeriods fills in each period's derived amounts and the report totals.
+func summarizeBudgetPeriods(b models.Budget, periods []models.BudgetPeriod) BudgetPerformance {
+	report := BudgetPerformance{
+		BudgetID:     b.ID,
+		CategoryID:   b.CategoryID,
+		CategoryName: b.CategoryName,
+		Period:       b.Period,
+		Rollover:     b.Rollover,
+		Periods:      periods,
+	}
+	for i := range periods {
+		p := &periods[i]
+		p.Available = p.Planned + p.CarriedIn
+		p.Remaining = p.Available - p.Actual
+		report.TotalPlanned += p.Planned
+		report.TotalActual += p.Actual
+		if !p.InProgress && p.Actual > p.Available {
+			report.OverBudgetPeriods++
+		}
+	}
+	return report
+}
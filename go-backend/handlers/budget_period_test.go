@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+func mustParseDate(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestPeriodBounds(t *testing.T) {
+	monthly := budgetSchedule{period: BudgetPeriodMonthly, monthStartDay: 1}
+	payday := budgetSchedule{period: BudgetPeriodMonthly, monthStartDay: 25}
+	weekly := budgetSchedule{period: BudgetPeriodWeekly, anchor: mustParseDate("2025-03-05")} // a Wednesday
+	custom := budgetSchedule{period: BudgetPeriodCustom, anchor: mustParseDate("2025-06-10"), end: mustParseDate("2025-06-24")}
+
+	tests := []struct {
+		name               string
+		schedule           budgetSchedule
+		day                string
+		wantStart, wantEnd string
+	}{
+		{name: "calendar month", schedule: monthly, day: "2025-02-14", wantStart: "2025-02-01", wantEnd: "2025-02-28"},
+		{name: "leap February", schedule: monthly, day: "2024-02-29", wantStart: "2024-02-01", wantEnd: "2024-02-29"},
+		{name: "December", schedule: monthly, day: "2025-12-31", wantStart: "2025-12-01", wantEnd: "2025-12-31"},
+		{name: "payday month on the start day", schedule: payday, day: "2025-03-25", wantStart: "2025-03-25", wantEnd: "2025-04-24"},
+		{name: "payday month before the start day", schedule: payday, day: "2025-01-10", wantStart: "2024-12-25", wantEnd: "2025-01-24"},
+		{name: "calendar year", schedule: budgetSchedule{period: BudgetPeriodYearly, monthStartDay: 1}, day: "2025-07-04", wantStart: "2025-01-01", wantEnd: "2025-12-31"},
+		{name: "payday year", schedule: budgetSchedule{period: BudgetPeriodYearly, monthStartDay: 25}, day: "2025-01-10", wantStart: "2024-01-25", wantEnd: "2025-01-24"},
+		{name: "quarter", schedule: budgetSchedule{period: BudgetPeriodQuarterly, monthStartDay: 1}, day: "2025-08-15", wantStart: "2025-07-01", wantEnd: "2025-09-30"},
+		{name: "payday quarter", schedule: budgetSchedule{period: BudgetPeriodQuarterly, monthStartDay: 25}, day: "2025-04-01", wantStart: "2025-01-25", wantEnd: "2025-04-24"},
+		{name: "week from anchor", schedule: weekly, day: "2025-03-18", wantStart: "2025-03-12", wantEnd: "2025-03-18"},
+		{name: "week before anchor", schedule: weekly, day: "2025-03-01", wantStart: "2025-02-26", wantEnd: "2025-03-04"},
+		{name: "fortnight", schedule: budgetSchedule{period: BudgetPeriodBiweekly, anchor: mustParseDate("2025-03-05")}, day: "2025-03-30", wantStart: "2025-03-19", wantEnd: "2025-04-01"},
+		{name: "custom range", schedule: custom, day: "2025-09-01", wantStart: "2025-06-10", wantEnd: "2025-06-24"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := tt.schedule.periodBounds(mustParseDate(tt.day))
+			if got := start.Format("2006-01-02"); got != tt.wantStart {
+				t.Errorf("start = %s, want %s", got, tt.wantStart)
+			}
+			if got := end.Format("2006-01-02"); got != tt.wantEnd {
+				t.Errorf("end = %s, want %s", got, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestWeekStart(t *testing.T) {
+	if got := weekStart(mustParseDate("2025-03-09")).Format("2006-01-02"); got != "2025-03-03" {
+		t.Errorf("weekStart(Sunday) = %s, want the Monday before", got)
+	}
+	if got := weekStart(mustParseDate("2025-03-10")).Format("2006-01-02"); got != "2025-03-10" {
+		t.Errorf("weekStart(Monday) = %s, want the same day", got)
+	}
+}
+
+func TestCompletedPeriods(t *testing.T) {
+	monthly := budgetSchedule{period: BudgetPeriodMonthly, monthStartDay: 1}
+	starts := monthly.completedPeriods(mustParseDate("2025-01-20"), mustParseDate("2025-04-02"), 10)
+	want := []string{"2025-01-01", "2025-02-01", "2025-03-01"}
+	if len(starts) != len(want) {
+		t.Fatalf("got %d periods, want %d", len(starts), len(want))
+	}
+	for i, s := range starts {
+		if s.Format("2006-01-02") != want[i] {
+			t.Errorf("starts[%d] = %s, want %s", i, s.Format("2006-01-02"), want[i])
+		}
+	}
+
+	if got := monthly.completedPeriods(mustParseDate("2025-04-01"), mustParseDate("2025-04-30"), 10); len(got) != 0 {
+		t.Errorf("current period must not be closed, got %d periods", len(got))
+	}
+
+	limited := monthly.completedPeriods(mustParseDate("2020-01-01"), mustParseDate("2025-04-02"), 2)
+	if len(limited) != 2 || limited[0].Format("2006-01-02") != "2025-02-01" {
+		t.Errorf("limit should keep the most recent periods, got %v", limited)
+	}
+}
+
+func TestCompletedPeriodsCustom(t *testing.T) {
+	custom := budgetSchedule{period: BudgetPeriodCustom, anchor: mustParseDate("2025-06-10"), end: mustParseDate("2025-06-24")}
+
+	if got := custom.completedPeriods(custom.anchor, time.Date(2025, 6, 24, 18, 0, 0, 0, time.UTC), 10); len(got) != 0 {
+		t.Errorf("range ending today must not be closed, got %v", got)
+	}
+	got := custom.completedPeriods(custom.anchor, mustParseDate("2025-06-25"), 10)
+	if len(got) != 1 || !got[0].Equal(custom.anchor) {
+		t.Errorf("ended range should be closed once, got %v", got)
+	}
+	// from is the day after the recorded period once it has been closed
+	if got := custom.completedPeriods(mustParseDate("2025-06-25"), mustParseDate("2025-08-01"), 10); len(got) != 0 {
+		t.Errorf("recorded range must not be closed again, got %v", got)
+	}
+}
+
+func TestValidateBudgetPeriod(t *testing.T) {
+	valid := []models.Budget{
+		{Period: BudgetPeriodMonthly},
+		{Period: BudgetPeriodWeekly},
+		{Period: BudgetPeriodBiweekly, StartDate: "2025-03-07", Rollover: true},
+		{Period: BudgetPeriodCustom, StartDate: "2025-06-10", EndDate: "2025-06-10"},
+	}
+	for _, b := range valid {
+		if err := ValidateBudgetPeriod(b); err != nil {
+			t.Errorf("ValidateBudgetPeriod(%+v) = %v", b, err)
+		}
+	}
+
+	invalid := []models.Budget{
+		{Period: "daily"},
+		{Period: BudgetPeriodMonthly, StartDate: "2025-03-01"},
+		{Period: BudgetPeriodWeekly, EndDate: "2025-03-01"},
+		{Period: BudgetPeriodWeekly, StartDate: "03/01/2025"},
+		{Period: BudgetPeriodCustom, StartDate: "2025-06-10"},
+		{Period: BudgetPeriodCustom, StartDate: "2025-06-10", EndDate: "2025-06-09"},
+		{Period: BudgetPeriodCustom, StartDate: "2025-06-10", EndDate: "2025-06-24", Rollover: true},
+	}
+	for _, b := range invalid {
+		if err := ValidateBudgetPeriod(b); err == nil {
+			t.Errorf("ValidateBudgetPeriod(%+v) should fail", b)
+		}
+	}
+}
+
+func TestSummarizeBudgetPeriods(t *testing.T) {
+	budget := models.Budget{ID: 3, CategoryName: "Food", Period: "monthly", Rollover: true}
+	periods := []models.BudgetPeriod{
+		{PeriodStart: "2025-01-01", Planned: 50000, CarriedIn: 0, Actual: 42000},
+		{PeriodStart: "2025-02-01", Planned: 50000, CarriedIn: 8000, Actual: 61000},
+		{PeriodStart: "2025-03-01", Planned: 50000, CarriedIn: -3000, Actual: 60000, InProgress: true},
+	}
+
+	report := summarizeBudgetPeriods(budget, periods)
+
+	if report.Periods[1].Available != 58000 || report.Periods[1].Remaining != -3000 {
+		t.Errorf("periods[1] = %+v, want available 580.00 and remaining -30.00", report.Periods[1])
+	}
+	if report.TotalPlanned != 150000 || report.TotalActual != 163000 {
+		t.Errorf("totals = %s planned / %s actual", report.TotalPlanned, report.TotalActual)
+	}
+	// The in-progress period is over budget so far but not counted until it closes
+	if report.OverBudgetPeriods != 1 {
+		t.Errorf("OverBudgetPeriods = %d, want 1", report.OverBudgetPeriods)
+	}
+}
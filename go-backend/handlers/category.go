@@ -3,37 +3,86 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/vidya381/myspendo-backend/models"
 	"github.com/vidya381/myspendo-backend/utils"
 )
 
-// AddCategory creates a new expense or income category for the specified user.
+var (
+	ErrCategoryNotFound     = errors.New("category not found or unauthorized")
+	ErrCategoryExists       = errors.New("category_exists")
+	ErrCategoryInUse        = errors.New("category_in_use")
+	ErrCategoryTypeMismatch = errors.New("category_type_mismatch")
+	ErrCategorySameAsTarget = errors.New("category_same_as_target")
+	ErrParentNotFound       = errors.New("parent_category_not_found")
+	ErrCategoryCycle        = errors.New("category_cycle")
+)
+
+// defaultCategories are created for accounts provisioned by single sign-on, which skip the
+// registration form, so they can start recording transactions right away.
+var defaultCategories = []struct{ name, ctype string }{
+	{"Groceries", "expense"},
+	{"Housing", "expense"},
+	{"Utilities", "expense"},
+	{"Transportation", "expense"},
+	{"Dining Out", "expense"},
+	{"Health", "expense"},
+	{"Entertainment", "expense"},
+	{"Shopping", "expense"},
+	{"Salary", "income"},
+	{"Other Income", "income"},
+}
+
+// createDefaultCategories adds defaultCategories to a ledger on behalf of the user, skipping any it already has.
+func createDefaultCategories(ctx context.Context, tx *sql.Tx, ledgerID, userID int) error {
+	for _, c := range defaultCategories {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO categories (ledger_id, user_id, name, type) VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (ledger_id, name, type) DO NOTHING`,
+			ledgerID, userID, c.name, c.ctype)
+		if err != nil {
+			return fmt.Errorf("failed to create default category %q: %w", c.name, err)
+		}
+	}
+	return nil
+}
+
+// AddCategory creates a new expense or income category in the ledger, created by the specified user.
+// parentID is optional (0 for a top-level category); a parent must be in the same ledger and have the same type.
 // Returns the newly created category ID on success, or an error if a category with
-// the same name and type already exists for this user.
-func AddCategory(ctx context.Context, db *sql.DB, userID int, name, ctype string) (int, error) {
+// the same name and type already exists in the ledger.
+func AddCategory(ctx context.Context, db *sql.DB, ledgerID, userID int, name, ctype string, parentID int) (int, error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
-	// Check if category already exists for this user/type
+	// Check if category already exists in this ledger for the type
 	var exists int
 	err := db.QueryRowContext(
 		ctx,
-		"SELECT 1 FROM categories WHERE user_id=$1 AND name=$2 AND type=$3",
-		userID, name, ctype).Scan(&exists)
+		"SELECT 1 FROM categories WHERE ledger_id=$1 AND name=$2 AND type=$3",
+		ledgerID, name, ctype).Scan(&exists)
 	if err == nil {
-		return 0, fmt.Errorf("category '%s' (type: %s) already exists for this user", name, ctype)
+		return 0, fmt.Errorf("category '%s' (type: %s) already exists in this ledger", name, ctype)
 	} else if err != sql.ErrNoRows {
 		return 0, fmt.Errorf("failed to check category existence: %w", err)
 	}
 
+	var parent sql.NullInt64
+	if parentID > 0 {
+		if err := validateParent(ctx, db, ledgerID, 0, parentID, ctype); err != nil {
+			return 0, err
+		}
+		parent = sql.NullInt64{Int64: int64(parentID), Valid: true}
+	}
+
 	// Insert category and get the returning ID
 	var categoryID int
 	err = db.QueryRowContext(
 		ctx,
-		"INSERT INTO categories (user_id, name, type) VALUES ($1, $2, $3) RETURNING id",
-		userID, name, ctype).Scan(&categoryID)
+		"INSERT INTO categories (ledger_id, user_id, name, type, parent_id) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		ledgerID, userID, name, ctype, parent).Scan(&categoryID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert category: %w", err)
 	}
@@ -41,14 +90,56 @@ func AddCategory(ctx context.Context, db *sql.DB, userID int, name, ctype string
 	return categoryID, nil
 }
 
-// ListCategories retrieves all expense and income categories belonging to the specified user.
-// Returns an empty slice if the user has no categories defined.
-func ListCategories(ctx context.Context, db *sql.DB, userID int) ([]models.Category, error) {
+// validateParent checks that parentID may become the parent of categoryID (0 for a new category).
+// The parent must be in the same ledger and have the same type, and must not be the category itself
+// or one of its descendants.
+func validateParent(ctx context.Context, db *sql.DB, ledgerID, categoryID, parentID int, ctype string) error {
+	var parentType string
+	err := db.QueryRowContext(ctx,
+		"SELECT type FROM categories WHERE id = $1 AND ledger_id = $2", parentID, ledgerID).Scan(&parentType)
+	if err == sql.ErrNoRows {
+		return ErrParentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up parent category: %w", err)
+	}
+	if parentType != ctype {
+		return ErrCategoryTypeMismatch
+	}
+	if categoryID == 0 {
+		return nil
+	}
+	if parentID == categoryID {
+		return ErrCategoryCycle
+	}
+
+	// Walk up from the proposed parent; reaching the category itself would create a cycle
+	var cycle bool
+	err = db.QueryRowContext(ctx,
+		`WITH RECURSIVE ancestors(id, parent_id) AS (
+			SELECT id, parent_id FROM categories WHERE id = $1
+			UNION
+			SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`,
+		parentID, categoryID).Scan(&cycle)
+	if err != nil {
+		return fmt.Errorf("failed to check category hierarchy: %w", err)
+	}
+	if cycle {
+		return ErrCategoryCycle
+	}
+	return nil
+}
+
+// ListCategories retrieves all expense and income categories in the specified ledger.
+// Returns an empty slice if the ledger has no categories defined.
+func ListCategories(ctx context.Context, db *sql.DB, ledgerID int) ([]models.Category, error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
 	rows, err := db.QueryContext(ctx,
-		"SELECT id, user_id, name, type, created_at FROM categories WHERE user_id = $1", userID)
+		"SELECT id, ledger_id, user_id, parent_id, name, type, created_at FROM categories WHERE ledger_id = $1", ledgerID)
 	if err != nil {
 		return nil, err
 	}
@@ -57,10 +148,265 @@ func ListCategories(ctx context.Context, db *sql.DB, userID int) ([]models.Categ
 	var categories []models.Category
 	for rows.Next() {
 		var cat models.Category
-		if err := rows.Scan(&cat.ID, &cat.UserID, &cat.Name, &cat.Type, &cat.CreatedAt); err != nil {
+		var parentID sql.NullInt64
+		if err := rows.Scan(&cat.ID, &cat.LedgerID, &cat.UserID, &parentID, &cat.Name, &cat.Type, &cat.CreatedAt); err != nil {
 			return nil, err
 		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			cat.ParentID = &id
+		}
 		categories = append(categories, cat)
 	}
 	return categories, nil
 }
+
+// MergeResult reports how many rows were moved from the source category to the target.
+type MergeResult struct {
+	TransactionsMoved int64 `json:"transactions_moved"`
+	RecurringMoved    int64 `json:"recurring_moved"`
+	BudgetsMoved      int64 `json:"budgets_moved"`
+	BudgetsDropped    int64 `json:"budgets_dropped"` // source budgets dropped because the target already had one for that period
+	RulesMoved        int64 `json:"rules_moved"`
+}
+
+// UpdateCategory renames a category in the ledger and optionally moves it in the hierarchy.
+// parentID nil leaves the parent unchanged; a pointer to 0 makes the category top-level.
+// Returns ErrCategoryNotFound if the category doesn't exist or belongs to another ledger,
+// ErrCategoryExists if another category of the same type already has that name,
+// or a hierarchy error (ErrParentNotFound, ErrCategoryTypeMismatch, ErrCategoryCycle).
+func UpdateCategory(ctx context.Context, db *sql.DB, ledgerID, categoryID int, name string, parentID *int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var ctype string
+	var currentParent sql.NullInt64
+	err := db.QueryRowContext(ctx,
+		"SELECT type, parent_id FROM categories WHERE id = $1 AND ledger_id = $2",
+		categoryID, ledgerID).Scan(&ctype, &currentParent)
+	if err == sql.ErrNoRows {
+		return ErrCategoryNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up category: %w", err)
+	}
+
+	var exists bool
+	err = db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM categories WHERE ledger_id = $1 AND name = $2 AND type = $3 AND id <> $4)",
+		ledgerID, name, ctype, categoryID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check category existence: %w", err)
+	}
+	if exists {
+		return ErrCategoryExists
+	}
+
+	parent := currentParent
+	if parentID != nil {
+		parent = sql.NullInt64{}
+		if *parentID > 0 {
+			if err := validateParent(ctx, db, ledgerID, categoryID, *parentID, ctype); err != nil {
+				return err
+			}
+			parent = sql.NullInt64{Int64: int64(*parentID), Valid: true}
+		}
+	}
+
+	result, err := db.ExecContext(ctx,
+		"UPDATE categories SET name = $1, parent_id = $2 WHERE id = $3 AND ledger_id = $4",
+		name, parent, categoryID, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to update category: %w", err)
+	}
+	return utils.CheckRowsAffected(result, "category")
+}
+
+// DeleteCategory removes a category from the ledger.
+// If transactions or recurring rules still use the category, reassignTo must name another
+// category of the same type; everything is then moved there before the delete (see MergeCategories).
+// Without a reassignment target, ErrCategoryInUse is returned and nothing is deleted.
+func DeleteCategory(ctx context.Context, db *sql.DB, ledgerID, categoryID, reassignTo int) (MergeResult, error) {
+	if reassignTo > 0 {
+		return MergeCategories(ctx, db, ledgerID, categoryID, reassignTo)
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockCategory(ctx, tx, ledgerID, categoryID); err != nil {
+		return MergeResult{}, err
+	}
+
+	var inUse bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM transactions WHERE category_id = $1)
+		     OR EXISTS (SELECT 1 FROM recurring_transactions WHERE category_id = $1)`,
+		categoryID).Scan(&inUse)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to check category usage: %w", err)
+	}
+	if inUse {
+		return MergeResult{}, ErrCategoryInUse
+	}
+
+	// Children move up to the deleted category's parent
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE categories SET parent_id = (SELECT parent_id FROM categories WHERE id = $1)
+		 WHERE parent_id = $1 AND ledger_id = $2`, categoryID, ledgerID); err != nil {
+		return MergeResult{}, fmt.Errorf("failed to reparent child categories: %w", err)
+	}
+
+	// budgets.category_id has no foreign key, so clean up category budgets explicitly
+	dropped, err := tx.ExecContext(ctx,
+		"DELETE FROM budgets WHERE ledger_id = $1 AND category_id = $2", ledgerID, categoryID)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to delete category budgets: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM categories WHERE id = $1 AND ledger_id = $2", categoryID, ledgerID); err != nil {
+		return MergeResult{}, fmt.Errorf("failed to delete category: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return MergeResult{}, fmt.Errorf("failed to commit category delete: %w", err)
+	}
+
+	var result MergeResult
+	result.BudgetsDropped, _ = dropped.RowsAffected()
+	return result, nil
+}
+
+// MergeCategories moves all transactions, recurring rules, budgets and categorization rules from sourceID to targetID
+// and deletes the source category, atomically. Both categories must be in the ledger and have
+// the same type. When both have a budget for the same period, the target's budget is kept.
+func MergeCategories(ctx context.Context, db *sql.DB, ledgerID, sourceID, targetID int) (MergeResult, error) {
+	if sourceID == targetID {
+		return MergeResult{}, ErrCategorySameAsTarget
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock in a stable order so concurrent merges of the same pair can't deadlock
+	first, second := sourceID, targetID
+	if first > second {
+		first, second = second, first
+	}
+	types := make(map[int]string, 2)
+	for _, id := range []int{first, second} {
+		ctype, err := lockCategory(ctx, tx, ledgerID, id)
+		if err != nil {
+			return MergeResult{}, err
+		}
+		types[id] = ctype
+	}
+	if types[sourceID] != types[targetID] {
+		return MergeResult{}, ErrCategoryTypeMismatch
+	}
+
+	var result MergeResult
+	res, err := tx.ExecContext(ctx,
+		"UPDATE transactions SET category_id = $1 WHERE category_id = $2 AND ledger_id = $3",
+		targetID, sourceID, ledgerID)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to move transactions: %w", err)
+	}
+	result.TransactionsMoved, _ = res.RowsAffected()
+
+	res, err = tx.ExecContext(ctx,
+		"UPDATE recurring_transactions SET category_id = $1 WHERE category_id = $2 AND ledger_id = $3",
+		targetID, sourceID, ledgerID)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to move recurring transactions: %w", err)
+	}
+	result.RecurringMoved, _ = res.RowsAffected()
+
+	// Budgets are unique per (ledger, category, period), custom ones per date range:
+	// drop source budgets that would collide
+	res, err = tx.ExecContext(ctx,
+		`DELETE FROM budgets b
+		 WHERE b.ledger_id = $1 AND b.category_id = $2
+		   AND EXISTS (
+			SELECT 1 FROM budgets t
+			WHERE t.ledger_id = $1 AND t.category_id = $3 AND t.period = b.period
+			  AND (b.period <> 'custom' OR (t.start_date = b.start_date AND t.end_date = b.end_date))
+		   )`,
+		ledgerID, sourceID, targetID)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to drop conflicting budgets: %w", err)
+	}
+	result.BudgetsDropped, _ = res.RowsAffected()
+
+	res, err = tx.ExecContext(ctx,
+		"UPDATE budgets SET category_id = $1 WHERE ledger_id = $2 AND category_id = $3",
+		targetID, ledgerID, sourceID)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to move budgets: %w", err)
+	}
+	result.BudgetsMoved, _ = res.RowsAffected()
+
+	res, err = tx.ExecContext(ctx,
+		"UPDATE categorization_rules SET category_id = $1 WHERE category_id = $2 AND ledger_id = $3",
+		targetID, sourceID, ledgerID)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to move categorization rules: %w", err)
+	}
+	result.RulesMoved, _ = res.RowsAffected()
+
+	// If the target sits below the source, lift it to the source's parent first so that
+	// reparenting the source's children onto the target can't create a cycle
+	if _, err := tx.ExecContext(ctx,
+		`WITH RECURSIVE descendants(id) AS (
+			SELECT id FROM categories WHERE parent_id = $1
+			UNION
+			SELECT c.id FROM categories c JOIN descendants d ON c.parent_id = d.id
+		)
+		UPDATE categories SET parent_id = (SELECT parent_id FROM categories WHERE id = $1)
+		WHERE id = $2 AND id IN (SELECT id FROM descendants)`,
+		sourceID, targetID); err != nil {
+		return MergeResult{}, fmt.Errorf("failed to lift target category: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE categories SET parent_id = $1 WHERE parent_id = $2 AND ledger_id = $3 AND id <> $1",
+		targetID, sourceID, ledgerID); err != nil {
+		return MergeResult{}, fmt.Errorf("failed to reparent child categories: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM categories WHERE id = $1 AND ledger_id = $2", sourceID, ledgerID); err != nil {
+		return MergeResult{}, fmt.Errorf("failed to delete source category: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return MergeResult{}, fmt.Errorf("failed to commit category merge: %w", err)
+	}
+	return result, nil
+}
+
+// lockCategory locks a category row for the rest of the transaction and returns its type.
+// Returns ErrCategoryNotFound if it doesn't exist or belongs to another ledger.
+func lockCategory(ctx context.Context, tx *sql.Tx, ledgerID, categoryID int) (string, error) {
+	var ctype string
+	err := tx.QueryRowContext(ctx,
+		"SELECT type FROM categories WHERE id = $1 AND ledger_id = $2 FOR UPDATE",
+		categoryID, ledgerID).Scan(&ctype)
+	if err == sql.ErrNoRows {
+		return "", ErrCategoryNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to lock category: %w", err)
+	}
+	return ctype, nil
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+// CategoryNode is one category in a summary, with spending from its descendants rolled up into Total.
+// OwnTotal only counts transactions booked directly against this category.
+type CategoryNode struct {
+	ID       int             `json:"id"`
+	Name     string          `json:"category"`
+	Type     string          `json:"type"`
+	OwnTotal models.Money    `json:"own_total"`
+	Total    models.Money    `json:"total"`
+	Children []*CategoryNode `json:"children,omitempty"`
+}
+
+// buildCategoryTree arranges categories into a forest and rolls each category's own total
+// up into all of its ancestors. Categories with no transactions anywhere in their subtree
+// (absent from ownTotals) are pruned. Roots are sorted by type then total descending,
+// children by total descending.
+func buildCategoryTree(categories []models.Category, ownTotals map[int]models.Money) []*CategoryNode {
+	nodes := make(map[int]*CategoryNode, len(categories))
+	for _, c := range categories {
+		nodes[c.ID] = &CategoryNode{ID: c.ID, Name: c.Name, Type: c.Type, OwnTotal: ownTotals[c.ID]}
+	}
+
+	roots := make([]*CategoryNode, 0, len(categories))
+	for _, c := range categories {
+		node := nodes[c.ID]
+		if c.ParentID != nil {
+			if parent, ok := nodes[*c.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	kept := roots[:0]
+	for _, root := range roots {
+		if rollUp(root, ownTotals) {
+			kept = append(kept, root)
+		}
+	}
+	roots = kept
+
+	sort.SliceStable(roots, func(i, j int) bool {
+		if roots[i].Type != roots[j].Type {
+			return roots[i].Type < roots[j].Type
+		}
+		return roots[i].Total > roots[j].Total
+	})
+	return roots
+}
+
+// rollUp computes node.Total from its subtree, prunes empty children, and
+// reports whether the subtree contains any transactions.
+func rollUp(node *CategoryNode, ownTotals map[int]models.Money) bool {
+	_, hasOwn := ownTotals[node.ID]
+	node.Total = node.OwnTotal
+
+	kept := node.Children[:0]
+	for _, child := range node.Children {
+		if rollUp(child, ownTotals) {
+			node.Total += child.Total
+			kept = append(kept, child)
+		}
+	}
+	node.Children = kept
+	if len(node.Children) == 0 {
+		node.Children = nil
+	}
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		return node.Children[i].Total > node.Children[j].Total
+	})
+
+	return hasOwn || len(node.Children) > 0
+}
+
+// categorySummary runs a query returning (category_id, total) rows and rolls the totals
+// up the ledger's category hierarchy. When tree is false only the top-level categories are
+// returned, each including its descendants' spending.
+func categorySummary(ctx context.Context, db *sql.DB, ledgerID int, tree bool, query string, args ...interface{}) ([]*CategoryNode, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query category totals: %w", err)
+	}
+	defer rows.Close()
+
+	ownTotals := make(map[int]models.Money)
+	for rows.Next() {
+		var categoryID int
+		var total models.Money
+		if err := rows.Scan(&categoryID, &total); err != nil {
+			return nil, fmt.Errorf("failed to scan category total row: %w", err)
+		}
+		ownTotals[categoryID] = total
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating category totals: %w", err)
+	}
+
+	categories, err := ListCategories(ctx, db, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load categories: %w", err)
+	}
+
+	roots := buildCategoryTree(categories, ownTotals)
+	if !tree {
+		for _, root := range roots {
+			root.Children = nil
+		}
+	}
+	return roots, nil
+}
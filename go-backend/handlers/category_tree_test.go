@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestBuildCategoryTree(t *testing.T) {
+	categories := []models.Category{
+		{ID: 1, Name: "Transport", Type: "expense"},
+		{ID: 2, Name: "Fuel", Type: "expense", ParentID: intPtr(1)},
+		{ID: 3, Name: "Parking", Type: "expense", ParentID: intPtr(1)},
+		{ID: 4, Name: "Food", Type: "expense"},
+		{ID: 5, Name: "Salary", Type: "income"},
+		{ID: 6, Name: "Unused", Type: "expense"},
+		{ID: 7, Name: "Diesel", Type: "expense", ParentID: intPtr(2)},
+		{ID: 8, Name: "Orphan", Type: "expense", ParentID: intPtr(99)},
+	}
+	ownTotals := map[int]models.Money{
+		1: 1000,
+		2: 4000,
+		3: 1500,
+		4: 5000,
+		5: 100000,
+		7: 500,
+		8: 100,
+	}
+
+	roots := buildCategoryTree(categories, ownTotals)
+
+	wantRoots := []struct {
+		id    int
+		total models.Money
+	}{
+		{1, 7000}, // 10 own + 45 fuel (incl. diesel) + 15 parking
+		{4, 5000},
+		{8, 100}, // parent missing, treated as top-level
+		{5, 100000},
+	}
+	if len(roots) != len(wantRoots) {
+		t.Fatalf("got %d roots, want %d", len(roots), len(wantRoots))
+	}
+	for i, w := range wantRoots {
+		if roots[i].ID != w.id || roots[i].Total != w.total {
+			t.Errorf("roots[%d] = (%d, %s), want (%d, %s)", i, roots[i].ID, roots[i].Total, w.id, w.total)
+		}
+	}
+
+	transport := roots[0]
+	if transport.OwnTotal != 1000 {
+		t.Errorf("Transport own total = %s, want 10.00", transport.OwnTotal)
+	}
+	if len(transport.Children) != 2 || transport.Children[0].ID != 2 || transport.Children[1].ID != 3 {
+		t.Fatalf("Transport children not sorted by total: %+v", transport.Children)
+	}
+	fuel := transport.Children[0]
+	if fuel.Total != 4500 || len(fuel.Children) != 1 || fuel.Children[0].ID != 7 {
+		t.Errorf("Fuel = %+v, want total 45 with child Diesel", fuel)
+	}
+	if fuel.Children[0].Children != nil {
+		t.Errorf("leaf children should be nil")
+	}
+}
+
+func TestBuildCategoryTreeKeepsParentWithOnlyChildSpending(t *testing.T) {
+	categories := []models.Category{
+		{ID: 1, Name: "Transport", Type: "expense"},
+		{ID: 2, Name: "Fuel", Type: "expense", ParentID: intPtr(1)},
+		{ID: 3, Name: "Parking", Type: "expense", ParentID: intPtr(1)},
+	}
+
+	roots := buildCategoryTree(categories, map[int]models.Money{2: 2000})
+	if len(roots) != 1 || roots[0].ID != 1 {
+		t.Fatalf("expected Transport as the only root, got %+v", roots)
+	}
+	if roots[0].OwnTotal != 0 || roots[0].Total != 2000 {
+		t.Errorf("Transport = (own %s, total %s), want (0.00, 20.00)", roots[0].OwnTotal, roots[0].Total)
+	}
+	if len(roots[0].Children) != 1 || roots[0].Children[0].ID != 2 {
+		t.Errorf("Parking has no spending and should be pruned, got %+v", roots[0].Children)
+	}
+}
+
+func TestBuildCategoryTreeEmpty(t *testing.T) {
+	roots := buildCategoryTree([]models.Category{{ID: 1, Name: "Food", Type: "expense"}}, map[int]models.Money{})
+	if len(roots) != 0 {
+		t.Errorf("expected no roots without spending, got %+v", roots)
+	}
+}
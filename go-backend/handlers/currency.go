@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// ErrNoExchangeRate is returned when an amount cannot be converted to a user's base currency
+// because no rate has been loaded for the currency pair.
+var ErrNoExchangeRate = errors.New("no exchange rate available for this currency")
+
+// ensureConvertible checks that an amount in currency on the given date can be converted to the
+// base currency of every member of the ledger, since each of them sees the ledger's summaries in
+// their own. An empty currency stands for the base currency of userID, the user making the change.
+// Returns ErrNoExchangeRate if it cannot.
+func ensureConvertible(ctx context.Context, db *sql.DB, ledgerID, userID int, currency, date string) error {
+	var converted int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(convert_currency(1, COALESCE(NULLIF($3, ''), a.base_currency), u.base_currency, $4::date))
+		 FROM ledger_members m
+		 JOIN users u ON u.id = m.user_id
+		 JOIN users a ON a.id = $2
+		 WHERE m.ledger_id = $1`,
+		ledgerID, userID, currency, date).Scan(&converted)
+	if err != nil {
+		if utils.IsPgError(err, utils.PgNoDataFound) {
+			return ErrNoExchangeRate
+		}
+		return fmt.Errorf("failed to check exchange rate: %w", err)
+	}
+	return nil
+}
+
+// conversionError returns ErrNoExchangeRate if err was raised by convert_currency for a pair
+// without rates, as when a ledger member's base currency has none for a currency another member
+// used, and otherwise err wrapped with msg.
+func conversionError(msg string, err error) error {
+	if utils.IsPgError(err, utils.PgNoDataFound) {
+		return ErrNoExchangeRate
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// GetBaseCurrency returns the currency the user's summaries and budgets are reported in.
+func GetBaseCurrency(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var currency string
+	err := db.QueryRowContext(ctx, `SELECT base_currency FROM users WHERE id = $1`, userID).Scan(&currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("user not found")
+		}
+		return "", fmt.Errorf("failed to query base currency: %w", err)
+	}
+	return currency, nil
+}
+
+// SetBaseCurrency changes the user's base currency. Budget amounts are not converted; they are
+// interpreted in the new currency. Returns ErrNoExchangeRate if any transaction, recurring rule or account
+// in the user's ledgers is in a currency that has no rate to the new base currency.
+func SetBaseCurrency(ctx context.Context, db *sql.DB, userID int, currency string) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	// convert_currency raises for the first pair without a rate; one probe per currency is enough
+	// because a pair with any rate can be converted on every date.
+	_, err := db.ExecContext(ctx,
+		`SELECT convert_currency(1, used.currency, $2, CURRENT_DATE)
+		 FROM (
+			SELECT currency FROM transactions
+			WHERE ledger_id IN (SELECT ledger_id FROM ledger_members WHERE user_id = $1)
+			UNION
+			SELECT currency FROM recurring_transactions
+			WHERE ledger_id IN (SELECT ledger_id FROM ledger_members WHERE user_id = $1)
+			UNION
+			SELECT currency FROM accounts
+			WHERE ledger_id IN (SELECT ledger_id FROM ledger_members WHERE user_id = $1)
+		 ) used`,
+		userID, currency)
+	if err != nil {
+		if utils.IsPgError(err, utils.PgNoDataFound) {
+			return ErrNoExchangeRate
+		}
+		return fmt.Errorf("failed to check existing currencies: %w", err)
+	}
+
+	result, err := db.ExecContext(ctx, `UPDATE users SET base_currency = $2 WHERE id = $1`, userID, currency)
+	if err != nil {
+		return fmt.Errorf("failed to update base currency: %w", err)
+	}
+	return utils.CheckRowsAffected(result, "user")
+}
+
+// ParseExchangeRatesCSV reads exchange rates from CSV with a header row containing the
+// columns date, from, to and rate (in any order; extra columns are ignored).
+// Rows are validated up front so an import either loads every row or none.
+func ParseExchangeRatesCSV(r io.Reader) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1 // trailing optional columns may be omitted
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("CSV is empty")
+		}
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"date", "from", "to", "rate"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header must include date, from, to and rate columns")
+		}
+	}
+
+	var rates []models.ExchangeRate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(rates) >= constants.MaxExchangeRateRows {
+			return nil, fmt.Errorf("too many rows: at most %d exchange rates per import", constants.MaxExchangeRateRows)
+		}
+
+		rate, err := parseExchangeRateRecord(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("CSV contains no exchange rates")
+	}
+	return rates, nil
+}
+
+func parseExchangeRateRecord(record []string, columns map[string]int) (models.ExchangeRate, error) {
+	field := func(name string) string {
+		if i := columns[name]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	date := field("date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+	from, err := utils.NormalizeCurrency(field("from"))
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("from: %w", err)
+	}
+	to, err := utils.NormalizeCurrency(field("to"))
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("to: %w", err)
+	}
+	if from == to {
+		return models.ExchangeRate{}, fmt.Errorf("from and to currencies must differ")
+	}
+	rate := field("rate")
+	if !isPositiveDecimal(rate) {
+		return models.ExchangeRate{}, fmt.Errorf("invalid rate %q, expected a positive decimal number", rate)
+	}
+
+	return models.ExchangeRate{FromCurrency: from, ToCurrency: to, EffectiveDate: date, Rate: rate}, nil
+}
+
+// isPositiveDecimal accepts plain decimals like "83.12" or "0.0092" (at most 10 fractional
+// digits to fit NUMERIC(20,10)) that are greater than zero.
+func isPositiveDecimal(s string) bool {
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" || (hasPoint && frac == "") || len(whole) > 10 || len(frac) > 10 {
+		return false
+	}
+	nonZero := false
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return false
+		}
+		if c != '0' {
+			nonZero = true
+		}
+	}
+	return nonZero
+}
+
+// ImportExchangeRates inserts or replaces exchange rates in a single transaction and
+// returns the number of rows written.
+func ImportExchangeRates(ctx context.Context, db *sql.DB, rates []models.ExchangeRate) (int, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO exchange_rates (from_currency, to_currency, effective_date, rate)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (from_currency, to_currency, effective_date)
+		 DO UPDATE SET rate = EXCLUDED.rate, created_at = CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare exchange rate insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, rate := range rates {
+		if _, err := stmt.ExecContext(ctx, rate.FromCurrency, rate.ToCurrency, rate.EffectiveDate, rate.Rate); err != nil {
+			return 0, fmt.Errorf("failed to store %s/%s rate for %s: %w", rate.FromCurrency, rate.ToCurrency, rate.EffectiveDate, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit exchange rates: %w", err)
+	}
+	return len(rates), nil
+}
+
+// ListExchangeRates returns loaded exchange rates, newest first per currency pair.
+// When currency is non-empty only pairs involving that currency are returned.
+func ListExchangeRates(ctx context.Context, db *sql.DB, currency string) ([]models.ExchangeRate, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT from_currency, to_currency, effective_date, rate
+		 FROM exchange_rates
+		 WHERE $1 = '' OR from_currency = $1 OR to_currency = $1
+		 ORDER BY from_currency, to_currency, effective_date DESC`, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := make([]models.ExchangeRate, 0)
+	for rows.Next() {
+		var rate models.ExchangeRate
+		var effectiveDate time.Time
+		if err := rows.Scan(&rate.FromCurrency, &rate.ToCurrency, &effectiveDate, &rate.Rate); err != nil {
+			return nil, fmt.Errorf("failed to scan exchange rate: %w", err)
+		}
+		rate.EffectiveDate = effectiveDate.Format("2006-01-02")
+		rate.Rate = trimDecimal(rate.Rate)
+		rates = append(rates, rate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating exchange rates: %w", err)
+	}
+	return rates, nil
+}
+
+// trimDecimal removes insignificant trailing zeros from a NUMERIC string ("1.0850000000" -> "1.085").
+func trimDecimal(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExchangeRatesCSV(t *testing.T) {
+	input := "Date, From, To, Rate, Source\n" +
+		"2025-01-01,eur,USD,1.0850,ecb\n" +
+		"2025-01-01, USD , INR , 83.12\n"
+
+	rates, err := ParseExchangeRatesCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rates) != 2 {
+		t.Fatalf("got %d rates, want 2", len(rates))
+	}
+	first := rates[0]
+	if first.FromCurrency != "EUR" || first.ToCurrency != "USD" || first.EffectiveDate != "2025-01-01" || first.Rate != "1.0850" {
+		t.Errorf("first rate = %+v", first)
+	}
+	if rates[1].FromCurrency != "USD" || rates[1].ToCurrency != "INR" || rates[1].Rate != "83.12" {
+		t.Errorf("second rate = %+v", rates[1])
+	}
+}
+
+func TestParseExchangeRatesCSVErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "empty", input: "", wantErr: "empty"},
+		{name: "missing column", input: "date,from,rate\n2025-01-01,EUR,1.1\n", wantErr: "header"},
+		{name: "no rows", input: "date,from,to,rate\n", wantErr: "no exchange rates"},
+		{name: "bad date", input: "date,from,to,rate\n01/02/2025,EUR,USD,1.1\n", wantErr: "line 2"},
+		{name: "bad currency", input: "date,from,to,rate\n2025-01-01,EURO,USD,1.1\n", wantErr: "line 2"},
+		{name: "same currency", input: "date,from,to,rate\n2025-01-01,EUR,EUR,1\n", wantErr: "must differ"},
+		{name: "zero rate", input: "date,from,to,rate\n2025-01-01,EUR,USD,0.00\n", wantErr: "invalid rate"},
+		{name: "negative rate", input: "date,from,to,rate\n2025-01-01,EUR,USD,-1.1\n", wantErr: "invalid rate"},
+		{name: "error on later line", input: "date,from,to,rate\n2025-01-01,EUR,USD,1.1\n2025-01-02,EUR,USD,abc\n", wantErr: "line 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseExchangeRatesCSV(strings.NewReader(tt.input))
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsPositiveDecimal(t *testing.T) {
+	tests := map[string]bool{
+		"1":             true,
+		"0.0092":        true,
+		"83.12":         true,
+		"0":             false,
+		"0.000":         false,
+		"":              false,
+		".5":            false,
+		"5.":            false,
+		"1e3":           false,
+		"-1":            false,
+		"1.12345678901": false, // more than 10 fractional digits
+	}
+	for input, want := range tests {
+		if got := isPositiveDecimal(input); got != want {
+			t.Errorf("isPositiveDecimal(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
+
+func TestTrimDecimal(t *testing.T) {
+	tests := map[string]string{
+		"1.0850000000":  "1.085",
+		"83.0000000000": "83",
+		"100":           "100",
+	}
+	for input, want := range tests {
+		if got := trimDecimal(input); got != want {
+			t.Errorf("trimDecimal(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Email token purposes
+const (
+	EmailTokenVerify = "verify_email"
+	EmailTokenReset  = "password_reset"
+)
+
+var (
+	ErrInvalidEmailToken    = errors.New("invalid_email_token")
+	ErrEmailAlreadyVerified = errors.New("email_already_verified")
+	ErrEmailNotVerified     = errors.New("email_not_verified")
+)
+
+// EmailVerificationPolicy decides whether accounts whose email isn't verified may sign in.
+type EmailVerificationPolicy struct {
+	Required    bool          // unverified accounts can't log in or refresh their session
+	GracePeriod time.Duration // how long after registering an unverified account may still sign in
+}
+
+// allows reports whether an account created at createdAt may sign in at now.
+func (p EmailVerificationPolicy) allows(verified bool, createdAt, now time.Time) bool {
+	return verified || !p.Required || now.Before(createdAt.Add(p.GracePeriod))
+}
+
+// checkEmailVerified returns ErrEmailNotVerified if the policy doesn't let the user sign in.
+func checkEmailVerified(ctx context.Context, q queryer, userID int, policy EmailVerificationPolicy) error {
+	if !policy.Required {
+		return nil
+	}
+	var verified bool
+	var createdAt time.Time
+	err := q.QueryRowContext(ctx,
+		`SELECT email_verified_at IS NOT NULL, created_at FROM users WHERE id = $1`, userID).Scan(&verified, &createdAt)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query email verification: %w", err)
+	}
+	if !policy.allows(verified, createdAt, time.Now()) {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// emailTokenSignature returns the HMAC that binds a token's random part to its purpose.
+func emailTokenSignature(secret, purpose, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + ":" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signEmailToken returns the token sent by email: the random value and its signature.
+func signEmailToken(secret, purpose, value string) string {
+	return value + "." + emailTokenSignature(secret, purpose, value)
+}
+
+// parseEmailToken returns the random value of a token whose signature is valid for purpose.
+// Forged or mistyped tokens are rejected without touching the database.
+func parseEmailToken(secret, purpose, token string) (string, bool) {
+	value, sig, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok || value == "" || sig == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(sig), []byte(emailTokenSignature(secret, purpose, value))) {
+		return "", false
+	}
+	return value, true
+}
+
+// createEmailToken stores a new token for the user and purpose, sent to email, and returns it.
+// Earlier unused tokens for the same purpose stop working, so only the latest link is valid.
+func createEmailToken(ctx context.Context, tx *sql.Tx, userID int, purpose, email, secret string, ttl time.Duration) (string, error) {
+	value, err := randomToken(constants.EmailTokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE email_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, purpose)
+	if err != nil {
+		return "", fmt.Errorf("failed to invalidate earlier tokens: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO email_tokens (user_id, purpose, token_hash, email, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		userID, purpose, hashToken(value), email, time.Now().UTC().Add(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to store email token: %w", err)
+	}
+	return signEmailToken(secret, purpose, value), nil
+}
+
+// consumeEmailToken marks a token as used and returns its user and address. Returns
+// ErrInvalidEmailToken if it is forged, unknown, expired or already used.
+func consumeEmailToken(ctx context.Context, tx *sql.Tx, purpose, token, secret string) (int, string, error) {
+	value, ok := parseEmailToken(secret, purpose, token)
+	if !ok {
+		return 0, "", ErrInvalidEmailToken
+	}
+
+	var userID int
+	var email string
+	err := tx.QueryRowContext(ctx,
+		`UPDATE email_tokens SET used_at = NOW()
+		 WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id, email`,
+		hashToken(value), purpose).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrInvalidEmailToken
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to use email token: %w", err)
+	}
+	return userID, email, nil
+}
+
+// CreateEmailVerification issues a verification token for the user's current email address and
+// returns it with the address to send it to. Returns ErrEmailAlreadyVerified if there is nothing to verify.
+func CreateEmailVerification(ctx context.Context, db *sql.DB, userID int, secret string) (token, email string, err error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var verified bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&email, &verified)
+	if err == sql.ErrNoRows {
+		return "", "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to query user: %w", err)
+	}
+	if verified {
+		return "", "", ErrEmailAlreadyVerified
+	}
+
+	token, err = createEmailToken(ctx, tx, userID, EmailTokenVerify, email, secret, constants.EmailVerificationTokenExpiration)
+	if err != nil {
+		return "", "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("failed to commit email token: %w", err)
+	}
+	return token, email, nil
+}
+
+// VerifyEmail marks the address a verification token was sent to as verified. Returns
+// ErrInvalidEmailToken if the token isn't valid or the user has changed their email since.
+func VerifyEmail(ctx context.Context, db *sql.DB, token, secret string) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, email, err := consumeEmailToken(ctx, tx, EmailTokenVerify, token, secret)
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1 AND email = $2`,
+		userID, email)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInvalidEmailToken
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit email verification: %w", err)
+	}
+
+	utils.LogInfo("Email verified", "userID", userID)
+	return nil
+}
+
+// CreatePasswordReset issues a password reset token for the account with the given email.
+// Returns ErrUserNotFound if there is none; callers should not reveal that to the requester.
+func CreatePasswordReset(ctx context.Context, db *sql.DB, email, secret string) (string, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx, `SELECT id FROM users WHERE email = $1 FOR UPDATE`, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query user by email: %w", err)
+	}
+
+	token, err := createEmailToken(ctx, tx, userID, EmailTokenReset, email, secret, constants.PasswordResetTokenExpiration)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit email token: %w", err)
+	}
+
+	utils.LogInfo("Password reset requested", "userID", userID)
+	return token, nil
+}
+
+// ResetPassword sets a new password using a password reset token and signs the user out of every
+// session. Returns ErrInvalidEmailToken if the token isn't valid or the account's email has changed.
+func ResetPassword(ctx context.Context, db *sql.DB, token, newPassword, secret string) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("password hashing failed: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, email, err := consumeEmailToken(ctx, tx, EmailTokenReset, token, secret)
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET password = $3 WHERE id = $1 AND email = $2`, userID, email, string(hashedPassword))
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInvalidEmailToken
+	}
+	if err := revokeUserSessions(ctx, tx, userID, ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit password reset: %w", err)
+	}
+
+	utils.LogInfo("Password reset, all sessions revoked", "userID", userID)
+	return nil
+}
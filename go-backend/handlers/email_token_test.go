@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailTokenSignature(t *testing.T) {
+	token := signEmailToken("secret", EmailTokenReset, "abc123")
+
+	if value, ok := parseEmailToken("secret", EmailTokenReset, token); !ok || value != "abc123" {
+		t.Errorf("parseEmailToken = %q, %v; want abc123, true", value, ok)
+	}
+	if _, ok := parseEmailToken("secret", EmailTokenVerify, token); ok {
+		t.Error("a password reset token must not verify an email")
+	}
+	if _, ok := parseEmailToken("other-secret", EmailTokenReset, token); ok {
+		t.Error("a token signed with another secret must be rejected")
+	}
+	tampered := "abc124" + token[strings.Index(token, "."):]
+	if _, ok := parseEmailToken("secret", EmailTokenReset, tampered); ok {
+		t.Error("a token with a changed value must be rejected")
+	}
+	for _, malformed := range []string{"", "abc123", "abc123.", ".sig"} {
+		if _, ok := parseEmailToken("secret", EmailTokenReset, malformed); ok {
+			t.Errorf("parseEmailToken(%q) should fail", malformed)
+		}
+	}
+}
+
+func TestEmailVerificationPolicyAllows(t *testing.T) {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := created.Add(48 * time.Hour)
+
+	tests := []struct {
+		name     string
+		policy   EmailVerificationPolicy
+		verified bool
+		now      time.Time
+		want     bool
+	}{
+		{name: "optional", policy: EmailVerificationPolicy{}, now: later, want: true},
+		{name: "required and verified", policy: EmailVerificationPolicy{Required: true}, verified: true, now: later, want: true},
+		{name: "required and unverified", policy: EmailVerificationPolicy{Required: true}, now: created, want: false},
+		{name: "within grace period", policy: EmailVerificationPolicy{Required: true, GracePeriod: 72 * time.Hour}, now: later, want: true},
+		{name: "after grace period", policy: EmailVerificationPolicy{Required: true, GracePeriod: 24 * time.Hour}, now: later, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.allows(tt.verified, created, tt.now); got != tt.want {
+				t.Errorf("allows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// GetForecast projects the ledger's balance for the given number of days after today, in the base currency
+// and against the balance floor of userID, the user asking. It starts from
+// the current balance (the opening balances of the ledger's accounts, converted at today's rate, plus
+// all income minus all expenses up to today), adds upcoming occurrences of active
+// recurring transactions and future-dated transactions, and subtracts the average daily discretionary
+// spending of the last ForecastLookbackDays days. Discretionary spending excludes expenses created by a
+// recurring rule or matching one (same category, amount, currency and description), since those are
+// projected separately, and settlements, which are paid back rather than spent.
+func GetForecast(ctx context.Context, db *sql.DB, ledgerID, userID, days int, today time.Time) (models.Forecast, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	end := today.AddDate(0, 0, days)
+	todayStr := today.Format("2006-01-02")
+
+	var currency string
+	var floor, balance models.Money
+	err := db.QueryRowContext(ctx,
+		`SELECT u.base_currency, u.balance_floor,
+			COALESCE(SUM(CASE WHEN c.type = 'income'
+				THEN convert_currency(t.amount, t.currency, u.base_currency, t.date)
+				ELSE -convert_currency(t.amount, t.currency, u.base_currency, t.date) END), 0)
+			+ (SELECT COALESCE(SUM(convert_currency(a.opening_balance, a.currency, u.base_currency, $2)), 0)
+			   FROM accounts a WHERE a.ledger_id = $3)
+		 FROM users u
+		 LEFT JOIN transactions t ON t.ledger_id = $3 AND t.date <= $2
+		 LEFT JOIN categories c ON c.id = t.category_id
+		 WHERE u.id = $1
+		 GROUP BY u.id`,
+		userID, todayStr, ledgerID).Scan(&currency, &floor, &balance)
+	if err == sql.ErrNoRows {
+		return models.Forecast{}, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return models.Forecast{}, conversionError("failed to query balance", err)
+	}
+
+	dailySpending, err := averageDiscretionarySpending(ctx, db, ledgerID, userID, today)
+	if err != nil {
+		return models.Forecast{}, err
+	}
+
+	var items []models.ForecastItem
+
+	// Occurrences of active recurring transactions, converted at today's rate
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+recurringColumns+`, c.type, convert_currency(r.amount, r.currency, u.base_currency, $2)
+		 FROM recurring_transactions r
+		 JOIN categories c ON c.id = r.category_id
+		 JOIN users u ON u.id = $4
+		 WHERE r.ledger_id = $1 AND r.status = $3`,
+		ledgerID, todayStr, models.RecurringActive, userID)
+	if err != nil {
+		return models.Forecast{}, conversionError("failed to query recurring transactions", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var txType string
+		var amount models.Money
+		rt, err := scanRecurring(rows, &txType, &amount)
+		if err != nil {
+			return models.Forecast{}, conversionError("failed to scan recurring transaction", err)
+		}
+		dates, err := RecurringOccurrences(rt, end, constants.MaxForecastDays*10)
+		if err != nil {
+			continue // an invalid rule creates nothing in the processor either
+		}
+		for _, d := range dates {
+			items = append(items, models.ForecastItem{
+				Date:        d.Format("2006-01-02"),
+				Source:      models.ForecastRecurring,
+				SourceID:    rt.ID,
+				CategoryID:  rt.CategoryID,
+				Type:        txType,
+				Description: rt.Description,
+				Amount:      amount,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return models.Forecast{}, conversionError("error iterating recurring transactions", err)
+	}
+
+	// Transactions already entered with a future date
+	scheduled, err := db.QueryContext(ctx,
+		`SELECT t.id, t.date, t.category_id, c.type, COALESCE(t.description, ''),
+			convert_currency(t.amount, t.currency, u.base_currency, t.date)
+		 FROM transactions t
+		 JOIN categories c ON c.id = t.category_id
+		 JOIN users u ON u.id = $4
+		 WHERE t.ledger_id = $1 AND t.date > $2 AND t.date <= $3`,
+		ledgerID, todayStr, end.Format("2006-01-02"), userID)
+	if err != nil {
+		return models.Forecast{}, conversionError("failed to query scheduled transactions", err)
+	}
+	defer scheduled.Close()
+	for scheduled.Next() {
+		item := models.ForecastItem{Source: models.ForecastScheduled}
+		var date time.Time
+		if err := scheduled.Scan(&item.SourceID, &date, &item.CategoryID, &item.Type, &item.Description, &item.Amount); err != nil {
+			return models.Forecast{}, conversionError("failed to scan scheduled transaction", err)
+		}
+		item.Date = date.Format("2006-01-02")
+		items = append(items, item)
+	}
+	if err := scheduled.Err(); err != nil {
+		return models.Forecast{}, conversionError("error iterating scheduled transactions", err)
+	}
+
+	forecast := buildForecast(today, days, balance, floor, dailySpending, items)
+	forecast.Currency = currency
+	return forecast, nil
+}
+
+// averageDiscretionarySpending returns the average daily expenses over the completed days of the lookback
+// window, not counting expenses created by or matching a recurring rule. For newer ledgers the window starts at
+// their first transaction.
+func averageDiscretionarySpending(ctx context.Context, q queryer, ledgerID, userID int, today time.Time) (models.Money, error) {
+	windowStart := today.AddDate(0, 0, -constants.ForecastLookbackDays)
+	windowEnd := today.AddDate(0, 0, -1)
+
+	var total models.Money
+	var first sql.NullTime
+	err := q.QueryRowContext(ctx,
+		`SELECT
+			COALESCE((SELECT SUM(convert_currency(t.amount, t.currency, u.base_currency, t.date))
+			 FROM transactions t
+			 JOIN categories c ON c.id = t.category_id
+			 JOIN users u ON u.id = $4
+			 WHERE t.ledger_id = $1 AND c.type = 'expense' AND t.date BETWEEN $2 AND $3 AND t.recurring_id IS NULL
+			   AND t.settlement_id IS NULL
+			   AND NOT EXISTS (
+				SELECT 1 FROM recurring_transactions r
+				WHERE r.ledger_id = t.ledger_id AND r.category_id = t.category_id AND r.amount = t.amount
+				  AND r.currency = t.currency AND COALESCE(r.description, '') = COALESCE(t.description, ''))), 0),
+			(SELECT MIN(date) FROM transactions WHERE ledger_id = $1)`,
+		ledgerID, windowStart.Format("2006-01-02"), windowEnd.Format("2006-01-02"), userID).Scan(&total, &first)
+	if err != nil {
+		return 0, conversionError("failed to query discretionary spending", err)
+	}
+	if !first.Valid {
+		return 0, nil
+	}
+	if first.Time.After(windowStart) {
+		windowStart = first.Time
+	}
+	days := int(windowEnd.Sub(windowStart).Hours()/24) + 1
+	if days < 1 {
+		return 0, nil
+	}
+	return total.DivRound(int64(days)), nil
+}
+
+// buildForecast lays out the projection for the days after today. Items due on or before today (recurring
+// occurrences the processor hasn't created yet) count on the first day.
+func buildForecast(today time.Time, days int, balance, floor, dailySpending models.Money, items []models.ForecastItem) models.Forecast {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Date < items[j].Date })
+
+	first := today.AddDate(0, 0, 1).Format("2006-01-02")
+	byDay := make(map[string][]models.ForecastItem)
+	for _, item := range items {
+		day := item.Date
+		if day < first {
+			day = first
+		}
+		byDay[day] = append(byDay[day], item)
+	}
+
+	f := models.Forecast{
+		From:                 first,
+		To:                   today.AddDate(0, 0, days).Format("2006-01-02"),
+		StartingBalance:      balance,
+		BalanceFloor:         floor,
+		AverageDailySpending: dailySpending,
+		LowestBalance:        balance,
+		LowestBalanceDate:    today.Format("2006-01-02"),
+		Upcoming:             items,
+		Days:                 make([]models.ForecastDay, 0, days),
+		Warnings:             []models.ForecastWarning{},
+	}
+	if f.Upcoming == nil {
+		f.Upcoming = []models.ForecastItem{}
+	}
+
+	var warning *models.ForecastWarning
+	for i := 1; i <= days; i++ {
+		day := models.ForecastDay{Date: today.AddDate(0, 0, i).Format("2006-01-02"), Discretionary: dailySpending}
+		for _, item := range byDay[day.Date] {
+			if item.Type == "income" {
+				day.Income += item.Amount
+			} else {
+				day.Expenses += item.Amount
+			}
+		}
+		balance += day.Income - day.Expenses - day.Discretionary
+		day.Balance = balance
+		f.Days = append(f.Days, day)
+
+		if balance < f.LowestBalance {
+			f.LowestBalance, f.LowestBalanceDate = balance, day.Date
+		}
+		if balance < floor {
+			if warning == nil {
+				f.Warnings = append(f.Warnings, models.ForecastWarning{Date: day.Date, LowestBalance: balance, LowestBalanceDate: day.Date})
+				warning = &f.Warnings[len(f.Warnings)-1]
+			}
+			warning.Days++
+			if balance < warning.LowestBalance {
+				warning.LowestBalance, warning.LowestBalanceDate = balance, day.Date
+			}
+		} else {
+			warning = nil
+		}
+	}
+	f.EndingBalance = balance
+
+	for i := range f.Warnings {
+		w := &f.Warnings[i]
+		w.Message = fmt.Sprintf("Balance is projected to drop below %s on %s, reaching %s on %s",
+			floor, w.Date, w.LowestBalance, w.LowestBalanceDate)
+	}
+	return f
+}
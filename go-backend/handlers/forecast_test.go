@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+func TestBuildForecast(t *testing.T) {
+	items := []models.ForecastItem{
+		{Date: "2025-03-05", Type: "expense", Amount: 120000, Source: models.ForecastRecurring}, // rent
+		{Date: "2025-03-01", Type: "expense", Amount: 5000, Source: models.ForecastRecurring},   // overdue, counts tomorrow
+		{Date: "2025-03-07", Type: "income", Amount: 200000, Source: models.ForecastScheduled},
+	}
+
+	f := buildForecast(mustParseDate("2025-03-02"), 7, 150000, 20000, 1000, items)
+
+	if f.From != "2025-03-03" || f.To != "2025-03-09" || len(f.Days) != 7 {
+		t.Fatalf("range = %s..%s with %d days", f.From, f.To, len(f.Days))
+	}
+	if f.Upcoming[0].Date != "2025-03-01" {
+		t.Errorf("upcoming should be sorted by date, got %v", f.Upcoming)
+	}
+	if d := f.Days[0]; d.Expenses != 5000 || d.Balance != 144000 {
+		t.Errorf("first day = %+v, want the overdue item and 1440.00", d)
+	}
+	// 1500.00 - 50.00 - 1200.00 - 3 * 10.00 = 220.00 after Mar 5, then 210.00 on Mar 6
+	if d := f.Days[3]; d.Date != "2025-03-06" || d.Balance != 21000 {
+		t.Errorf("Mar 6 = %+v, want 210.00", d)
+	}
+	if f.EndingBalance != 218000 {
+		t.Errorf("EndingBalance = %s, want 2180.00", f.EndingBalance)
+	}
+	if f.LowestBalance != 21000 || f.LowestBalanceDate != "2025-03-06" {
+		t.Errorf("lowest = %s on %s", f.LowestBalance, f.LowestBalanceDate)
+	}
+	if len(f.Warnings) != 0 {
+		t.Errorf("balance stays above the floor, got %v", f.Warnings)
+	}
+
+	// A higher floor is crossed on Mar 5 and recovered on payday
+	f = buildForecast(mustParseDate("2025-03-02"), 7, 150000, 25000, 1000, items)
+	if len(f.Warnings) != 1 {
+		t.Fatalf("got %d warnings, want 1", len(f.Warnings))
+	}
+	w := f.Warnings[0]
+	if w.Date != "2025-03-05" || w.Days != 2 || w.LowestBalance != 21000 || w.LowestBalanceDate != "2025-03-06" {
+		t.Errorf("warning = %+v", w)
+	}
+}
+
+func TestBuildForecastWithoutItems(t *testing.T) {
+	f := buildForecast(mustParseDate("2025-03-02"), 3, 0, 0, 0, nil)
+	if f.Upcoming == nil || f.Warnings == nil || len(f.Days) != 3 {
+		t.Errorf("empty forecast should have empty lists and every day, got %+v", f)
+	}
+}
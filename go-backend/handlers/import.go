@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/importer"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// Import row statuses reported by CommitImport
+const (
+	ImportStatusImported  = "imported"
+	ImportStatusDuplicate = "skipped_duplicate"
+	ImportStatusError     = "error"
+	ImportStatusAborted   = "not_imported" // valid, but another row failed
+)
+
+// ImportPreviewRow is a parsed statement row as shown to the user before committing.
+// Amount is always positive; Type says whether the row is money out (expense) or in (income).
+// Description is the raw statement text, to be sent back unchanged in ImportCommitRow.
+// SuggestedCategoryID is set when one of the user's categorization rules matches the row.
+type ImportPreviewRow struct {
+	Index                 int          `json:"index"`
+	Line                  int          `json:"line"`
+	Date                  string       `json:"date"`
+	Amount                models.Money `json:"amount"`
+	Type                  string       `json:"type"`
+	Description           string       `json:"description"`
+	Currency              string       `json:"currency,omitempty"`
+	Reference             string       `json:"reference,omitempty"`
+	SuggestedCategoryID   int          `json:"suggested_category_id,omitempty"`
+	SuggestedCategoryName string       `json:"suggested_category,omitempty"`
+	Duplicate             bool         `json:"duplicate"`
+	Error                 string       `json:"error,omitempty"`
+}
+
+// ImportCommitRow is a row the user selected for import. Without a CategoryID the
+// categorization rules choose one of the given Type, as for AddTransaction.
+type ImportCommitRow struct {
+	Date           string       `json:"date"`
+	Amount         models.Money `json:"amount"`
+	Description    string       `json:"description"`
+	CategoryID     int          `json:"category_id,omitempty"`
+	Type           string       `json:"type,omitempty"` // "expense" or "income"; required without category_id
+	Currency       string       `json:"currency,omitempty"`
+	AllowDuplicate bool         `json:"allow_duplicate"`
+}
+
+// ImportRowResult reports what happened to one committed row.
+type ImportRowResult struct {
+	Index         int    `json:"index"`
+	Status        string `json:"status"`
+	TransactionID int    `json:"transaction_id,omitempty"`
+	CategoryID    int    `json:"category_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ImportResult is the outcome of CommitImport. When any row has an error nothing is
+// written and Committed is false; Rows then lists every row's status.
+type ImportResult struct {
+	Committed bool              `json:"committed"`
+	Imported  int               `json:"imported"`
+	Skipped   int               `json:"skipped"`
+	Failed    int               `json:"failed"`
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// duplicateKey identifies a transaction for duplicate detection: same date, amount and
+// (sanitized, case-insensitive) description.
+type duplicateKey struct {
+	date        string
+	amount      models.Money
+	description string
+}
+
+func newDuplicateKey(date string, amount models.Money, sanitizedDescription string) duplicateKey {
+	return duplicateKey{
+		date:        date,
+		amount:      amount,
+		description: strings.ToLower(strings.TrimSpace(sanitizedDescription)),
+	}
+}
+
+// markDuplicates flags rows that match an existing transaction. Each existing transaction
+// matches at most one row, so two identical purchases on the same day in the file are only
+// both flagged if both are already recorded. Rows with errors are never flagged.
+func markDuplicates(rows []ImportPreviewRow, existing map[duplicateKey]int) {
+	remaining := make(map[duplicateKey]int, len(existing))
+	for k, n := range existing {
+		remaining[k] = n
+	}
+	for i := range rows {
+		if rows[i].Error != "" {
+			continue
+		}
+		key := newDuplicateKey(rows[i].Date, rows[i].Amount, utils.SanitizeDescription(rows[i].Description))
+		if remaining[key] > 0 {
+			remaining[key]--
+			rows[i].Duplicate = true
+		}
+	}
+}
+
+// existingTransactionKeys counts the ledger's transactions between from and to by duplicate key.
+func existingTransactionKeys(ctx context.Context, q queryer, ledgerID int, from, to string) (map[duplicateKey]int, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT to_char(date, 'YYYY-MM-DD'), amount, COALESCE(description, '')
+		 FROM transactions
+		 WHERE ledger_id = $1 AND date BETWEEN $2 AND $3`,
+		ledgerID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing transactions: %w", err)
+	}
+	defer rows.Close()
+
+	keys := map[duplicateKey]int{}
+	for rows.Next() {
+		var date, description string
+		var amount models.Money
+		if err := rows.Scan(&date, &amount, &description); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		keys[newDuplicateKey(date, amount, description)]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate transactions: %w", err)
+	}
+	return keys, nil
+}
+
+// dateRange returns the earliest and latest of the non-empty YYYY-MM-DD dates.
+func dateRange(dates []string) (from, to string, ok bool) {
+	for _, d := range dates {
+		if d == "" {
+			continue
+		}
+		if from == "" || d < from {
+			from = d
+		}
+		if to == "" || d > to {
+			to = d
+		}
+	}
+	return from, to, from != ""
+}
+
+// PreviewImport validates parsed statement rows, flags likely duplicates of the ledger's
+// existing transactions and suggests categories from the ledger's rules. Nothing is written.
+// Dates are checked in the time zone of userID, the user importing.
+func PreviewImport(ctx context.Context, db *sql.DB, ledgerID, userID int, parsed []importer.Row) ([]ImportPreviewRow, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	loc, err := userLocation(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := make([]ImportPreviewRow, len(parsed))
+	dates := make([]string, 0, len(parsed))
+	for i, row := range parsed {
+		p := ImportPreviewRow{
+			Index:       i,
+			Line:        row.Line,
+			Date:        row.Date,
+			Amount:      row.Amount,
+			Type:        "income",
+			Description: strings.TrimSpace(row.Description),
+			Reference:   row.Reference,
+			Error:       row.Error,
+		}
+		if p.Amount < 0 {
+			p.Amount = -p.Amount
+			p.Type = "expense"
+		}
+		if p.Error == "" {
+			p.Error = validateImportRow(p.Date, p.Amount, loc)
+		}
+		if p.Error == "" && row.Currency != "" {
+			currency, err := utils.NormalizeCurrency(row.Currency)
+			if err != nil {
+				p.Error = err.Error()
+			}
+			p.Currency = currency
+		}
+		if p.Error == "" {
+			dates = append(dates, p.Date)
+		}
+		preview[i] = p
+	}
+
+	from, to, ok := dateRange(dates)
+	if !ok {
+		return preview, nil
+	}
+	existing, err := existingTransactionKeys(ctx, db, ledgerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	markDuplicates(preview, existing)
+
+	matchers, err := loadRuleMatchers(ctx, db, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range preview {
+		p := &preview[i]
+		if p.Error != "" {
+			continue
+		}
+		if rule := matchRule(matchers, p.Type, p.Description, p.Amount, p.Date); rule != nil {
+			p.SuggestedCategoryID = rule.CategoryID
+			p.SuggestedCategoryName = rule.CategoryName
+		}
+	}
+	return preview, nil
+}
+
+// validateImportRow returns a user-facing error message, or "" if the row can be imported.
+// Dates may not be later than today in loc, the user's time zone.
+func validateImportRow(date string, amount models.Money, loc *time.Location) string {
+	if err := utils.ValidateTransactionDateIn(date, loc); err != nil {
+		return err.Error()
+	}
+	if err := utils.ValidateAmount(amount); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// CommitImport inserts the selected rows as transactions in the ledger, recorded by userID, in a single
+// database transaction. Rows without a category are filed by the ledger's categorization rules (or under
+// "Uncategorized").
+// Rows matching an existing transaction are skipped unless AllowDuplicate is set. If any row
+// is invalid (bad date or amount, foreign category, currency without an exchange rate),
+// nothing is written and the result reports the error for each failing row.
+func CommitImport(ctx context.Context, db *sql.DB, ledgerID, userID int, rows []ImportCommitRow) (ImportResult, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result := ImportResult{Rows: make([]ImportRowResult, len(rows))}
+
+	loc, err := userLocation(ctx, db, userID)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	// Validate everything before opening the transaction
+	ownedCategories := map[int]bool{}
+	convertible := map[string]error{}
+	dates := make([]string, 0, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		result.Rows[i] = ImportRowResult{Index: i}
+		msg, err := validateCommitRow(ctx, db, ledgerID, userID, loc, row, ownedCategories, convertible)
+		if err != nil {
+			return ImportResult{}, err
+		}
+		if msg != "" {
+			result.Rows[i].Status = ImportStatusError
+			result.Rows[i].Error = msg
+			result.Failed++
+			continue
+		}
+		dates = append(dates, row.Date)
+	}
+	if result.Failed > 0 {
+		for i := range result.Rows {
+			if result.Rows[i].Status == "" {
+				result.Rows[i].Status = ImportStatusAborted
+			}
+		}
+		return result, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	existing := map[duplicateKey]int{}
+	if from, to, ok := dateRange(dates); ok {
+		existing, err = existingTransactionKeys(ctx, tx, ledgerID, from, to)
+		if err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	matchers, err := loadRuleMatchers(ctx, tx, ledgerID)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	uncategorized := map[string]int{}
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO transactions (user_id, category_id, amount, currency, description, date, ledger_id)
+		 VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), (SELECT base_currency FROM users WHERE id = $1)), $5, $6, $7)
+		 RETURNING id`)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, row := range rows {
+		key := newDuplicateKey(row.Date, row.Amount, row.Description)
+		if existing[key] > 0 {
+			existing[key]--
+			if !row.AllowDuplicate {
+				result.Rows[i].Status = ImportStatusDuplicate
+				result.Skipped++
+				continue
+			}
+		}
+
+		categoryID := row.CategoryID
+		if categoryID == 0 {
+			if rule := matchRule(matchers, row.Type, row.Description, row.Amount, row.Date); rule != nil {
+				categoryID = rule.CategoryID
+			} else if categoryID = uncategorized[row.Type]; categoryID == 0 {
+				categoryID, err = uncategorizedCategory(ctx, tx, ledgerID, userID, row.Type)
+				if err != nil {
+					return ImportResult{}, err
+				}
+				uncategorized[row.Type] = categoryID
+			}
+		}
+
+		var id int
+		err := stmt.QueryRowContext(ctx, userID, categoryID, row.Amount, row.Currency, row.Description, row.Date, ledgerID).Scan(&id)
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("failed to insert row %d: %w", i, err)
+		}
+		result.Rows[i].Status = ImportStatusImported
+		result.Rows[i].TransactionID = id
+		result.Rows[i].CategoryID = categoryID
+		result.Imported++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ImportResult{}, fmt.Errorf("failed to commit import: %w", err)
+	}
+	result.Committed = true
+	return result, nil
+}
+
+// validateCommitRow normalizes row in place and returns a user-facing error message, or ""
+// if it can be imported. Category ownership and currency checks are cached across rows.
+// A non-nil error means the database could not be queried.
+func validateCommitRow(ctx context.Context, db *sql.DB, ledgerID, userID int, loc *time.Location, row *ImportCommitRow,
+	ownedCategories map[int]bool, convertible map[string]error) (string, error) {
+	if msg := validateImportRow(row.Date, row.Amount, loc); msg != "" {
+		return msg, nil
+	}
+	if row.CategoryID < 0 {
+		return "category_id must be a positive number", nil
+	}
+	row.Description = utils.SanitizeDescription(row.Description)
+	if row.CategoryID == 0 {
+		row.Type = strings.ToLower(strings.TrimSpace(row.Type))
+		if row.Type != "expense" && row.Type != "income" {
+			return "type must be 'expense' or 'income' when category_id is omitted", nil
+		}
+		return validateCommitCurrency(ctx, db, ledgerID, userID, row, convertible)
+	}
+
+	owned, checked := ownedCategories[row.CategoryID]
+	if !checked {
+		err := utils.VerifyCategoryOwnership(db, ledgerID, row.CategoryID)
+		if err != nil && err.Error() != "category not found or unauthorized" {
+			return "", err
+		}
+		owned = err == nil
+		ownedCategories[row.CategoryID] = owned
+	}
+	if !owned {
+		return "category not found or unauthorized", nil
+	}
+	return validateCommitCurrency(ctx, db, ledgerID, userID, row, convertible)
+}
+
+// validateCommitCurrency normalizes the row's optional currency (the user's base currency when
+// omitted) and checks it has an exchange rate to the base currency of every member of the
+// ledger, caching the result per currency.
+func validateCommitCurrency(ctx context.Context, db *sql.DB, ledgerID, userID int, row *ImportCommitRow, convertible map[string]error) (string, error) {
+	currency := row.Currency
+	if currency != "" {
+		normalized, err := utils.NormalizeCurrency(currency)
+		if err != nil {
+			return err.Error(), nil
+		}
+		currency = normalized
+		row.Currency = currency
+	}
+
+	convErr, checked := convertible[currency]
+	if !checked {
+		convErr = ensureConvertible(ctx, db, ledgerID, userID, currency, row.Date)
+		if convErr != nil && !errors.Is(convErr, ErrNoExchangeRate) {
+			return "", convErr
+		}
+		convertible[currency] = convErr
+	}
+	if convErr != nil {
+		if currency == "" {
+			return "no exchange rate is loaded between your base currency and the base currency of every ledger member", nil
+		}
+		return "no exchange rate is loaded between " + currency + " and the base currency of every ledger member", nil
+	}
+	return "", nil
+}
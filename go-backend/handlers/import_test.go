@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+func TestMarkDuplicates(t *testing.T) {
+	rows := []ImportPreviewRow{
+		{Date: "2025-01-10", Amount: 450, Description: "Coffee & Cake"},
+		{Date: "2025-01-10", Amount: 450, Description: "coffee & cake "},
+		{Date: "2025-01-10", Amount: 451, Description: "Coffee & Cake"},
+		{Date: "2025-01-11", Amount: 9900, Description: "Groceries"},
+		{Date: "2025-01-11", Amount: 9900, Description: "Groceries", Error: "invalid date"},
+	}
+	// Existing descriptions are stored sanitized, so "&" is "&amp;" in the database
+	existing := map[duplicateKey]int{
+		newDuplicateKey("2025-01-10", 450, utils.SanitizeDescription("Coffee & Cake")): 1,
+		newDuplicateKey("2025-01-11", 9900, "Groceries"):                               2,
+	}
+
+	markDuplicates(rows, existing)
+
+	want := []bool{true, false, false, true, false}
+	for i, row := range rows {
+		if row.Duplicate != want[i] {
+			t.Errorf("rows[%d].Duplicate = %v, want %v", i, row.Duplicate, want[i])
+		}
+	}
+	if existing[newDuplicateKey("2025-01-11", 9900, "Groceries")] != 2 {
+		t.Error("markDuplicates must not modify the existing counts")
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	from, to, ok := dateRange([]string{"2025-03-02", "", "2024-12-31", "2025-01-15"})
+	if !ok || from != "2024-12-31" || to != "2025-03-02" {
+		t.Errorf("dateRange = (%q, %q, %v), want (2024-12-31, 2025-03-02, true)", from, to, ok)
+	}
+	if _, _, ok := dateRange(nil); ok {
+		t.Error("dateRange(nil) should report no dates")
+	}
+}
@@ -0,0 +1,661 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+var (
+	ErrLedgerNotFound           = errors.New("ledger not found or unauthorized")
+	ErrLedgerMemberNotFound     = errors.New("ledger_member_not_found")
+	ErrLastLedgerOwner          = errors.New("last_ledger_owner")
+	ErrAlreadyLedgerMember      = errors.New("already_ledger_member")
+	ErrTooManyLedgers           = errors.New("too_many_ledgers")
+	ErrInvalidLedgerInvitation  = errors.New("invalid_ledger_invitation")
+	ErrLedgerInvitationNotFound = errors.New("ledger_invitation_not_found")
+	ErrLedgerInvitationEmail    = errors.New("ledger_invitation_other_email")
+)
+
+// defaultLedgerName is the name of the ledger every account starts with
+const defaultLedgerName = "Personal"
+
+// ledgerInvitePurpose binds invitation tokens to invitations, like the email token purposes
+const ledgerInvitePurpose = "ledger_invite"
+
+// ledgerTables are the tables whose rows belong to a ledger; their user_id is who created the row.
+var ledgerTables = []string{"categories", "transactions", "recurring_transactions", "budgets", "categorization_rules", "accounts", "transfers"}
+
+// createPersonalLedger creates the ledger a new account starts with and makes it the user's default.
+func createPersonalLedger(ctx context.Context, tx *sql.Tx, userID int) (int, error) {
+	ledgerID, err := insertLedger(ctx, tx, userID, defaultLedgerName)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET default_ledger_id = $2 WHERE id = $1", userID, ledgerID); err != nil {
+		return 0, fmt.Errorf("failed to set default ledger: %w", err)
+	}
+	return ledgerID, nil
+}
+
+// insertLedger creates a ledger owned by the user.
+func insertLedger(ctx context.Context, tx *sql.Tx, userID int, name string) (int, error) {
+	var ledgerID int
+	err := tx.QueryRowContext(ctx,
+		"INSERT INTO ledgers (name, created_by) VALUES ($1, $2) RETURNING id", name, userID).Scan(&ledgerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert ledger: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO ledger_members (ledger_id, user_id, role) VALUES ($1, $2, $3)",
+		ledgerID, userID, models.LedgerRoleOwner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add ledger owner: %w", err)
+	}
+	return ledgerID, nil
+}
+
+// LookupLedger returns the ID of a ledger the user is a member of and their role in it.
+// With ledgerID 0 it returns the user's default ledger, or their oldest membership if the
+// default ledger is gone. ok is false if the user isn't a member.
+func LookupLedger(ctx context.Context, db *sql.DB, userID, ledgerID int) (id int, role string, ok bool, err error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	err = db.QueryRowContext(ctx,
+		`SELECT m.ledger_id, m.role
+		 FROM ledger_members m
+		 JOIN users u ON u.id = m.user_id
+		 WHERE m.user_id = $1 AND ($2 = 0 OR m.ledger_id = $2)
+		 ORDER BY m.ledger_id = u.default_ledger_id DESC NULLS LAST, m.joined_at, m.ledger_id
+		 LIMIT 1`,
+		userID, ledgerID).Scan(&id, &role)
+	if err == sql.ErrNoRows {
+		return 0, "", false, nil
+	}
+	if err != nil {
+		return 0, "", false, fmt.Errorf("failed to look up ledger: %w", err)
+	}
+	return id, role, true, nil
+}
+
+// CreateLedger creates a ledger owned by the user.
+// Returns ErrTooManyLedgers once the user has created constants.MaxLedgersPerUser of them.
+func CreateLedger(ctx context.Context, db *sql.DB, userID int, name string) (models.Ledger, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serializes ledger creation per user, so the limit holds under concurrent requests
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to lock user: %w", err)
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM ledgers WHERE created_by = $1", userID).Scan(&count); err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to count ledgers: %w", err)
+	}
+	if count >= constants.MaxLedgersPerUser {
+		return models.Ledger{}, ErrTooManyLedgers
+	}
+
+	ledgerID, err := insertLedger(ctx, tx, userID, name)
+	if err != nil {
+		return models.Ledger{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to commit ledger: %w", err)
+	}
+
+	utils.LogInfo("Ledger created", "userID", userID, "ledgerID", ledgerID)
+	return GetLedger(ctx, db, userID, ledgerID)
+}
+
+// ledgerColumns selects a ledger (aliased l) as seen by a member (m, joined to their user u) for scanLedger.
+const ledgerColumns = `l.id, l.name, m.role, COALESCE(l.id = u.default_ledger_id, false),
+	(SELECT COUNT(*) FROM ledger_members c WHERE c.ledger_id = l.id), l.created_at`
+
+func scanLedger(row interface{ Scan(...any) error }) (models.Ledger, error) {
+	var l models.Ledger
+	var createdAt time.Time
+	if err := row.Scan(&l.ID, &l.Name, &l.Role, &l.Default, &l.Members, &createdAt); err != nil {
+		return l, err
+	}
+	l.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	return l, nil
+}
+
+// GetLedger returns one of the user's ledgers. Returns ErrLedgerNotFound if they aren't a member.
+func GetLedger(ctx context.Context, db *sql.DB, userID, ledgerID int) (models.Ledger, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	l, err := scanLedger(db.QueryRowContext(ctx,
+		`SELECT `+ledgerColumns+`
+		 FROM ledger_members m
+		 JOIN ledgers l ON l.id = m.ledger_id
+		 JOIN users u ON u.id = m.user_id
+		 WHERE m.user_id = $1 AND m.ledger_id = $2`, userID, ledgerID))
+	if err == sql.ErrNoRows {
+		return l, ErrLedgerNotFound
+	}
+	if err != nil {
+		return l, fmt.Errorf("failed to query ledger: %w", err)
+	}
+	return l, nil
+}
+
+// ListLedgers returns the ledgers the user is a member of, oldest first.
+func ListLedgers(ctx context.Context, db *sql.DB, userID int) ([]models.Ledger, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+ledgerColumns+`
+		 FROM ledger_members m
+		 JOIN ledgers l ON l.id = m.ledger_id
+		 JOIN users u ON u.id = m.user_id
+		 WHERE m.user_id = $1
+		 ORDER BY l.created_at, l.id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledgers: %w", err)
+	}
+	defer rows.Close()
+
+	ledgers := []models.Ledger{}
+	for rows.Next() {
+		l, err := scanLedger(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ledger: %w", err)
+		}
+		ledgers = append(ledgers, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ledgers: %w", err)
+	}
+	return ledgers, nil
+}
+
+// RenameLedger changes a ledger's name.
+func RenameLedger(ctx context.Context, db *sql.DB, ledgerID int, name string) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "UPDATE ledgers SET name = $2 WHERE id = $1", ledgerID, name)
+	if err != nil {
+		return fmt.Errorf("failed to rename ledger: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrLedgerNotFound
+	}
+	return nil
+}
+
+// DeleteLedger deletes a ledger with all of its categories, transactions, recurring rules,
+// budgets, accounts and transfers, for every member.
+func DeleteLedger(ctx context.Context, db *sql.DB, ledgerID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Transfers keep their accounts from being deleted, so they go first
+	if _, err := tx.ExecContext(ctx, "DELETE FROM transfers WHERE ledger_id = $1", ledgerID); err != nil {
+		return fmt.Errorf("failed to delete transfers: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM ledgers WHERE id = $1", ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete ledger: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrLedgerNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ledger deletion: %w", err)
+	}
+	utils.LogInfo("Ledger deleted", "ledgerID", ledgerID)
+	return nil
+}
+
+// SetDefaultLedger makes a ledger the user is a member of the one used when requests don't select one.
+func SetDefaultLedger(ctx context.Context, db *sql.DB, userID, ledgerID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		`UPDATE users SET default_ledger_id = $2
+		 WHERE id = $1 AND EXISTS (SELECT 1 FROM ledger_members WHERE ledger_id = $2 AND user_id = $1)`,
+		userID, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to set default ledger: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrLedgerNotFound
+	}
+	return nil
+}
+
+// ListLedgerMembers returns a ledger's members, owners first.
+func ListLedgerMembers(ctx context.Context, db *sql.DB, ledgerID int) ([]models.LedgerMember, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT u.id, u.username, u.email, m.role, m.joined_at
+		 FROM ledger_members m
+		 JOIN users u ON u.id = m.user_id
+		 WHERE m.ledger_id = $1
+		 ORDER BY m.role = $2 DESC, m.joined_at, u.id`,
+		ledgerID, models.LedgerRoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.LedgerMember{}
+	for rows.Next() {
+		var m models.LedgerMember
+		var joinedAt time.Time
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Email, &m.Role, &joinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger member: %w", err)
+		}
+		m.JoinedAt = joinedAt.UTC().Format(time.RFC3339)
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ledger members: %w", err)
+	}
+	return members, nil
+}
+
+// lockLedgerMember locks a ledger for changes to its membership and returns the member's role.
+// Returns ErrLedgerMemberNotFound if the user isn't a member.
+func lockLedgerMember(ctx context.Context, tx *sql.Tx, ledgerID, userID int) (string, error) {
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM ledgers WHERE id = $1 FOR UPDATE", ledgerID); err != nil {
+		return "", fmt.Errorf("failed to lock ledger: %w", err)
+	}
+	var role string
+	err := tx.QueryRowContext(ctx,
+		"SELECT role FROM ledger_members WHERE ledger_id = $1 AND user_id = $2", ledgerID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrLedgerMemberNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query ledger member: %w", err)
+	}
+	return role, nil
+}
+
+// isLastOwner reports whether the ledger has no owner other than userID.
+func isLastOwner(ctx context.Context, tx *sql.Tx, ledgerID, userID int) (bool, error) {
+	var others bool
+	err := tx.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM ledger_members WHERE ledger_id = $1 AND user_id <> $2 AND role = $3)",
+		ledgerID, userID, models.LedgerRoleOwner).Scan(&others)
+	if err != nil {
+		return false, fmt.Errorf("failed to count ledger owners: %w", err)
+	}
+	return !others, nil
+}
+
+// SetLedgerMemberRole changes a member's role. Returns ErrLedgerMemberNotFound, or
+// ErrLastLedgerOwner if it would leave the ledger without an owner.
+func SetLedgerMemberRole(ctx context.Context, db *sql.DB, ledgerID, userID int, role string) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := lockLedgerMember(ctx, tx, ledgerID, userID)
+	if err != nil {
+		return err
+	}
+	if current == models.LedgerRoleOwner && role != models.LedgerRoleOwner {
+		last, err := isLastOwner(ctx, tx, ledgerID, userID)
+		if err != nil {
+			return err
+		}
+		if last {
+			return ErrLastLedgerOwner
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE ledger_members SET role = $3 WHERE ledger_id = $1 AND user_id = $2", ledgerID, userID, role); err != nil {
+		return fmt.Errorf("failed to update ledger member: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ledger member: %w", err)
+	}
+	utils.LogInfo("Ledger member role changed", "ledgerID", ledgerID, "userID", userID, "role", role)
+	return nil
+}
+
+// RemoveLedgerMember takes a user out of a ledger; it is also how members leave. Rows they created
+// stay in the ledger. Returns ErrLedgerMemberNotFound, or ErrLastLedgerOwner for the only owner,
+// who has to hand over ownership or delete the ledger instead.
+func RemoveLedgerMember(ctx context.Context, db *sql.DB, ledgerID, userID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	role, err := lockLedgerMember(ctx, tx, ledgerID, userID)
+	if err != nil {
+		return err
+	}
+	if role == models.LedgerRoleOwner {
+		last, err := isLastOwner(ctx, tx, ledgerID, userID)
+		if err != nil {
+			return err
+		}
+		if last {
+			return ErrLastLedgerOwner
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM ledger_members WHERE ledger_id = $1 AND user_id = $2", ledgerID, userID); err != nil {
+		return fmt.Errorf("failed to remove ledger member: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE users SET default_ledger_id = NULL WHERE id = $1 AND default_ledger_id = $2", userID, ledgerID); err != nil {
+		return fmt.Errorf("failed to clear default ledger: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ledger member removal: %w", err)
+	}
+	utils.LogInfo("Ledger member removed", "ledgerID", ledgerID, "userID", userID)
+	return nil
+}
+
+// InviteToLedger creates an invitation for email to join the ledger with the given role and returns
+// the token to send to that address, valid for constants.LedgerInvitationExpiration. An earlier
+// pending invitation for the same address stops working. Returns ErrAlreadyLedgerMember if the
+// account with that email is already a member.
+func InviteToLedger(ctx context.Context, db *sql.DB, ledgerID, invitedBy int, email, role, secret string) (string, models.LedgerInvitation, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	value, err := randomToken(constants.EmailTokenBytes)
+	if err != nil {
+		return "", models.LedgerInvitation{}, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", models.LedgerInvitation{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	inv := models.LedgerInvitation{LedgerID: ledgerID, Email: email, Role: role, InvitedBy: &invitedBy}
+	err = tx.QueryRowContext(ctx, "SELECT name FROM ledgers WHERE id = $1 FOR UPDATE", ledgerID).Scan(&inv.LedgerName)
+	if err == sql.ErrNoRows {
+		return "", models.LedgerInvitation{}, ErrLedgerNotFound
+	}
+	if err != nil {
+		return "", models.LedgerInvitation{}, fmt.Errorf("failed to lock ledger: %w", err)
+	}
+
+	var member bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM ledger_members m JOIN users u ON u.id = m.user_id
+		 WHERE m.ledger_id = $1 AND LOWER(u.email) = LOWER($2))`,
+		ledgerID, email).Scan(&member)
+	if err != nil {
+		return "", models.LedgerInvitation{}, fmt.Errorf("failed to check ledger membership: %w", err)
+	}
+	if member {
+		return "", models.LedgerInvitation{}, ErrAlreadyLedgerMember
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM ledger_invitations WHERE ledger_id = $1 AND LOWER(email) = LOWER($2) AND accepted_at IS NULL`,
+		ledgerID, email); err != nil {
+		return "", models.LedgerInvitation{}, fmt.Errorf("failed to replace earlier invitation: %w", err)
+	}
+	var expiresAt, createdAt time.Time
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO ledger_invitations (ledger_id, email, role, token_hash, invited_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, expires_at, created_at`,
+		ledgerID, email, role, hashToken(value), invitedBy, time.Now().UTC().Add(constants.LedgerInvitationExpiration)).
+		Scan(&inv.ID, &expiresAt, &createdAt)
+	if err != nil {
+		return "", models.LedgerInvitation{}, fmt.Errorf("failed to store ledger invitation: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", models.LedgerInvitation{}, fmt.Errorf("failed to commit ledger invitation: %w", err)
+	}
+
+	inv.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	inv.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	utils.LogInfo("Ledger invitation created", "ledgerID", ledgerID, "invitationID", inv.ID, "invitedBy", invitedBy)
+	return signEmailToken(secret, ledgerInvitePurpose, value), inv, nil
+}
+
+// ListLedgerInvitations returns a ledger's pending invitations, newest first.
+func ListLedgerInvitations(ctx context.Context, db *sql.DB, ledgerID int) ([]models.LedgerInvitation, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT i.id, l.id, l.name, i.email, i.role, i.invited_by, i.expires_at, i.created_at
+		 FROM ledger_invitations i
+		 JOIN ledgers l ON l.id = i.ledger_id
+		 WHERE i.ledger_id = $1 AND i.accepted_at IS NULL AND i.expires_at > NOW()
+		 ORDER BY i.created_at DESC, i.id DESC`, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []models.LedgerInvitation{}
+	for rows.Next() {
+		var inv models.LedgerInvitation
+		var invitedBy sql.NullInt64
+		var expiresAt, createdAt time.Time
+		if err := rows.Scan(&inv.ID, &inv.LedgerID, &inv.LedgerName, &inv.Email, &inv.Role, &invitedBy, &expiresAt, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger invitation: %w", err)
+		}
+		if invitedBy.Valid {
+			id := int(invitedBy.Int64)
+			inv.InvitedBy = &id
+		}
+		inv.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+		inv.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ledger invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// RevokeLedgerInvitation withdraws a pending invitation.
+func RevokeLedgerInvitation(ctx context.Context, db *sql.DB, ledgerID, invitationID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		"DELETE FROM ledger_invitations WHERE id = $1 AND ledger_id = $2 AND accepted_at IS NULL",
+		invitationID, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke ledger invitation: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrLedgerInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptLedgerInvitation adds the user to the ledger an invitation token is for, with the invited
+// role, and returns the ledger. The invitation must have been sent to the user's email address.
+// Returns ErrInvalidLedgerInvitation if the token is forged, unknown, expired or already used,
+// ErrLedgerInvitationEmail, ErrAlreadyLedgerMember, or ErrNoExchangeRate if a currency used in the
+// ledger has no rate to the user's base currency.
+func AcceptLedgerInvitation(ctx context.Context, db *sql.DB, userID int, token, secret string) (models.Ledger, error) {
+	value, ok := parseEmailToken(secret, ledgerInvitePurpose, token)
+	if !ok {
+		return models.Ledger{}, ErrInvalidLedgerInvitation
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var invitationID, ledgerID int
+	var invited, role string
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, ledger_id, email, role FROM ledger_invitations
+		 WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > NOW()
+		 FOR UPDATE`,
+		hashToken(value)).Scan(&invitationID, &ledgerID, &invited, &role)
+	if err == sql.ErrNoRows {
+		return models.Ledger{}, ErrInvalidLedgerInvitation
+	}
+	if err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to look up ledger invitation: %w", err)
+	}
+
+	var email string
+	err = tx.QueryRowContext(ctx, "SELECT email FROM users WHERE id = $1", userID).Scan(&email)
+	if err == sql.ErrNoRows {
+		return models.Ledger{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to query user: %w", err)
+	}
+	if !strings.EqualFold(email, invited) {
+		return models.Ledger{}, ErrLedgerInvitationEmail
+	}
+
+	// The new member sees the ledger's summaries in their own base currency, so every currency
+	// already used in it must convert to that; one probe per currency is enough, as in SetBaseCurrency.
+	_, err = tx.ExecContext(ctx,
+		`SELECT convert_currency(1, used.currency, (SELECT base_currency FROM users WHERE id = $2), CURRENT_DATE)
+		 FROM (
+			SELECT currency FROM transactions WHERE ledger_id = $1
+			UNION
+			SELECT currency FROM recurring_transactions WHERE ledger_id = $1
+			UNION
+			SELECT currency FROM accounts WHERE ledger_id = $1
+		 ) used`,
+		ledgerID, userID)
+	if err != nil {
+		if utils.IsPgError(err, utils.PgNoDataFound) {
+			return models.Ledger{}, ErrNoExchangeRate
+		}
+		return models.Ledger{}, fmt.Errorf("failed to check ledger currencies: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO ledger_members (ledger_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		ledgerID, userID, role)
+	if err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to add ledger member: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return models.Ledger{}, ErrAlreadyLedgerMember
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE ledger_invitations SET accepted_at = NOW() WHERE id = $1", invitationID); err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to use ledger invitation: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Ledger{}, fmt.Errorf("failed to commit ledger invitation: %w", err)
+	}
+
+	utils.LogInfo("Ledger invitation accepted", "ledgerID", ledgerID, "userID", userID, "role", role)
+	return GetLedger(ctx, db, userID, ledgerID)
+}
+
+// handOverLedgers prepares a user's ledgers for their account being deleted. Ledgers nobody else
+// is a member of are deleted with everything in them. In shared ledgers the longest-standing
+// member becomes owner if the user was the only one, and rows the user created are handed over
+// to an owner, so the other members keep their history.
+func handOverLedgers(ctx context.Context, tx *sql.Tx, userID int) error {
+	// Transfers keep their accounts from being deleted, so they go before the ledgers
+	_, err := tx.ExecContext(ctx,
+		`DELETE FROM transfers t
+		 WHERE EXISTS (SELECT 1 FROM ledger_members WHERE ledger_id = t.ledger_id AND user_id = $1)
+		   AND NOT EXISTS (SELECT 1 FROM ledger_members WHERE ledger_id = t.ledger_id AND user_id <> $1)`,
+		userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete transfers of unshared ledgers: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM ledgers l
+		 WHERE EXISTS (SELECT 1 FROM ledger_members WHERE ledger_id = l.id AND user_id = $1)
+		   AND NOT EXISTS (SELECT 1 FROM ledger_members WHERE ledger_id = l.id AND user_id <> $1)`,
+		userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete unshared ledgers: %w", err)
+	}
+
+	// Editors are preferred over viewers as the new owner
+	_, err = tx.ExecContext(ctx,
+		`UPDATE ledger_members m SET role = $2
+		 FROM (
+			SELECT DISTINCT ON (o.ledger_id) o.ledger_id, o.user_id
+			FROM ledger_members o
+			WHERE o.user_id <> $1
+			  AND o.ledger_id IN (SELECT ledger_id FROM ledger_members WHERE user_id = $1 AND role = $2)
+			  AND NOT EXISTS (SELECT 1 FROM ledger_members x WHERE x.ledger_id = o.ledger_id AND x.user_id <> $1 AND x.role = $2)
+			ORDER BY o.ledger_id, o.role = $3 DESC, o.joined_at, o.user_id
+		 ) heir
+		 WHERE m.ledger_id = heir.ledger_id AND m.user_id = heir.user_id`,
+		userID, models.LedgerRoleOwner, models.LedgerRoleEditor)
+	if err != nil {
+		return fmt.Errorf("failed to hand over ledger ownership: %w", err)
+	}
+
+	for _, table := range ledgerTables {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`UPDATE %s t SET user_id = (
+				SELECT o.user_id FROM ledger_members o
+				WHERE o.ledger_id = t.ledger_id AND o.role = $2 AND o.user_id <> $1
+				ORDER BY o.joined_at, o.user_id LIMIT 1
+			 )
+			 WHERE t.user_id = $1`, table),
+			userID, models.LedgerRoleOwner)
+		if err != nil {
+			return fmt.Errorf("failed to hand over %s: %w", table, err)
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE budget_periods bp SET user_id = b.user_id
+		 FROM budgets b WHERE b.id = bp.budget_id AND bp.user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to hand over budget history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// ErrNotificationNotFound is returned when a notification doesn't exist or belongs to another user.
+var ErrNotificationNotFound = errors.New("notification not found or unauthorized")
+
+// AddNotification adds an entry to the user's inbox. data holds kind-specific details and may be nil.
+func AddNotification(ctx context.Context, db *sql.DB, userID int, kind, title, body string, data map[string]any) error {
+	encoded := []byte("{}")
+	if data != nil {
+		var err error
+		if encoded, err = json.Marshal(data); err != nil {
+			return fmt.Errorf("failed to encode notification data: %w", err)
+		}
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO notifications (user_id, kind, title, body, data)
+		 VALUES ($1, $2, $3, $4, $5::jsonb)`,
+		userID, kind, title, body, string(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to store notification: %w", err)
+	}
+	return nil
+}
+
+// ListNotifications returns the user's notifications, newest first, optionally only unread ones.
+func ListNotifications(ctx context.Context, db *sql.DB, userID int, unreadOnly bool, limit, offset int) ([]models.Notification, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, kind, title, body, data, read_at, created_at
+		 FROM notifications
+		 WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $3 OFFSET $4`,
+		userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var data []byte
+		var readAt sql.NullTime
+		var createdAt time.Time
+		if err := rows.Scan(&n.ID, &n.Kind, &n.Title, &n.Body, &data, &readAt, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		n.Data = json.RawMessage(data)
+		if readAt.Valid {
+			s := readAt.Time.Format(time.RFC3339)
+			n.ReadAt = &s
+		}
+		n.CreatedAt = createdAt.Format(time.RFC3339)
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// UnreadNotificationCount returns how many of the user's notifications are unread.
+func UnreadNotificationCount(ctx context.Context, db *sql.DB, userID int) (int, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var count int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`,
+		userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkNotificationRead marks one notification as read; already read notifications keep their read time.
+// Returns ErrNotificationNotFound if it doesn't belong to the user.
+func MarkNotificationRead(ctx context.Context, db *sql.DB, userID, id int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		 WHERE id = $1 AND user_id = $2`,
+		id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification read: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user as read and returns how many changed.
+func MarkAllNotificationsRead(ctx context.Context, db *sql.DB, userID int) (int64, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL`,
+		userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// DeleteNotification removes a notification from the user's inbox.
+// Returns ErrNotificationNotFound if it doesn't belong to the user.
+func DeleteNotification(ctx context.Context, db *sql.DB, userID, id int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM notifications WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
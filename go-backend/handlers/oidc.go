@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/oidc"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+var (
+	ErrInvalidOIDCState     = errors.New("invalid_oidc_state")
+	ErrOIDCLoginFailed      = errors.New("oidc_login_failed")
+	ErrOIDCEmailNotVerified = errors.New("oidc_email_not_verified")
+	ErrOIDCUnavailable      = errors.New("oidc_provider_unavailable")
+)
+
+// noPassword is stored as the password of accounts without one, such as those created by single
+// sign-on. It is not a bcrypt hash, so password login fails until the user sets a password with a reset.
+const noPassword = "!"
+
+// maxUsernameAttempts is how many numbered variants of a username are tried when provisioning an account.
+const maxUsernameAttempts = 100
+
+// StartOIDCLogin begins a single sign-on login and returns the identity provider URL to send the
+// browser to, and a binding the client must keep to itself and present to CompleteOIDCLogin. The
+// binding ties the login to the client that started it, so a leaked redirect URL can't be used to
+// finish it elsewhere. The state, nonce, PKCE verifier and binding hash are kept until
+// CompleteOIDCLogin uses them or constants.OIDCLoginExpiration passes. Returns ErrOIDCUnavailable if
+// the provider's discovery document can't be fetched.
+func StartOIDCLogin(ctx context.Context, db *sql.DB, provider *oidc.Provider) (authURL, binding string, err error) {
+	state, err := randomToken(constants.OIDCStateBytes)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken(constants.OIDCStateBytes)
+	if err != nil {
+		return "", "", err
+	}
+	binding, err = randomToken(constants.OIDCStateBytes)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err = provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		utils.LogError("Identity provider unavailable", "error", err)
+		return "", "", ErrOIDCUnavailable
+	}
+
+	dbCtx, cancel := utils.DBContext(ctx)
+	defer cancel()
+	_, err = db.ExecContext(dbCtx,
+		`INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, binding_hash, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		hashToken(state), nonce, verifier, hashToken(binding), time.Now().UTC().Add(constants.OIDCLoginExpiration))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store login state: %w", err)
+	}
+	return authURL, binding, nil
+}
+
+// oidcBindingMatches reports whether binding is the one a login was started with, in constant time.
+func oidcBindingMatches(bindingHash, binding string) bool {
+	return subtle.ConstantTimeCompare([]byte(bindingHash), []byte(hashToken(binding))) == 1
+}
+
+// CompleteOIDCLogin finishes a single sign-on login with the code and state the identity provider
+// redirected back with, and signs the user in. binding must be the one StartOIDCLogin returned to
+// the client that started the login; it is checked before the code is exchanged. The identity is
+// matched to a local account by the provider's subject ID, or else linked to the account with the
+// same email address, or else a new account with default categories is created; the bool result
+// reports the latter. Linking and creating accounts need an email address the provider has verified.
+//
+// Returns ErrInvalidOIDCState for an unknown, used or expired state or a wrong binding (which uses
+// up the state), ErrOIDCLoginFailed if the provider rejects the code or its ID token doesn't
+// verify, and ErrOIDCEmailNotVerified. As with LoginUser, accounts with two-factor authentication
+// get a challenge token instead of a session.
+func CompleteOIDCLogin(ctx context.Context, db *sql.DB, provider *oidc.Provider, state, binding, code, jwtSecret string, policy EmailVerificationPolicy) (TokenPair, bool, error) {
+	var nonce, verifier, bindingHash string
+	dbCtx, cancel := utils.DBContext(ctx)
+	err := db.QueryRowContext(dbCtx,
+		`DELETE FROM oidc_login_states WHERE state_hash = $1 AND expires_at > NOW() RETURNING nonce, code_verifier, binding_hash`,
+		hashToken(state)).Scan(&nonce, &verifier, &bindingHash)
+	cancel()
+	if err == sql.ErrNoRows {
+		return TokenPair{}, false, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return TokenPair{}, false, fmt.Errorf("failed to look up login state: %w", err)
+	}
+	if !oidcBindingMatches(bindingHash, binding) {
+		utils.LogInfo("Single sign-on refused: login binding doesn't match")
+		return TokenPair{}, false, ErrInvalidOIDCState
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		utils.LogInfo("Single sign-on failed: code exchange", "error", err)
+		return TokenPair{}, false, ErrOIDCLoginFailed
+	}
+	claims, err := provider.Verify(ctx, rawIDToken, nonce)
+	if err != nil {
+		utils.LogInfo("Single sign-on failed: ID token", "error", err)
+		return TokenPair{}, false, ErrOIDCLoginFailed
+	}
+
+	ctx, cancel = utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return TokenPair{}, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, created, err := resolveOIDCUser(ctx, tx, claims)
+	if err != nil {
+		if err == ErrOIDCEmailNotVerified {
+			utils.LogInfo("Single sign-on refused: no verified email", "issuer", claims.Issuer, "subject", claims.Subject)
+		}
+		return TokenPair{}, false, err
+	}
+	var twoFactor bool
+	err = tx.QueryRowContext(ctx, "SELECT totp_enabled_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&twoFactor)
+	if err != nil {
+		return TokenPair{}, false, fmt.Errorf("failed to query user: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return TokenPair{}, false, fmt.Errorf("failed to commit single sign-on: %w", err)
+	}
+
+	if err := checkEmailVerified(ctx, db, userID, policy); err != nil {
+		return TokenPair{}, false, err
+	}
+	if twoFactor {
+		utils.LogInfo("Single sign-on verified, two-factor authentication required", "userID", userID)
+		pair, err := issueTwoFactorChallenge(userID, jwtSecret)
+		return pair, created, err
+	}
+
+	pair, err := StartSession(ctx, db, userID, jwtSecret)
+	if err != nil {
+		return TokenPair{}, false, err
+	}
+	utils.LogInfo("User logged in with single sign-on", "userID", userID, "issuer", claims.Issuer, "created", created)
+	return pair, created, nil
+}
+
+// resolveOIDCUser returns the local user for a verified identity, linking or creating the account
+// on first login, and whether it was created.
+func resolveOIDCUser(ctx context.Context, tx *sql.Tx, claims oidc.Claims) (int, bool, error) {
+	var userID int
+	err := tx.QueryRowContext(ctx,
+		`UPDATE user_identities SET last_login_at = NOW(), email = NULLIF($3, '')
+		 WHERE issuer = $1 AND subject = $2 RETURNING user_id`,
+		claims.Issuer, claims.Subject, claims.Email).Scan(&userID)
+	if err == nil {
+		return userID, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, fmt.Errorf("failed to look up identity: %w", err)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, false, ErrOIDCEmailNotVerified
+	}
+
+	created := false
+	var verified bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, email_verified_at IS NOT NULL FROM users WHERE LOWER(email) = LOWER($1) FOR UPDATE`,
+		claims.Email).Scan(&userID, &verified)
+	switch {
+	case err == sql.ErrNoRows:
+		userID, err = provisionOIDCUser(ctx, tx, claims)
+		if err != nil {
+			return 0, false, err
+		}
+		created = true
+	case err != nil:
+		return 0, false, fmt.Errorf("failed to query user by email: %w", err)
+	case verified:
+		utils.LogInfo("Linking identity to existing account", "userID", userID, "issuer", claims.Issuer)
+	default:
+		// Nobody proved they own this address when the account was registered, so whoever did may
+		// not be the person the provider vouches for: drop their password and sessions
+		_, err = tx.ExecContext(ctx,
+			`UPDATE users SET email_verified_at = NOW(), password = $2 WHERE id = $1`, userID, noPassword)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to verify email: %w", err)
+		}
+		if err := revokeUserSessions(ctx, tx, userID, ""); err != nil {
+			return 0, false, err
+		}
+		utils.LogInfo("Linking identity to unverified account, password cleared", "userID", userID, "issuer", claims.Issuer)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at) VALUES ($1, $2, $3, $4, NOW())`,
+		userID, claims.Issuer, claims.Subject, claims.Email)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to link identity: %w", err)
+	}
+	return userID, created, nil
+}
+
+// provisionOIDCUser creates an account without a password for a new single sign-on user, with a
+// personal ledger holding the default categories.
+func provisionOIDCUser(ctx context.Context, tx *sql.Tx, claims oidc.Claims) (int, error) {
+	base := usernameFromClaims(claims)
+	username := ""
+	for i := 1; i <= maxUsernameAttempts && username == ""; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, i)
+		}
+		var taken bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)", candidate).Scan(&taken)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check username existence: %w", err)
+		}
+		if !taken {
+			username = candidate
+		}
+	}
+	if username == "" {
+		return 0, ErrUsernameExists
+	}
+
+	var userID int
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO users (username, email, password, email_verified_at) VALUES ($1, $2, $3, NOW()) RETURNING id`,
+		username, claims.Email, noPassword).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting user: %w", err)
+	}
+	ledgerID, err := createPersonalLedger(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := createDefaultCategories(ctx, tx, ledgerID, userID); err != nil {
+		return 0, err
+	}
+
+	utils.LogInfo("User provisioned by single sign-on", "userID", userID, "username", username, "issuer", claims.Issuer)
+	return userID, nil
+}
+
+// usernameFromClaims suggests a username for a new account from the provider's preferred
+// username, the email address's local part or the user's name, in that order, keeping to the
+// characters utils.ValidateUsername allows and leaving room for a numeric suffix.
+func usernameFromClaims(claims oidc.Claims) string {
+	local, _, _ := strings.Cut(claims.Email, "@")
+	for _, s := range []string{claims.PreferredUsername, local, claims.Name} {
+		name := strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+				return r
+			case r == '.' || r == ' ' || r == '+':
+				return '_'
+			}
+			return -1
+		}, s)
+		name = strings.Trim(name, "_-")
+		if len(name) > 40 {
+			name = name[:40]
+		}
+		if len(name) >= 3 {
+			return name
+		}
+	}
+	return "user"
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/oidc"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+func TestUsernameFromClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims oidc.Claims
+		want   string
+	}{
+		{name: "preferred username", claims: oidc.Claims{PreferredUsername: "jane_doe", Email: "jd@example.com"}, want: "jane_doe"},
+		{name: "email local part", claims: oidc.Claims{Email: "jane.doe+work@example.com"}, want: "jane_doe_work"},
+		{name: "name", claims: oidc.Claims{Name: "Zoë Smith"}, want: "Zo_Smith"},
+		{name: "too short falls through", claims: oidc.Claims{PreferredUsername: "j", Email: "jd@example.com", Name: "Jane Doe"}, want: "Jane_Doe"},
+		{name: "nothing usable", claims: oidc.Claims{PreferredUsername: "李", Email: "李@example.com"}, want: "user"},
+		{name: "long", claims: oidc.Claims{PreferredUsername: strings.Repeat("a", 60)}, want: strings.Repeat("a", 40)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := usernameFromClaims(tt.claims)
+			if got != tt.want {
+				t.Errorf("usernameFromClaims = %q, want %q", got, tt.want)
+			}
+			if !utils.ValidateUsername(got) || !utils.ValidateUsername(got+"-99") {
+				t.Errorf("%q (with a suffix) is not a valid username", got)
+			}
+		})
+	}
+}
+
+func TestOIDCBindingMatches(t *testing.T) {
+	stored := hashToken("binding-from-start")
+	if !oidcBindingMatches(stored, "binding-from-start") {
+		t.Error("the binding the login was started with doesn't match")
+	}
+	for _, binding := range []string{"", "binding-from-other-client", stored} {
+		if oidcBindingMatches(stored, binding) {
+			t.Errorf("binding %q matches", binding)
+		}
+	}
+}
+
+func TestSignedInRecently(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		signedInAt time.Time
+		want       bool
+	}{
+		{"just now", now, true},
+		{"within the window", now.Add(-constants.RecentSignInWindow + time.Second), true},
+		{"at the end of the window", now.Add(-constants.RecentSignInWindow), true},
+		{"after the window", now.Add(-constants.RecentSignInWindow - time.Second), false},
+		{"days ago", now.Add(-72 * time.Hour), false},
+		{"in the future", now.Add(time.Minute), false},
+	}
+	for _, tt := range tests {
+		if got := signedInRecently(tt.signedInAt, now); got != tt.want {
+			t.Errorf("%s: signedInRecently = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
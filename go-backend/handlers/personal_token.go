@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+var (
+	ErrPersonalTokenNotFound = errors.New("personal token not found or unauthorized")
+	ErrPersonalTokenExists   = errors.New("personal_token_exists")
+	ErrTooManyPersonalTokens = errors.New("too_many_personal_tokens")
+)
+
+// PersonalTokenScopes are the scopes a personal access token can be granted.
+var PersonalTokenScopes = []string{
+	constants.ScopeTransactionsRead,
+	constants.ScopeTransactionsWrite,
+	constants.ScopeCategoriesRead,
+	constants.ScopeCategoriesWrite,
+	constants.ScopeBudgetsRead,
+	constants.ScopeBudgetsWrite,
+	constants.ScopeRecurringRead,
+	constants.ScopeRecurringWrite,
+	constants.ScopeReportsRead,
+	constants.ScopeNotificationsRead,
+	constants.ScopeNotificationsWrite,
+}
+
+// personalTokenPrefixLength is how much of a token is kept in clear to identify it in listings.
+const personalTokenPrefixLength = len(constants.PersonalTokenPrefix) + 8
+
+// ParseScopes reads a comma- or space-separated list of scopes, dropping duplicates.
+func ParseScopes(s string) ([]string, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	seen := make(map[string]bool, len(fields))
+	scopes := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if !validScope(f) {
+			return nil, fmt.Errorf("unknown scope %q; valid scopes are %s", f, strings.Join(PersonalTokenScopes, ", "))
+		}
+		if !seen[f] {
+			seen[f] = true
+			scopes = append(scopes, f)
+		}
+	}
+	return scopes, nil
+}
+
+func validScope(scope string) bool {
+	for _, s := range PersonalTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatePersonalToken creates a named token with the given scopes that expires after the given
+// number of days, and returns it with its details. The token is only available now; just its hash is stored.
+// Returns ErrPersonalTokenExists if the user already has a token with that name.
+func CreatePersonalToken(ctx context.Context, db *sql.DB, userID int, name string, scopes []string, days int) (string, models.PersonalToken, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	random, err := randomToken(constants.PersonalTokenBytes)
+	if err != nil {
+		return "", models.PersonalToken{}, err
+	}
+	token := constants.PersonalTokenPrefix + random
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", models.PersonalToken{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serializes token creation per user, so the limit holds under concurrent requests
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return "", models.PersonalToken{}, fmt.Errorf("failed to lock user: %w", err)
+	}
+	// Expired tokens would otherwise count towards the limit and hold on to their names until purged
+	if _, err := tx.ExecContext(ctx, "DELETE FROM personal_access_tokens WHERE user_id = $1 AND expires_at <= NOW()", userID); err != nil {
+		return "", models.PersonalToken{}, fmt.Errorf("failed to remove expired personal tokens: %w", err)
+	}
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM personal_access_tokens WHERE user_id = $1", userID).Scan(&count)
+	if err != nil {
+		return "", models.PersonalToken{}, fmt.Errorf("failed to count personal tokens: %w", err)
+	}
+	if count >= constants.MaxPersonalTokens {
+		return "", models.PersonalToken{}, ErrTooManyPersonalTokens
+	}
+
+	pt := models.PersonalToken{Name: name, Prefix: token[:personalTokenPrefixLength], Scopes: scopes}
+	var expiresAt, createdAt time.Time
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, NOW() + make_interval(days => $6))
+		 RETURNING id, expires_at, created_at`,
+		userID, name, hashToken(token), pt.Prefix, strings.Join(scopes, " "), days).Scan(&pt.ID, &expiresAt, &createdAt)
+	if err != nil {
+		if utils.IsPgError(err, utils.PgUniqueViolation) {
+			return "", models.PersonalToken{}, ErrPersonalTokenExists
+		}
+		return "", models.PersonalToken{}, fmt.Errorf("failed to store personal token: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", models.PersonalToken{}, fmt.Errorf("failed to commit personal token: %w", err)
+	}
+
+	pt.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	pt.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	utils.LogInfo("Personal access token created", "userID", userID, "tokenID", pt.ID, "scopes", pt.Scopes)
+	return token, pt, nil
+}
+
+// ListPersonalTokens returns the user's unexpired personal access tokens, newest first.
+func ListPersonalTokens(ctx context.Context, db *sql.DB, userID int) ([]models.PersonalToken, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+		 FROM personal_access_tokens
+		 WHERE user_id = $1 AND expires_at > NOW()
+		 ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query personal tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []models.PersonalToken{}
+	for rows.Next() {
+		var pt models.PersonalToken
+		var scopes string
+		var expiresAt, createdAt time.Time
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&pt.ID, &pt.Name, &pt.Prefix, &scopes, &expiresAt, &lastUsed, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan personal token: %w", err)
+		}
+		pt.Scopes = strings.Fields(scopes)
+		pt.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+		pt.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		if lastUsed.Valid {
+			s := lastUsed.Time.UTC().Format(time.RFC3339)
+			pt.LastUsedAt = &s
+		}
+		tokens = append(tokens, pt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating personal tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// DeletePersonalToken revokes one of the user's personal access tokens.
+func DeletePersonalToken(ctx context.Context, db *sql.DB, userID, tokenID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		"DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2", tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete personal token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrPersonalTokenNotFound
+	}
+	utils.LogInfo("Personal access token revoked", "userID", userID, "tokenID", tokenID)
+	return nil
+}
+
+// LookupPersonalToken returns the user and scopes of a valid personal access token, and records
+// that it was used (at most every constants.PersonalTokenUseInterval). ok is false for unknown,
+// revoked or expired tokens.
+func LookupPersonalToken(ctx context.Context, db *sql.DB, token string) (userID int, scopes []string, ok bool, err error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var id int
+	var scopeList string
+	var lastUsed sql.NullTime
+	err = db.QueryRowContext(ctx,
+		`SELECT id, user_id, scopes, last_used_at FROM personal_access_tokens
+		 WHERE token_hash = $1 AND expires_at > NOW()`,
+		hashToken(token)).Scan(&id, &userID, &scopeList, &lastUsed)
+	if err == sql.ErrNoRows {
+		return 0, nil, false, nil
+	}
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("failed to look up personal token: %w", err)
+	}
+
+	if !lastUsed.Valid || time.Since(lastUsed.Time) >= constants.PersonalTokenUseInterval {
+		if _, err := db.ExecContext(ctx, "UPDATE personal_access_tokens SET last_used_at = NOW() WHERE id = $1", id); err != nil {
+			// Not worth failing the request over
+			utils.LogError("Failed to record personal token use", "error", err, "tokenID", id)
+		}
+	}
+	return userID, strings.Fields(scopeList), true, nil
+}
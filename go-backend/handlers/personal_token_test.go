@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "transactions:read", want: []string{"transactions:read"}},
+		{in: "transactions:read, budgets:read transactions:read", want: []string{"transactions:read", "budgets:read"}},
+		{in: " , ", wantErr: true},
+		{in: "transactions:read,admin", wantErr: true},
+		{in: "Transactions:Read", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseScopes(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseScopes(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseScopes(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
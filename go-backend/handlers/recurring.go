@@ -3,53 +3,139 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/rrule"
 	"github.com/vidya381/myspendo-backend/utils"
 )
 
+var (
+	// ErrRecurringNotFound is returned when a recurring transaction doesn't exist or belongs to another ledger.
+	ErrRecurringNotFound = errors.New("recurring transaction not found or unauthorized")
+	// ErrRecurringPaused is returned when skipping an occurrence of a paused recurring transaction.
+	ErrRecurringPaused = errors.New("recurring transaction is paused")
+	// ErrNoNextOccurrence is returned when a recurring transaction has no occurrence left to skip.
+	ErrNoNextOccurrence = errors.New("recurring transaction has no upcoming occurrence")
+	// ErrNotAnOccurrence is returned when an exception date isn't a future occurrence of the rule.
+	ErrNotAnOccurrence = errors.New("date is not an upcoming occurrence of the recurring transaction")
+	// ErrRecurringExceptionNotFound is returned when removing a date that isn't skipped.
+	ErrRecurringExceptionNotFound = errors.New("recurring exception not found")
+)
+
+// endOfTime bounds searches for a rule's next occurrence.
+var endOfTime = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// RecurrenceRule returns the schedule of a recurring transaction: its RRule when set,
+// otherwise the plain 'daily', 'weekly', 'monthly' or 'yearly' Recurrence.
+func RecurrenceRule(rt models.RecurringTransaction) (rrule.Rule, error) {
+	if rt.RRule != "" {
+		return rrule.Parse(rt.RRule)
+	}
+	freq, err := rrule.ParseFrequency(rt.Recurrence)
+	if err != nil {
+		return rrule.Rule{}, fmt.Errorf("recurrence must be daily, weekly, monthly, or yearly")
+	}
+	return rrule.Simple(freq), nil
+}
+
 // AddRecurringTransaction creates a new recurring transaction that automatically generates transactions.
-// Validates that the recurrence is 'daily', 'weekly', 'monthly', or 'yearly' and that the category belongs to the user.
+// The schedule is an RRULE, or a recurrence of 'daily', 'weekly', 'monthly', or 'yearly', and the category must be in rt.LedgerID.
 // Recurring transactions are processed by a background job to create actual transactions.
+// An empty Currency defaults to the base currency of rt.UserID, who creates it, or to the account's currency
+// when AccountID names one; the currency must match the account's (ErrAccountCurrency otherwise).
 func AddRecurringTransaction(ctx context.Context, db *sql.DB, rt models.RecurringTransaction) error {
-	rec := strings.ToLower(rt.Recurrence)
-	if rec != "daily" && rec != "weekly" && rec != "monthly" && rec != "yearly" {
-		return fmt.Errorf("recurrence must be daily, weekly, monthly, or yearly")
+	rule, err := RecurrenceRule(rt)
+	if err != nil {
+		return err
 	}
 
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
+	if rt.AccountID != nil && *rt.AccountID == 0 {
+		rt.AccountID = nil
+	}
+	if rt.AccountID != nil {
+		currency, err := accountTransactionCurrency(ctx, db, rt.LedgerID, *rt.AccountID, rt.Currency)
+		if err != nil {
+			return err
+		}
+		rt.Currency = currency
+	}
+
 	// Verify category ownership before creating recurring transaction
-	if err := utils.VerifyCategoryOwnership(db, rt.UserID, rt.CategoryID); err != nil {
+	if err := utils.VerifyCategoryOwnership(db, rt.LedgerID, rt.CategoryID); err != nil {
 		return err
 	}
 
-	_, err := db.ExecContext(ctx,
+	if err := ensureConvertible(ctx, db, rt.LedgerID, rt.UserID, rt.Currency, rt.StartDate); err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx,
 		`INSERT INTO recurring_transactions
-		(user_id, category_id, amount, description, start_date, recurrence)
-		VALUES ($1, $2, $3, $4, $5, $6)`,
-		rt.UserID, rt.CategoryID, rt.Amount, rt.Description, rt.StartDate, rec)
+		(user_id, category_id, amount, currency, description, start_date, recurrence, rrule, ledger_id, account_id)
+		VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), (SELECT base_currency FROM users WHERE id = $1)), $5, $6, $7, $8, $9, $10)`,
+		rt.UserID, rt.CategoryID, rt.Amount, rt.Currency, rt.Description, rt.StartDate,
+		strings.ToLower(rule.Freq.String()), rule.String(), rt.LedgerID, rt.AccountID)
 	if err != nil {
 		return fmt.Errorf("failed to insert recurring transaction: %w", err)
 	}
 	return nil
 }
 
-// ListRecurringTransactions retrieves all recurring transactions for the specified user.
-// Includes information about when each recurring transaction was last processed.
-func ListRecurringTransactions(ctx context.Context, db *sql.DB, userID int) ([]models.RecurringTransaction, error) {
+// recurringColumns selects a recurring transaction (aliased r) for scanRecurring, with its exception dates
+// as a comma-separated list.
+const recurringColumns = `r.id, r.ledger_id, r.user_id, r.category_id, r.amount, r.currency, r.description, r.start_date, r.recurrence, r.rrule, r.status,
+	(SELECT COALESCE(string_agg(to_char(e.date, 'YYYY-MM-DD'), ',' ORDER BY e.date), '')
+	 FROM recurring_exceptions e WHERE e.recurring_id = r.id),
+	r.last_occurrence, r.account_id, r.created_at`
+
+// scanRecurring scans the columns of recurringColumns, then any extra columns selected after them into extra.
+func scanRecurring(row interface{ Scan(...any) error }, extra ...any) (models.RecurringTransaction, error) {
+	var rt models.RecurringTransaction
+	var startDate, createdAt time.Time
+	var exceptions string
+	var lastOccurrence sql.NullTime
+	var accountID sql.NullInt64
+	dest := []any{&rt.ID, &rt.LedgerID, &rt.UserID, &rt.CategoryID, &rt.Amount, &rt.Currency, &rt.Description, &startDate,
+		&rt.Recurrence, &rt.RRule, &rt.Status, &exceptions, &lastOccurrence, &accountID, &createdAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return rt, err
+	}
+	rt.StartDate = startDate.Format("2006-01-02")
+	rt.Exceptions = []string{}
+	if exceptions != "" {
+		rt.Exceptions = strings.Split(exceptions, ",")
+	}
+	if lastOccurrence.Valid {
+		rt.LastOccurrence = &lastOccurrence.Time
+	}
+	if accountID.Valid {
+		id := int(accountID.Int64)
+		rt.AccountID = &id
+	}
+	rt.CreatedAt = createdAt.Format("2006-01-02")
+	return rt, nil
+}
+
+// ListRecurringTransactions retrieves all recurring transactions in the specified ledger.
+// Includes information about when each recurring transaction was last processed, its skipped dates,
+// and the next date it will create a transaction for (none while paused or once the rule has ended).
+func ListRecurringTransactions(ctx context.Context, db *sql.DB, ledgerID int) ([]models.RecurringTransaction, error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
 	rows, err := db.QueryContext(ctx,
-		`SELECT id, user_id, category_id, amount, description, start_date, recurrence, last_occurrence, created_at
-		 FROM recurring_transactions
-		 WHERE user_id = $1
-		 ORDER BY start_date DESC`, userID)
+		`SELECT `+recurringColumns+`
+		 FROM recurring_transactions r
+		 WHERE r.ledger_id = $1
+		 ORDER BY r.start_date DESC`, ledgerID)
 	if err != nil {
 		return nil, err
 	}
@@ -58,54 +144,111 @@ func ListRecurringTransactions(ctx context.Context, db *sql.DB, userID int) ([]m
 	// Pre-allocate for typical number of recurring transactions (5-20)
 	list := make([]models.RecurringTransaction, 0, 10)
 	for rows.Next() {
-		var rt models.RecurringTransaction
-		var lastOccurrence sql.NullTime
-		var createdAt time.Time
-		err := rows.Scan(&rt.ID, &rt.UserID, &rt.CategoryID, &rt.Amount, &rt.Description, &rt.StartDate, &rt.Recurrence, &lastOccurrence, &createdAt)
+		rt, err := scanRecurring(rows)
 		if err != nil {
 			return nil, err
 		}
-		if lastOccurrence.Valid {
-			rt.LastOccurrence = &lastOccurrence.Time
-		} else {
-			rt.LastOccurrence = nil
+		if rt.Status == models.RecurringActive {
+			if next, err := RecurringOccurrences(rt, endOfTime, 1); err == nil && len(next) > 0 {
+				due := next[0].Format("2006-01-02")
+				rt.NextDue = &due
+			}
 		}
-		rt.CreatedAt = createdAt.Format("2006-01-02")
 		list = append(list, rt)
 	}
-	return list, nil
+	return list, rows.Err()
 }
 
-// EditRecurringTransaction updates an existing recurring transaction's amount, description, start date, and recurrence.
-// Verifies that the recurring transaction belongs to the user before updating.
-// Returns an error if the transaction doesn't exist or belongs to another user.
-func EditRecurringTransaction(ctx context.Context, db *sql.DB, userID, id int, amount float64, description, startDate, recurrence string) error {
+// getRecurringTransaction loads one of the ledger's recurring transactions.
+// Returns ErrRecurringNotFound if it isn't in the ledger.
+func getRecurringTransaction(ctx context.Context, q queryer, ledgerID, id int) (models.RecurringTransaction, error) {
+	rt, err := scanRecurring(q.QueryRowContext(ctx,
+		`SELECT `+recurringColumns+` FROM recurring_transactions r WHERE r.id = $1 AND r.ledger_id = $2`, id, ledgerID))
+	if err == sql.ErrNoRows {
+		return rt, ErrRecurringNotFound
+	}
+	if err != nil {
+		return rt, fmt.Errorf("failed to load recurring transaction: %w", err)
+	}
+	return rt, nil
+}
+
+// EditRecurringTransaction updates an existing recurring transaction's amount, currency, description, start date, and schedule.
+// The schedule is rule (an RRULE) when given, otherwise recurrence.
+// Verifies that the recurring transaction is in the ledger before updating. An empty currency keeps the current one,
+// any other needs an exchange rate to the base currency of userID, who makes the change. A nil accountID keeps
+// the current account and 0 takes the rule off its account; the currency must match the account's
+// (ErrAccountCurrency otherwise).
+// Returns an error if the transaction doesn't exist or belongs to another ledger.
+func EditRecurringTransaction(ctx context.Context, db *sql.DB, ledgerID, userID, id int, amount models.Money, currency, description, startDate, recurrence, rule string, accountID *int) error {
+	schedule, err := RecurrenceRule(models.RecurringTransaction{Recurrence: recurrence, RRule: rule})
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
-	// Only allow update if user owns it
-	result, err := db.ExecContext(ctx,
+	if currency != "" {
+		if err := ensureConvertible(ctx, db, ledgerID, userID, currency, startDate); err != nil {
+			return err
+		}
+	}
+
+	if accountID != nil && *accountID > 0 {
+		if _, err := accountCurrency(ctx, db, ledgerID, *accountID); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only allow update within the ledger
+	result, err := tx.ExecContext(ctx,
 		`UPDATE recurring_transactions
-		 SET amount = $1, description = $2, start_date = $3, recurrence = $4
-		 WHERE id = $5 AND user_id = $6`,
-		amount, description, startDate, recurrence, id, userID)
+		 SET amount = $1, currency = COALESCE(NULLIF($2, ''), currency), description = $3, start_date = $4, recurrence = $5, rrule = $6,
+		     account_id = CASE WHEN $9::int IS NULL THEN account_id ELSE NULLIF($9::int, 0) END
+		 WHERE id = $7 AND ledger_id = $8`,
+		amount, currency, description, startDate, strings.ToLower(schedule.Freq.String()), schedule.String(), id, ledgerID, accountID)
 	if err != nil {
 		return fmt.Errorf("failed to update recurring transaction: %w", err)
 	}
 
 	// Check if any rows were actually updated
-	return utils.CheckRowsAffected(result, "recurring transaction")
+	if err := utils.CheckRowsAffected(result, "recurring transaction"); err != nil {
+		return err
+	}
+
+	// A recurring rule is in its account's currency
+	var mismatch bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM recurring_transactions r JOIN accounts a ON a.id = r.account_id
+		                WHERE r.id = $1 AND a.currency <> r.currency)`, id).Scan(&mismatch)
+	if err != nil {
+		return fmt.Errorf("failed to check account currency: %w", err)
+	}
+	if mismatch {
+		return ErrAccountCurrency
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
 // DeleteRecurringTransaction removes a recurring transaction from the database.
-// Returns an error if the transaction doesn't exist or belongs to another user.
+// Returns an error if the transaction doesn't exist or belongs to another ledger.
 // Note: This does not delete the transactions that were already created from this recurring rule.
-func DeleteRecurringTransaction(ctx context.Context, db *sql.DB, id, userID int) error {
+func DeleteRecurringTransaction(ctx context.Context, db *sql.DB, id, ledgerID int) error {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
 	result, err := db.ExecContext(ctx,
-		"DELETE FROM recurring_transactions WHERE id = $1 AND user_id = $2", id, userID)
+		"DELETE FROM recurring_transactions WHERE id = $1 AND ledger_id = $2", id, ledgerID)
 	if err != nil {
 		return fmt.Errorf("failed to delete recurring transaction: %w", err)
 	}
@@ -113,3 +256,220 @@ func DeleteRecurringTransaction(ctx context.Context, db *sql.DB, id, userID int)
 	// Check if any rows were actually deleted
 	return utils.CheckRowsAffected(result, "recurring transaction")
 }
+
+// RecurringOccurrences returns the dates a recurring transaction still has to create a transaction for,
+// up to until (inclusive) and at most limit of them: occurrences of its rule after the last occurrence,
+// without its exception dates. The status is not considered.
+func RecurringOccurrences(rt models.RecurringTransaction, until time.Time, limit int) ([]time.Time, error) {
+	rule, err := RecurrenceRule(rt)
+	if err != nil {
+		return nil, err
+	}
+	start, err := time.Parse("2006-01-02", rt.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date: %w", err)
+	}
+	skip := make(map[string]bool, len(rt.Exceptions))
+	for _, d := range rt.Exceptions {
+		skip[d] = true
+	}
+
+	var dates []time.Time
+	it := rule.Iter(start)
+	for len(dates) < limit {
+		d, ok := it.Next()
+		if !ok || d.After(until) {
+			break
+		}
+		if rt.LastOccurrence != nil && d.Format("2006-01-02") <= rt.LastOccurrence.Format("2006-01-02") {
+			continue
+		}
+		if skip[d.Format("2006-01-02")] {
+			continue
+		}
+		dates = append(dates, d)
+	}
+	return dates, nil
+}
+
+// isPendingOccurrence reports whether date is an occurrence of rt's rule that hasn't been created yet.
+func isPendingOccurrence(rt models.RecurringTransaction, date time.Time) (bool, error) {
+	rt.Exceptions = nil
+	dates, err := RecurringOccurrences(rt, date, 1<<30)
+	if err != nil {
+		return false, err
+	}
+	return len(dates) > 0 && dates[len(dates)-1].Equal(date), nil
+}
+
+// PauseRecurringTransaction stops a recurring transaction from creating transactions until it's resumed.
+// Returns ErrRecurringNotFound if it isn't in the ledger.
+func PauseRecurringTransaction(ctx context.Context, db *sql.DB, ledgerID, id int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		`UPDATE recurring_transactions SET status = $1 WHERE id = $2 AND ledger_id = $3`,
+		models.RecurringPaused, id, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to pause recurring transaction: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecurringNotFound
+	}
+	return nil
+}
+
+// ResumeRecurringTransaction reactivates a paused recurring transaction. Occurrences before today
+// that fell while it was paused are skipped rather than created. Resuming an active rule does nothing.
+// Returns ErrRecurringNotFound if it isn't in the ledger.
+func ResumeRecurringTransaction(ctx context.Context, db *sql.DB, ledgerID, id int, today time.Time) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rt, err := getRecurringTransaction(ctx, db, ledgerID, id)
+	if err != nil {
+		return err
+	}
+	if rt.Status != models.RecurringPaused {
+		return nil
+	}
+
+	// Move last_occurrence up to the latest occurrence before today so the processor doesn't catch up
+	rt.Exceptions = nil
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	var skipTo *string
+	missed, err := RecurringOccurrences(rt, today.AddDate(0, 0, -1), 1<<30)
+	if err != nil {
+		return err
+	}
+	if len(missed) > 0 {
+		last := missed[len(missed)-1].Format("2006-01-02")
+		skipTo = &last
+	}
+
+	result, err := db.ExecContext(ctx,
+		`UPDATE recurring_transactions
+		 SET status = $1, last_occurrence = GREATEST(last_occurrence, $2::date)
+		 WHERE id = $3 AND ledger_id = $4`,
+		models.RecurringActive, skipTo, id, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to resume recurring transaction: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecurringNotFound
+	}
+	return nil
+}
+
+// SkipNextRecurringOccurrence adds the next due date of a recurring transaction to its exceptions
+// and returns that date. Returns ErrRecurringPaused for a paused rule and ErrNoNextOccurrence
+// once the rule has ended.
+func SkipNextRecurringOccurrence(ctx context.Context, db *sql.DB, ledgerID, id int) (time.Time, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rt, err := getRecurringTransaction(ctx, db, ledgerID, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if rt.Status == models.RecurringPaused {
+		return time.Time{}, ErrRecurringPaused
+	}
+	next, err := RecurringOccurrences(rt, endOfTime, 1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(next) == 0 {
+		return time.Time{}, ErrNoNextOccurrence
+	}
+
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO recurring_exceptions (recurring_id, date) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		id, next[0].Format("2006-01-02"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to skip occurrence: %w", err)
+	}
+	return next[0], nil
+}
+
+// AddRecurringException skips one occurrence of a recurring transaction. The date must be an
+// occurrence that hasn't been created yet, otherwise ErrNotAnOccurrence is returned.
+func AddRecurringException(ctx context.Context, db *sql.DB, ledgerID, id int, date time.Time) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rt, err := getRecurringTransaction(ctx, db, ledgerID, id)
+	if err != nil {
+		return err
+	}
+	ok, err := isPendingOccurrence(rt, date)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotAnOccurrence
+	}
+
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO recurring_exceptions (recurring_id, date) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		id, date.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("failed to add recurring exception: %w", err)
+	}
+	return nil
+}
+
+// RemoveRecurringException stops skipping a date. A past date that is later than the last created
+// occurrence gets its transaction on the processor's next run.
+// Returns ErrRecurringExceptionNotFound if the ledger's recurring transaction doesn't skip that date.
+func RemoveRecurringException(ctx context.Context, db *sql.DB, ledgerID, id int, date time.Time) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		`DELETE FROM recurring_exceptions e
+		 USING recurring_transactions r
+		 WHERE e.recurring_id = r.id AND r.id = $1 AND r.ledger_id = $2 AND e.date = $3`,
+		id, ledgerID, date.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("failed to remove recurring exception: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRecurringExceptionNotFound
+	}
+	return nil
+}
+
+// ListRecurringJobRuns returns runs of the recurring transaction processor, most recent first.
+func ListRecurringJobRuns(ctx context.Context, db *sql.DB, limit, offset int) ([]models.RecurringJobRun, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, started_at, finished_at, rules_processed, transactions_created, failed_rules, error
+		 FROM recurring_job_runs
+		 ORDER BY started_at DESC, id DESC
+		 LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]models.RecurringJobRun, 0, limit)
+	for rows.Next() {
+		var run models.RecurringJobRun
+		var startedAt time.Time
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&run.ID, &startedAt, &finishedAt, &run.RulesProcessed, &run.TransactionsCreated, &run.FailedRules, &run.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan job run: %w", err)
+		}
+		run.StartedAt = startedAt.Format(time.RFC3339)
+		if finishedAt.Valid {
+			finished := finishedAt.Time.Format(time.RFC3339)
+			run.FinishedAt = &finished
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+func formatDates(dates []time.Time) []string {
+	out := make([]string, len(dates))
+	for i, d := range dates {
+		out[i] = d.Format("2006-01-02")
+	}
+	return out
+}
+
+func TestRecurringOccurrences(t *testing.T) {
+	last := mustParseDate("2025-02-01")
+	rt := models.RecurringTransaction{
+		StartDate:      "2025-01-01",
+		RRule:          "FREQ=MONTHLY;BYMONTHDAY=1,15",
+		LastOccurrence: &last,
+		Exceptions:     []string{"2025-03-01"},
+	}
+
+	got, err := RecurringOccurrences(rt, mustParseDate("2025-03-31"), 10)
+	if err != nil {
+		t.Fatalf("RecurringOccurrences: %v", err)
+	}
+	want := []string{"2025-02-15", "2025-03-15"}
+	if g := formatDates(got); strings.Join(g, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v (after the last occurrence, without the exception)", g, want)
+	}
+
+	if next, _ := RecurringOccurrences(rt, endOfTime, 1); len(next) != 1 || !next[0].Equal(mustParseDate("2025-02-15")) {
+		t.Errorf("next = %v, want 2025-02-15", next)
+	}
+}
+
+func TestRecurringOccurrencesLegacyRecurrence(t *testing.T) {
+	rt := models.RecurringTransaction{StartDate: "2025-01-31", Recurrence: "monthly"}
+	got, err := RecurringOccurrences(rt, mustParseDate("2025-04-30"), 10)
+	if err != nil {
+		t.Fatalf("RecurringOccurrences: %v", err)
+	}
+	want := []string{"2025-01-31", "2025-02-28", "2025-03-31", "2025-04-30"}
+	if g := formatDates(got); strings.Join(g, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", g, want)
+	}
+}
+
+func TestIsPendingOccurrence(t *testing.T) {
+	last := mustParseDate("2025-03-03")
+	rt := models.RecurringTransaction{StartDate: "2025-03-03", Recurrence: "weekly", LastOccurrence: &last}
+
+	tests := []struct {
+		date string
+		want bool
+	}{
+		{"2025-03-10", true},
+		{"2025-03-31", true},
+		{"2025-03-11", false}, // not a Monday
+		{"2025-03-03", false}, // already created
+	}
+	for _, tt := range tests {
+		got, err := isPendingOccurrence(rt, mustParseDate(tt.date))
+		if err != nil || got != tt.want {
+			t.Errorf("isPendingOccurrence(%s) = %v, %v; want %v", tt.date, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// Rule match types
+const (
+	RuleMatchContains = "contains"
+	RuleMatchRegex    = "regex"
+)
+
+var (
+	ErrRuleNotFound           = errors.New("rule not found or unauthorized")
+	ErrInvalidTransactionType = errors.New("type must be 'expense' or 'income'")
+)
+
+// ValidateRule checks a rule's match type, pattern, amount range and weekday.
+func ValidateRule(rule models.CategorizationRule) error {
+	switch rule.MatchType {
+	case RuleMatchContains, RuleMatchRegex:
+	default:
+		return fmt.Errorf("match_type must be '%s' or '%s'", RuleMatchContains, RuleMatchRegex)
+	}
+	if strings.TrimSpace(rule.Pattern) == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	if len(rule.Pattern) > constants.MaxRulePatternLength {
+		return fmt.Errorf("pattern must be %d characters or less", constants.MaxRulePatternLength)
+	}
+	if rule.MatchType == RuleMatchRegex {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+	}
+	if rule.MinAmount != nil && *rule.MinAmount < 0 || rule.MaxAmount != nil && *rule.MaxAmount < 0 {
+		return fmt.Errorf("amount bounds cannot be negative")
+	}
+	if rule.MinAmount != nil && rule.MaxAmount != nil && *rule.MinAmount > *rule.MaxAmount {
+		return fmt.Errorf("min_amount cannot be greater than max_amount")
+	}
+	if rule.Weekday != nil && (*rule.Weekday < 0 || *rule.Weekday > 6) {
+		return fmt.Errorf("weekday must be between 0 (Sunday) and 6 (Saturday)")
+	}
+	return nil
+}
+
+// ruleMatcher is a rule prepared for matching.
+type ruleMatcher struct {
+	rule  models.CategorizationRule
+	regex *regexp.Regexp // regex rules only
+}
+
+// newRuleMatchers prepares rules for matching, keeping their order. Regex rules are
+// compiled case-insensitively; rules whose pattern no longer compiles are skipped.
+func newRuleMatchers(rules []models.CategorizationRule) []ruleMatcher {
+	matchers := make([]ruleMatcher, 0, len(rules))
+	for _, rule := range rules {
+		m := ruleMatcher{rule: rule}
+		if rule.MatchType == RuleMatchRegex {
+			re, err := regexp.Compile("(?i)" + rule.Pattern)
+			if err != nil {
+				continue
+			}
+			m.regex = re
+		} else {
+			m.rule.Pattern = strings.ToLower(rule.Pattern)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers
+}
+
+// matches reports whether a transaction satisfies every condition of the rule.
+// description is the raw (unescaped) text and date is YYYY-MM-DD.
+func (m ruleMatcher) matches(description string, amount models.Money, date string) bool {
+	if m.rule.MinAmount != nil && amount < *m.rule.MinAmount {
+		return false
+	}
+	if m.rule.MaxAmount != nil && amount > *m.rule.MaxAmount {
+		return false
+	}
+	if m.rule.Weekday != nil {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil || int(t.Weekday()) != *m.rule.Weekday {
+			return false
+		}
+	}
+	if m.regex != nil {
+		return m.regex.MatchString(description)
+	}
+	return strings.Contains(strings.ToLower(description), m.rule.Pattern)
+}
+
+// matchRule returns the first rule (in priority order) whose category has type ctype and that
+// matches the transaction, or nil. Descriptions may be passed sanitized or raw.
+func matchRule(matchers []ruleMatcher, ctype, description string, amount models.Money, date string) *models.CategorizationRule {
+	description = html.UnescapeString(description)
+	for i := range matchers {
+		if matchers[i].rule.CategoryType == ctype && matchers[i].matches(description, amount, date) {
+			return &matchers[i].rule
+		}
+	}
+	return nil
+}
+
+// loadRuleMatchers loads the ledger's rules in evaluation order, ready for matchRule.
+func loadRuleMatchers(ctx context.Context, q queryer, ledgerID int) ([]ruleMatcher, error) {
+	rules, err := queryRules(ctx, q, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	return newRuleMatchers(rules), nil
+}
+
+func queryRules(ctx context.Context, q queryer, ledgerID int) ([]models.CategorizationRule, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT r.id, r.ledger_id, r.user_id, r.category_id, c.name, c.type, r.match_type, r.pattern,
+		        r.min_amount, r.max_amount, r.weekday, r.priority, r.created_at
+		 FROM categorization_rules r
+		 JOIN categories c ON c.id = r.category_id
+		 WHERE r.ledger_id = $1
+		 ORDER BY r.priority DESC, r.id`,
+		ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.CategorizationRule{}
+	for rows.Next() {
+		var rule models.CategorizationRule
+		if err := rows.Scan(&rule.ID, &rule.LedgerID, &rule.UserID, &rule.CategoryID, &rule.CategoryName, &rule.CategoryType,
+			&rule.MatchType, &rule.Pattern, &rule.MinAmount, &rule.MaxAmount, &rule.Weekday,
+			&rule.Priority, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rules: %w", err)
+	}
+	return rules, nil
+}
+
+// uncategorizedCategory returns the ID of the ledger's "Uncategorized" category of the given
+// type, creating it on behalf of the user if needed. It receives transactions that no rule matched.
+func uncategorizedCategory(ctx context.Context, q queryer, ledgerID, userID int, ctype string) (int, error) {
+	var id int
+	err := q.QueryRowContext(ctx,
+		`INSERT INTO categories (ledger_id, user_id, name, type) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (ledger_id, name, type) DO UPDATE SET name = EXCLUDED.name
+		 RETURNING id`,
+		ledgerID, userID, constants.UncategorizedCategoryName, ctype).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get uncategorized category: %w", err)
+	}
+	return id, nil
+}
+
+// resolveCategory picks the category for a transaction entered without one: the first
+// matching rule's category, or the ledger's "Uncategorized" category of that type.
+func resolveCategory(ctx context.Context, db *sql.DB, ledgerID, userID int, ctype, description string, amount models.Money, date string) (int, error) {
+	if ctype != "expense" && ctype != "income" {
+		return 0, ErrInvalidTransactionType
+	}
+	matchers, err := loadRuleMatchers(ctx, db, ledgerID)
+	if err != nil {
+		return 0, err
+	}
+	if rule := matchRule(matchers, ctype, description, amount, date); rule != nil {
+		return rule.CategoryID, nil
+	}
+	return uncategorizedCategory(ctx, db, ledgerID, userID, ctype)
+}
+
+// AddRule creates a categorization rule and returns its ID.
+// The category must be in rule.LedgerID (ErrCategoryNotFound otherwise); rule.UserID is who creates it.
+func AddRule(ctx context.Context, db *sql.DB, rule models.CategorizationRule) (int, error) {
+	if err := ValidateRule(rule); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var id int
+	err := db.QueryRowContext(ctx,
+		`INSERT INTO categorization_rules (ledger_id, user_id, category_id, match_type, pattern, min_amount, max_amount, weekday, priority)
+		 SELECT $1, $9, c.id, $3, $4, $5, $6, $7, $8 FROM categories c WHERE c.id = $2 AND c.ledger_id = $1
+		 RETURNING id`,
+		rule.LedgerID, rule.CategoryID, rule.MatchType, rule.Pattern, rule.MinAmount, rule.MaxAmount,
+		rule.Weekday, rule.Priority, rule.UserID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrCategoryNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert rule: %w", err)
+	}
+	return id, nil
+}
+
+// ListRules returns the ledger's rules in evaluation order.
+func ListRules(ctx context.Context, db *sql.DB, ledgerID int) ([]models.CategorizationRule, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	return queryRules(ctx, db, ledgerID)
+}
+
+// UpdateRule replaces every field of an existing rule.
+// Returns ErrRuleNotFound or ErrCategoryNotFound if either isn't in rule.LedgerID.
+func UpdateRule(ctx context.Context, db *sql.DB, rule models.CategorizationRule) error {
+	if err := ValidateRule(rule); err != nil {
+		return err
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	if err := utils.VerifyCategoryOwnership(db, rule.LedgerID, rule.CategoryID); err != nil {
+		if err.Error() == ErrCategoryNotFound.Error() {
+			return ErrCategoryNotFound
+		}
+		return err
+	}
+
+	result, err := db.ExecContext(ctx,
+		`UPDATE categorization_rules
+		 SET category_id = $3, match_type = $4, pattern = $5, min_amount = $6, max_amount = $7, weekday = $8, priority = $9
+		 WHERE id = $1 AND ledger_id = $2`,
+		rule.ID, rule.LedgerID, rule.CategoryID, rule.MatchType, rule.Pattern, rule.MinAmount, rule.MaxAmount,
+		rule.Weekday, rule.Priority)
+	if err != nil {
+		return fmt.Errorf("failed to update rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// DeleteRule removes a rule from the ledger.
+func DeleteRule(ctx context.Context, db *sql.DB, ledgerID, ruleID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		"DELETE FROM categorization_rules WHERE id = $1 AND ledger_id = $2", ruleID, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// RuleChange is a category change proposed (or made) by re-running rules on a transaction.
+type RuleChange struct {
+	TransactionID    int          `json:"transaction_id"`
+	Date             string       `json:"date"`
+	Amount           models.Money `json:"amount"`
+	Description      string       `json:"description"`
+	RuleID           int          `json:"rule_id"`
+	FromCategoryID   int          `json:"from_category_id"`
+	FromCategoryName string       `json:"from_category_name"`
+	ToCategoryID     int          `json:"to_category_id"`
+	ToCategoryName   string       `json:"to_category_name"`
+}
+
+// ApplyRules re-runs the ledger's rules over existing transactions. With no transactionIDs it
+// covers every transaction in the ledger's "Uncategorized" categories; otherwise only the given
+// transactions (IDs belonging to other ledgers are ignored). Rules only move a transaction to a
+// category of the same type. With dryRun the changes are computed but not saved.
+func ApplyRules(ctx context.Context, db *sql.DB, ledgerID int, transactionIDs []int, dryRun bool) ([]RuleChange, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	matchers, err := loadRuleMatchers(ctx, tx, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT t.id, to_char(t.date, 'YYYY-MM-DD'), t.amount, COALESCE(t.description, ''), t.category_id, c.name, c.type
+		 FROM transactions t
+		 JOIN categories c ON c.id = t.category_id
+		 WHERE t.ledger_id = $1 AND `
+	args := []any{ledgerID}
+	if len(transactionIDs) == 0 {
+		query += "c.name = $2"
+		args = append(args, constants.UncategorizedCategoryName)
+	} else {
+		query += "t.id = ANY($2)"
+		args = append(args, transactionIDs)
+	}
+	query += " ORDER BY t.date, t.id FOR UPDATE OF t"
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	changes := []RuleChange{}
+	for rows.Next() {
+		var change RuleChange
+		var ctype string
+		if err := rows.Scan(&change.TransactionID, &change.Date, &change.Amount, &change.Description,
+			&change.FromCategoryID, &change.FromCategoryName, &ctype); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		rule := matchRule(matchers, ctype, change.Description, change.Amount, change.Date)
+		if rule == nil || rule.CategoryID == change.FromCategoryID {
+			continue
+		}
+		change.RuleID = rule.ID
+		change.ToCategoryID = rule.CategoryID
+		change.ToCategoryName = rule.CategoryName
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("failed to iterate transactions: %w", err)
+	}
+	rows.Close()
+
+	if dryRun {
+		return changes, nil
+	}
+	for _, change := range changes {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE transactions SET category_id = $1 WHERE id = $2 AND ledger_id = $3",
+			change.ToCategoryID, change.TransactionID, ledgerID); err != nil {
+			return nil, fmt.Errorf("failed to recategorize transaction %d: %w", change.TransactionID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit rule changes: %w", err)
+	}
+	return changes, nil
+}
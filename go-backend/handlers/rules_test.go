@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+func moneyPtr(m models.Money) *models.Money { return &m }
+
+func TestValidateRule(t *testing.T) {
+	valid := models.CategorizationRule{MatchType: RuleMatchContains, Pattern: "coffee"}
+	if err := ValidateRule(valid); err != nil {
+		t.Errorf("unexpected error for a valid rule: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		rule models.CategorizationRule
+	}{
+		{name: "unknown match type", rule: models.CategorizationRule{MatchType: "prefix", Pattern: "a"}},
+		{name: "blank pattern", rule: models.CategorizationRule{MatchType: RuleMatchContains, Pattern: "  "}},
+		{name: "bad regex", rule: models.CategorizationRule{MatchType: RuleMatchRegex, Pattern: "(unclosed"}},
+		{name: "inverted range", rule: models.CategorizationRule{MatchType: RuleMatchContains, Pattern: "a", MinAmount: moneyPtr(500), MaxAmount: moneyPtr(100)}},
+		{name: "negative bound", rule: models.CategorizationRule{MatchType: RuleMatchContains, Pattern: "a", MinAmount: moneyPtr(-1)}},
+		{name: "weekday out of range", rule: models.CategorizationRule{MatchType: RuleMatchContains, Pattern: "a", Weekday: intPtr(7)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateRule(tt.rule); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	// Already in evaluation order: priority descending
+	matchers := newRuleMatchers([]models.CategorizationRule{
+		{ID: 1, CategoryID: 10, CategoryType: "expense", MatchType: RuleMatchRegex, Pattern: `^uber\s+eats`},
+		{ID: 2, CategoryID: 11, CategoryType: "expense", MatchType: RuleMatchContains, Pattern: "UBER"},
+		{ID: 3, CategoryID: 12, CategoryType: "expense", MatchType: RuleMatchContains, Pattern: "market", MaxAmount: moneyPtr(2000)},
+		{ID: 4, CategoryID: 13, CategoryType: "expense", MatchType: RuleMatchContains, Pattern: "market", Weekday: intPtr(6)},
+		{ID: 5, CategoryID: 20, CategoryType: "income", MatchType: RuleMatchContains, Pattern: "uber"},
+		{ID: 6, CategoryID: 14, CategoryType: "expense", MatchType: RuleMatchContains, Pattern: "m&m"},
+	})
+
+	tests := []struct {
+		name        string
+		ctype       string
+		description string
+		amount      models.Money
+		date        string
+		wantRule    int // 0 for no match
+	}{
+		{name: "regex beats lower priority", ctype: "expense", description: "Uber Eats order", amount: 2500, date: "2025-03-03", wantRule: 1},
+		{name: "contains is case-insensitive", ctype: "expense", description: "Trip with uber", amount: 1800, date: "2025-03-03", wantRule: 2},
+		{name: "within amount range", ctype: "expense", description: "Farmers Market", amount: 2000, date: "2025-03-03", wantRule: 3},
+		{name: "over range falls through to weekday rule", ctype: "expense", description: "Farmers Market", amount: 2001, date: "2025-03-08", wantRule: 4},
+		{name: "wrong weekday matches nothing", ctype: "expense", description: "Farmers Market", amount: 2001, date: "2025-03-07", wantRule: 0},
+		{name: "only rules of the same type", ctype: "income", description: "Uber Eats payout", amount: 9900, date: "2025-03-03", wantRule: 5},
+		{name: "sanitized description is unescaped", ctype: "expense", description: "M&amp;M store", amount: 300, date: "2025-03-03", wantRule: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := matchRule(matchers, tt.ctype, tt.description, tt.amount, tt.date)
+			got := 0
+			if rule != nil {
+				got = rule.ID
+			}
+			if got != tt.wantRule {
+				t.Errorf("matched rule %d, want %d", got, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestNewRuleMatchersSkipsInvalidRegex(t *testing.T) {
+	matchers := newRuleMatchers([]models.CategorizationRule{
+		{ID: 1, MatchType: RuleMatchRegex, Pattern: "(broken"},
+		{ID: 2, MatchType: RuleMatchContains, Pattern: "ok"},
+	})
+	if len(matchers) != 1 || matchers[0].rule.ID != 2 {
+		t.Errorf("got %d matchers, want only rule 2", len(matchers))
+	}
+}
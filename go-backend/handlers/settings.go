@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// GetMonthStartDay returns the day of the month the user's monthly, quarterly and yearly
+// budget periods and the current month summary start on (1 for calendar months).
+func GetMonthStartDay(ctx context.Context, db *sql.DB, userID int) (int, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	return monthStartDay(ctx, db, userID)
+}
+
+func monthStartDay(ctx context.Context, q queryer, userID int) (int, error) {
+	var day int
+	err := q.QueryRowContext(ctx, `SELECT month_start_day FROM users WHERE id = $1`, userID).Scan(&day)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("user not found")
+		}
+		return 0, fmt.Errorf("failed to query month start day: %w", err)
+	}
+	return day, nil
+}
+
+// SetMonthStartDay changes the day of the month the user's months start on (1-28).
+// Periods of the user's budgets that have already ended are recorded with the old boundaries first.
+func SetMonthStartDay(ctx context.Context, db *sql.DB, userID, day int) error {
+	if day < 1 || day > constants.MaxMonthStartDay {
+		return fmt.Errorf("month start day must be between 1 and %d", constants.MaxMonthStartDay)
+	}
+
+	if _, err := CloseUserBudgetPeriods(ctx, db, userID, time.Now()); err != nil {
+		return err
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE users SET month_start_day = $2 WHERE id = $1`, userID, day)
+	if err != nil {
+		return fmt.Errorf("failed to update month start day: %w", err)
+	}
+	return utils.CheckRowsAffected(result, "user")
+}
+
+// GetBalanceFloor returns the balance below which /forecast warns the user (0 unless set).
+func GetBalanceFloor(ctx context.Context, db *sql.DB, userID int) (models.Money, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var floor models.Money
+	err := db.QueryRowContext(ctx, `SELECT balance_floor FROM users WHERE id = $1`, userID).Scan(&floor)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("user not found")
+		}
+		return 0, fmt.Errorf("failed to query balance floor: %w", err)
+	}
+	return floor, nil
+}
+
+// SetBalanceFloor changes the balance below which /forecast warns the user. It may be negative
+// for accounts with an overdraft.
+func SetBalanceFloor(ctx context.Context, db *sql.DB, userID int, floor models.Money) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE users SET balance_floor = $2 WHERE id = $1`, userID, floor)
+	if err != nil {
+		return fmt.Errorf("failed to update balance floor: %w", err)
+	}
+	return utils.CheckRowsAffected(result, "user")
+}
+
+// GetTimezone returns the user's IANA time zone name.
+func GetTimezone(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var name string
+	err := db.QueryRowContext(ctx, `SELECT timezone FROM users WHERE id = $1`, userID).Scan(&name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("user not found")
+		}
+		return "", fmt.Errorf("failed to query time zone: %w", err)
+	}
+	return name, nil
+}
+
+// SetTimezone changes the user's time zone, which must be an IANA name such as "America/Los_Angeles".
+func SetTimezone(ctx context.Context, db *sql.DB, userID int, name string) error {
+	if _, err := utils.LoadTimezone(name); err != nil {
+		return err
+	}
+
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE users SET timezone = $2 WHERE id = $1`, userID, name)
+	if err != nil {
+		return fmt.Errorf("failed to update time zone: %w", err)
+	}
+	return utils.CheckRowsAffected(result, "user")
+}
+
+// UserLocation returns the user's time zone, used to decide which calendar day it is for them.
+func UserLocation(ctx context.Context, db *sql.DB, userID int) (*time.Location, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	return userLocation(ctx, db, userID)
+}
+
+func userLocation(ctx context.Context, q queryer, userID int) (*time.Location, error) {
+	var name string
+	err := q.QueryRowContext(ctx, `SELECT timezone FROM users WHERE id = $1`, userID).Scan(&name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to query time zone: %w", err)
+	}
+	return utils.LocationOrUTC(name), nil
+}
+
+// UserToday returns today's date in the user's time zone, as midnight UTC.
+func UserToday(ctx context.Context, db *sql.DB, userID int) (time.Time, error) {
+	loc, err := UserLocation(ctx, db, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return utils.TodayIn(loc), nil
+}
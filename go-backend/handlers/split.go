@@ -0,0 +1,753 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+var (
+	// ErrTransactionNotFound is returned when a transaction doesn't exist or belongs to another ledger.
+	ErrTransactionNotFound = errors.New("transaction not found or unauthorized")
+	// ErrSplitNotFound is returned when a transaction isn't split.
+	ErrSplitNotFound = errors.New("split not found")
+	// ErrSplitNotExpense is returned when splitting an income transaction.
+	ErrSplitNotExpense = errors.New("only expenses can be split")
+	// ErrSplitNotMember is returned when the payer or a participant isn't a member of the ledger.
+	ErrSplitNotMember = errors.New("split participant is not a ledger member")
+	// ErrSettlementNotFound is returned when a settlement doesn't exist or belongs to another ledger.
+	ErrSettlementNotFound = errors.New("settlement not found or unauthorized")
+	// ErrSplitTotal is wrapped by errors for exact amounts or percentages that don't add up.
+	ErrSplitTotal = errors.New("split doesn't add up")
+	// ErrSplitExactAmount is returned when changing the amount of an expense split by exact amounts.
+	ErrSplitExactAmount = errors.New("expense is split by exact amounts")
+	// ErrSettlementTransaction is returned when changing one of the transactions recording a settlement.
+	ErrSettlementTransaction = errors.New("transaction records a settlement")
+	// ErrNothingToSettle is returned when settling the full debt between two members who don't owe each other.
+	ErrNothingToSettle = errors.New("nothing to settle")
+)
+
+// SplitPart is a participant in a split and the weight their part is worked out from: 1 for equal
+// splits, cents for exact amounts, hundredths of a percent for percentages and the number of shares
+// for shares.
+type SplitPart struct {
+	UserID int
+	Weight int64
+}
+
+// ParseSplitParts reads the participants of a split. Equal splits take a comma-separated list of
+// user IDs ("5,9"); the other methods take user_id:value pairs ("5:60,9:40") where the value is an
+// amount, a percentage or a number of shares.
+func ParseSplitParts(method, s string) ([]SplitPart, error) {
+	if !validSplitMethod(method) {
+		return nil, fmt.Errorf("method must be one of: %s", strings.Join(models.SplitMethods, ", "))
+	}
+	fields := strings.Split(s, ",")
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("at least one participant is required")
+	}
+	if len(fields) > constants.MaxSplitParticipants {
+		return nil, fmt.Errorf("an expense can be split between at most %d participants", constants.MaxSplitParticipants)
+	}
+
+	seen := make(map[int]bool, len(fields))
+	parts := make([]SplitPart, 0, len(fields))
+	for _, f := range fields {
+		idText, value, hasValue := strings.Cut(strings.TrimSpace(f), ":")
+		userID, err := strconv.Atoi(strings.TrimSpace(idText))
+		if err != nil || userID <= 0 {
+			return nil, fmt.Errorf("invalid participant %q: expected a user ID", f)
+		}
+		if seen[userID] {
+			return nil, fmt.Errorf("user %d is listed more than once", userID)
+		}
+		seen[userID] = true
+
+		if method == models.SplitEqual {
+			if hasValue {
+				return nil, fmt.Errorf("equal splits take user IDs only, got %q", f)
+			}
+			parts = append(parts, SplitPart{UserID: userID, Weight: 1})
+			continue
+		}
+		if !hasValue {
+			return nil, fmt.Errorf("participant %d needs a value (user_id:value)", userID)
+		}
+		value = strings.TrimSpace(value)
+
+		var weight int64
+		switch method {
+		case models.SplitExact:
+			amount, err := models.ParseMoney(value)
+			if err != nil || amount <= 0 {
+				return nil, fmt.Errorf("amount for user %d must be a positive number with at most 2 decimal places", userID)
+			}
+			weight = int64(amount)
+		case models.SplitPercentage:
+			// Percentages have the same format as amounts, so hundredths of a percent are "cents"
+			pct, err := models.ParseMoney(value)
+			if err != nil || pct <= 0 || pct > 10000 {
+				return nil, fmt.Errorf("percentage for user %d must be between 0 and 100 with at most 2 decimal places", userID)
+			}
+			weight = int64(pct)
+		case models.SplitShares:
+			shares, err := strconv.Atoi(value)
+			if err != nil || shares < 1 || shares > constants.MaxSplitShares {
+				return nil, fmt.Errorf("shares for user %d must be a whole number between 1 and %d", userID, constants.MaxSplitShares)
+			}
+			weight = int64(shares)
+		}
+		parts = append(parts, SplitPart{UserID: userID, Weight: weight})
+	}
+	return parts, nil
+}
+
+func validSplitMethod(method string) bool {
+	for _, m := range models.SplitMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// splitAmounts works out each participant's part of amount. Exact amounts must add up to the
+// amount and percentages to 100.
+func splitAmounts(amount models.Money, method string, parts []SplitPart) ([]models.Money, error) {
+	var total int64
+	for _, p := range parts {
+		total += p.Weight
+	}
+	switch method {
+	case models.SplitExact:
+		if models.Money(total) != amount {
+			return nil, fmt.Errorf("%w: amounts add up to %s, not the expense's %s", ErrSplitTotal, models.Money(total), amount)
+		}
+	case models.SplitPercentage:
+		if total != 10000 {
+			return nil, fmt.Errorf("%w: percentages add up to %s, not 100", ErrSplitTotal, models.Money(total))
+		}
+	}
+	weights := make([]int64, len(parts))
+	for i, p := range parts {
+		weights[i] = p.Weight
+	}
+	return allocate(amount, weights), nil
+}
+
+// allocate divides amount in proportion to weights. Each part is rounded down to the cent and
+// the cents left over go to the parts that lost the most to rounding (the earliest on ties),
+// so the parts always add up to amount.
+func allocate(amount models.Money, weights []int64) []models.Money {
+	parts := make([]models.Money, len(weights))
+	var sum int64
+	for _, w := range weights {
+		sum += w
+	}
+	if sum <= 0 {
+		return parts
+	}
+
+	// amount * weight can overflow int64 for exact amounts, so the products are big.Ints
+	total := big.NewInt(sum)
+	remainders := make([]*big.Int, len(weights))
+	var allocated models.Money
+	for i, w := range weights {
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(w)), total, new(big.Int))
+		parts[i] = models.Money(q.Int64())
+		remainders[i] = r
+		allocated += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+	for i := 0; allocated < amount; i++ {
+		parts[order[i%len(order)]]++
+		allocated++
+	}
+	return parts
+}
+
+// SetSplit splits an expense in the ledger between members, replacing any earlier split of it.
+// paidBy is the member who paid. Returns ErrTransactionNotFound, ErrSplitNotExpense,
+// ErrSplitNotMember, or an error wrapping ErrSplitTotal if exact amounts or percentages don't add up.
+func SetSplit(ctx context.Context, db *sql.DB, ledgerID, transactionID, paidBy int, method string, parts []SplitPart) (models.ExpenseSplit, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ExpenseSplit{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var amount models.Money
+	var categoryType string
+	err = tx.QueryRowContext(ctx,
+		`SELECT t.amount, c.type FROM transactions t
+		 JOIN categories c ON c.id = t.category_id
+		 WHERE t.id = $1 AND t.ledger_id = $2
+		 FOR UPDATE OF t`,
+		transactionID, ledgerID).Scan(&amount, &categoryType)
+	if err == sql.ErrNoRows {
+		return models.ExpenseSplit{}, ErrTransactionNotFound
+	}
+	if err != nil {
+		return models.ExpenseSplit{}, fmt.Errorf("failed to query transaction: %w", err)
+	}
+	if categoryType != "expense" {
+		return models.ExpenseSplit{}, ErrSplitNotExpense
+	}
+
+	amounts, err := splitAmounts(amount, method, parts)
+	if err != nil {
+		return models.ExpenseSplit{}, err
+	}
+
+	userIDs := []int{paidBy}
+	for _, p := range parts {
+		if p.UserID != paidBy {
+			userIDs = append(userIDs, p.UserID)
+		}
+	}
+	var members int
+	err = tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM ledger_members WHERE ledger_id = $1 AND user_id = ANY($2::int[])",
+		ledgerID, userIDs).Scan(&members)
+	if err != nil {
+		return models.ExpenseSplit{}, fmt.Errorf("failed to check ledger members: %w", err)
+	}
+	if members != len(userIDs) {
+		return models.ExpenseSplit{}, ErrSplitNotMember
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM expense_splits WHERE transaction_id = $1", transactionID); err != nil {
+		return models.ExpenseSplit{}, fmt.Errorf("failed to replace split: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO expense_splits (transaction_id, paid_by, method) VALUES ($1, $2, $3)",
+		transactionID, paidBy, method); err != nil {
+		return models.ExpenseSplit{}, fmt.Errorf("failed to insert split: %w", err)
+	}
+	for i, p := range parts {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO expense_split_shares (transaction_id, user_id, weight, amount) VALUES ($1, $2, $3, $4)",
+			transactionID, p.UserID, p.Weight, amounts[i]); err != nil {
+			return models.ExpenseSplit{}, fmt.Errorf("failed to insert split share: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ExpenseSplit{}, fmt.Errorf("failed to commit split: %w", err)
+	}
+
+	utils.LogInfo("Expense split", "ledgerID", ledgerID, "transactionID", transactionID, "method", method, "participants", len(parts))
+	return GetSplit(ctx, db, ledgerID, transactionID)
+}
+
+// resplitExpense works a split expense's parts out again after the expense changed. A split
+// keeps its weights, so parts stay in the same proportions; an expense moved to an income
+// category is no longer split. The amounts of an exact split were given by the user and are
+// not rescaled: changing the expense's amount returns ErrSplitExactAmount until the split is
+// set again or removed.
+func resplitExpense(ctx context.Context, tx *sql.Tx, transactionID int) error {
+	var amount, splitTotal models.Money
+	var method, categoryType string
+	err := tx.QueryRowContext(ctx,
+		`SELECT t.amount, e.method, c.type,
+			(SELECT COALESCE(SUM(s.amount), 0) FROM expense_split_shares s WHERE s.transaction_id = e.transaction_id)
+		 FROM expense_splits e
+		 JOIN transactions t ON t.id = e.transaction_id
+		 JOIN categories c ON c.id = t.category_id
+		 WHERE e.transaction_id = $1`, transactionID).Scan(&amount, &method, &categoryType, &splitTotal)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query split: %w", err)
+	}
+	if categoryType != "expense" {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM expense_splits WHERE transaction_id = $1", transactionID); err != nil {
+			return fmt.Errorf("failed to remove split: %w", err)
+		}
+		return nil
+	}
+	if method == models.SplitExact {
+		if amount != splitTotal {
+			return ErrSplitExactAmount
+		}
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT user_id, weight FROM expense_split_shares WHERE transaction_id = $1 ORDER BY user_id", transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to query split shares: %w", err)
+	}
+	var userIDs []int
+	var weights []int64
+	for rows.Next() {
+		var userID int
+		var weight int64
+		if err := rows.Scan(&userID, &weight); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan split share: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+		weights = append(weights, weight)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating split shares: %w", err)
+	}
+
+	for i, part := range allocate(amount, weights) {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE expense_split_shares SET amount = $3 WHERE transaction_id = $1 AND user_id = $2",
+			transactionID, userIDs[i], part); err != nil {
+			return fmt.Errorf("failed to update split share: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetSplit returns how an expense in the ledger is split. Returns ErrSplitNotFound if it isn't.
+func GetSplit(ctx context.Context, db *sql.DB, ledgerID, transactionID int) (models.ExpenseSplit, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	s := models.ExpenseSplit{TransactionID: transactionID, Shares: []models.SplitShare{}}
+	var createdAt time.Time
+	err := db.QueryRowContext(ctx,
+		`SELECT e.paid_by, e.method, t.amount, t.currency, e.created_at
+		 FROM expense_splits e
+		 JOIN transactions t ON t.id = e.transaction_id
+		 WHERE e.transaction_id = $1 AND t.ledger_id = $2`,
+		transactionID, ledgerID).Scan(&s.PaidBy, &s.Method, &s.Amount, &s.Currency, &createdAt)
+	if err == sql.ErrNoRows {
+		return s, ErrSplitNotFound
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to query split: %w", err)
+	}
+	s.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT s.user_id, u.username, s.weight, s.amount
+		 FROM expense_split_shares s
+		 JOIN users u ON u.id = s.user_id
+		 WHERE s.transaction_id = $1
+		 ORDER BY s.amount DESC, s.user_id`, transactionID)
+	if err != nil {
+		return s, fmt.Errorf("failed to query split shares: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var share models.SplitShare
+		var weight int64
+		if err := rows.Scan(&share.UserID, &share.Username, &weight, &share.Amount); err != nil {
+			return s, fmt.Errorf("failed to scan split share: %w", err)
+		}
+		describeSplitShare(&share, s.Method, weight)
+		s.Shares = append(s.Shares, share)
+	}
+	if err := rows.Err(); err != nil {
+		return s, fmt.Errorf("error iterating split shares: %w", err)
+	}
+	return s, nil
+}
+
+// describeSplitShare fills in the percentage or number of shares a part was given as, from its
+// stored weight. Exact amounts are the part's amount, and equal parts have nothing to add.
+func describeSplitShare(share *models.SplitShare, method string, weight int64) {
+	switch method {
+	case models.SplitPercentage:
+		// Hundredths of a percent are stored like cents
+		share.Percentage = models.Money(weight).String()
+	case models.SplitShares:
+		share.Shares = int(weight)
+	}
+}
+
+// DeleteSplit stops an expense from being split. Returns ErrSplitNotFound if it isn't.
+func DeleteSplit(ctx context.Context, db *sql.DB, ledgerID, transactionID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		`DELETE FROM expense_splits e USING transactions t
+		 WHERE e.transaction_id = $1 AND t.id = e.transaction_id AND t.ledger_id = $2`,
+		transactionID, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete split: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSplitNotFound
+	}
+	return nil
+}
+
+// netDebts nets amounts owed in both directions between each pair of members, per currency.
+// The result is sorted by currency, then debtor and creditor.
+func netDebts(owed []models.Debt) []models.Debt {
+	type pair struct {
+		a, b     int // a < b
+		currency string
+	}
+	balances := make(map[pair]models.Money) // positive when a owes b
+	names := make(map[int]string)
+	for _, d := range owed {
+		names[d.FromUserID], names[d.ToUserID] = d.FromUsername, d.ToUsername
+		if d.FromUserID < d.ToUserID {
+			balances[pair{d.FromUserID, d.ToUserID, d.Currency}] += d.Amount
+		} else {
+			balances[pair{d.ToUserID, d.FromUserID, d.Currency}] -= d.Amount
+		}
+	}
+
+	debts := []models.Debt{}
+	for p, amount := range balances {
+		switch {
+		case amount > 0:
+			debts = append(debts, models.Debt{FromUserID: p.a, ToUserID: p.b, Amount: amount, Currency: p.currency})
+		case amount < 0:
+			debts = append(debts, models.Debt{FromUserID: p.b, ToUserID: p.a, Amount: -amount, Currency: p.currency})
+		}
+	}
+	for i := range debts {
+		debts[i].FromUsername, debts[i].ToUsername = names[debts[i].FromUserID], names[debts[i].ToUserID]
+	}
+	sortDebts(debts)
+	return debts
+}
+
+// simplifyDebts replaces debts with as few payments as the greedy method finds that leave
+// everyone even: in each currency the member who owes the most pays the member owed the most,
+// until nobody owes anything. That takes at most one payment fewer than the number of members
+// involved.
+func simplifyDebts(debts []models.Debt) []models.Debt {
+	type member struct {
+		currency string
+		userID   int
+	}
+	net := make(map[member]models.Money) // positive when owed
+	names := make(map[int]string)
+	var currencies []string
+	for _, d := range debts {
+		currencies = append(currencies, d.Currency)
+		names[d.FromUserID], names[d.ToUserID] = d.FromUsername, d.ToUsername
+		net[member{d.Currency, d.FromUserID}] -= d.Amount
+		net[member{d.Currency, d.ToUserID}] += d.Amount
+	}
+
+	// largest picks the member with the largest balance of the given sign (lowest user ID on ties)
+	largest := func(currency string, sign models.Money) (int, models.Money) {
+		best, bestAmount := 0, models.Money(0)
+		for m, amount := range net {
+			amount *= sign
+			if m.currency == currency && amount > 0 &&
+				(amount > bestAmount || (amount == bestAmount && m.userID < best)) {
+				best, bestAmount = m.userID, amount
+			}
+		}
+		return best, bestAmount
+	}
+
+	payments := []models.Debt{}
+	for _, currency := range uniqueSorted(currencies) {
+		for {
+			debtor, owes := largest(currency, -1)
+			creditor, owed := largest(currency, 1)
+			if owes == 0 || owed == 0 {
+				break
+			}
+			amount := min(owes, owed)
+			payments = append(payments, models.Debt{
+				FromUserID: debtor, FromUsername: names[debtor],
+				ToUserID: creditor, ToUsername: names[creditor],
+				Amount: amount, Currency: currency,
+			})
+			net[member{currency, debtor}] += amount
+			net[member{currency, creditor}] -= amount
+		}
+	}
+	return payments
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+func sortDebts(debts []models.Debt) {
+	sort.Slice(debts, func(i, j int) bool {
+		a, b := debts[i], debts[j]
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		if a.FromUserID != b.FromUserID {
+			return a.FromUserID < b.FromUserID
+		}
+		return a.ToUserID < b.ToUserID
+	})
+}
+
+// ledgerDebts returns what members of the ledger owe each other: their parts of split expenses
+// paid by someone else, less what they have paid back in settlements.
+func ledgerDebts(ctx context.Context, q queryer, ledgerID int) ([]models.Debt, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT d.debtor, du.username, d.creditor, cu.username, d.currency, SUM(d.amount)
+		 FROM (
+			SELECT s.user_id AS debtor, e.paid_by AS creditor, t.currency, s.amount
+			FROM expense_splits e
+			JOIN transactions t ON t.id = e.transaction_id
+			JOIN expense_split_shares s ON s.transaction_id = e.transaction_id
+			WHERE t.ledger_id = $1 AND s.user_id <> e.paid_by
+			UNION ALL
+			-- Paying someone back works like them now owing you
+			SELECT to_user_id, from_user_id, currency, amount FROM settlements WHERE ledger_id = $1
+		 ) d
+		 JOIN users du ON du.id = d.debtor
+		 JOIN users cu ON cu.id = d.creditor
+		 GROUP BY d.debtor, du.username, d.creditor, cu.username, d.currency`, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query debts: %w", err)
+	}
+	defer rows.Close()
+
+	var owed []models.Debt
+	for rows.Next() {
+		var d models.Debt
+		if err := rows.Scan(&d.FromUserID, &d.FromUsername, &d.ToUserID, &d.ToUsername, &d.Currency, &d.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan debt: %w", err)
+		}
+		owed = append(owed, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating debts: %w", err)
+	}
+	return netDebts(owed), nil
+}
+
+// GetSplitBalances returns who owes whom in the ledger, per pair of members and currency, and
+// the fewest payments found that would settle everything.
+func GetSplitBalances(ctx context.Context, db *sql.DB, ledgerID int) (balances, settleUp []models.Debt, err error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	balances, err = ledgerDebts(ctx, db, ledgerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return balances, simplifyDebts(balances), nil
+}
+
+// AddSettlement records a payment from s.FromUserID to s.ToUserID in s.LedgerID, made by
+// s.CreatedBy, and adds it to the ledger's history as an expense of the payer and an income of
+// the member paid, both in the ledger's "Settlements" categories. An empty Currency defaults to
+// the recording user's base currency. With full set, the amount is everything FromUserID owes
+// ToUserID in that currency (ErrNothingToSettle if that's nothing) and s.Amount is ignored.
+// Both users must be members of the ledger or still have split expenses in it (ErrSplitNotMember).
+// Returns ErrNoExchangeRate if the currency can't be converted to every member's base currency.
+func AddSettlement(ctx context.Context, db *sql.DB, s models.Settlement, full bool) (models.Settlement, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	for _, userID := range []int{s.FromUserID, s.ToUserID} {
+		var involved bool
+		err := db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM ledger_members WHERE ledger_id = $1 AND user_id = $2)
+			     OR EXISTS (SELECT 1 FROM expense_splits e
+			                JOIN transactions t ON t.id = e.transaction_id
+			                LEFT JOIN expense_split_shares s ON s.transaction_id = e.transaction_id AND s.user_id = $2
+			                WHERE t.ledger_id = $1 AND (e.paid_by = $2 OR s.user_id IS NOT NULL))`,
+			s.LedgerID, userID).Scan(&involved)
+		if err != nil {
+			return s, fmt.Errorf("failed to check settlement member: %w", err)
+		}
+		if !involved {
+			return s, ErrSplitNotMember
+		}
+	}
+
+	if s.Currency == "" {
+		currency, err := GetBaseCurrency(ctx, db, *s.CreatedBy)
+		if err != nil {
+			return s, err
+		}
+		s.Currency = currency
+	}
+	if err := ensureConvertible(ctx, db, s.LedgerID, *s.CreatedBy, s.Currency, s.Date); err != nil {
+		return s, err
+	}
+	if full {
+		debts, err := ledgerDebts(ctx, db, s.LedgerID)
+		if err != nil {
+			return s, err
+		}
+		s.Amount = 0
+		for _, d := range debts {
+			if d.FromUserID == s.FromUserID && d.ToUserID == s.ToUserID && d.Currency == s.Currency {
+				s.Amount = d.Amount
+			}
+		}
+		if s.Amount == 0 {
+			return s, ErrNothingToSettle
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return s, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var date, createdAt time.Time
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO settlements (ledger_id, from_user_id, to_user_id, amount, currency, date, note, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 RETURNING id, date, created_at`,
+		s.LedgerID, s.FromUserID, s.ToUserID, s.Amount, s.Currency, s.Date, s.Note, s.CreatedBy).
+		Scan(&s.ID, &date, &createdAt)
+	if err != nil {
+		return s, fmt.Errorf("failed to insert settlement: %w", err)
+	}
+	s.Date = date.Format("2006-01-02")
+	s.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+
+	var fromName, toName string
+	err = tx.QueryRowContext(ctx,
+		`SELECT (SELECT username FROM users WHERE id = $1), (SELECT username FROM users WHERE id = $2)`,
+		s.FromUserID, s.ToUserID).Scan(&fromName, &toName)
+	if err != nil {
+		return s, fmt.Errorf("failed to query settlement members: %w", err)
+	}
+	description := settlementDescription(fromName, toName, s.Note)
+	for _, side := range []struct {
+		ctype string
+		id    *int
+	}{{"expense", &s.ExpenseTransactionID}, {"income", &s.IncomeTransactionID}} {
+		categoryID, err := settlementCategory(ctx, tx, s.LedgerID, *s.CreatedBy, side.ctype)
+		if err != nil {
+			return s, err
+		}
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO transactions (user_id, ledger_id, category_id, amount, currency, description, date, settlement_id)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			*s.CreatedBy, s.LedgerID, categoryID, s.Amount, s.Currency, description, s.Date, s.ID).Scan(side.id)
+		if err != nil {
+			return s, fmt.Errorf("failed to insert settlement %s: %w", side.ctype, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return s, fmt.Errorf("failed to commit settlement: %w", err)
+	}
+
+	utils.LogInfo("Settlement recorded", "ledgerID", s.LedgerID, "settlementID", s.ID, "from", s.FromUserID, "to", s.ToUserID)
+	return s, nil
+}
+
+// settlementCategory returns the ID of the ledger's "Settlements" category of the given type,
+// creating it on behalf of the user if needed.
+func settlementCategory(ctx context.Context, q queryer, ledgerID, userID int, ctype string) (int, error) {
+	var id int
+	err := q.QueryRowContext(ctx,
+		`INSERT INTO categories (ledger_id, user_id, name, type) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (ledger_id, name, type) DO UPDATE SET name = EXCLUDED.name
+		 RETURNING id`,
+		ledgerID, userID, constants.SettlementCategoryName, ctype).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get settlements category: %w", err)
+	}
+	return id, nil
+}
+
+// settlementDescription describes the transactions of a settlement from one member to another.
+func settlementDescription(from, to, note string) string {
+	description := "Settlement from " + from + " to " + to
+	if note != "" {
+		description += ": " + note
+	}
+	return description
+}
+
+// ListSettlements returns the ledger's settlements, newest first.
+func ListSettlements(ctx context.Context, db *sql.DB, ledgerID int) ([]models.Settlement, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT s.id, s.ledger_id, s.from_user_id, s.to_user_id, s.amount, s.currency, s.date, s.note,
+			COALESCE((SELECT t.id FROM transactions t JOIN categories c ON c.id = t.category_id
+			          WHERE t.settlement_id = s.id AND c.type = 'expense' LIMIT 1), 0),
+			COALESCE((SELECT t.id FROM transactions t JOIN categories c ON c.id = t.category_id
+			          WHERE t.settlement_id = s.id AND c.type = 'income' LIMIT 1), 0),
+			s.created_by, s.created_at
+		 FROM settlements s
+		 WHERE s.ledger_id = $1
+		 ORDER BY s.date DESC, s.id DESC`, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settlements: %w", err)
+	}
+	defer rows.Close()
+
+	settlements := []models.Settlement{}
+	for rows.Next() {
+		var s models.Settlement
+		var createdBy sql.NullInt64
+		var date, createdAt time.Time
+		if err := rows.Scan(&s.ID, &s.LedgerID, &s.FromUserID, &s.ToUserID, &s.Amount, &s.Currency,
+			&date, &s.Note, &s.ExpenseTransactionID, &s.IncomeTransactionID, &createdBy, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan settlement: %w", err)
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			s.CreatedBy = &id
+		}
+		s.Date = date.Format("2006-01-02")
+		s.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		settlements = append(settlements, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating settlements: %w", err)
+	}
+	return settlements, nil
+}
+
+// DeleteSettlement removes a settlement recorded by mistake, with its transactions; what it paid
+// back is owed again.
+func DeleteSettlement(ctx context.Context, db *sql.DB, ledgerID, settlementID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx,
+		"DELETE FROM settlements WHERE id = $1 AND ledger_id = $2", settlementID, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete settlement: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSettlementNotFound
+	}
+	return nil
+}
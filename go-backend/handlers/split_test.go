@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+func TestParseSplitParts(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		input   string
+		want    []SplitPart
+		wantErr bool
+	}{
+		{name: "equal", method: models.SplitEqual, input: "5, 9", want: []SplitPart{{5, 1}, {9, 1}}},
+		{name: "exact", method: models.SplitExact, input: "5:30,9:15.50", want: []SplitPart{{5, 3000}, {9, 1550}}},
+		{name: "percentage", method: models.SplitPercentage, input: "5:66.67,9:33.33", want: []SplitPart{{5, 6667}, {9, 3333}}},
+		{name: "shares", method: models.SplitShares, input: "5:2,9:1", want: []SplitPart{{5, 2}, {9, 1}}},
+		{name: "unknown method", method: "half", input: "5,9", wantErr: true},
+		{name: "no participants", method: models.SplitEqual, input: " ", wantErr: true},
+		{name: "duplicate", method: models.SplitEqual, input: "5,5", wantErr: true},
+		{name: "value on equal", method: models.SplitEqual, input: "5:1", wantErr: true},
+		{name: "missing value", method: models.SplitShares, input: "5:2,9", wantErr: true},
+		{name: "zero amount", method: models.SplitExact, input: "5:0", wantErr: true},
+		{name: "three decimals", method: models.SplitExact, input: "5:1.005", wantErr: true},
+		{name: "over 100 percent", method: models.SplitPercentage, input: "5:100.01", wantErr: true},
+		{name: "fractional shares", method: models.SplitShares, input: "5:1.5", wantErr: true},
+		{name: "bad user ID", method: models.SplitEqual, input: "alex", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSplitParts(tt.method, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitAmounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  models.Money
+		method  string
+		parts   []SplitPart
+		want    []models.Money
+		wantErr bool
+	}{
+		{name: "equal even", amount: 9000, method: models.SplitEqual, parts: []SplitPart{{1, 1}, {2, 1}, {3, 1}}, want: []models.Money{3000, 3000, 3000}},
+		{name: "equal leftover cent", amount: 10000, method: models.SplitEqual, parts: []SplitPart{{1, 1}, {2, 1}, {3, 1}}, want: []models.Money{3334, 3333, 3333}},
+		{name: "exact", amount: 4550, method: models.SplitExact, parts: []SplitPart{{1, 3000}, {2, 1550}}, want: []models.Money{3000, 1550}},
+		{name: "exact mismatch", amount: 4500, method: models.SplitExact, parts: []SplitPart{{1, 3000}, {2, 1550}}, wantErr: true},
+		{name: "percentage", amount: 10000, method: models.SplitPercentage, parts: []SplitPart{{1, 6667}, {2, 3333}}, want: []models.Money{6667, 3333}},
+		{name: "percentage rounding", amount: 1001, method: models.SplitPercentage, parts: []SplitPart{{1, 5000}, {2, 5000}}, want: []models.Money{501, 500}},
+		{name: "percentage short", amount: 10000, method: models.SplitPercentage, parts: []SplitPart{{1, 5000}, {2, 4999}}, wantErr: true},
+		{name: "shares", amount: 9000, method: models.SplitShares, parts: []SplitPart{{1, 2}, {2, 1}}, want: []models.Money{6000, 3000}},
+		{name: "largest remainder wins", amount: 100, method: models.SplitShares, parts: []SplitPart{{1, 1}, {2, 2}}, want: []models.Money{33, 67}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitAmounts(tt.amount, tt.method, tt.parts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrSplitTotal) {
+					t.Fatalf("err = %v, want ErrSplitTotal", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocateLargeAmounts(t *testing.T) {
+	// An exact split of the largest amount must not overflow
+	amount := models.Money(100000000000)
+	got := allocate(amount, []int64{int64(amount) - 1, 1})
+	if got[0]+got[1] != amount || got[1] != 1 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestDescribeSplitShare(t *testing.T) {
+	tests := []struct {
+		method string
+		weight int64
+		want   models.SplitShare
+	}{
+		{models.SplitEqual, 1, models.SplitShare{}},
+		{models.SplitExact, 1550, models.SplitShare{}},
+		{models.SplitPercentage, 3333, models.SplitShare{Percentage: "33.33"}},
+		{models.SplitPercentage, 10000, models.SplitShare{Percentage: "100.00"}},
+		{models.SplitShares, 3, models.SplitShare{Shares: 3}},
+	}
+	for _, tt := range tests {
+		var got models.SplitShare
+		describeSplitShare(&got, tt.method, tt.weight)
+		if got != tt.want {
+			t.Errorf("describeSplitShare(%s, %d) = %+v, want %+v", tt.method, tt.weight, got, tt.want)
+		}
+	}
+}
+
+func TestSettlementDescription(t *testing.T) {
+	if got := settlementDescription("alex", "sam", ""); got != "Settlement from alex to sam" {
+		t.Errorf("without a note: got %q", got)
+	}
+	if got := settlementDescription("alex", "sam", "Ski trip"); got != "Settlement from alex to sam: Ski trip" {
+		t.Errorf("with a note: got %q", got)
+	}
+}
+
+func TestNetDebts(t *testing.T) {
+	owed := []models.Debt{
+		{FromUserID: 2, FromUsername: "sam", ToUserID: 1, ToUsername: "alex", Amount: 3000, Currency: "USD"},
+		{FromUserID: 1, FromUsername: "alex", ToUserID: 2, ToUsername: "sam", Amount: 1000, Currency: "USD"},
+		{FromUserID: 1, FromUsername: "alex", ToUserID: 2, ToUsername: "sam", Amount: 500, Currency: "EUR"},
+		{FromUserID: 3, FromUsername: "kim", ToUserID: 1, ToUsername: "alex", Amount: 700, Currency: "USD"},
+		{FromUserID: 1, FromUsername: "alex", ToUserID: 3, ToUsername: "kim", Amount: 700, Currency: "USD"},
+	}
+	want := []models.Debt{
+		{FromUserID: 1, FromUsername: "alex", ToUserID: 2, ToUsername: "sam", Amount: 500, Currency: "EUR"},
+		{FromUserID: 2, FromUsername: "sam", ToUserID: 1, ToUsername: "alex", Amount: 2000, Currency: "USD"},
+	}
+	if got := netDebts(owed); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSimplifyDebts(t *testing.T) {
+	debt := func(from, to int, amount models.Money) models.Debt {
+		return models.Debt{FromUserID: from, ToUserID: to, Amount: amount, Currency: "USD"}
+	}
+
+	// A chain: 1 owes 2 owes 3 the same amount, so 1 can pay 3 directly
+	got := simplifyDebts([]models.Debt{debt(1, 2, 1000), debt(2, 3, 1000)})
+	if want := []models.Debt{debt(1, 3, 1000)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chain: got %+v, want %+v", got, want)
+	}
+
+	// 1 and 2 each owe 3 and 4; the biggest debtor pays the biggest creditor first
+	got = simplifyDebts([]models.Debt{debt(1, 3, 3000), debt(1, 4, 1000), debt(2, 3, 1000), debt(2, 4, 3000)})
+	want := []models.Debt{debt(1, 3, 4000), debt(2, 4, 4000)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pairs: got %+v, want %+v", got, want)
+	}
+
+	// Currencies are settled separately
+	eur := debt(2, 1, 500)
+	eur.Currency = "EUR"
+	got = simplifyDebts([]models.Debt{debt(1, 2, 1000), eur})
+	if want := []models.Debt{eur, debt(1, 2, 1000)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("currencies: got %+v, want %+v", got, want)
+	}
+
+	if got := simplifyDebts(nil); len(got) != 0 {
+		t.Errorf("no debts: got %+v", got)
+	}
+}
@@ -7,45 +7,51 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/vidya381/myspendo-backend/models"
 	"github.com/vidya381/myspendo-backend/utils"
 )
 
-// GetTotals calculates the total expenses and income for the specified user across all time.
-// Returns two float64 values: total expenses and total income.
-func GetTotals(ctx context.Context, db *sql.DB, userID int) (expenses float64, income float64, err error) {
+// GetTotals calculates the total expenses and income in the specified ledger across all time.
+// Like every summary in this file, amounts are converted to the base currency of userID, the user
+// asking, using the exchange rate effective on each transaction's date. Transfers between accounts
+// aren't transactions, so no summary counts them as income or expense.
+// Returns two exact Money values: total expenses and total income.
+func GetTotals(ctx context.Context, db *sql.DB, ledgerID, userID int) (expenses models.Money, income models.Money, err error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
 	err = db.QueryRowContext(ctx,
 		`SELECT
-			COALESCE(SUM(CASE WHEN c.type = 'expense' THEN t.amount ELSE 0 END),0),
-			COALESCE(SUM(CASE WHEN c.type = 'income' THEN t.amount ELSE 0 END),0)
+			COALESCE(SUM(CASE WHEN c.type = 'expense' THEN convert_currency(t.amount, t.currency, u.base_currency, t.date) ELSE 0 END),0),
+			COALESCE(SUM(CASE WHEN c.type = 'income' THEN convert_currency(t.amount, t.currency, u.base_currency, t.date) ELSE 0 END),0)
 		FROM transactions t
 		JOIN categories c ON t.category_id = c.id
-		WHERE t.user_id = $1`, userID).Scan(&expenses, &income)
+		JOIN users u ON u.id = $2
+		WHERE t.ledger_id = $1`, ledgerID, userID).Scan(&expenses, &income)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to query totals: %w", err)
+		return 0, 0, conversionError("failed to query totals", err)
 	}
 	return expenses, income, nil
 }
 
-// GetMonthlyTotals retrieves monthly aggregated income and expense totals for the user.
+// GetMonthlyTotals retrieves monthly aggregated income and expense totals for the ledger.
 // Returns data grouped by month in descending order (most recent first).
-func GetMonthlyTotals(ctx context.Context, db *sql.DB, userID int) ([]map[string]interface{}, error) {
+func GetMonthlyTotals(ctx context.Context, db *sql.DB, ledgerID, userID int) ([]map[string]interface{}, error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
 	rows, err := db.QueryContext(ctx,
 		`SELECT DATE_TRUNC('month', t.date) as month,
-				COALESCE(SUM(CASE WHEN c.type = 'expense' THEN t.amount ELSE 0 END),0) as total_expenses,
-				COALESCE(SUM(CASE WHEN c.type = 'income' THEN t.amount ELSE 0 END),0) as total_income
+				COALESCE(SUM(CASE WHEN c.type = 'expense' THEN convert_currency(t.amount, t.currency, u.base_currency, t.date) ELSE 0 END),0) as total_expenses,
+				COALESCE(SUM(CASE WHEN c.type = 'income' THEN convert_currency(t.amount, t.currency, u.base_currency, t.date) ELSE 0 END),0) as total_income
 		 FROM transactions t
 		 JOIN categories c ON t.category_id = c.id
-		 WHERE t.user_id = $1
+		 JOIN users u ON u.id = $2
+		 WHERE t.ledger_id = $1
 		 GROUP BY month
-		 ORDER BY month DESC`, userID)
+		 ORDER BY month DESC`, ledgerID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query monthly totals: %w", err)
+		return nil, conversionError("failed to query monthly totals", err)
 	}
 	defer rows.Close()
 
@@ -53,9 +59,9 @@ func GetMonthlyTotals(ctx context.Context, db *sql.DB, userID int) ([]map[string
 	results := make([]map[string]interface{}, 0, 12)
 	for rows.Next() {
 		var month time.Time
-		var totalExpenses, totalIncome float64
+		var totalExpenses, totalIncome models.Money
 		if err := rows.Scan(&month, &totalExpenses, &totalIncome); err != nil {
-			return nil, fmt.Errorf("failed to scan monthly total row: %w", err)
+			return nil, conversionError("failed to scan monthly total row", err)
 		}
 		results = append(results, map[string]interface{}{
 			"month":          month.Format("2006-01"),
@@ -66,22 +72,23 @@ func GetMonthlyTotals(ctx context.Context, db *sql.DB, userID int) ([]map[string
 
 	// Check for any error that occurred during iteration
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating monthly totals: %w", err)
+		return nil, conversionError("error iterating monthly totals", err)
 	}
 
 	return results, nil
 }
 
-// GetCategoryBreakdown provides a breakdown of spending by category for the specified user.
+// GetCategoryBreakdown provides a breakdown of spending by category for the specified ledger.
 // Optionally filters by date range using 'from' and 'to' parameters (format: YYYY-MM-DD).
-// Returns data grouped by category and type, sorted by type and total amount.
-func GetCategoryBreakdown(ctx context.Context, db *sql.DB, userID int, from, to string) ([]map[string]interface{}, error) {
-	base := `SELECT c.name, c.type, COALESCE(SUM(t.amount),0) AS total
+// Child category spending is rolled up into parents. When tree is true the full hierarchy is
+// returned; otherwise only top-level categories, sorted by type and total amount.
+func GetCategoryBreakdown(ctx context.Context, db *sql.DB, ledgerID, userID int, from, to string, tree bool) ([]*CategoryNode, error) {
+	base := `SELECT t.category_id, COALESCE(SUM(convert_currency(t.amount, t.currency, u.base_currency, t.date)),0) AS total
 	 FROM transactions t
-	 JOIN categories c ON t.category_id = c.id
-	 WHERE t.user_id = $1`
-	params := []interface{}{userID}
-	paramIdx := 2
+	 JOIN users u ON u.id = $2
+	 WHERE t.ledger_id = $1`
+	params := []interface{}{ledgerID, userID}
+	paramIdx := 3
 	if from != "" {
 		base += fmt.Sprintf(" AND t.date >= $%d", paramIdx)
 		params = append(params, from)
@@ -92,44 +99,22 @@ func GetCategoryBreakdown(ctx context.Context, db *sql.DB, userID int, from, to
 		params = append(params, to)
 		paramIdx++
 	}
-	base += " GROUP BY c.name, c.type ORDER BY c.type, total DESC"
+	base += " GROUP BY t.category_id"
 
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
-	rows, err := db.QueryContext(ctx, base, params...)
+	result, err := categorySummary(ctx, db, ledgerID, tree, base, params...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query category breakdown: %w", err)
+		return nil, conversionError("failed to build category breakdown", err)
 	}
-	defer rows.Close()
-
-	// Pre-allocate for typical number of categories (5-20)
-	result := make([]map[string]interface{}, 0, 10)
-	for rows.Next() {
-		var name, ctype string
-		var total float64
-		if err := rows.Scan(&name, &ctype, &total); err != nil {
-			return nil, fmt.Errorf("failed to scan category breakdown row: %w", err)
-		}
-		result = append(result, map[string]interface{}{
-			"category": name,
-			"type":     ctype,
-			"total":    total,
-		})
-	}
-
-	// Check for any error that occurred during iteration
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating category breakdown: %w", err)
-	}
-
 	return result, nil
 }
 
 // GetGroupTotals retrieves income and expense totals grouped by time period.
 // The granularity parameter must be 'month', 'week', or 'year'.
 // Returns data sorted by period in descending order (most recent first).
-func GetGroupTotals(ctx context.Context, db *sql.DB, userID int, granularity string) ([]map[string]interface{}, error) {
+func GetGroupTotals(ctx context.Context, db *sql.DB, ledgerID, userID int, granularity string) ([]map[string]interface{}, error) {
 	// Strict whitelist validation - explicitly reject invalid values
 	allowedGranularities := map[string]bool{
 		"month": true,
@@ -144,19 +129,20 @@ func GetGroupTotals(ctx context.Context, db *sql.DB, userID int, granularity str
 	// Safe to use in SQL since we validated against strict whitelist
 	sqlQuery := fmt.Sprintf(`
 		SELECT DATE_TRUNC('%s', t.date) as period,
-			COALESCE(SUM(CASE WHEN c.type = 'expense' THEN t.amount ELSE 0 END), 0) as total_expenses,
-			COALESCE(SUM(CASE WHEN c.type = 'income' THEN t.amount ELSE 0 END), 0) as total_income
+			COALESCE(SUM(CASE WHEN c.type = 'expense' THEN convert_currency(t.amount, t.currency, u.base_currency, t.date) ELSE 0 END), 0) as total_expenses,
+			COALESCE(SUM(CASE WHEN c.type = 'income' THEN convert_currency(t.amount, t.currency, u.base_currency, t.date) ELSE 0 END), 0) as total_income
 		FROM transactions t
 		JOIN categories c ON t.category_id = c.id
-		WHERE t.user_id = $1
+		JOIN users u ON u.id = $2
+		WHERE t.ledger_id = $1
 		GROUP BY period ORDER BY period DESC`, granularity)
 
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
-	rows, err := db.QueryContext(ctx, sqlQuery, userID)
+	rows, err := db.QueryContext(ctx, sqlQuery, ledgerID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query group totals: %w", err)
+		return nil, conversionError("failed to query group totals", err)
 	}
 	defer rows.Close()
 
@@ -170,9 +156,9 @@ func GetGroupTotals(ctx context.Context, db *sql.DB, userID int, granularity str
 	results := make([]map[string]interface{}, 0, capacity)
 	for rows.Next() {
 		var period time.Time
-		var totalExpenses, totalIncome float64
+		var totalExpenses, totalIncome models.Money
 		if err := rows.Scan(&period, &totalExpenses, &totalIncome); err != nil {
-			return nil, fmt.Errorf("failed to scan group totals row: %w", err)
+			return nil, conversionError("failed to scan group totals row", err)
 		}
 		results = append(results, map[string]interface{}{
 			"period":         period.Format("2006-01-02"),
@@ -183,115 +169,116 @@ func GetGroupTotals(ctx context.Context, db *sql.DB, userID int, granularity str
 
 	// Check for any error that occurred during iteration
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating group totals: %w", err)
+		return nil, conversionError("error iterating group totals", err)
 	}
 
 	return results, nil
 }
 
 // GetCategoryMonthSummary provides a category breakdown for a specific month.
-// Returns aggregated expenses and income grouped by category for the specified year and month.
-func GetCategoryMonthSummary(ctx context.Context, db *sql.DB, userID int, year, month int) ([]map[string]interface{}, error) {
+// Returns aggregated expenses and income grouped by category for the specified year and month,
+// with child category spending rolled up into parents (full hierarchy when tree is true).
+func GetCategoryMonthSummary(ctx context.Context, db *sql.DB, ledgerID, userID int, year, month int, tree bool) ([]*CategoryNode, error) {
 	query := `
-		SELECT c.name, c.type, COALESCE(SUM(t.amount),0)
+		SELECT t.category_id, COALESCE(SUM(convert_currency(t.amount, t.currency, u.base_currency, t.date)),0)
 		FROM transactions t
-		JOIN categories c ON t.category_id = c.id
-		WHERE t.user_id = $1 AND EXTRACT(YEAR FROM t.date) = $2 AND EXTRACT(MONTH FROM t.date) = $3
-		GROUP BY c.name, c.type
-		ORDER BY c.type, SUM(t.amount) DESC`
+		JOIN users u ON u.id = $4
+		WHERE t.ledger_id = $1 AND EXTRACT(YEAR FROM t.date) = $2 AND EXTRACT(MONTH FROM t.date) = $3
+		GROUP BY t.category_id`
 
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
-	rows, err := db.QueryContext(ctx, query, userID, year, month)
+	result, err := categorySummary(ctx, db, ledgerID, tree, query, ledgerID, year, month, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query category month summary: %w", err)
+		return nil, conversionError("failed to build category month summary", err)
 	}
-	defer rows.Close()
-
-	// Pre-allocate for typical number of categories
-	result := make([]map[string]interface{}, 0, 10)
-	for rows.Next() {
-		var name, ctype string
-		var total float64
-		if err := rows.Scan(&name, &ctype, &total); err != nil {
-			return nil, fmt.Errorf("failed to scan category month summary row: %w", err)
-		}
-		result = append(result, map[string]interface{}{
-			"category": name,
-			"type":     ctype,
-			"total":    total,
-		})
-	}
-
-	// Check for any error that occurred during iteration
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating category month summary: %w", err)
-	}
-
 	return result, nil
 }
 
-// GetCurrentMonthSummary returns income and expenses for the current month, plus normalized monthly recurring expenses
-func GetCurrentMonthSummary(ctx context.Context, db *sql.DB, userID int) (map[string]float64, error) {
+// GetCurrentMonthSummary returns the ledger's income and expenses for the current month, plus normalized monthly
+// recurring expenses. The month starts on the user's month start day, in the user's time zone.
+func GetCurrentMonthSummary(ctx context.Context, db *sql.DB, ledgerID, userID int) (map[string]models.Money, error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
-	now := time.Now()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-	endOfMonth := startOfMonth.AddDate(0, 1, 0).Add(-time.Second)
+	startDay, err := monthStartDay(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := userLocation(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	today := utils.TodayIn(loc)
+	month := budgetSchedule{period: BudgetPeriodMonthly, monthStartDay: startDay}
+	startOfMonth, endOfMonth := month.periodBounds(today)
 
 	// Get current month totals
-	var monthlyExpenses, monthlyIncome float64
-	err := db.QueryRowContext(ctx,
+	var monthlyExpenses, monthlyIncome models.Money
+	err = db.QueryRowContext(ctx,
 		`SELECT
-			COALESCE(SUM(CASE WHEN c.type = 'expense' THEN t.amount ELSE 0 END),0),
-			COALESCE(SUM(CASE WHEN c.type = 'income' THEN t.amount ELSE 0 END),0)
+			COALESCE(SUM(CASE WHEN c.type = 'expense' THEN convert_currency(t.amount, t.currency, u.base_currency, t.date) ELSE 0 END),0),
+			COALESCE(SUM(CASE WHEN c.type = 'income' THEN convert_currency(t.amount, t.currency, u.base_currency, t.date) ELSE 0 END),0)
 		FROM transactions t
 		JOIN categories c ON t.category_id = c.id
-		WHERE t.user_id = $1 AND t.date >= $2 AND t.date <= $3`,
-		userID, startOfMonth.Format("2006-01-02"), endOfMonth.Format("2006-01-02")).Scan(&monthlyExpenses, &monthlyIncome)
+		JOIN users u ON u.id = $4
+		WHERE t.ledger_id = $1 AND t.date >= $2 AND t.date <= $3`,
+		ledgerID, startOfMonth.Format("2006-01-02"), endOfMonth.Format("2006-01-02"), userID).Scan(&monthlyExpenses, &monthlyIncome)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query monthly totals: %w", err)
+		return nil, conversionError("failed to query monthly totals", err)
 	}
 
 	// Get normalized monthly recurring expenses
 	rows, err := db.QueryContext(ctx,
-		`SELECT r.amount, r.recurrence
+		`SELECT convert_currency(r.amount, r.currency, u.base_currency, CURRENT_DATE), r.recurrence, r.rrule, r.start_date
 		FROM recurring_transactions r
 		JOIN categories c ON r.category_id = c.id
-		WHERE r.user_id = $1 AND c.type = 'expense'`, userID)
+		JOIN users u ON u.id = $2
+		WHERE r.ledger_id = $1 AND c.type = 'expense'`, ledgerID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query recurring expenses: %w", err)
+		return nil, conversionError("failed to query recurring expenses", err)
 	}
 	defer rows.Close()
 
-	var monthlyRecurring float64
+	var monthlyRecurring models.Money
 	for rows.Next() {
-		var amount float64
-		var recurrence string
-		if err := rows.Scan(&amount, &recurrence); err != nil {
-			return nil, fmt.Errorf("failed to scan recurring expense: %w", err)
+		var amount models.Money
+		var recurrence, schedule string
+		var start time.Time
+		if err := rows.Scan(&amount, &recurrence, &schedule, &start); err != nil {
+			return nil, conversionError("failed to scan recurring expense", err)
+		}
+
+		// Rules with intervals, specific days or an end average their occurrences over the coming year
+		rule, err := RecurrenceRule(models.RecurringTransaction{Recurrence: recurrence, RRule: schedule})
+		if err != nil {
+			return nil, fmt.Errorf("invalid recurrence rule: %w", err)
+		}
+		if !rule.IsSimple() {
+			upcoming := rule.Between(start, today, today.AddDate(1, 0, -1), 366)
+			monthlyRecurring += amount.MulInt(int64(len(upcoming))).DivRound(12)
+			continue
 		}
 
 		// Normalize to monthly
 		switch recurrence {
 		case "daily":
-			monthlyRecurring += amount * 30
+			monthlyRecurring += amount.MulInt(30)
 		case "weekly":
-			monthlyRecurring += amount * 4
+			monthlyRecurring += amount.MulInt(4)
 		case "monthly":
 			monthlyRecurring += amount
 		case "yearly":
-			monthlyRecurring += amount / 12
+			monthlyRecurring += amount.DivRound(12)
 		}
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating recurring expenses: %w", err)
+		return nil, conversionError("error iterating recurring expenses", err)
 	}
 
-	return map[string]float64{
+	return map[string]models.Money{
 		"monthly_expenses":   monthlyExpenses,
 		"monthly_income":     monthlyIncome,
 		"monthly_recurring":  monthlyRecurring,
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid_refresh_token")
+	ErrRefreshTokenReused  = errors.New("refresh_token_reused")
+)
+
+// TokenPair is returned by login and refresh: a short-lived JWT access token
+// plus an opaque refresh token that can be exchanged once for a new pair.
+// When TwoFactorRequired is set, AccessToken is a challenge token for /login/2fa
+// and there is no refresh token.
+type TokenPair struct {
+	AccessToken       string `json:"token"`
+	RefreshToken      string `json:"refresh_token,omitempty"`
+	ExpiresIn         int    `json:"expires_in"` // access token lifetime in seconds
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+}
+
+// randomToken returns n random bytes encoded as URL-safe base64.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// randomID returns 16 random bytes as hex, used for jti and family identifiers.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a refresh token; only the hash is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// signAccessToken creates an HS256 JWT for the user with a unique jti claim.
+func signAccessToken(userID int, jti string, issuedAt, expiresAt time.Time, jwtSecret string) (string, error) {
+	return signClaims(jwt.MapClaims{
+		"user_id": userID,
+		"jti":     jti,
+		"iat":     issuedAt.Unix(),
+		"exp":     expiresAt.Unix(),
+	}, jwtSecret)
+}
+
+func signClaims(claims jwt.MapClaims, jwtSecret string) (string, error) {
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return tokenString, nil
+}
+
+// issueTwoFactorChallenge signs the partially-authenticated token a password login returns for
+// accounts with two-factor authentication. middleware.RequireAuth rejects it; only /login/2fa,
+// behind middleware.RequireTwoFactorChallenge, accepts it.
+func issueTwoFactorChallenge(userID int, jwtSecret string) (TokenPair, error) {
+	jti, err := randomID()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	now := time.Now().UTC()
+	token, err := signClaims(jwt.MapClaims{
+		"user_id":                userID,
+		"jti":                    jti,
+		"iat":                    now.Unix(),
+		"exp":                    now.Add(constants.TwoFactorChallengeExpiration).Unix(),
+		constants.TwoFactorClaim: constants.TwoFactorPending,
+	}, jwtSecret)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:       token,
+		ExpiresIn:         int(constants.TwoFactorChallengeExpiration.Seconds()),
+		TwoFactorRequired: true,
+	}, nil
+}
+
+// issueTokenPair signs a new access token and stores a new refresh token in the given family,
+// which was signed in at signedInAt. Returns the pair and the ID of the inserted refresh token row.
+func issueTokenPair(ctx context.Context, tx *sql.Tx, userID int, familyID string, signedInAt time.Time, jwtSecret string) (TokenPair, int, error) {
+	jti, err := randomID()
+	if err != nil {
+		return TokenPair{}, 0, err
+	}
+	refreshToken, err := randomToken(constants.RefreshTokenBytes)
+	if err != nil {
+		return TokenPair{}, 0, err
+	}
+
+	now := time.Now().UTC()
+	accessExpiresAt := now.Add(constants.AccessTokenExpiration)
+	accessToken, err := signAccessToken(userID, jti, now, accessExpiresAt, jwtSecret)
+	if err != nil {
+		return TokenPair{}, 0, err
+	}
+
+	var refreshID int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, token_hash, family_id, access_jti, access_expires_at, expires_at, signed_in_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		userID, hashToken(refreshToken), familyID, jti, accessExpiresAt, now.Add(constants.RefreshTokenExpiration), signedInAt,
+	).Scan(&refreshID)
+	if err != nil {
+		return TokenPair{}, 0, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(constants.AccessTokenExpiration.Seconds()),
+	}, refreshID, nil
+}
+
+// StartSession creates a new refresh-token family for the user and returns its first token pair.
+func StartSession(ctx context.Context, db *sql.DB, userID int, jwtSecret string) (TokenPair, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	familyID, err := randomID()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	pair, _, err := issueTokenPair(ctx, tx, userID, familyID, time.Now().UTC(), jwtSecret)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return TokenPair{}, fmt.Errorf("failed to commit session: %w", err)
+	}
+	return pair, nil
+}
+
+// RefreshSession exchanges a refresh token for a new token pair, rotating the refresh token.
+// Presenting a refresh token that was already rotated is treated as theft: the whole family
+// is revoked (including outstanding access tokens) and ErrRefreshTokenReused is returned.
+// Returns ErrEmailNotVerified if the policy no longer lets the user sign in.
+func RefreshSession(ctx context.Context, db *sql.DB, refreshToken, jwtSecret string, policy EmailVerificationPolicy) (TokenPair, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		id         int
+		userID     int
+		familyID   string
+		signedInAt time.Time
+		expiresAt  time.Time
+		revokedAt  sql.NullTime
+		replacedBy sql.NullInt64
+	)
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, user_id, family_id, signed_in_at, expires_at, revoked_at, replaced_by
+		 FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`,
+		hashToken(refreshToken),
+	).Scan(&id, &userID, &familyID, &signedInAt, &expiresAt, &revokedAt, &replacedBy)
+	if err == sql.ErrNoRows {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+
+	if revokedAt.Valid {
+		if !replacedBy.Valid {
+			// Revoked by logout, not rotation
+			return TokenPair{}, ErrInvalidRefreshToken
+		}
+		utils.LogWarn("Refresh token reuse detected, revoking family", "userID", userID, "familyID", familyID)
+		if err := revokeFamily(ctx, tx, familyID); err != nil {
+			return TokenPair{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return TokenPair{}, fmt.Errorf("failed to commit family revocation: %w", err)
+		}
+		return TokenPair{}, ErrRefreshTokenReused
+	}
+	if time.Now().After(expiresAt) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err := checkEmailVerified(ctx, tx, userID, policy); err != nil {
+		return TokenPair{}, err
+	}
+
+	pair, newID, err := issueTokenPair(ctx, tx, userID, familyID, signedInAt, jwtSecret)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $1 WHERE id = $2`, newID, id)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return TokenPair{}, fmt.Errorf("failed to commit refresh: %w", err)
+	}
+	return pair, nil
+}
+
+// revokeFamily revokes every refresh token in a family and adds any still-valid
+// access tokens issued from it to the revocation list.
+func revokeFamily(ctx context.Context, tx *sql.Tx, familyID string) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		 SELECT access_jti, user_id, access_expires_at FROM refresh_tokens
+		 WHERE family_id = $1 AND access_expires_at > NOW()
+		 ON CONFLICT (jti) DO NOTHING`, familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`, familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// revokeUserSessions revokes every token family belonging to the user except keepFamilyID
+// (pass "" to revoke all of them).
+func revokeUserSessions(ctx context.Context, tx *sql.Tx, userID int, keepFamilyID string) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		 SELECT access_jti, user_id, access_expires_at FROM refresh_tokens
+		 WHERE user_id = $1 AND family_id <> $2 AND access_expires_at > NOW()
+		 ON CONFLICT (jti) DO NOTHING`, userID, keepFamilyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL`, userID, keepFamilyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// Logout ends the session that issued the given access token: its jti is revoked
+// and the refresh-token family it belongs to can no longer be refreshed.
+func Logout(ctx context.Context, db *sql.DB, userID int, jti string) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var familyID string
+	err = tx.QueryRowContext(ctx,
+		`SELECT family_id FROM refresh_tokens WHERE access_jti = $1 AND user_id = $2`,
+		jti, userID).Scan(&familyID)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to look up session: %w", err)
+	}
+	if err == nil {
+		if err := revokeFamily(ctx, tx, familyID); err != nil {
+			return err
+		}
+	}
+
+	// The access token may be older than the family's latest rotation; revoke it explicitly.
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (jti) DO NOTHING`,
+		jti, userID, time.Now().UTC().Add(constants.AccessTokenExpiration))
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// LogoutAll revokes every session belonging to the user, on all devices.
+func LogoutAll(ctx context.Context, db *sql.DB, userID int) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := revokeUserSessions(ctx, tx, userID, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsAccessTokenRevoked reports whether the access token with the given jti has been revoked.
+func IsAccessTokenRevoked(ctx context.Context, db *sql.DB, jti string) (bool, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var revoked bool
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+// PurgeExpiredTokens deletes refresh tokens, revocation entries, email tokens, single sign-on logins,
+// personal access tokens and ledger invitations that have expired and can no longer be presented.
+// Returns the number of rows removed.
+func PurgeExpiredTokens(ctx context.Context, db *sql.DB) (int64, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	revoked, err := db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge revoked tokens: %w", err)
+	}
+	refresh, err := db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge refresh tokens: %w", err)
+	}
+
+	email, err := db.ExecContext(ctx, "DELETE FROM email_tokens WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge email tokens: %w", err)
+	}
+
+	oidcStates, err := db.ExecContext(ctx, "DELETE FROM oidc_login_states WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge single sign-on logins: %w", err)
+	}
+
+	personal, err := db.ExecContext(ctx, "DELETE FROM personal_access_tokens WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge personal access tokens: %w", err)
+	}
+
+	invitations, err := db.ExecContext(ctx, "DELETE FROM ledger_invitations WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge ledger invitations: %w", err)
+	}
+
+	revokedCount, _ := revoked.RowsAffected()
+	refreshCount, _ := refresh.RowsAffected()
+	emailCount, _ := email.RowsAffected()
+	oidcCount, _ := oidcStates.RowsAffected()
+	personalCount, _ := personal.RowsAffected()
+	invitationCount, _ := invitations.RowsAffected()
+	return revokedCount + refreshCount + emailCount + oidcCount + personalCount + invitationCount, nil
+}
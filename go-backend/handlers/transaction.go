@@ -10,30 +10,55 @@ import (
 	"github.com/vidya381/myspendo-backend/utils"
 )
 
-// AddTransaction creates a new expense or income transaction for the user.
-// Verifies that the specified category belongs to the user before creation.
-func AddTransaction(ctx context.Context, db *sql.DB, tx models.Transaction) error {
+// AddTransaction creates a new expense or income transaction in tx.LedgerID, recorded by tx.UserID, and
+// returns the category it was filed under. Verifies that the specified category is in the ledger before creation.
+// With CategoryID 0 the category is chosen by the ledger's categorization rules among categories of
+// CategoryType ("expense" or "income"), falling back to the "Uncategorized" category of that type.
+// An empty Currency defaults to the recording user's base currency, or to the account's currency when
+// AccountID names one; any other currency must have an exchange rate to the base currency (ErrNoExchangeRate
+// otherwise) and match the account's (ErrAccountCurrency otherwise).
+func AddTransaction(ctx context.Context, db *sql.DB, tx models.Transaction) (int, error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
-	// Verify category ownership
-	if err := utils.VerifyCategoryOwnership(db, tx.UserID, tx.CategoryID); err != nil {
-		return err
+	if tx.AccountID != nil && *tx.AccountID == 0 {
+		tx.AccountID = nil
+	}
+	if tx.AccountID != nil {
+		currency, err := accountTransactionCurrency(ctx, db, tx.LedgerID, *tx.AccountID, tx.Currency)
+		if err != nil {
+			return 0, err
+		}
+		tx.Currency = currency
+	}
+
+	if err := ensureConvertible(ctx, db, tx.LedgerID, tx.UserID, tx.Currency, tx.Date); err != nil {
+		return 0, err
 	}
 
-	query := `INSERT INTO transactions (user_id, category_id, amount, description, date)
-			  VALUES ($1, $2, $3, $4, $5)`
+	if tx.CategoryID == 0 {
+		categoryID, err := resolveCategory(ctx, db, tx.LedgerID, tx.UserID, tx.CategoryType, tx.Description, tx.Amount, tx.Date)
+		if err != nil {
+			return 0, err
+		}
+		tx.CategoryID = categoryID
+	} else if err := utils.VerifyCategoryOwnership(db, tx.LedgerID, tx.CategoryID); err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO transactions (user_id, category_id, amount, currency, description, date, ledger_id, account_id)
+			  VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), (SELECT base_currency FROM users WHERE id = $1)), $5, $6, $7, $8)`
 	_, err := db.ExecContext(ctx, query,
-		tx.UserID, tx.CategoryID, tx.Amount, tx.Description, tx.Date)
+		tx.UserID, tx.CategoryID, tx.Amount, tx.Currency, tx.Description, tx.Date, tx.LedgerID, tx.AccountID)
 	if err != nil {
-		return fmt.Errorf("failed to insert transaction: %w", err)
+		return 0, fmt.Errorf("failed to insert transaction: %w", err)
 	}
-	return nil
+	return tx.CategoryID, nil
 }
 
-// ListTransactions retrieves all transactions for the specified user, including category details.
+// ListTransactions retrieves all transactions in the specified ledger, including category details.
 // Returns transactions in descending order by date (newest first).
-func ListTransactions(ctx context.Context, db *sql.DB, userID int) ([]models.Transaction, error) {
+func ListTransactions(ctx context.Context, db *sql.DB, ledgerID int) ([]models.Transaction, error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
@@ -41,19 +66,23 @@ func ListTransactions(ctx context.Context, db *sql.DB, userID int) ([]models.Tra
 		`
         SELECT
             t.id,
+            t.ledger_id,
             t.user_id,
             t.category_id,
             c.name AS category_name,
             c.type AS category_type,
             t.amount,
+            t.currency,
             t.description,
             t.date,
+            t.recurring_id,
+            t.account_id,
             t.created_at
         FROM transactions t
         JOIN categories c ON t.category_id = c.id
-        WHERE t.user_id = $1
+        WHERE t.ledger_id = $1
         ORDER BY t.date DESC
-        `, userID)
+        `, ledgerID)
 
 	if err != nil {
 		return nil, err
@@ -64,19 +93,32 @@ func ListTransactions(ctx context.Context, db *sql.DB, userID int) ([]models.Tra
 	transactions := make([]models.Transaction, 0, constants.TypicalTransactionCount)
 	for rows.Next() {
 		var tx models.Transaction
+		var recurringID, accountID sql.NullInt64
 		if err := rows.Scan(
 			&tx.ID,
+			&tx.LedgerID,
 			&tx.UserID,
 			&tx.CategoryID,
 			&tx.CategoryName,
 			&tx.CategoryType,
 			&tx.Amount,
+			&tx.Currency,
 			&tx.Description,
 			&tx.Date,
+			&recurringID,
+			&accountID,
 			&tx.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
+		if recurringID.Valid {
+			id := int(recurringID.Int64)
+			tx.RecurringID = &id
+		}
+		if accountID.Valid {
+			id := int(accountID.Int64)
+			tx.AccountID = &id
+		}
 		transactions = append(transactions, tx)
 	}
 
@@ -88,39 +130,107 @@ func ListTransactions(ctx context.Context, db *sql.DB, userID int) ([]models.Tra
 	return transactions, nil
 }
 
-// UpdateTransaction modifies an existing transaction's amount, description, category, and date.
-// Verifies category ownership and that the transaction belongs to the user.
-// Returns an error if the transaction doesn't exist or belongs to another user.
+// UpdateTransaction modifies an existing transaction's amount, currency, description, category, and date.
+// Verifies that the category and the transaction are in tx.LedgerID; tx.UserID is the user making the change.
+// An empty Currency keeps the transaction's current currency. A nil AccountID keeps its current account
+// and an AccountID of 0 takes it off its account; the currency must match the account's (ErrAccountCurrency
+// otherwise). If the transaction is a split expense, its parts are worked out again for the new amount,
+// except that the amount of an expense split by exact amounts can't change (ErrSplitExactAmount).
+// The transactions of a settlement can't be changed (ErrSettlementTransaction).
+// Returns an error if the transaction doesn't exist or belongs to another ledger.
 func UpdateTransaction(ctx context.Context, db *sql.DB, tx models.Transaction) error {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
 	// Verify category ownership
-	if err := utils.VerifyCategoryOwnership(db, tx.UserID, tx.CategoryID); err != nil {
+	if err := utils.VerifyCategoryOwnership(db, tx.LedgerID, tx.CategoryID); err != nil {
 		return err
 	}
 
+	if tx.Currency != "" {
+		if err := ensureConvertible(ctx, db, tx.LedgerID, tx.UserID, tx.Currency, tx.Date); err != nil {
+			return err
+		}
+	}
+	if tx.AccountID != nil && *tx.AccountID > 0 {
+		if _, err := accountCurrency(ctx, db, tx.LedgerID, *tx.AccountID); err != nil {
+			return err
+		}
+	}
+
+	dbTx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
 	query := `UPDATE transactions
-			  SET amount = $1, description = $2, category_id = $3, date = $4
-			  WHERE id = $5 AND user_id = $6`
-	result, err := db.ExecContext(ctx, query,
-		tx.Amount, tx.Description, tx.CategoryID, tx.Date, tx.ID, tx.UserID)
+			  SET amount = $1, currency = COALESCE(NULLIF($2, ''), currency), description = $3, category_id = $4, date = $5,
+			      account_id = CASE WHEN $8::int IS NULL THEN account_id ELSE NULLIF($8::int, 0) END
+			  WHERE id = $6 AND ledger_id = $7`
+	result, err := dbTx.ExecContext(ctx, query,
+		tx.Amount, tx.Currency, tx.Description, tx.CategoryID, tx.Date, tx.ID, tx.LedgerID, tx.AccountID)
 	if err != nil {
 		return fmt.Errorf("failed to update transaction: %w", err)
 	}
 
 	// Check if any rows were actually updated
-	return utils.CheckRowsAffected(result, "transaction")
+	if err := utils.CheckRowsAffected(result, "transaction"); err != nil {
+		return err
+	}
+
+	// A transaction is in its account's currency
+	var mismatch bool
+	err = dbTx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM transactions t JOIN accounts a ON a.id = t.account_id
+		                WHERE t.id = $1 AND a.currency <> t.currency)`, tx.ID).Scan(&mismatch)
+	if err != nil {
+		return fmt.Errorf("failed to check account currency: %w", err)
+	}
+	if mismatch {
+		return ErrAccountCurrency
+	}
+
+	// The transactions of a settlement change with it, not on their own
+	var settlement bool
+	err = dbTx.QueryRowContext(ctx,
+		"SELECT settlement_id IS NOT NULL FROM transactions WHERE id = $1", tx.ID).Scan(&settlement)
+	if err != nil {
+		return fmt.Errorf("failed to check settlement: %w", err)
+	}
+	if settlement {
+		return ErrSettlementTransaction
+	}
+
+	// A split expense's parts follow its new amount
+	if err := resplitExpense(ctx, dbTx, tx.ID); err != nil {
+		return err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
-// DeleteTransaction removes a transaction from the database.
-// Returns an error if the transaction doesn't exist or belongs to another user.
-func DeleteTransaction(ctx context.Context, db *sql.DB, id, userID int) error {
+// DeleteTransaction removes a transaction from the database. Deleting either transaction of a
+// settlement deletes the settlement with both of them.
+// Returns an error if the transaction doesn't exist or belongs to another ledger.
+func DeleteTransaction(ctx context.Context, db *sql.DB, id, ledgerID int) error {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
 	result, err := db.ExecContext(ctx,
-		`DELETE FROM transactions WHERE id = $1 AND user_id = $2`, id, userID)
+		`DELETE FROM settlements
+		 WHERE id = (SELECT settlement_id FROM transactions WHERE id = $1 AND ledger_id = $2)`, id, ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete settlement: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	result, err = db.ExecContext(ctx,
+		`DELETE FROM transactions WHERE id = $1 AND ledger_id = $2`, id, ledgerID)
 	if err != nil {
 		return fmt.Errorf("failed to delete transaction: %w", err)
 	}
@@ -135,13 +245,13 @@ func DeleteTransaction(ctx context.Context, db *sql.DB, id, userID int) error {
 func FilterTransactionsPaginated(
 	ctx context.Context,
 	db *sql.DB,
-	userID int,
+	ledgerID int,
 	keyword string,
 	categoryID int,
 	dateFrom string,
 	dateTo string,
-	amountMin float64,
-	amountMax float64,
+	amountMin models.Money,
+	amountMax models.Money,
 	orderBy string,
 	limit int,
 	offset int,
@@ -149,18 +259,22 @@ func FilterTransactionsPaginated(
 
 	base := `SELECT
                 t.id,
+                t.ledger_id,
                 t.user_id,
                 t.category_id,
                 c.name AS category_name,
                 c.type AS category_type,
                 t.amount,
+                t.currency,
                 t.description,
                 t.date,
+                t.recurring_id,
+                t.account_id,
                 t.created_at
              FROM transactions t
              JOIN categories c ON t.category_id = c.id
-             WHERE t.user_id = $1`
-	args := []interface{}{userID}
+             WHERE t.ledger_id = $1`
+	args := []interface{}{ledgerID}
 	argpos := 2
 
 	if keyword != "" {
@@ -231,19 +345,32 @@ func FilterTransactionsPaginated(
 	results := make([]models.Transaction, 0, limit)
 	for rows.Next() {
 		var t models.Transaction
+		var recurringID, accountID sql.NullInt64
 		if err := rows.Scan(
 			&t.ID,
+			&t.LedgerID,
 			&t.UserID,
 			&t.CategoryID,
 			&t.CategoryName,
 			&t.CategoryType,
 			&t.Amount,
+			&t.Currency,
 			&t.Description,
 			&t.Date,
+			&recurringID,
+			&accountID,
 			&t.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
+		if recurringID.Valid {
+			id := int(recurringID.Int64)
+			t.RecurringID = &id
+		}
+		if accountID.Valid {
+			id := int(accountID.Int64)
+			t.AccountID = &id
+		}
 		results = append(results, t)
 	}
 
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/totp"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two_factor_enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two_factor_not_enabled")
+	ErrTwoFactorNotSetUp    = errors.New("two_factor_not_set_up")
+	ErrInvalidTwoFactorCode = errors.New("invalid_two_factor_code")
+)
+
+// TwoFactorSetup is what an authenticator app needs to start generating codes.
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`      // base32, for manual entry
+	URI    string `json:"otpauth_uri"` // provisioning URI to show as a QR code
+}
+
+// SetupTwoFactor starts enrollment by generating a new TOTP secret for the user. Two-factor
+// authentication is not required until EnableTwoFactor confirms a code from the app.
+// Returns ErrTwoFactorEnabled if it is already on.
+func SetupTwoFactor(ctx context.Context, db *sql.DB, userID int) (TwoFactorSetup, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+
+	var email string
+	err = db.QueryRowContext(ctx,
+		`UPDATE users SET totp_secret = $2, totp_last_step = 0
+		 WHERE id = $1 AND totp_enabled_at IS NULL
+		 RETURNING email`,
+		userID, secret).Scan(&email)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+			return TwoFactorSetup{}, fmt.Errorf("failed to query user: %w", err)
+		}
+		if !exists {
+			return TwoFactorSetup{}, ErrUserNotFound
+		}
+		return TwoFactorSetup{}, ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return TwoFactorSetup{}, fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	return TwoFactorSetup{Secret: secret, URI: totp.URI(secret, constants.TOTPIssuer, email)}, nil
+}
+
+// EnableTwoFactor turns on two-factor authentication once the user has entered a code generated
+// from the secret of SetupTwoFactor, and returns their recovery codes. They are shown only once.
+func EnableTwoFactor(ctx context.Context, db *sql.DB, userID int, code string) ([]string, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var enabled bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE`,
+		userID).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if !secret.Valid {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	step, ok := totp.Validate(secret.String, code, time.Now(), constants.TOTPSkewSteps)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $2 WHERE id = $1`, userID, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit two-factor authentication: %w", err)
+	}
+
+	utils.LogInfo("Two-factor authentication enabled", "userID", userID)
+	return codes, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking the user's password and
+// a current code or recovery code. The secret and recovery codes are deleted. Accounts without a
+// password need a recent sign-in instead, by the session of the access token with the given jti
+// (see confirmIdentity).
+func DisableTwoFactor(ctx context.Context, db *sql.DB, userID int, password, code, jti string) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	if err := confirmIdentity(ctx, db, userID, password, jti); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := verifySecondFactor(ctx, tx, userID, code); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit two-factor authentication: %w", err)
+	}
+
+	utils.LogInfo("Two-factor authentication disabled", "userID", userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a current code or
+// recovery code, and returns the new ones. Earlier codes stop working.
+func RegenerateRecoveryCodes(ctx context.Context, db *sql.DB, userID int, code string) ([]string, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := verifySecondFactor(ctx, tx, userID, code); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recovery codes: %w", err)
+	}
+
+	utils.LogInfo("Recovery codes regenerated", "userID", userID)
+	return codes, nil
+}
+
+// CompleteTwoFactorLogin finishes a password login with a code or recovery code and starts the
+// session. The challenge token (challengeJTI) from the password step can only be used once.
+func CompleteTwoFactorLogin(ctx context.Context, db *sql.DB, userID int, challengeJTI, code, jwtSecret string) (TokenPair, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	familyID, err := randomID()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := verifySecondFactor(ctx, tx, userID, code); err != nil {
+		if err == ErrInvalidTwoFactorCode {
+			utils.LogInfo("Two-factor login failed: invalid code", "userID", userID)
+		}
+		return TokenPair{}, err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (jti) DO NOTHING`,
+		challengeJTI, userID, time.Now().UTC().Add(constants.TwoFactorChallengeExpiration))
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to revoke challenge token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Another request already completed this login
+		return TokenPair{}, ErrInvalidTwoFactorCode
+	}
+
+	pair, _, err := issueTokenPair(ctx, tx, userID, familyID, time.Now().UTC(), jwtSecret)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return TokenPair{}, fmt.Errorf("failed to commit session: %w", err)
+	}
+
+	utils.LogInfo("User logged in with two-factor authentication", "userID", userID)
+	return pair, nil
+}
+
+// verifySecondFactor accepts a TOTP code or an unused recovery code for the user, who must have
+// two-factor authentication enabled. The user's row is locked, and the code is used up: a TOTP
+// code can't be accepted again and a recovery code is marked used.
+func verifySecondFactor(ctx context.Context, tx *sql.Tx, userID int, code string) error {
+	var secret sql.NullString
+	var enabled bool
+	var lastStep int64
+	err := tx.QueryRowContext(ctx,
+		`SELECT totp_secret, totp_enabled_at IS NOT NULL, totp_last_step FROM users WHERE id = $1 FOR UPDATE`,
+		userID).Scan(&secret, &enabled, &lastStep)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+	if !enabled || !secret.Valid {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := totp.Validate(secret.String, code, time.Now(), constants.TOTPSkewSteps); ok {
+		if step <= lastStep {
+			return ErrInvalidTwoFactorCode // already used
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET totp_last_step = $2 WHERE id = $1`, userID, step); err != nil {
+			return fmt.Errorf("failed to record TOTP code: %w", err)
+		}
+		return nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, hashToken(normalized))
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	utils.LogInfo("Recovery code used", "userID", userID)
+	return nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores constants.RecoveryCodeCount new ones.
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, 0, constants.RecoveryCodeCount)
+	for len(codes) < constants.RecoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCode returns a random code formatted for reading, e.g. "K7QX-2M4P-ZT9A-BC3D".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, constants.RecoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	s := recoveryCodeEncoding.EncodeToString(b)
+	var parts []string
+	for len(s) > 4 {
+		parts = append(parts, s[:4])
+		s = s[4:]
+	}
+	return strings.Join(append(parts, s), "-"), nil
+}
+
+// normalizeRecoveryCode ignores case, dashes and spaces, so codes can be typed as printed or not.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return r
+	}, strings.TrimSpace(code))
+}
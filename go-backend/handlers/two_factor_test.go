@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	format := regexp.MustCompile(`^[A-Z2-7]{4}(-[A-Z2-7]{4})+$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			t.Fatalf("newRecoveryCode: %v", err)
+		}
+		if !format.MatchString(code) {
+			t.Errorf("code %q is not in groups of four", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+
+		typed := " " + strings.ToLower(strings.ReplaceAll(code, "-", "")) + " "
+		if normalizeRecoveryCode(typed) != normalizeRecoveryCode(code) {
+			t.Errorf("normalizeRecoveryCode(%q) != normalizeRecoveryCode(%q)", typed, code)
+		}
+	}
+}
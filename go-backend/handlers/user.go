@@ -7,8 +7,8 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
 	"github.com/vidya381/myspendo-backend/utils"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -18,12 +18,14 @@ var (
 	ErrUsernameExists     = errors.New("username_exists")
 	ErrUserNotFound       = errors.New("user_not_found")
 	ErrInvalidCredentials = errors.New("invalid_credentials")
+	ErrSignInRequired     = errors.New("sign_in_required")
 )
 
-// RegisterUser creates a new user account with the provided credentials.
+// RegisterUser creates a new user account with the provided credentials and returns its ID.
 // Returns ErrEmailExists if email is already registered, ErrUsernameExists if username is taken.
-// The password is hashed using bcrypt before storage.
-func RegisterUser(ctx context.Context, db *sql.DB, username, email, password string) error {
+// The password is hashed using bcrypt before storage. The email starts out unverified.
+// The account starts with a personal ledger, which becomes its default.
+func RegisterUser(ctx context.Context, db *sql.DB, username, email, password string) (int, error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
@@ -35,11 +37,11 @@ func RegisterUser(ctx context.Context, db *sql.DB, username, email, password str
 	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)", email).Scan(&exists)
 	if err != nil {
 		utils.LogError("Failed to check email existence", "error", err)
-		return fmt.Errorf("failed to check email existence: %w", err)
+		return 0, fmt.Errorf("failed to check email existence: %w", err)
 	}
 	if exists {
 		utils.LogInfo("Registration failed: email already exists", "email", email)
-		return ErrEmailExists
+		return 0, ErrEmailExists
 	}
 	utils.LogDebug("Email check passed", "email", email)
 
@@ -48,11 +50,11 @@ func RegisterUser(ctx context.Context, db *sql.DB, username, email, password str
 	err = db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)", username).Scan(&exists)
 	if err != nil {
 		utils.LogError("Failed to check username existence", "error", err)
-		return fmt.Errorf("failed to check username existence: %w", err)
+		return 0, fmt.Errorf("failed to check username existence: %w", err)
 	}
 	if exists {
 		utils.LogInfo("Registration failed: username already exists", "username", username)
-		return ErrUsernameExists
+		return 0, ErrUsernameExists
 	}
 	utils.LogDebug("Username check passed", "username", username)
 
@@ -61,27 +63,43 @@ func RegisterUser(ctx context.Context, db *sql.DB, username, email, password str
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		utils.LogError("Password hashing failed", "error", err)
-		return fmt.Errorf("password hashing failed: %w", err)
+		return 0, fmt.Errorf("password hashing failed: %w", err)
 	}
 	utils.LogDebug("Password hashed successfully")
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Insert into users table
 	utils.LogDebug("Inserting user into database", "username", username, "email", email)
-	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3)`
-	_, err = db.ExecContext(ctx, query, username, email, string(hashedPassword))
+	var userID int
+	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id`
+	err = tx.QueryRowContext(ctx, query, username, email, string(hashedPassword)).Scan(&userID)
 	if err != nil {
 		utils.LogError("Failed to insert user", "error", err, "username", username, "email", email)
-		return fmt.Errorf("error inserting user: %w", err)
+		return 0, fmt.Errorf("error inserting user: %w", err)
+	}
+	if _, err := createPersonalLedger(ctx, tx, userID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit user: %w", err)
 	}
 
 	utils.LogInfo("User registered successfully", "username", username, "email", email)
-	return nil
+	return userID, nil
 }
 
-// LoginUser authenticates a user with email and password, returning a JWT token on success.
+// LoginUser authenticates a user with email and password, returning a token pair on success.
 // Returns ErrUserNotFound if the email doesn't exist, ErrInvalidCredentials if password is incorrect.
-// The JWT token expires after 72 hours and contains the user ID in its claims.
-func LoginUser(ctx context.Context, db *sql.DB, email, password, jwtSecret string) (string, error) {
+// The access token is short-lived (constants.AccessTokenExpiration); the refresh token is stored
+// server-side and rotated on every use via RefreshSession. Returns ErrEmailNotVerified if the
+// policy requires a verified email and the user hasn't verified theirs. For accounts with
+// two-factor authentication the pair only holds a challenge token (see CompleteTwoFactorLogin).
+func LoginUser(ctx context.Context, db *sql.DB, email, password, jwtSecret string, policy EmailVerificationPolicy) (TokenPair, error) {
 	ctx, cancel := utils.DBContext(ctx)
 	defer cancel()
 
@@ -89,39 +107,268 @@ func LoginUser(ctx context.Context, db *sql.DB, email, password, jwtSecret strin
 
 	var userID int
 	var hashedPassword string
+	var twoFactor bool
 
 	utils.LogDebug("Querying user from database", "email", email)
-	err := db.QueryRowContext(ctx, "SELECT id, password FROM users WHERE email = $1", email).Scan(&userID, &hashedPassword)
+	err := db.QueryRowContext(ctx, "SELECT id, password, totp_enabled_at IS NOT NULL FROM users WHERE email = $1", email).
+		Scan(&userID, &hashedPassword, &twoFactor)
 	if err == sql.ErrNoRows {
 		utils.LogInfo("Login failed: user not found", "email", email)
-		return "", ErrUserNotFound
+		return TokenPair{}, ErrUserNotFound
 	}
 	if err != nil {
 		utils.LogError("Failed to query user by email", "error", err, "email", email)
-		return "", fmt.Errorf("failed to query user by email: %w", err)
+		return TokenPair{}, fmt.Errorf("failed to query user by email: %w", err)
 	}
 	utils.LogDebug("User found in database", "email", email, "userID", userID)
 
 	utils.LogDebug("Comparing password hash")
 	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) != nil {
 		utils.LogInfo("Login failed: invalid password", "email", email)
-		return "", ErrInvalidCredentials
+		return TokenPair{}, ErrInvalidCredentials
 	}
 	utils.LogDebug("Password verified successfully")
 
-	// Create and sign JWT
-	utils.LogDebug("Creating JWT token", "userID", userID)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(constants.JWTExpirationHours).Unix(),
-	})
+	if err := checkEmailVerified(ctx, db, userID, policy); err != nil {
+		if err == ErrEmailNotVerified {
+			utils.LogInfo("Login refused: email not verified", "email", email, "userID", userID)
+		}
+		return TokenPair{}, err
+	}
+
+	if twoFactor {
+		utils.LogInfo("Password verified, two-factor authentication required", "email", email, "userID", userID)
+		return issueTwoFactorChallenge(userID, jwtSecret)
+	}
 
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	// Start a new refresh-token family for this login
+	utils.LogDebug("Creating session tokens", "userID", userID)
+	pair, err := StartSession(ctx, db, userID, jwtSecret)
 	if err != nil {
-		utils.LogError("Failed to sign JWT", "error", err, "userID", userID)
-		return "", fmt.Errorf("failed to sign JWT: %w", err)
+		utils.LogError("Failed to start session", "error", err, "userID", userID)
+		return TokenPair{}, err
 	}
 
-	utils.LogInfo("User logged in successfully", "email", email, "userID", userID, "tokenLength", len(tokenString))
-	return tokenString, nil
+	utils.LogInfo("User logged in successfully", "email", email, "userID", userID, "tokenLength", len(pair.AccessToken))
+	return pair, nil
+}
+
+// GetProfile returns the user's account details, without the password.
+func GetProfile(ctx context.Context, db *sql.DB, userID int) (models.User, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	var u models.User
+	var createdAt time.Time
+	err := db.QueryRowContext(ctx,
+		`SELECT id, username, email, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL, base_currency, timezone, created_at
+		 FROM users WHERE id = $1`,
+		userID).Scan(&u.ID, &u.Username, &u.Email, &u.EmailVerified, &u.TwoFactorEnabled, &u.BaseCurrency, &u.Timezone, &createdAt)
+	if err == sql.ErrNoRows {
+		return models.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to query user: %w", err)
+	}
+	u.CreatedAt = createdAt.Format(time.RFC3339)
+	return u, nil
+}
+
+// UpdateProfile changes the user's username and/or email; an empty value leaves it unchanged.
+// A new email address starts out unverified.
+// Returns ErrUsernameExists or ErrEmailExists if another account already uses the new value.
+func UpdateProfile(ctx context.Context, db *sql.DB, userID int, username, email string) (models.User, error) {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	if email != "" {
+		var exists bool
+		err := db.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND id <> $2)", email, userID).Scan(&exists)
+		if err != nil {
+			return models.User{}, fmt.Errorf("failed to check email existence: %w", err)
+		}
+		if exists {
+			return models.User{}, ErrEmailExists
+		}
+	}
+	if username != "" {
+		var exists bool
+		err := db.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM users WHERE username = $1 AND id <> $2)", username, userID).Scan(&exists)
+		if err != nil {
+			return models.User{}, fmt.Errorf("failed to check username existence: %w", err)
+		}
+		if exists {
+			return models.User{}, ErrUsernameExists
+		}
+	}
+
+	result, err := db.ExecContext(ctx,
+		`UPDATE users
+		 SET username = COALESCE(NULLIF($2, ''), username),
+		     email = COALESCE(NULLIF($3, ''), email),
+		     email_verified_at = CASE WHEN $3 <> '' AND $3 <> email THEN NULL ELSE email_verified_at END
+		 WHERE id = $1`,
+		userID, username, email)
+	if err != nil {
+		// A concurrent change may have taken the name between the check and the update
+		if utils.IsPgError(err, utils.PgUniqueViolation) {
+			if utils.PgConstraintName(err) == "users_email_key" {
+				return models.User{}, ErrEmailExists
+			}
+			return models.User{}, ErrUsernameExists
+		}
+		return models.User{}, fmt.Errorf("failed to update user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return models.User{}, ErrUserNotFound
+	}
+
+	utils.LogInfo("User profile updated", "userID", userID)
+	return GetProfile(ctx, db, userID)
+}
+
+// checkPassword returns ErrInvalidCredentials unless password is the user's current password.
+func checkPassword(ctx context.Context, q queryer, userID int, password string) error {
+	var hashedPassword string
+	err := q.QueryRowContext(ctx, "SELECT password FROM users WHERE id = $1", userID).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// confirmIdentity checks that the request comes from the account holder before an irreversible
+// change. Accounts with a password must give it (ErrInvalidCredentials otherwise). Accounts
+// without one, such as those created by single sign-on, must instead use a session signed in
+// within constants.RecentSignInWindow; jti identifies the access token of the request. Returns
+// ErrSignInRequired if it isn't.
+func confirmIdentity(ctx context.Context, q queryer, userID int, password, jti string) error {
+	var hashedPassword string
+	err := q.QueryRowContext(ctx, "SELECT password FROM users WHERE id = $1", userID).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+	if hashedPassword != noPassword {
+		if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) != nil {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}
+
+	var signedInAt time.Time
+	err = q.QueryRowContext(ctx,
+		`SELECT signed_in_at FROM refresh_tokens WHERE access_jti = $1 AND user_id = $2`,
+		jti, userID).Scan(&signedInAt)
+	if err == sql.ErrNoRows {
+		return ErrSignInRequired
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up session: %w", err)
+	}
+	if !signedInRecently(signedInAt, time.Now()) {
+		return ErrSignInRequired
+	}
+	return nil
+}
+
+// signedInRecently reports whether a session signed in at signedInAt is recent enough at now
+// to stand in for a password.
+func signedInRecently(signedInAt, now time.Time) bool {
+	return !signedInAt.After(now) && now.Sub(signedInAt) <= constants.RecentSignInWindow
+}
+
+// ChangePassword replaces the user's password after verifying the current one, and revokes every
+// other session. The session that issued the access token with the given jti stays signed in.
+// Returns ErrInvalidCredentials if currentPassword is wrong.
+func ChangePassword(ctx context.Context, db *sql.DB, userID int, currentPassword, newPassword, jti string) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	if err := checkPassword(ctx, db, userID, currentPassword); err != nil {
+		if err == ErrInvalidCredentials {
+			utils.LogInfo("Password change failed: invalid current password", "userID", userID)
+		}
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("password hashing failed: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET password = $2 WHERE id = $1", userID, string(hashedPassword)); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	var familyID string
+	err = tx.QueryRowContext(ctx,
+		`SELECT family_id FROM refresh_tokens WHERE access_jti = $1 AND user_id = $2`,
+		jti, userID).Scan(&familyID)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to look up session: %w", err)
+	}
+	if err := revokeUserSessions(ctx, tx, userID, familyID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit password change: %w", err)
+	}
+
+	utils.LogInfo("Password changed, other sessions revoked", "userID", userID)
+	return nil
+}
+
+// DeleteAccount permanently deletes the user after verifying their password. Ledgers only the
+// user is a member of are deleted with everything in them; shared ledgers stay with the other
+// members (see handOverLedgers). Sessions and everything else the user owns are removed with
+// it through ON DELETE CASCADE. Returns ErrInvalidCredentials if password is wrong, or
+// ErrSignInRequired if the account has no password and the session of the access token with the
+// given jti wasn't signed in recently (see confirmIdentity).
+func DeleteAccount(ctx context.Context, db *sql.DB, userID int, password, jti string) error {
+	ctx, cancel := utils.DBContext(ctx)
+	defer cancel()
+
+	if err := confirmIdentity(ctx, db, userID, password, jti); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := handOverLedgers(ctx, tx, userID); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit account deletion: %w", err)
+	}
+
+	utils.LogInfo("User account deleted", "userID", userID)
+	return nil
 }
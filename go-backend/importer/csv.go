@@ -0,0 +1,163 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+// CSVMapping describes how to read a bank's CSV export. Column references are header
+// names (case-insensitive) or 1-based indexes. Either Amount or Debit/Credit must be set.
+type CSVMapping struct {
+	Date        string
+	Amount      string // single signed amount column
+	Debit       string // money out, as a positive number
+	Credit      string // money in, as a positive number
+	Description string
+	Currency    string // optional per-row currency column
+
+	DateFormat   string // pattern such as "DD/MM/YYYY"; defaults to YYYY-MM-DD
+	Delimiter    rune   // defaults to ','
+	NoHeader     bool   // file has no header row; columns must be indexes
+	DecimalComma bool   // amounts use ',' as the decimal separator
+	InvertSign   bool   // bank exports expenses as positive amounts
+}
+
+// ParseCSV parses a CSV statement using the given column mapping.
+func ParseCSV(r io.Reader, m CSVMapping) ([]Row, error) {
+	if m.Date == "" || m.Description == "" {
+		return nil, fmt.Errorf("date and description columns are required")
+	}
+	if m.Amount == "" && m.Debit == "" && m.Credit == "" {
+		return nil, fmt.Errorf("either an amount column or debit/credit columns are required")
+	}
+	layout, err := DateLayout(m.DateFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true // some banks leave quotes inside fields unescaped
+	if m.Delimiter != 0 {
+		reader.Comma = m.Delimiter
+	}
+
+	var header []string
+	if !m.NoHeader {
+		header, err = reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("CSV is empty")
+			}
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		if len(header) > 0 {
+			header[0] = strings.TrimPrefix(header[0], "\ufeff") // Excel byte order mark
+		}
+	}
+
+	cols := map[string]int{}
+	for name, ref := range map[string]string{
+		"date": m.Date, "amount": m.Amount, "debit": m.Debit, "credit": m.Credit,
+		"description": m.Description, "currency": m.Currency,
+	} {
+		idx, err := columnIndex(ref, header)
+		if err != nil {
+			return nil, fmt.Errorf("%s column: %w", name, err)
+		}
+		cols[name] = idx
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, parseCSVRecord(record, cols, layout, m, line))
+	}
+	return rows, nil
+}
+
+func parseCSVRecord(record []string, cols map[string]int, layout string, m CSVMapping, line int) Row {
+	field := func(name string) string {
+		if i := cols[name]; i >= 0 && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row := Row{Line: line, Description: field("description"), Currency: strings.ToUpper(field("currency"))}
+
+	date, err := parseDate(field("date"), layout)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Date = date
+
+	if cols["amount"] >= 0 {
+		row.Amount, err = ParseAmount(field("amount"), m.DecimalComma)
+	} else {
+		row.Amount, err = debitCreditAmount(field("debit"), field("credit"), m.DecimalComma)
+	}
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	if m.InvertSign {
+		row.Amount = -row.Amount
+	}
+	if row.Amount == 0 {
+		row.Error = "amount is zero"
+	}
+	return row
+}
+
+// debitCreditAmount combines separate debit (out) and credit (in) columns into a signed amount.
+func debitCreditAmount(debit, credit string, decimalComma bool) (models.Money, error) {
+	var total models.Money
+	if debit != "" {
+		amount, err := ParseAmount(debit, decimalComma)
+		if err != nil {
+			return 0, err
+		}
+		if amount > 0 {
+			amount = -amount
+		}
+		total += amount
+	}
+	if credit != "" {
+		amount, err := ParseAmount(credit, decimalComma)
+		if err != nil {
+			return 0, err
+		}
+		if amount < 0 {
+			amount = -amount
+		}
+		total += amount
+	}
+	return total, nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, f := range record {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
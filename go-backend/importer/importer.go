@@ -0,0 +1,168 @@
+// Package importer parses bank statement files (CSV, OFX/QFX and QIF) into
+// a common row format. It does no database work; handlers/import.go previews,
+// de-duplicates and commits the parsed rows.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+// Supported statement formats
+const (
+	FormatCSV = "csv"
+	FormatOFX = "ofx"
+	FormatQFX = "qfx"
+	FormatQIF = "qif"
+)
+
+// ErrUnsupportedFormat is returned for formats other than csv, ofx, qfx and qif.
+var ErrUnsupportedFormat = errors.New("unsupported import format: expected csv, ofx, qfx or qif")
+
+// Row is one parsed statement entry. Amount is signed as on the statement:
+// negative for money going out, positive for money coming in.
+// Rows that could not be parsed carry an Error and should not be imported.
+type Row struct {
+	Line        int          `json:"line"` // line (CSV, QIF) or record number (OFX) in the source file
+	Date        string       `json:"date"` // YYYY-MM-DD
+	Amount      models.Money `json:"amount"`
+	Description string       `json:"description"`
+	Currency    string       `json:"currency,omitempty"`
+	Reference   string       `json:"reference,omitempty"` // bank transaction ID or check number, if present
+	Error       string       `json:"error,omitempty"`
+}
+
+// DetectFormat returns the explicit format if given, otherwise infers it from the file extension.
+func DetectFormat(format, filename string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	switch format {
+	case FormatCSV, FormatOFX, FormatQFX, FormatQIF:
+		return format, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// ParseAmount parses a statement amount leniently: currency symbols, spaces and thousands
+// separators are ignored, and "(12.30)" or a trailing minus mean negative. With decimalComma
+// the comma is the decimal separator ("1.234,56"). More than two decimal places is an error.
+func ParseAmount(s string, decimalComma bool) (models.Money, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	if strings.HasSuffix(s, "-") {
+		negative = true
+		s = strings.TrimSuffix(s, "-")
+	}
+
+	decimalSep, groupSep := '.', ','
+	if decimalComma {
+		decimalSep, groupSep = ',', '.'
+	}
+
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == decimalSep:
+			b.WriteRune('.')
+		case c == '-' || c == '+':
+			if b.Len() > 0 {
+				return 0, fmt.Errorf("invalid amount %q", s)
+			}
+			if c == '-' {
+				negative = !negative
+			}
+		case c == groupSep || c == ' ' || c == '\u00a0' || c == '\'':
+			// thousands separators
+		case strings.ContainsRune("$€£₹¥", c) || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'):
+			// currency symbols and codes
+		default:
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	amount, err := models.ParseMoney(b.String())
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// dateLayouts maps user-facing date patterns to Go layouts.
+var dateLayouts = map[string]string{
+	"YYYY-MM-DD": "2006-01-02",
+	"YYYY/MM/DD": "2006/01/02",
+	"YYYYMMDD":   "20060102",
+	"DD/MM/YYYY": "02/01/2006",
+	"MM/DD/YYYY": "01/02/2006",
+	"DD.MM.YYYY": "02.01.2006",
+	"DD-MM-YYYY": "02-01-2006",
+	"MM-DD-YYYY": "01-02-2006",
+	"DD/MM/YY":   "02/01/06",
+	"MM/DD/YY":   "01/02/06",
+}
+
+// DateLayout converts a pattern such as "DD/MM/YYYY" to a Go time layout.
+// An empty pattern means YYYY-MM-DD.
+func DateLayout(pattern string) (string, error) {
+	if pattern == "" {
+		return "2006-01-02", nil
+	}
+	layout, ok := dateLayouts[strings.ToUpper(strings.TrimSpace(pattern))]
+	if !ok {
+		return "", fmt.Errorf("unsupported date format %q", pattern)
+	}
+	return layout, nil
+}
+
+// parseDate parses s with layout, tolerating single-digit day and month values.
+func parseDate(s, layout string) (string, error) {
+	s = strings.TrimSpace(s)
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		// "1/2/2025" does not match "01/02/2006"; retry with non-padded fields
+		loose := strings.NewReplacer("01", "1", "02", "2").Replace(layout)
+		if t, err = time.Parse(loose, s); err != nil {
+			return "", fmt.Errorf("invalid date %q", s)
+		}
+	}
+	return t.Format("2006-01-02"), nil
+}
+
+// columnIndex resolves a column reference (header name, case-insensitive, or 1-based index).
+// Returns -1 for an empty reference.
+func columnIndex(ref string, header []string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return -1, nil
+	}
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 {
+			return 0, fmt.Errorf("column index %d must be 1 or greater", n)
+		}
+		return n - 1, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), ref) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("column %q not found in header", ref)
+}
@@ -0,0 +1,251 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input        string
+		decimalComma bool
+		want         models.Money
+		wantErr      bool
+	}{
+		{input: "-12.34", want: -1234},
+		{input: "1,234.56", want: 123456},
+		{input: "$ 99.90", want: 9990},
+		{input: "(45.00)", want: -4500},
+		{input: "45.00-", want: -4500},
+		{input: "+7", want: 700},
+		{input: "1.234,56", decimalComma: true, want: 123456},
+		{input: "-0,5", decimalComma: true, want: -50},
+		{input: "12.345", wantErr: true},
+		{input: "", wantErr: true},
+		{input: "1-2", wantErr: true},
+		{input: "12#", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.input, tt.decimalComma)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAmount(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		format, filename, want string
+		wantErr                bool
+	}{
+		{format: "", filename: "statement.OFX", want: FormatOFX},
+		{format: "", filename: "export.qfx", want: FormatQFX},
+		{format: "QIF", filename: "data.txt", want: FormatQIF},
+		{format: "", filename: "data.xlsx", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := DetectFormat(tt.format, tt.filename)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("DetectFormat(%q, %q) = (%q, %v), want %q", tt.format, tt.filename, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseCSVWithAmountColumn(t *testing.T) {
+	input := "\ufeffBooking Date;Text;Amount;Ccy\n" +
+		"15.01.2025;Coffee \"Corner\";-3,50;eur\n" +
+		"\n" +
+		"16.01.2025;Salary;2.500,00;EUR\n" +
+		"31.02.2025;Bad date;-1,00;EUR\n"
+
+	rows, err := ParseCSV(strings.NewReader(input), CSVMapping{
+		Date: "booking date", Amount: "Amount", Description: "Text", Currency: "4",
+		DateFormat: "DD.MM.YYYY", Delimiter: ';', DecimalComma: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	want := Row{Line: 2, Date: "2025-01-15", Amount: -350, Description: `Coffee "Corner"`, Currency: "EUR"}
+	if rows[0] != want {
+		t.Errorf("rows[0] = %+v, want %+v", rows[0], want)
+	}
+	if rows[1].Line != 4 || rows[1].Amount != 250000 {
+		t.Errorf("rows[1] = %+v, want line 4 amount 2500.00", rows[1])
+	}
+	if rows[2].Error == "" {
+		t.Errorf("expected an error for an invalid date, got %+v", rows[2])
+	}
+}
+
+func TestParseCSVWithDebitCreditColumns(t *testing.T) {
+	input := "1/5/2025,Rent,1200.00,\n" +
+		"1/6/2025,Refund,,25.10\n"
+
+	rows, err := ParseCSV(strings.NewReader(input), CSVMapping{
+		Date: "1", Description: "2", Debit: "3", Credit: "4", DateFormat: "MM/DD/YYYY", NoHeader: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Amount != -120000 || rows[1].Amount != 2510 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	if rows[0].Date != "2025-01-05" || rows[0].Line != 1 {
+		t.Errorf("rows[0] = %+v", rows[0])
+	}
+}
+
+func TestParseCSVMappingErrors(t *testing.T) {
+	header := "date,description,amount\n"
+	tests := []struct {
+		name    string
+		mapping CSVMapping
+	}{
+		{name: "missing amount", mapping: CSVMapping{Date: "date", Description: "description"}},
+		{name: "unknown column", mapping: CSVMapping{Date: "posted", Description: "description", Amount: "amount"}},
+		{name: "unknown date format", mapping: CSVMapping{Date: "date", Description: "description", Amount: "amount", DateFormat: "YYYY.DDD"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCSV(strings.NewReader(header), tt.mapping); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseOFXSGML(t *testing.T) {
+	input := `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>GBP
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20250114120000.000[0:GMT]
+<TRNAMT>-42.10
+<FITID>T1001
+<NAME>TESCO STORES
+<MEMO>Card payment
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20250115
+<TRNAMT>1500.00
+<FITID>T1002
+<NAME>ACME &amp; SONS
+</STMTTRN>
+<STMTTRN>
+<DTPOSTED>2025
+<TRNAMT>1.00
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>`
+
+	rows, err := ParseOFX(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	want := Row{Line: 1, Date: "2025-01-14", Amount: -4210, Description: "TESCO STORES - Card payment", Currency: "GBP", Reference: "T1001"}
+	if rows[0] != want {
+		t.Errorf("rows[0] = %+v, want %+v", rows[0], want)
+	}
+	if rows[1].Description != "ACME & SONS" || rows[1].Amount != 150000 {
+		t.Errorf("rows[1] = %+v", rows[1])
+	}
+	if rows[2].Error == "" {
+		t.Errorf("expected an error for a truncated date, got %+v", rows[2])
+	}
+}
+
+func TestParseOFXXML(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX><CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+<CURDEF>USD</CURDEF>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20250201</DTPOSTED><TRNAMT>-9.99</TRNAMT><FITID>X1</FITID><NAME>Streaming</NAME></STMTTRN>
+</BANKTRANLIST>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`
+
+	rows, err := ParseOFX(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Row{Line: 1, Date: "2025-02-01", Amount: -999, Description: "Streaming", Currency: "USD", Reference: "X1"}
+	if len(rows) != 1 || rows[0] != want {
+		t.Fatalf("rows = %+v, want [%+v]", rows, want)
+	}
+}
+
+func TestParseOFXRejectsOtherFiles(t *testing.T) {
+	if _, err := ParseOFX(strings.NewReader("date,amount\n")); err == nil {
+		t.Error("expected an error for non-OFX input")
+	}
+}
+
+func TestParseQIF(t *testing.T) {
+	input := "!Type:Bank\n" +
+		"D1/15'25\n" +
+		"T-1,250.00\n" +
+		"PLandlord\n" +
+		"MJanuary rent\n" +
+		"N1042\n" +
+		"^\n" +
+		"D01/16/2025\n" +
+		"U300.00\n" +
+		"PPaycheck\n" +
+		"^\n" +
+		"!Type:Cat\n" +
+		"NGroceries\n" +
+		"^\n" +
+		"!Type:Bank\n" +
+		"D13/45/2025\n" +
+		"T-5.00\n" +
+		"^\n"
+
+	rows, err := ParseQIF(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3 (category list skipped): %+v", len(rows), rows)
+	}
+	want := Row{Line: 2, Date: "2025-01-15", Amount: -125000, Description: "Landlord - January rent", Reference: "1042"}
+	if rows[0] != want {
+		t.Errorf("rows[0] = %+v, want %+v", rows[0], want)
+	}
+	if rows[1].Date != "2025-01-16" || rows[1].Amount != 30000 || rows[1].Line != 8 {
+		t.Errorf("rows[1] = %+v", rows[1])
+	}
+	if rows[2].Error == "" {
+		t.Errorf("expected an error for an invalid date, got %+v", rows[2])
+	}
+}
+
+func TestParseQIFDayFirstDates(t *testing.T) {
+	input := "!Type:CCard\nD15/01/2025\nT-20.00\nPCafe\n^\n"
+	rows, err := ParseQIF(strings.NewReader(input), "DD/MM/YYYY")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Date != "2025-01-15" {
+		t.Fatalf("rows = %+v", rows)
+	}
+}
@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ofxTag matches an opening or closing OFX tag and the text that follows it. It handles both
+// OFX 1.x SGML (leaf elements without closing tags) and OFX 2.x XML.
+var ofxTag = regexp.MustCompile(`<(/?)([A-Za-z0-9.]+)>([^<]*)`)
+
+// ParseOFX parses an OFX or QFX statement (QFX is OFX with Quicken-specific headers).
+// Every STMTTRN aggregate becomes one row, numbered in file order. The statement's
+// CURDEF sets the currency of the transactions that follow it.
+func ParseOFX(r io.Reader) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OFX file: %w", err)
+	}
+	content := string(data)
+	if !strings.Contains(strings.ToUpper(content), "<OFX>") {
+		return nil, fmt.Errorf("not an OFX file: missing <OFX> element")
+	}
+
+	var rows []Row
+	var currency string
+	var fields map[string]string // non-nil while inside a STMTTRN aggregate
+	record := 0
+
+	for _, m := range ofxTag.FindAllStringSubmatch(content, -1) {
+		closing, name, value := m[1] == "/", strings.ToUpper(m[2]), strings.TrimSpace(html.UnescapeString(m[3]))
+
+		switch {
+		case name == "STMTTRN" && !closing:
+			fields = map[string]string{}
+			record++
+		case name == "STMTTRN" && closing:
+			if fields != nil {
+				rows = append(rows, ofxRow(fields, currency, record))
+				fields = nil
+			}
+		case name == "CURDEF" && !closing:
+			currency = strings.ToUpper(value)
+		case fields != nil && !closing && value != "":
+			fields[name] = value
+		}
+	}
+	if fields != nil {
+		// Unterminated final aggregate
+		rows = append(rows, ofxRow(fields, currency, record))
+	}
+	return rows, nil
+}
+
+func ofxRow(fields map[string]string, currency string, record int) Row {
+	row := Row{
+		Line:        record,
+		Description: joinDescription(fields["NAME"], fields["MEMO"]),
+		Currency:    currency,
+		Reference:   fields["FITID"],
+	}
+
+	posted := fields["DTPOSTED"]
+	if len(posted) < 8 {
+		row.Error = fmt.Sprintf("invalid date %q", posted)
+		return row
+	}
+	date, err := parseDate(posted[:8], "20060102")
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Date = date
+
+	amount, err := ParseAmount(fields["TRNAMT"], false)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Amount = amount
+	if amount == 0 {
+		row.Error = "amount is zero"
+	}
+	return row
+}
+
+// joinDescription combines a payee and memo, skipping empty or repeated parts.
+func joinDescription(payee, memo string) string {
+	payee, memo = strings.TrimSpace(payee), strings.TrimSpace(memo)
+	switch {
+	case payee == "":
+		return memo
+	case memo == "" || strings.EqualFold(payee, memo):
+		return payee
+	default:
+		return payee + " - " + memo
+	}
+}
@@ -0,0 +1,126 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseQIF parses a Quicken Interchange Format file. Only bank/cash/credit card records are
+// read: D (date), T or U (amount), P (payee), M (memo) and N (check number), terminated by '^'.
+// dateFormat is a pattern such as "DD/MM/YYYY"; empty means the US default MM/DD/YYYY.
+// Apostrophe year separators ("1/15'25") and two-digit years are accepted.
+func ParseQIF(r io.Reader, dateFormat string) ([]Row, error) {
+	if dateFormat == "" {
+		dateFormat = "MM/DD/YYYY"
+	}
+	layout, err := DateLayout(dateFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	var rows []Row
+	fields := map[string]string{}
+	start := 0
+	line := 0
+	skipping := false // inside a non-transaction section such as !Account or !Type:Cat
+
+	flush := func() {
+		if len(fields) > 0 && !skipping {
+			rows = append(rows, qifRow(fields, layout, start))
+		}
+		fields = map[string]string{}
+		start = 0
+	}
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "!") {
+			flush()
+			header := strings.ToLower(strings.TrimSpace(text))
+			switch header {
+			case "!type:bank", "!type:cash", "!type:ccard", "!type:oth a", "!type:oth l":
+				skipping = false
+			default:
+				skipping = !strings.HasPrefix(header, "!option") && !strings.HasPrefix(header, "!clear")
+			}
+			continue
+		}
+		if text == "^" {
+			flush()
+			continue
+		}
+
+		if start == 0 {
+			start = line
+		}
+		code, value := text[:1], strings.TrimSpace(text[1:])
+		if _, seen := fields[code]; !seen {
+			fields[code] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read QIF file: %w", err)
+	}
+	flush()
+
+	return rows, nil
+}
+
+func qifRow(fields map[string]string, layout string, line int) Row {
+	row := Row{
+		Line:        line,
+		Description: joinDescription(fields["P"], fields["M"]),
+		Reference:   fields["N"],
+	}
+
+	date, err := parseQIFDate(fields["D"], layout)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Date = date
+
+	amountStr := fields["T"]
+	if amountStr == "" {
+		amountStr = fields["U"]
+	}
+	amount, err := ParseAmount(amountStr, false)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Amount = amount
+	if amount == 0 {
+		row.Error = "amount is zero"
+	}
+	return row
+}
+
+// parseQIFDate normalizes Quicken date quirks ("1/15'25", "1/15/25", " 1/ 5/2025") before parsing.
+func parseQIFDate(s, layout string) (string, error) {
+	normalized := strings.ReplaceAll(strings.ReplaceAll(s, " ", ""), "'", "/")
+
+	// Expand a two-digit year so the four-digit layouts apply
+	if i := strings.LastIndexAny(normalized, "/.-"); i >= 0 && len(normalized)-i-1 == 2 && strings.HasSuffix(layout, "2006") {
+		normalized = normalized[:i+1] + "20" + normalized[i+1:]
+	}
+
+	if date, err := parseDate(normalized, layout); err == nil {
+		return date, nil
+	}
+	if date, err := parseDate(normalized, "2006-01-02"); err == nil {
+		return date, nil
+	}
+	return "", fmt.Errorf("invalid date %q", s)
+}
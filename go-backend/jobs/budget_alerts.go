@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/handlers"
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/notify"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// BudgetAlertJob notifies users when budgets they created reach an alert threshold. It checks every
+// ledger on a schedule and individual ledgers on demand after their transactions change.
+type BudgetAlertJob struct {
+	db       *sql.DB
+	notifier notify.Notifier
+	pending  chan int
+	quit     chan struct{}
+}
+
+// StartBudgetAlertJob launches the budget alert job in a background goroutine, delivering
+// through notifier. Call Stop to shut it down gracefully.
+func StartBudgetAlertJob(db *sql.DB, notifier notify.Notifier) *BudgetAlertJob {
+	j := &BudgetAlertJob{
+		db:       db,
+		notifier: notifier,
+		pending:  make(chan int, constants.BudgetAlertQueueSize),
+		quit:     make(chan struct{}),
+	}
+	go func() {
+		ticker := time.NewTicker(constants.BudgetAlertCheckInterval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		j.checkAll()
+
+		for {
+			select {
+			case ledgerID := <-j.pending:
+				j.check(ledgerID)
+			case <-ticker.C:
+				j.checkAll()
+			case <-j.quit:
+				slog.Info("Budget alert job shutting down gracefully")
+				return
+			}
+		}
+	}()
+	return j
+}
+
+// Trigger queues a check of the ledger's budgets, e.g. after a transaction is written.
+// It never blocks; when the queue is full the scheduled check picks the ledger up instead.
+func (j *BudgetAlertJob) Trigger(ledgerID int) {
+	select {
+	case j.pending <- ledgerID:
+	default:
+		slog.Warn("Budget alerts: queue full, deferring to scheduled check", "ledger_id", ledgerID)
+	}
+}
+
+// Stop shuts the job down.
+func (j *BudgetAlertJob) Stop() {
+	close(j.quit)
+}
+
+func (j *BudgetAlertJob) checkAll() {
+	ledgerIDs, err := handlers.LedgersWithBudgets(context.Background(), j.db)
+	if err != nil {
+		slog.Error("Budget alerts: error listing ledgers", "error", err)
+		return
+	}
+	for _, ledgerID := range ledgerIDs {
+		j.check(ledgerID)
+	}
+}
+
+// check records the ledger's newly reached thresholds and delivers one notification for each to
+// the budget's creator. Thresholds are recorded before delivery, so a failed delivery is logged
+// rather than retried.
+func (j *BudgetAlertJob) check(ledgerID int) {
+	events, err := handlers.RecordBudgetAlerts(context.Background(), j.db, ledgerID)
+	if err != nil {
+		slog.Error("Budget alerts: error evaluating budgets", "error", err, "ledger_id", ledgerID)
+	}
+
+	emails := make(map[int]string)
+	for _, e := range events {
+		userID := e.Budget.UserID
+		email, ok := emails[userID]
+		if !ok {
+			email, err = userEmail(j.db, userID)
+			if err != nil {
+				slog.Error("Budget alerts: error loading user email", "error", err, "user_id", userID)
+			}
+			emails[userID] = email
+		}
+		n := budgetAlertNotification(userID, email, e)
+		ctx, cancel := context.WithTimeout(context.Background(), constants.NotificationTimeout)
+		err := j.notifier.Notify(ctx, n)
+		cancel()
+		if err != nil {
+			slog.Error("Budget alerts: delivery failed", "error", err, "user_id", userID, "budget_id", e.Budget.ID)
+			continue
+		}
+		slog.Info("Budget alert sent", "user_id", userID, "budget_id", e.Budget.ID, "threshold", e.Threshold)
+	}
+}
+
+func userEmail(db *sql.DB, userID int) (string, error) {
+	ctx, cancel := utils.DBContext(nil)
+	defer cancel()
+
+	var email string
+	err := db.QueryRowContext(ctx, `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return email, err
+}
+
+// budgetAlertNotification describes a reached budget threshold.
+func budgetAlertNotification(userID int, email string, e handlers.BudgetAlertEvent) notify.Notification {
+	b := e.Budget
+	title := fmt.Sprintf("%s budget reached %d%%", b.CategoryName, e.Threshold)
+	if e.Threshold == handlers.BudgetExceededThreshold {
+		title = fmt.Sprintf("%s budget used up", b.CategoryName)
+	}
+	body := fmt.Sprintf("You have spent %s of %s available for %s to %s.",
+		b.CurrentSpending, b.Available, b.PeriodStart, b.PeriodEnd)
+	if b.CurrentSpending > b.Available {
+		body += fmt.Sprintf(" That is %s over budget.", b.CurrentSpending-b.Available)
+	}
+
+	return notify.Notification{
+		UserID: userID,
+		Email:  email,
+		Kind:   models.NotificationBudgetAlert,
+		Title:  title,
+		Body:   body,
+		Data: map[string]any{
+			"budget_id":        b.ID,
+			"ledger_id":        b.LedgerID,
+			"category_id":      b.CategoryID,
+			"threshold":        e.Threshold,
+			"period_start":     b.PeriodStart,
+			"period_end":       b.PeriodEnd,
+			"current_spending": b.CurrentSpending,
+			"available":        b.Available,
+		},
+		CreatedAt: time.Now().UTC(),
+	}
+}
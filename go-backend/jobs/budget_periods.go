@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/handlers"
+)
+
+// StartBudgetPeriodJob launches a background goroutine that records ended budget periods
+// (planned vs actual, plus rollover carry) for every user, so budget history is kept even for
+// users who don't open their budgets. Returns a channel that can be closed to stop the job gracefully.
+func StartBudgetPeriodJob(db *sql.DB) chan struct{} {
+	quit := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(constants.BudgetPeriodCloseInterval)
+		defer ticker.Stop()
+
+		// Run once immediately on startup
+		closeBudgetPeriods(db)
+
+		for {
+			select {
+			case <-ticker.C:
+				closeBudgetPeriods(db)
+			case <-quit:
+				slog.Info("Budget period job shutting down gracefully")
+				return
+			}
+		}
+	}()
+	return quit
+}
+
+func closeBudgetPeriods(db *sql.DB) {
+	closed, err := handlers.CloseBudgetPeriods(context.Background(), db, 0, time.Now())
+	if err != nil {
+		slog.Error("Budget periods: error closing ended periods", "error", err)
+		return
+	}
+	if closed > 0 {
+		slog.Info("Budget periods closed", "count", closed)
+	}
+}
@@ -1,10 +1,14 @@
 package jobs
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/vidya381/myspendo-backend/handlers"
 	"github.com/vidya381/myspendo-backend/models"
 	"github.com/vidya381/myspendo-backend/utils"
 )
@@ -36,7 +40,11 @@ func StartRecurringJob(db *sql.DB) chan struct{} {
 
 // ProcessRecurringTransactions checks all recurring transaction rules and creates due transactions.
 // Uses PostgreSQL advisory locks to prevent concurrent processing by multiple instances.
-// Transactions are created for all missed occurrences up to the current date.
+// Transactions are created for all missed occurrences up to the current date in the rule owner's time
+// zone, so an occurrence is due once its day has started for the user. Each rule's occurrences
+// and its last_occurrence are written in one database transaction, and every created transaction
+// records its rule and occurrence date, which are unique together, so a retried run never duplicates
+// an occurrence. Each run is recorded in recurring_job_runs.
 func ProcessRecurringTransactions(db *sql.DB) {
 	// Use PostgreSQL advisory lock to prevent multiple instances from processing simultaneously
 	// Lock ID: 123456789 (arbitrary number for this specific job)
@@ -59,76 +67,42 @@ func ProcessRecurringTransactions(db *sql.DB) {
 		}
 	}()
 
-	rows, err := db.Query(`
-		SELECT id, user_id, category_id, amount, description, start_date, recurrence, last_occurrence
-		FROM recurring_transactions
-	`)
+	var runID int
+	if err := db.QueryRow(`INSERT INTO recurring_job_runs DEFAULT VALUES RETURNING id`).Scan(&runID); err != nil {
+		slog.Error("Recurring jobs: error recording run", "error", err)
+	}
+
+	now := time.Now()
+
+	var totalProcessed, totalFailed, totalCreated int
+	rules, err := activeRecurringTransactions(db)
 	if err != nil {
 		slog.Error("Recurring jobs: error querying", "error", err)
+		finishJobRun(db, runID, 0, 0, 0, err)
 		return
 	}
-	defer rows.Close()
-	// Use UTC and truncate to midnight for consistent date-only comparison across timezones
-	now := time.Now().UTC().Truncate(24 * time.Hour)
 
-	var totalProcessed, totalFailed, totalCreated int
-
-	for rows.Next() {
-		var rt models.RecurringTransaction
-		var lastOccurrence sql.NullTime
-		var startDate time.Time
+	for _, rule := range rules {
+		rt := rule.RecurringTransaction
+		dueDates := GetAllMissedDueDates(rt, utils.DateIn(now, rule.loc))
+		if len(dueDates) == 0 {
+			continue
+		}
+		totalProcessed++
 
-		err := rows.Scan(&rt.ID, &rt.UserID, &rt.CategoryID, &rt.Amount, &rt.Description, &startDate, &rt.Recurrence, &lastOccurrence)
+		created, err := createOccurrences(db, rt, dueDates)
 		if err != nil {
-			slog.Error("Recurring jobs: error scanning row", "error", err)
+			slog.Error("Recurring jobs: error creating transactions", "error", err, "recurring_id", rt.ID)
+			totalFailed++
 			continue
 		}
-		rt.StartDate = startDate.Format("2006-01-02")
-		if lastOccurrence.Valid {
-			rt.LastOccurrence = &lastOccurrence.Time
-		} else {
-			rt.LastOccurrence = nil
-		}
-
-		dueDates := GetAllMissedDueDates(rt, now)
-		if len(dueDates) > 0 {
-			totalProcessed++
-			var failedCount int
-			// Create transactions with fresh context for each batch
-			for _, dueDate := range dueDates {
-				ctx, cancel := utils.DBContext(nil)
-				_, err := db.ExecContext(ctx,
-					`INSERT INTO transactions (user_id, category_id, amount, description, date)
-					VALUES ($1, $2, $3, $4, $5)`,
-					rt.UserID, rt.CategoryID, rt.Amount, rt.Description, dueDate.Format("2006-01-02"),
-				)
-				cancel()
-				if err != nil {
-					slog.Error("Recurring jobs: error creating transaction", "error", err, "recurring_id", rt.ID, "date", dueDate.Format("2006-01-02"))
-					failedCount++
-					continue
-				}
-				totalCreated++
-			}
-
-			if failedCount > 0 {
-				totalFailed++
-			}
-
-			// Update last_occurrence to latest due date with fresh context
-			latestDue := dueDates[len(dueDates)-1]
-			ctx, cancel := utils.DBContext(nil)
-			_, err = db.ExecContext(ctx,
-				`UPDATE recurring_transactions SET last_occurrence = $1 WHERE id = $2`,
-				latestDue.Format("2006-01-02"), rt.ID)
-			cancel()
-			if err != nil {
-				slog.Error("Recurring jobs: error updating last_occurrence", "error", err, "recurring_id", rt.ID)
-			} else {
-				slog.Info("Updated recurring transaction", "recurring_id", rt.ID, "last_occurrence", latestDue.Format("2006-01-02"))
-			}
+		totalCreated += created
+		if created > 0 {
+			notifyRecurringCreated(db, rt, dueDates, created)
 		}
+		slog.Info("Updated recurring transaction", "recurring_id", rt.ID, "last_occurrence", dueDates[len(dueDates)-1].Format("2006-01-02"))
 	}
+	finishJobRun(db, runID, totalProcessed, totalCreated, totalFailed, nil)
 
 	// Log summary of job execution
 	if totalProcessed > 0 {
@@ -145,95 +119,161 @@ func ProcessRecurringTransactions(db *sql.DB) {
 	}
 }
 
-// GetAllMissedDueDates calculates all due dates for a recurring transaction up to today (inclusive).
-// Handles month-end and leap year edge cases for monthly and yearly recurrences.
-// Returns an empty slice if the start date is in the future or if there are no due dates.
-func GetAllMissedDueDates(rt models.RecurringTransaction, today time.Time) []time.Time {
-	layout := "2006-01-02"
-	start, err := time.Parse(layout, rt.StartDate)
+// activeRule is a rule the processor may create occurrences for, with its owner's time zone.
+type activeRule struct {
+	models.RecurringTransaction
+	loc *time.Location
+}
+
+// activeRecurringTransactions loads every rule that isn't paused, with its exception dates.
+func activeRecurringTransactions(db *sql.DB) ([]activeRule, error) {
+	ctx, cancel := utils.DBContext(nil)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.id, r.ledger_id, r.user_id, r.category_id, r.amount, r.currency, r.account_id, r.description, r.start_date, r.recurrence, r.rrule, r.last_occurrence,
+			(SELECT COALESCE(string_agg(to_char(e.date, 'YYYY-MM-DD'), ','), '')
+			 FROM recurring_exceptions e WHERE e.recurring_id = r.id),
+			u.timezone
+		FROM recurring_transactions r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.status = 'active'
+	`)
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Normalize to midnight UTC to avoid timezone issues
-	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
-	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	var rules []activeRule
+	for rows.Next() {
+		var rt models.RecurringTransaction
+		var lastOccurrence sql.NullTime
+		var accountID sql.NullInt64
+		var startDate time.Time
+		var exceptions, timezone string
 
-	// Start date is in the future, no transactions due yet
-	if start.After(today) {
-		return nil
+		err := rows.Scan(&rt.ID, &rt.LedgerID, &rt.UserID, &rt.CategoryID, &rt.Amount, &rt.Currency, &accountID, &rt.Description, &startDate, &rt.Recurrence, &rt.RRule, &lastOccurrence, &exceptions, &timezone)
+		if err != nil {
+			slog.Error("Recurring jobs: error scanning row", "error", err)
+			continue
+		}
+		rt.StartDate = startDate.Format("2006-01-02")
+		if exceptions != "" {
+			rt.Exceptions = strings.Split(exceptions, ",")
+		}
+		if lastOccurrence.Valid {
+			rt.LastOccurrence = &lastOccurrence.Time
+		}
+		if accountID.Valid {
+			id := int(accountID.Int64)
+			rt.AccountID = &id
+		}
+		rules = append(rules, activeRule{RecurringTransaction: rt, loc: utils.LocationOrUTC(timezone)})
 	}
+	return rules, rows.Err()
+}
 
-	var next time.Time
-	if rt.LastOccurrence != nil {
-		last := *rt.LastOccurrence
-		last = time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC)
-		// Calculate next occurrence after last
-		next = calculateNextOccurrence(last, start, rt.Recurrence)
-	} else {
-		// No last occurrence, start from the start date
-		next = start
+// createOccurrences inserts a transaction for each due date of a rule and moves its last_occurrence to the
+// latest one, all in one database transaction. Occurrences that already exist are left alone.
+// Returns how many transactions were created.
+func createOccurrences(db *sql.DB, rt models.RecurringTransaction, dueDates []time.Time) (int, error) {
+	ctx, cancel := utils.DBContext(nil)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	var dueDates []time.Time
-	// Limit to prevent infinite loops or excessive processing (max 3650 days / ~10 years of daily)
-	maxIterations := 3650
-	iterations := 0
+	created := 0
+	for _, dueDate := range dueDates {
+		date := dueDate.Format("2006-01-02")
+		result, err := tx.ExecContext(ctx,
+			`INSERT INTO transactions (user_id, category_id, amount, currency, description, date, recurring_id, occurrence_date, ledger_id, account_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $6, $8, $9)
+			ON CONFLICT (recurring_id, occurrence_date) DO NOTHING`,
+			rt.UserID, rt.CategoryID, rt.Amount, rt.Currency, rt.Description, date, rt.ID, rt.LedgerID, rt.AccountID,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create transaction for %s: %w", date, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			created++
+		}
+	}
 
-	for !next.After(today) && iterations < maxIterations {
-		dueDates = append(dueDates, next)
-		next = calculateNextOccurrence(next, start, rt.Recurrence)
-		iterations++
+	_, err = tx.ExecContext(ctx,
+		`UPDATE recurring_transactions SET last_occurrence = $1 WHERE id = $2`,
+		dueDates[len(dueDates)-1].Format("2006-01-02"), rt.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update last_occurrence: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
 	}
+	return created, nil
+}
 
-	return dueDates
+// finishJobRun records the outcome of a run started with runID (0 if the start couldn't be recorded).
+func finishJobRun(db *sql.DB, runID, processed, created, failed int, runErr error) {
+	if runID == 0 {
+		return
+	}
+	errText := ""
+	if runErr != nil {
+		errText = runErr.Error()
+	}
+
+	ctx, cancel := utils.DBContext(nil)
+	defer cancel()
+	_, err := db.ExecContext(ctx,
+		`UPDATE recurring_job_runs
+		 SET finished_at = CURRENT_TIMESTAMP, rules_processed = $2, transactions_created = $3, failed_rules = $4, error = $5
+		 WHERE id = $1`,
+		runID, processed, created, failed, errText)
+	if err != nil {
+		slog.Error("Recurring jobs: error recording run", "error", err, "run_id", runID)
+	}
 }
 
-// calculateNextOccurrence calculates the next occurrence date based on recurrence type
-// For monthly recurrence, preserves the original day-of-month from start date when possible
-func calculateNextOccurrence(current time.Time, start time.Time, recurrence string) time.Time {
-	switch recurrence {
-	case "daily":
-		return current.AddDate(0, 0, 1)
-	case "weekly":
-		return current.AddDate(0, 0, 7)
-	case "monthly":
-		// Preserve the day from start date, handling month-end edge cases
-		targetDay := start.Day()
-		next := current.AddDate(0, 1, 0)
-
-		// Handle month-end dates (e.g., Jan 31 -> Feb 28/29)
-		// Get last day of the target month
-		firstOfNextMonth := time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, time.UTC)
-		lastDayOfMonth := firstOfNextMonth.AddDate(0, 0, -1).Day()
-
-		if targetDay > lastDayOfMonth {
-			// Use last day of month if target day doesn't exist
-			return time.Date(next.Year(), next.Month(), lastDayOfMonth, 0, 0, 0, 0, time.UTC)
-		}
-		return time.Date(next.Year(), next.Month(), targetDay, 0, 0, 0, 0, time.UTC)
-	case "yearly":
-		// Preserve month and day from start date, handling Feb 29 edge case
-		targetMonth := start.Month()
-		targetDay := start.Day()
-		nextYear := current.Year() + 1
-
-		// Handle Feb 29 on non-leap years
-		if targetMonth == time.February && targetDay == 29 {
-			// Check if next year is a leap year
-			if !isLeapYear(nextYear) {
-				// Use Feb 28 instead
-				return time.Date(nextYear, time.February, 28, 0, 0, 0, 0, time.UTC)
-			}
-		}
-		return time.Date(nextYear, targetMonth, targetDay, 0, 0, 0, 0, time.UTC)
-	default:
-		// Unknown recurrence, return current (will cause loop to exit)
-		return current
+// notifyRecurringCreated tells the user in their inbox that a recurring rule created transactions.
+func notifyRecurringCreated(db *sql.DB, rt models.RecurringTransaction, dueDates []time.Time, created int) {
+	name := rt.Description
+	if name == "" {
+		name = "Recurring transaction"
+	}
+	title := fmt.Sprintf("%s: 1 transaction added", name)
+	if created > 1 {
+		title = fmt.Sprintf("%s: %d transactions added", name, created)
+	}
+	body := fmt.Sprintf("Your %s rule added %s %s dated %s.",
+		rt.Recurrence, rt.Amount, rt.Currency, dueDates[len(dueDates)-1].Format("2006-01-02"))
+	if len(dueDates) > 1 {
+		body = fmt.Sprintf("Your %s rule added %s %s for each due date from %s to %s.",
+			rt.Recurrence, rt.Amount, rt.Currency, dueDates[0].Format("2006-01-02"), dueDates[len(dueDates)-1].Format("2006-01-02"))
+	}
+
+	err := handlers.AddNotification(context.Background(), db, rt.UserID, models.NotificationRecurringPosted, title, body,
+		map[string]any{"recurring_id": rt.ID, "created": created})
+	if err != nil {
+		slog.Error("Recurring jobs: error adding notification", "error", err, "recurring_id", rt.ID)
 	}
 }
 
-// isLeapYear checks if a year is a leap year
-func isLeapYear(year int) bool {
-	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+// GetAllMissedDueDates calculates all due dates for a recurring transaction up to today (inclusive).
+// Dates follow the transaction's recurrence rule from its start date; those on or before the last
+// occurrence were already created, and exception dates are skipped. The rule's COUNT and UNTIL end the schedule.
+// Returns an empty slice if the start date is in the future or if there are no due dates.
+func GetAllMissedDueDates(rt models.RecurringTransaction, today time.Time) []time.Time {
+	// Normalize to midnight UTC to avoid timezone issues
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	// Limit to prevent excessive processing (max 3650 dates / ~10 years of daily)
+	dueDates, err := handlers.RecurringOccurrences(rt, today, 3650)
+	if err != nil {
+		slog.Error("Recurring jobs: invalid schedule", "error", err, "recurring_id", rt.ID)
+		return nil
+	}
+	return dueDates
 }
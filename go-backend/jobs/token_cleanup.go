@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/handlers"
+)
+
+// StartTokenCleanupJob launches a background goroutine that periodically deletes
+// expired refresh tokens and access-token revocations.
+// Returns a channel that can be closed to stop the job gracefully.
+func StartTokenCleanupJob(db *sql.DB) chan struct{} {
+	quit := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(constants.TokenCleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				purged, err := handlers.PurgeExpiredTokens(context.Background(), db)
+				if err != nil {
+					slog.Error("Token cleanup: error purging expired tokens", "error", err)
+					continue
+				}
+				if purged > 0 {
+					slog.Info("Token cleanup completed", "purged", purged)
+				}
+			case <-quit:
+				slog.Info("Token cleanup job shutting down gracefully")
+				return
+			}
+		}
+	}()
+	return quit
+}
@@ -1,26 +1,37 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/mail"
+	"net/smtp"
+	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // time zone data for hosts without a zoneinfo database
 
 	"github.com/rs/cors"
 	"github.com/vidya381/myspendo-backend/constants"
 	"github.com/vidya381/myspendo-backend/handlers"
+	"github.com/vidya381/myspendo-backend/importer"
 	"github.com/vidya381/myspendo-backend/jobs"
 	"github.com/vidya381/myspendo-backend/middleware"
 	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/notify"
+	"github.com/vidya381/myspendo-backend/oidc"
+	"github.com/vidya381/myspendo-backend/rrule"
 	"github.com/vidya381/myspendo-backend/utils"
 	"golang.org/x/time/rate"
 
@@ -30,8 +41,26 @@ import (
 
 var jwtSecret string
 
+// adminKey protects operator endpoints; empty disables them
+var adminKey string
+
+// appURL is the frontend address used in links sent by email
+var appURL string
+
+// mailer sends email verification and password reset links
+var mailer notify.Mailer
+
+// emailVerification decides whether unverified accounts may sign in
+var emailVerification handlers.EmailVerificationPolicy
+
+// oidcProvider is the single sign-on identity provider; nil when OIDC_ISSUER isn't set
+var oidcProvider *oidc.Provider
+
 var db *sql.DB
 
+// budgetAlerts notifies users when their budgets reach an alert threshold
+var budgetAlerts *jobs.BudgetAlertJob
+
 func main() {
 	// Initialize structured logger
 	utils.InitLogger()
@@ -40,16 +69,37 @@ func main() {
 	_ = godotenv.Load()
 
 	// Validate all required environment variables
-	if err := utils.ValidateConfig(); err != nil {
+	var err error
+	if err = utils.ValidateConfig(); err != nil {
 		slog.Error("Configuration validation failed", "error", err)
 		os.Exit(1)
 	}
 
 	// Load JWT secret (already validated above)
 	jwtSecret = os.Getenv("JWT_SECRET")
+	adminKey = os.Getenv("ADMIN_API_KEY")
+
+	// Configure email verification, password reset links and how they are sent
+	emailVerification, err = loadEmailVerificationPolicy()
+	if err != nil {
+		slog.Error("Configuration validation failed", "error", err)
+		os.Exit(1)
+	}
+	appURL = strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	if appURL == "" {
+		appURL = "http://localhost:3000"
+		slog.Warn("APP_URL not set, email links point to localhost:3000. Set APP_URL in production.")
+	}
+	mailer = newMailer()
+
+	// Configure single sign-on
+	oidcProvider, err = loadOIDCProvider()
+	if err != nil {
+		slog.Error("Configuration validation failed", "error", err)
+		os.Exit(1)
+	}
 
 	// Connect to database
-	var err error
 	db, err = sql.Open("pgx", getDBConnURL())
 	if err != nil {
 		panic(err)
@@ -69,9 +119,23 @@ func main() {
 
 	slog.Info("Connected to PostgreSQL successfully")
 
+	// Optionally seed exchange rates from a local CSV file
+	if path := os.Getenv("EXCHANGE_RATES_FILE"); path != "" {
+		loadExchangeRatesFile(path)
+	}
+
 	// Start recurring job and capture quit channel for graceful shutdown
 	recurringJobQuit := jobs.StartRecurringJob(db)
 
+	// Start expired token cleanup job
+	tokenCleanupQuit := jobs.StartTokenCleanupJob(db)
+
+	// Start job recording ended budget periods
+	budgetPeriodQuit := jobs.StartBudgetPeriodJob(db)
+
+	// Start budget alert notifications
+	budgetAlerts = jobs.StartBudgetAlertJob(db, newNotifier())
+
 	// Create rate limiter for authentication endpoints
 	authRateLimiter := middleware.NewIPRateLimiter(
 		rate.Limit(constants.AuthRateLimitPerMinute),
@@ -91,30 +155,111 @@ func main() {
 	// Define routes with HTTPS enforcement, security headers, rate limiting
 	mux.HandleFunc("/register", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(registerHandler))))
 	mux.HandleFunc("/login", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(loginHandler))))
-	// Protected routes (require JWT in Authorization header, with API rate limiting)
-	mux.HandleFunc("/category/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, addCategoryHandler)))))
-	mux.HandleFunc("/category/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, listCategoryHandler)))))
-	mux.HandleFunc("/transaction/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, addTransactionHandler)))))
-	mux.HandleFunc("/transaction/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, listTransactionHandler)))))
-	mux.HandleFunc("/transaction/update", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, updateTransactionHandler)))))
-	mux.HandleFunc("/transaction/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, deleteTransactionHandler)))))
-	mux.HandleFunc("/summary/totals", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, summaryTotalsHandler)))))
-	mux.HandleFunc("/summary/monthly", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, summaryMonthlyHandler)))))
-	mux.HandleFunc("/summary/current-month", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, summaryCurrentMonthHandler)))))
-	mux.HandleFunc("/summary/category", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, summaryCategoryHandler)))))
-	mux.HandleFunc("/summary/group", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, summaryGroupHandler)))))
-	mux.HandleFunc("/summary/category/monthly", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, summaryCategoryMonthHandler)))))
-	mux.HandleFunc("/export", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, exportTransactionsHandler)))))
-	mux.HandleFunc("/recurring/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, addRecurringHandler)))))
-	mux.HandleFunc("/recurring/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, listRecurringHandler)))))
-	mux.HandleFunc("/recurring/edit", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, editRecurringHandler)))))
-	mux.HandleFunc("/recurring/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, deleteRecurringHandler)))))
-	mux.HandleFunc("/transactions/search", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, searchAndFilterTransactionsHandler)))))
-	mux.HandleFunc("/budget/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, addBudgetHandler)))))
-	mux.HandleFunc("/budget/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, listBudgetHandler)))))
-	mux.HandleFunc("/budget/update", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, updateBudgetHandler)))))
-	mux.HandleFunc("/budget/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, deleteBudgetHandler)))))
-	mux.HandleFunc("/budget/alerts", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, budgetAlertsHandler)))))
+	mux.HandleFunc("/refresh", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(refreshHandler))))
+	mux.HandleFunc("/logout", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, logoutHandler)))))
+	mux.HandleFunc("/logout-all", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, logoutAllHandler)))))
+	mux.HandleFunc("/me", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, meHandler)))))
+	mux.HandleFunc("/me/update", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, updateMeHandler)))))
+	mux.HandleFunc("/me/password", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, changePasswordHandler)))))
+	mux.HandleFunc("/me/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, deleteMeHandler)))))
+	mux.HandleFunc("/login/2fa", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireTwoFactorChallenge(jwtSecret, isTokenRevoked, twoFactorLoginHandler)))))
+	mux.HandleFunc("/2fa/setup", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, twoFactorSetupHandler)))))
+	mux.HandleFunc("/2fa/enable", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, twoFactorEnableHandler)))))
+	mux.HandleFunc("/2fa/disable", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, twoFactorDisableHandler)))))
+	mux.HandleFunc("/2fa/recovery-codes", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, recoveryCodesHandler)))))
+	mux.HandleFunc("/me/verify-email", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, resendVerificationHandler)))))
+	mux.HandleFunc("/verify-email", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(verifyEmailHandler))))
+	mux.HandleFunc("/password/forgot", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(forgotPasswordHandler))))
+	mux.HandleFunc("/password/reset", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(resetPasswordHandler))))
+	mux.HandleFunc("/auth/oidc/start", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(oidcStartHandler))))
+	mux.HandleFunc("/auth/oidc/callback", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(oidcCallbackHandler))))
+	mux.HandleFunc("/tokens/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, addPersonalTokenHandler)))))
+	mux.HandleFunc("/tokens/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, listPersonalTokensHandler)))))
+	mux.HandleFunc("/tokens/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, deletePersonalTokenHandler)))))
+	mux.HandleFunc("/ledgers/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, addLedgerHandler)))))
+	mux.HandleFunc("/ledgers/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, listLedgersHandler)))))
+	mux.HandleFunc("/ledger/rename", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleOwner, renameLedgerHandler))))))
+	mux.HandleFunc("/ledger/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleOwner, deleteLedgerHandler))))))
+	mux.HandleFunc("/ledger/default", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, defaultLedgerHandler))))))
+	mux.HandleFunc("/ledger/leave", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, leaveLedgerHandler))))))
+	mux.HandleFunc("/ledger/members", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, listLedgerMembersHandler))))))
+	mux.HandleFunc("/ledger/members/update", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleOwner, updateLedgerMemberHandler))))))
+	mux.HandleFunc("/ledger/members/remove", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleOwner, removeLedgerMemberHandler))))))
+	mux.HandleFunc("/ledger/invitations/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleOwner, addLedgerInvitationHandler))))))
+	mux.HandleFunc("/ledger/invitations/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleOwner, listLedgerInvitationsHandler))))))
+	mux.HandleFunc("/ledger/invitations/revoke", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleOwner, revokeLedgerInvitationHandler))))))
+	mux.HandleFunc("/ledger/invitations/accept", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAuth(jwtSecret, isTokenRevoked, acceptLedgerInvitationHandler)))))
+	// Protected routes (require JWT in Authorization header, with API rate limiting). Routes wrapped in
+	// AcceptPersonalToken can also be called with a personal access token that has the given scope.
+	// Routes wrapped in RequireLedger work on the ledger sent in the X-Ledger-ID header (or the user's
+	// default ledger) and need at least the given role in it.
+	mux.HandleFunc("/category/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, addCategoryHandler)))))))
+	mux.HandleFunc("/category/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, listCategoryHandler)))))))
+	mux.HandleFunc("/category/update", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, updateCategoryHandler)))))))
+	mux.HandleFunc("/category/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, deleteCategoryHandler)))))))
+	mux.HandleFunc("/category/merge", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, mergeCategoryHandler)))))))
+	mux.HandleFunc("/transaction/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, addTransactionHandler)))))))
+	mux.HandleFunc("/transaction/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, listTransactionHandler)))))))
+	mux.HandleFunc("/transaction/update", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, updateTransactionHandler)))))))
+	mux.HandleFunc("/transaction/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, deleteTransactionHandler)))))))
+	mux.HandleFunc("/summary/totals", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeReportsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, summaryTotalsHandler)))))))
+	mux.HandleFunc("/summary/monthly", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeReportsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, summaryMonthlyHandler)))))))
+	mux.HandleFunc("/summary/current-month", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeReportsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, summaryCurrentMonthHandler)))))))
+	mux.HandleFunc("/summary/category", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeReportsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, summaryCategoryHandler)))))))
+	mux.HandleFunc("/summary/group", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeReportsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, summaryGroupHandler)))))))
+	mux.HandleFunc("/summary/category/monthly", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeReportsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, summaryCategoryMonthHandler)))))))
+	mux.HandleFunc("/export", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, exportTransactionsHandler)))))))
+	mux.HandleFunc("/recurring/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeRecurringWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, addRecurringHandler)))))))
+	mux.HandleFunc("/recurring/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeRecurringRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, listRecurringHandler)))))))
+	mux.HandleFunc("/recurring/edit", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeRecurringWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, editRecurringHandler)))))))
+	mux.HandleFunc("/recurring/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeRecurringWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, deleteRecurringHandler)))))))
+	mux.HandleFunc("/recurring/pause", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeRecurringWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, pauseRecurringHandler)))))))
+	mux.HandleFunc("/recurring/resume", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeRecurringWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, resumeRecurringHandler)))))))
+	mux.HandleFunc("/recurring/skip", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeRecurringWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, skipRecurringHandler)))))))
+	mux.HandleFunc("/recurring/exceptions/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeRecurringWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, addRecurringExceptionHandler)))))))
+	mux.HandleFunc("/recurring/exceptions/remove", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeRecurringWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, removeRecurringExceptionHandler)))))))
+	mux.HandleFunc("/transactions/search", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, searchAndFilterTransactionsHandler)))))))
+	mux.HandleFunc("/splits/set", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, setSplitHandler)))))))
+	mux.HandleFunc("/splits/get", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, getSplitHandler)))))))
+	mux.HandleFunc("/splits/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, deleteSplitHandler)))))))
+	mux.HandleFunc("/splits/balances", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, splitBalancesHandler)))))))
+	mux.HandleFunc("/settlements/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, addSettlementHandler)))))))
+	mux.HandleFunc("/settlements/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, listSettlementsHandler)))))))
+	mux.HandleFunc("/settlements/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, deleteSettlementHandler)))))))
+	mux.HandleFunc("/accounts/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, addAccountHandler)))))))
+	mux.HandleFunc("/accounts/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, listAccountsHandler)))))))
+	mux.HandleFunc("/accounts/update", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, updateAccountHandler)))))))
+	mux.HandleFunc("/accounts/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, removeAccountHandler)))))))
+	mux.HandleFunc("/accounts/register", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, accountRegisterHandler)))))))
+	mux.HandleFunc("/transfers/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, addTransferHandler)))))))
+	mux.HandleFunc("/transfers/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, listTransfersHandler)))))))
+	mux.HandleFunc("/transfers/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, deleteTransferHandler)))))))
+	mux.HandleFunc("/budget/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeBudgetsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, addBudgetHandler)))))))
+	mux.HandleFunc("/budget/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeBudgetsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, listBudgetHandler)))))))
+	mux.HandleFunc("/budget/update", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeBudgetsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, updateBudgetHandler)))))))
+	mux.HandleFunc("/budget/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeBudgetsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, deleteBudgetHandler)))))))
+	mux.HandleFunc("/budget/alerts", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeBudgetsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, budgetAlertsHandler)))))))
+	mux.HandleFunc("/budget/performance", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeBudgetsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, budgetPerformanceHandler)))))))
+	mux.HandleFunc("/settings/month-start", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, monthStartDayHandler)))))
+	mux.HandleFunc("/settings/balance-floor", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, balanceFloorHandler)))))
+	mux.HandleFunc("/settings/timezone", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, timezoneHandler)))))
+	mux.HandleFunc("/forecast", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeReportsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, forecastHandler)))))))
+	mux.HandleFunc("/settings/currency", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.RequireAuth(jwtSecret, isTokenRevoked, baseCurrencyHandler)))))
+	mux.HandleFunc("/exchange-rates", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeReportsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, listExchangeRatesHandler))))))
+	mux.HandleFunc("/import/preview", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, importPreviewHandler)))))))
+	mux.HandleFunc("/import/commit", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeTransactionsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, importCommitHandler)))))))
+	mux.HandleFunc("/rules/add", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, addRuleHandler)))))))
+	mux.HandleFunc("/rules/list", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleViewer, listRulesHandler)))))))
+	mux.HandleFunc("/rules/update", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, updateRuleHandler)))))))
+	mux.HandleFunc("/rules/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, deleteRuleHandler)))))))
+	mux.HandleFunc("/rules/apply", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeCategoriesWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, middleware.RequireLedger(lookupLedger, models.LedgerRoleEditor, applyRulesHandler)))))))
+	mux.HandleFunc("/notifications", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeNotificationsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, listNotificationsHandler))))))
+	mux.HandleFunc("/notifications/unread-count", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeNotificationsRead, middleware.RequireAuth(jwtSecret, isTokenRevoked, unreadNotificationCountHandler))))))
+	mux.HandleFunc("/notifications/read", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeNotificationsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, markNotificationReadHandler))))))
+	mux.HandleFunc("/notifications/read-all", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeNotificationsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, markAllNotificationsReadHandler))))))
+	mux.HandleFunc("/notifications/delete", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAPI(middleware.AcceptPersonalToken(lookupPersonalToken, constants.ScopeNotificationsWrite, middleware.RequireAuth(jwtSecret, isTokenRevoked, deleteNotificationHandler))))))
+	mux.HandleFunc("/admin/exchange-rates", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAdminKey(adminKey, importExchangeRatesHandler)))))
+	mux.HandleFunc("/admin/recurring-runs", middleware.RequireHTTPS(middleware.SecurityHeaders(rateLimitAuth(middleware.RequireAdminKey(adminKey, recurringJobRunsHandler)))))
 
 	// Get CORS origins from environment (comma-separated) or use default
 	corsOriginEnv := os.Getenv("CORS_ORIGIN")
@@ -140,7 +285,7 @@ func main() {
 
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   allowedOrigins,
-		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", middleware.LedgerHeader},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowCredentials: true,
 	})
@@ -174,8 +319,11 @@ func main() {
 	<-sigChan
 	slog.Info("Shutdown signal received, stopping server...")
 
-	// Close recurring job gracefully
+	// Close background jobs gracefully
 	close(recurringJobQuit)
+	close(tokenCleanupQuit)
+	close(budgetPeriodQuit)
+	budgetAlerts.Stop()
 
 	// Give server time to finish ongoing requests
 	time.Sleep(constants.ShutdownGracePeriod)
@@ -283,13 +431,14 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	slog.Info("Calling RegisterUser", "username", username, "email", email)
-	err := handlers.RegisterUser(r.Context(), db, username, email, password)
+	userID, err := handlers.RegisterUser(r.Context(), db, username, email, password)
 
 	slog.Info("RegisterUser returned", "error", err)
 	w.Header().Set("Content-Type", "application/json")
 
 	switch err {
 	case nil:
+		sendVerificationEmail(r.Context(), userID)
 		slog.Info("Sending success response for registration", "username", username)
 		w.WriteHeader(http.StatusOK)
 		encodeErr := json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "User registered successfully!"})
@@ -318,7 +467,7 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Handles user login via POST request (expects 'email', 'password')
-// Returns a JWT token if credentials are valid
+// Returns a short-lived JWT access token and a refresh token if credentials are valid
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	slog.Info("loginHandler called",
 		"method", r.Method,
@@ -352,16 +501,32 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	slog.Info("Calling LoginUser", "email", email)
-	token, err := handlers.LoginUser(r.Context(), db, email, password, jwtSecret)
+	pair, err := handlers.LoginUser(r.Context(), db, email, password, jwtSecret, emailVerification)
 
-	slog.Info("LoginUser returned", "error", err, "tokenLength", len(token))
+	slog.Info("LoginUser returned", "error", err, "tokenLength", len(pair.AccessToken))
 	w.Header().Set("Content-Type", "application/json")
 
 	switch err {
 	case nil:
-		slog.Info("Sending success response for login", "email", email, "tokenLength", len(token))
+		if pair.TwoFactorRequired {
+			// The token only works for completing the login at /login/2fa
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success":             true,
+				"two_factor_required": true,
+				"token":               pair.AccessToken,
+				"expires_in":          pair.ExpiresIn,
+			})
+			return
+		}
+		slog.Info("Sending success response for login", "email", email, "tokenLength", len(pair.AccessToken))
 		w.WriteHeader(http.StatusOK)
-		encodeErr := json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "token": token})
+		encodeErr := json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":       true,
+			"token":         pair.AccessToken,
+			"refresh_token": pair.RefreshToken,
+			"expires_in":    pair.ExpiresIn,
+		})
 		if encodeErr != nil {
 			slog.Error("Failed to encode login success response", "error", encodeErr)
 		} else {
@@ -373,6 +538,10 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Email or password is incorrect."})
 		return
+	case handlers.ErrEmailNotVerified:
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Please verify your email address before logging in."})
+		return
 	default:
 		slog.Error("Login error", "error", err, "email", email)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -381,123 +550,62 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// AddCategoryHandler creates a category for an authenticated user.
-func addCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
+// Exchanges a refresh token for a new access/refresh token pair (expects 'refresh_token')
+func refreshHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Only POST allowed",
-		})
-		return
-	}
-
-	userID, ok := middleware.GetUserID(r)
-	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "User not authenticated",
-		})
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
 
-	name := utils.SanitizeCategoryName(r.FormValue("name"))
-	ctype := strings.ToLower(strings.TrimSpace(r.FormValue("type")))
-
-	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Category name is required",
-		})
-		return
-	}
-	if len(name) > constants.MaxCategoryNameLength {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("Category name must be %d characters or less", constants.MaxCategoryNameLength),
-		})
-		return
-	}
-	if ctype != "expense" && ctype != "income" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Category type must be 'expense' or 'income'",
-		})
+	refreshToken := strings.TrimSpace(r.FormValue("refresh_token"))
+	if refreshToken == "" {
+		utils.RespondWithValidationError(w, "refresh_token is required")
 		return
 	}
 
-	categoryID, err := handlers.AddCategory(r.Context(), db, userID, name, ctype)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Add category failed: " + err.Error(),
+	pair, err := handlers.RefreshSession(r.Context(), db, refreshToken, jwtSecret, emailVerification)
+	switch err {
+	case nil:
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success":       true,
+			"token":         pair.AccessToken,
+			"refresh_token": pair.RefreshToken,
+			"expires_in":    pair.ExpiresIn,
 		})
-		return
-	}
-
-	// Return JSON of the newly created category
-	newCategory := map[string]interface{}{
-		"id":   categoryID,
-		"name": name,
-		"type": ctype,
+	case handlers.ErrRefreshTokenReused:
+		utils.RespondWithUnauthorized(w, "Refresh token has already been used. Please log in again.")
+	case handlers.ErrInvalidRefreshToken:
+		utils.RespondWithUnauthorized(w, "Invalid or expired refresh token")
+	case handlers.ErrEmailNotVerified:
+		utils.RespondWithForbidden(w, "Please verify your email address to continue.")
+	default:
+		utils.RespondWithInternalError(w, err, "Refresh token")
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":  true,
-		"category": newCategory,
-	})
 }
 
-// Handles listing all categories for a user (expects 'user_id' as a URL query parameter)
-func listCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Only GET allowed",
-		})
+// Revokes the current session's access and refresh tokens
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
 
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "User not authenticated",
-		})
+		utils.RespondWithUnauthorized(w, "User not authenticated")
 		return
 	}
+	jti, _ := middleware.GetTokenID(r)
 
-	cats, err := handlers.ListCategories(r.Context(), db, userID)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to list categories: " + err.Error(),
-		})
+	if err := handlers.Logout(r.Context(), db, userID, jti); err != nil {
+		utils.RespondWithInternalError(w, err, "Logout")
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":    true,
-		"categories": cats,
-	})
+	utils.RespondWithSuccess(w, http.StatusOK, "Logged out successfully", nil)
 }
 
-// Add a new transaction via POST
-func addTransactionHandler(w http.ResponseWriter, r *http.Request) {
+// Revokes every session for the authenticated user on all devices
+func logoutAllHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
@@ -509,474 +617,676 @@ func addTransactionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate category_id
-	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
-	if err != nil || categoryID <= 0 {
-		utils.RespondWithValidationError(w, "Valid category_id is required (must be a positive number)")
+	if err := handlers.LogoutAll(r.Context(), db, userID); err != nil {
+		utils.RespondWithInternalError(w, err, "Logout all")
 		return
 	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Logged out of all sessions", nil)
+}
 
-	// Validate amount
-	amountStr := r.FormValue("amount")
-	if amountStr == "" {
-		utils.RespondWithValidationError(w, "Amount is required")
+// Returns the authenticated user's profile
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
 		return
 	}
-	amount, err := strconv.ParseFloat(amountStr, 64)
-	if err != nil {
-		utils.RespondWithValidationError(w, "Amount must be a valid number")
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-	if err := utils.ValidateAmount(amount); err != nil {
-		utils.RespondWithValidationError(w, err.Error())
-		return
+
+	user, err := handlers.GetProfile(r.Context(), db, userID)
+	switch err {
+	case nil:
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"success": true, "user": user})
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Get profile")
 	}
+}
 
-	// Validate date format
-	date := r.FormValue("date")
-	if err := utils.ValidateTransactionDate(date); err != nil {
-		utils.RespondWithValidationError(w, err.Error())
+// Changes the authenticated user's username and/or email (POST 'username', 'email'; omitted fields are kept)
+func updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-
-	description := utils.SanitizeDescription(r.FormValue("description"))
-
-	tx := models.Transaction{
-		UserID:      userID,
-		CategoryID:  categoryID,
-		Amount:      amount,
-		Description: description,
-		Date:        date,
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
 	}
 
-	err = handlers.AddTransaction(r.Context(), db, tx)
-	if err != nil {
-		// Check if it's a category ownership error
-		if err.Error() == "category not found or unauthorized" {
-			utils.RespondWithValidationError(w, "Invalid category or you don't have permission to use this category")
+	username := strings.TrimSpace(r.FormValue("username"))
+	email := strings.TrimSpace(r.FormValue("email"))
+	if username == "" && email == "" {
+		utils.RespondWithValidationError(w, "username or email is required")
+		return
+	}
+	if username != "" && !utils.ValidateUsername(username) {
+		utils.RespondWithValidationError(w, "Username must be 3-50 characters and contain only letters, numbers, underscores, or hyphens")
+		return
+	}
+	if email != "" {
+		if _, err := mail.ParseAddress(email); err != nil {
+			utils.RespondWithValidationError(w, "Invalid email format")
 			return
 		}
-		utils.RespondWithInternalError(w, err, "Add transaction")
-		return
 	}
 
-	utils.RespondWithSuccess(w, http.StatusCreated, "Transaction added successfully", nil)
+	user, err := handlers.UpdateProfile(r.Context(), db, userID, username, email)
+	switch err {
+	case nil:
+		if email != "" && !user.EmailVerified {
+			sendVerificationEmail(r.Context(), userID)
+		}
+		utils.RespondWithSuccess(w, http.StatusOK, "Profile updated successfully", user)
+	case handlers.ErrEmailExists:
+		utils.RespondWithConflict(w, "This email is already registered.")
+	case handlers.ErrUsernameExists:
+		utils.RespondWithConflict(w, "This username is already taken.")
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Update profile")
+	}
 }
 
-// List all transactions for a user (GET)
-func listTransactionHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Only GET allowed",
-		})
+// Changes the password (POST 'current_password', 'new_password') and signs out every other session
+func changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "User not authenticated",
-		})
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-	list, err := handlers.ListTransactions(r.Context(), db, userID)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to fetch transactions: " + err.Error(),
-		})
+	jti, _ := middleware.GetTokenID(r)
+
+	current := r.FormValue("current_password")
+	newPassword := r.FormValue("new_password")
+	if current == "" {
+		utils.RespondWithValidationError(w, "current_password is required")
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":      true,
-		"transactions": list,
-	})
+	if len(newPassword) < constants.MinPasswordLength {
+		utils.RespondWithValidationError(w, fmt.Sprintf("Password must be at least %d characters", constants.MinPasswordLength))
+		return
+	}
+
+	switch err := handlers.ChangePassword(r.Context(), db, userID, current, newPassword, jti); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Password changed; other sessions have been signed out", nil)
+	case handlers.ErrInvalidCredentials:
+		utils.RespondWithUnauthorized(w, "Current password is incorrect")
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Change password")
+	}
 }
 
-// Update an existing transaction (POST)
-func updateTransactionHandler(w http.ResponseWriter, r *http.Request) {
+// Permanently deletes the account and all its data (POST 'password', 'confirm' = "DELETE").
+// Accounts without a password leave out 'password' and must have signed in recently instead.
+func deleteMeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		utils.RespondWithUnauthorized(w, "User not authenticated")
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
+	jti, _ := middleware.GetTokenID(r)
 
-	// Validate transaction ID
-	id, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil || id <= 0 {
-		utils.RespondWithValidationError(w, "Valid transaction ID is required (must be a positive number)")
+	if r.FormValue("confirm") != constants.AccountDeletionConfirmation {
+		utils.RespondWithValidationError(w, fmt.Sprintf("confirm must be %q to delete the account", constants.AccountDeletionConfirmation))
 		return
 	}
+	password := r.FormValue("password")
 
-	// Validate category_id
-	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
-	if err != nil || categoryID <= 0 {
-		utils.RespondWithValidationError(w, "Valid category_id is required (must be a positive number)")
-		return
+	switch err := handlers.DeleteAccount(r.Context(), db, userID, password, jti); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Account deleted", nil)
+	case handlers.ErrInvalidCredentials:
+		utils.RespondWithUnauthorized(w, "Password is incorrect")
+	case handlers.ErrSignInRequired:
+		respondSignInRequired(w)
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Delete account")
 	}
+}
 
-	// Validate amount
-	amountStr := r.FormValue("amount")
-	if amountStr == "" {
-		utils.RespondWithValidationError(w, "Amount is required")
+// Completes a password login for an account with two-factor authentication (POST 'code': an
+// authenticator code or a recovery code), authorized by the challenge token from /login
+func twoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-	amount, err := strconv.ParseFloat(amountStr, 64)
-	if err != nil {
-		utils.RespondWithValidationError(w, "Amount must be a valid number")
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-	if err := utils.ValidateAmount(amount); err != nil {
-		utils.RespondWithValidationError(w, err.Error())
+	jti, _ := middleware.GetTokenID(r)
+
+	code := strings.TrimSpace(r.FormValue("code"))
+	if code == "" {
+		utils.RespondWithValidationError(w, "code is required")
 		return
 	}
 
-	// Validate date format
-	date := r.FormValue("date")
-	if err := utils.ValidateTransactionDate(date); err != nil {
-		utils.RespondWithValidationError(w, err.Error())
-		return
+	pair, err := handlers.CompleteTwoFactorLogin(r.Context(), db, userID, jti, code, jwtSecret)
+	switch err {
+	case nil:
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success":       true,
+			"token":         pair.AccessToken,
+			"refresh_token": pair.RefreshToken,
+			"expires_in":    pair.ExpiresIn,
+		})
+	case handlers.ErrInvalidTwoFactorCode:
+		utils.RespondWithUnauthorized(w, "Invalid two-factor code")
+	case handlers.ErrTwoFactorNotEnabled, handlers.ErrUserNotFound:
+		utils.RespondWithUnauthorized(w, "Please log in again.")
+	default:
+		utils.RespondWithInternalError(w, err, "Two-factor login")
 	}
+}
 
-	description := utils.SanitizeDescription(r.FormValue("description"))
-
-	tx := models.Transaction{
-		ID:          id,
-		UserID:      userID,
-		CategoryID:  categoryID,
-		Amount:      amount,
-		Description: description,
-		Date:        date,
+// Starts two-factor enrollment: returns a new TOTP secret and its otpauth:// URI for a QR code
+func twoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
 	}
-
-	err = handlers.UpdateTransaction(r.Context(), db, tx)
-	if err != nil {
-		if err.Error() == "category not found or unauthorized" {
-			utils.RespondWithValidationError(w, "Invalid category or you don't have permission to use this category")
-			return
-		}
-		utils.RespondWithInternalError(w, err, "Update transaction")
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
 
-	utils.RespondWithSuccess(w, http.StatusOK, "Transaction updated successfully", nil)
+	setup, err := handlers.SetupTwoFactor(r.Context(), db, userID)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Scan the QR code with your authenticator app, then confirm a code", setup)
+	case handlers.ErrTwoFactorEnabled:
+		utils.RespondWithConflict(w, "Two-factor authentication is already enabled.")
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Two-factor setup")
+	}
 }
 
-// Delete a transaction (POST)
-func deleteTransactionHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
+// Enables two-factor authentication with a code from the authenticator (POST 'code') and returns recovery codes
+func twoFactorEnableHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Only POST allowed",
-		})
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "User not found in context",
-		})
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-
-	id, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil || id <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Valid transaction ID is required",
-		})
+	code := strings.TrimSpace(r.FormValue("code"))
+	if code == "" {
+		utils.RespondWithValidationError(w, "code is required")
 		return
 	}
 
-	err = handlers.DeleteTransaction(r.Context(), db, id, userID)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to delete transaction: " + err.Error(),
-		})
-		return
+	codes, err := handlers.EnableTwoFactor(r.Context(), db, userID, code)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Two-factor authentication enabled. Store your recovery codes somewhere safe.",
+			map[string][]string{"recovery_codes": codes})
+	case handlers.ErrInvalidTwoFactorCode:
+		utils.RespondWithValidationError(w, "Invalid two-factor code")
+	case handlers.ErrTwoFactorNotSetUp:
+		utils.RespondWithValidationError(w, "Start two-factor setup first")
+	case handlers.ErrTwoFactorEnabled:
+		utils.RespondWithConflict(w, "Two-factor authentication is already enabled.")
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Enable two-factor authentication")
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Transaction deleted",
-	})
 }
 
-// Returns overall totals for this user
-func summaryTotalsHandler(w http.ResponseWriter, r *http.Request) {
+// Disables two-factor authentication (POST 'password', 'code': an authenticator or recovery code).
+// Accounts without a password leave out 'password' and must have signed in recently instead.
+func twoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
 		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-	expenses, income, err := handlers.GetTotals(r.Context(), db, userID)
-	if err != nil {
-		utils.RespondWithInternalError(w, err, "Summary totals")
+	jti, _ := middleware.GetTokenID(r)
+	password := r.FormValue("password")
+	code := strings.TrimSpace(r.FormValue("code"))
+	if code == "" {
+		utils.RespondWithValidationError(w, "code is required")
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]float64{
-		"total_expenses": expenses,
-		"total_income":   income,
-	})
+
+	switch err := handlers.DisableTwoFactor(r.Context(), db, userID, password, code, jti); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Two-factor authentication disabled", nil)
+	case handlers.ErrInvalidCredentials:
+		utils.RespondWithUnauthorized(w, "Password is incorrect")
+	case handlers.ErrSignInRequired:
+		respondSignInRequired(w)
+	case handlers.ErrInvalidTwoFactorCode:
+		utils.RespondWithUnauthorized(w, "Invalid two-factor code")
+	case handlers.ErrTwoFactorNotEnabled:
+		utils.RespondWithValidationError(w, "Two-factor authentication is not enabled")
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Disable two-factor authentication")
+	}
 }
 
-// Returns monthly group totals for this user
-func summaryMonthlyHandler(w http.ResponseWriter, r *http.Request) {
+// Replaces the recovery codes (POST 'code': an authenticator or recovery code) and returns the new ones
+func recoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
 		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-	summary, err := handlers.GetMonthlyTotals(r.Context(), db, userID)
-	if err != nil {
-		utils.RespondWithInternalError(w, err, "Summary monthly")
+	code := strings.TrimSpace(r.FormValue("code"))
+	if code == "" {
+		utils.RespondWithValidationError(w, "code is required")
 		return
 	}
-	json.NewEncoder(w).Encode(summary)
+
+	codes, err := handlers.RegenerateRecoveryCodes(r.Context(), db, userID, code)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "New recovery codes generated; the old ones no longer work",
+			map[string][]string{"recovery_codes": codes})
+	case handlers.ErrInvalidTwoFactorCode:
+		utils.RespondWithUnauthorized(w, "Invalid two-factor code")
+	case handlers.ErrTwoFactorNotEnabled:
+		utils.RespondWithValidationError(w, "Two-factor authentication is not enabled")
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Regenerate recovery codes")
+	}
 }
 
-// Returns current month summary with normalized monthly recurring
-func summaryCurrentMonthHandler(w http.ResponseWriter, r *http.Request) {
+// Sends a new verification link to the authenticated user's email address
+func resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
 		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-	summary, err := handlers.GetCurrentMonthSummary(r.Context(), db, userID)
-	if err != nil {
-		utils.RespondWithInternalError(w, err, "Summary current month")
+	if !emailEnabled() {
+		respondEmailDisabled(w)
 		return
 	}
-	json.NewEncoder(w).Encode(summary)
+
+	token, email, err := handlers.CreateEmailVerification(r.Context(), db, userID, jwtSecret)
+	switch err {
+	case nil:
+		sendEmail(verificationEmail(email, token))
+		utils.RespondWithSuccess(w, http.StatusOK, "Verification email sent", nil)
+	case handlers.ErrEmailAlreadyVerified:
+		utils.RespondWithConflict(w, "Your email address is already verified.")
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Resend verification email")
+	}
 }
 
-// Returns category-wise breakdown for this user for a date range
-func summaryCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r)
-	if !ok {
-		utils.RespondWithUnauthorized(w, "")
+// Verifies an email address with the token from a verification link (POST 'token')
+func verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-	from := r.URL.Query().Get("from")
-	to := r.URL.Query().Get("to")
-	result, err := handlers.GetCategoryBreakdown(r.Context(), db, userID, from, to)
-	if err != nil {
-		utils.RespondWithInternalError(w, err, "Summary category")
+	token := strings.TrimSpace(r.FormValue("token"))
+	if token == "" {
+		utils.RespondWithValidationError(w, "token is required")
 		return
 	}
-	json.NewEncoder(w).Encode(result)
+
+	switch err := handlers.VerifyEmail(r.Context(), db, token, jwtSecret); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Email verified successfully", nil)
+	case handlers.ErrInvalidEmailToken:
+		utils.RespondWithValidationError(w, "Invalid or expired verification link")
+	default:
+		utils.RespondWithInternalError(w, err, "Verify email")
+	}
 }
 
-// Group by period endpoint
-func summaryGroupHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r)
-	if !ok {
-		utils.RespondWithUnauthorized(w, "")
+// Starts a single sign-on login; the frontend sends the browser to the returned authorization_url
+func oidcStartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-	granularity := r.URL.Query().Get("by")
-	summary, err := handlers.GetGroupTotals(r.Context(), db, userID, granularity)
-	if err != nil {
-		utils.RespondWithInternalError(w, err, "Summary group")
+	if oidcProvider == nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Single sign-on is not configured")
 		return
 	}
-	json.NewEncoder(w).Encode(summary)
-}
 
-// Category-wise summary for given year/month
-func summaryCategoryMonthHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r)
-	if !ok {
-		utils.RespondWithUnauthorized(w, "")
-		return
+	authURL, binding, err := handlers.StartOIDCLogin(r.Context(), db, oidcProvider)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Redirect to the identity provider",
+			map[string]string{"authorization_url": authURL, "login_binding": binding})
+	case handlers.ErrOIDCUnavailable:
+		utils.RespondWithError(w, http.StatusBadGateway, "The identity provider is unavailable. Please try again later.")
+	default:
+		utils.RespondWithInternalError(w, err, "Start single sign-on")
 	}
-	year, _ := strconv.Atoi(r.URL.Query().Get("year"))
-	month, _ := strconv.Atoi(r.URL.Query().Get("month"))
-	if year == 0 || month == 0 {
-		utils.RespondWithValidationError(w, "year and month required")
+}
+
+// Finishes a single sign-on login (POST 'code', 'state': the query parameters the identity provider
+// redirected back with, and 'login_binding' from /auth/oidc/start) and responds like /login
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-	result, err := handlers.GetCategoryMonthSummary(r.Context(), db, userID, year, month)
-	if err != nil {
-		utils.RespondWithInternalError(w, err, "Summary category month")
+	if oidcProvider == nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Single sign-on is not configured")
 		return
 	}
-	json.NewEncoder(w).Encode(result)
-}
-
-// Export transactions to CSV or JSON
-func exportTransactionsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r)
-	if !ok {
-		utils.RespondWithUnauthorized(w, "")
+	if providerErr := r.FormValue("error"); providerErr != "" {
+		slog.Info("Identity provider returned an error", "error", providerErr, "description", r.FormValue("error_description"))
+		utils.RespondWithUnauthorized(w, "Single sign-on was cancelled or denied")
 		return
 	}
-	transactions, err := handlers.ListTransactions(r.Context(), db, userID)
-	if err != nil {
-		utils.RespondWithInternalError(w, err, "Export transactions")
+	code := strings.TrimSpace(r.FormValue("code"))
+	state := strings.TrimSpace(r.FormValue("state"))
+	binding := strings.TrimSpace(r.FormValue("login_binding"))
+	if code == "" || state == "" || binding == "" {
+		utils.RespondWithValidationError(w, "code, state and login_binding are required")
 		return
 	}
 
-	format := r.URL.Query().Get("format")
-	if format == "csv" {
-		w.Header().Set("Content-Disposition", "attachment;filename=transactions.csv")
-		w.Header().Set("Content-Type", "text/csv")
-		writer := csv.NewWriter(w)
-		if err := writer.Write([]string{"ID", "CategoryID", "Amount", "Description", "Date", "CreatedAt"}); err != nil {
-			utils.RespondWithInternalError(w, err, "CSV header write")
-			return
-		}
-		for _, tx := range transactions {
-			if err := writer.Write([]string{
-				strconv.Itoa(tx.ID),
-				strconv.Itoa(tx.CategoryID),
-				fmt.Sprintf("%.2f", tx.Amount),
-				tx.Description,
-				tx.Date,
-				tx.CreatedAt,
-			}); err != nil {
-				utils.RespondWithInternalError(w, err, "CSV row write")
-				return
-			}
-		}
-		writer.Flush()
-		if err := writer.Error(); err != nil {
-			utils.RespondWithInternalError(w, err, "CSV flush")
+	pair, created, err := handlers.CompleteOIDCLogin(r.Context(), db, oidcProvider, state, binding, code, jwtSecret, emailVerification)
+	switch err {
+	case nil:
+		if pair.TwoFactorRequired {
+			utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"success":             true,
+				"two_factor_required": true,
+				"token":               pair.AccessToken,
+				"expires_in":          pair.ExpiresIn,
+				"new_account":         created,
+			})
 			return
 		}
-		return
-	}
-	// Default: JSON
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(transactions); err != nil {
-		utils.RespondWithInternalError(w, err, "JSON encode")
-		return
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success":       true,
+			"token":         pair.AccessToken,
+			"refresh_token": pair.RefreshToken,
+			"expires_in":    pair.ExpiresIn,
+			"new_account":   created,
+		})
+	case handlers.ErrInvalidOIDCState:
+		utils.RespondWithValidationError(w, "Invalid or expired login. Please start again.")
+	case handlers.ErrOIDCLoginFailed:
+		utils.RespondWithUnauthorized(w, "Single sign-on failed. Please start again.")
+	case handlers.ErrOIDCEmailNotVerified:
+		utils.RespondWithForbidden(w, "Your identity provider account has no verified email address.")
+	case handlers.ErrEmailNotVerified:
+		utils.RespondWithForbidden(w, "Please verify your email address before logging in.")
+	case handlers.ErrUsernameExists:
+		utils.RespondWithConflict(w, "Could not choose a username for the new account.")
+	default:
+		utils.RespondWithInternalError(w, err, "Complete single sign-on")
 	}
 }
 
-// User to add a recurring transaction.
-func addRecurringHandler(w http.ResponseWriter, r *http.Request) {
+// Emails a password reset link (POST 'email'). The response is the same whether or not an
+// account exists, so it can't be used to discover registered addresses.
+func forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-
-	userID, ok := middleware.GetUserID(r)
-	if !ok {
-		utils.RespondWithUnauthorized(w, "User not authenticated")
+	if !emailEnabled() {
+		respondEmailDisabled(w)
+		return
+	}
+	email := strings.TrimSpace(r.FormValue("email"))
+	if _, err := mail.ParseAddress(email); err != nil {
+		utils.RespondWithValidationError(w, "Invalid email format")
 		return
 	}
 
-	// Validate category_id
-	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
-	if err != nil || categoryID <= 0 {
-		utils.RespondWithValidationError(w, "Valid category_id is required (must be a positive number)")
+	token, err := handlers.CreatePasswordReset(r.Context(), db, email, jwtSecret)
+	switch err {
+	case nil:
+		sendEmail(passwordResetEmail(email, token))
+	case handlers.ErrUserNotFound:
+		slog.Info("Password reset requested for unknown email", "email", email)
+	default:
+		utils.RespondWithInternalError(w, err, "Forgot password")
 		return
 	}
+	utils.RespondWithSuccess(w, http.StatusOK, "If an account exists for this email, a password reset link has been sent.", nil)
+}
 
-	// Validate amount
-	amountStr := r.FormValue("amount")
-	if amountStr == "" {
-		utils.RespondWithValidationError(w, "Amount is required")
+// Sets a new password with the token from a reset link (POST 'token', 'new_password') and signs out every session
+func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-	amount, err := strconv.ParseFloat(amountStr, 64)
-	if err != nil {
-		utils.RespondWithValidationError(w, "Amount must be a valid number")
+	token := strings.TrimSpace(r.FormValue("token"))
+	newPassword := r.FormValue("new_password")
+	if token == "" {
+		utils.RespondWithValidationError(w, "token is required")
 		return
 	}
-	if err := utils.ValidateAmount(amount); err != nil {
-		utils.RespondWithValidationError(w, err.Error())
+	if len(newPassword) < constants.MinPasswordLength {
+		utils.RespondWithValidationError(w, fmt.Sprintf("Password must be at least %d characters", constants.MinPasswordLength))
 		return
 	}
 
-	// Validate start date format
-	startDate := r.FormValue("start_date")
-	if err := utils.ValidateRecurringDate(startDate); err != nil {
-		utils.RespondWithValidationError(w, err.Error())
-		return
+	switch err := handlers.ResetPassword(r.Context(), db, token, newPassword, jwtSecret); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Password reset successfully. Please log in with your new password.", nil)
+	case handlers.ErrInvalidEmailToken:
+		utils.RespondWithValidationError(w, "Invalid or expired password reset link")
+	default:
+		utils.RespondWithInternalError(w, err, "Reset password")
 	}
+}
 
-	// Validate recurrence
-	recurrence := strings.ToLower(strings.TrimSpace(r.FormValue("recurrence")))
-	if recurrence == "" {
-		utils.RespondWithValidationError(w, "Recurrence is required")
+// sendVerificationEmail emails the user a link to verify their address; failures are logged
+func sendVerificationEmail(ctx context.Context, userID int) {
+	token, email, err := handlers.CreateEmailVerification(ctx, db, userID, jwtSecret)
+	if err != nil {
+		slog.Error("Failed to create email verification", "error", err, "userID", userID)
 		return
 	}
-	validRecurrence := map[string]bool{
-		"daily":   true,
-		"weekly":  true,
-		"monthly": true,
-		"yearly":  true,
+	sendEmail(verificationEmail(email, token))
+}
+
+func verificationEmail(to, token string) notify.Email {
+	link := appURL + "/verify-email?token=" + url.QueryEscape(token)
+	return notify.Email{
+		To:      to,
+		Subject: "Verify your MySpendo email address",
+		Body: fmt.Sprintf("Confirm this is your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you didn't create a MySpendo account, you can ignore this email.",
+			link, formatHours(constants.EmailVerificationTokenExpiration)),
 	}
-	if !validRecurrence[recurrence] {
-		utils.RespondWithValidationError(w, "Recurrence must be one of: daily, weekly, monthly, yearly")
-		return
+}
+
+func passwordResetEmail(to, token string) notify.Email {
+	link := appURL + "/reset-password?token=" + url.QueryEscape(token)
+	return notify.Email{
+		To:      to,
+		Subject: "Reset your MySpendo password",
+		Body: fmt.Sprintf("Choose a new password by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s and can be used once. If you didn't ask to reset your password, you can ignore this email.",
+			link, formatHours(constants.PasswordResetTokenExpiration)),
 	}
+}
 
-	description := utils.SanitizeDescription(r.FormValue("description"))
+func ledgerInvitationEmail(inv models.LedgerInvitation, token string) notify.Email {
+	link := appURL + "/ledger-invite?token=" + url.QueryEscape(token)
+	return notify.Email{
+		To:      inv.Email,
+		Subject: fmt.Sprintf("You're invited to the %s ledger on MySpendo", inv.LedgerName),
+		Body: fmt.Sprintf("You've been invited to join the %q ledger as %s. Sign in with this email address and open the link below to accept:\n\n%s\n\n"+
+			"The link expires in %s. If you weren't expecting this invitation, you can ignore this email.",
+			inv.LedgerName, inv.Role, link, formatHours(constants.LedgerInvitationExpiration)),
+	}
+}
 
-	rt := models.RecurringTransaction{
-		UserID:      userID,
-		CategoryID:  categoryID,
-		Amount:      amount,
-		Description: description,
-		StartDate:   startDate,
-		Recurrence:  recurrence,
+// formatHours describes a whole number of hours, e.g. "1 hour" or "48 hours"
+func formatHours(d time.Duration) string {
+	if h := int(d.Hours()); h != 1 {
+		return fmt.Sprintf("%d hours", h)
 	}
+	return "1 hour"
+}
 
-	err = handlers.AddRecurringTransaction(r.Context(), db, rt)
-	if err != nil {
-		if err.Error() == "category not found or unauthorized" {
-			utils.RespondWithValidationError(w, "Invalid category or you don't have permission to use this category")
-			return
+// sendEmail delivers an email in the background, so responses don't wait on (or reveal) delivery
+func sendEmail(e notify.Email) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), constants.NotificationTimeout)
+		defer cancel()
+		if err := mailer.Send(ctx, e); err != nil {
+			slog.Error("Failed to send email", "error", err, "subject", e.Subject)
 		}
-		utils.RespondWithInternalError(w, err, "Add recurring transaction")
-		return
+	}()
+}
+
+// emailEnabled reports whether account email goes anywhere. Endpoints that only exist to send a
+// link fail without it rather than pretend the link was sent.
+func emailEnabled() bool {
+	_, disabled := mailer.(notify.DisabledMailer)
+	return !disabled
+}
+
+// respondEmailDisabled tells the client that the server can't send account email
+func respondEmailDisabled(w http.ResponseWriter) {
+	utils.RespondWithError(w, http.StatusServiceUnavailable, "Email is not configured on this server")
+}
+
+// respondNoExchangeRate tells the client that an amount in currency (the user's base currency
+// when empty) can't be converted for every member of the ledger
+func respondNoExchangeRate(w http.ResponseWriter, currency string) {
+	if currency == "" {
+		currency = "your base currency"
 	}
+	utils.RespondWithValidationError(w, "No exchange rate is loaded between "+currency+" and the base currency of every member of this ledger")
+}
 
-	utils.RespondWithSuccess(w, http.StatusCreated, "Recurring transaction added successfully", nil)
+// respondUnconvertible tells the client that a report can't be worked out because some of the
+// ledger's amounts are in a currency with no exchange rate to the base currency it is shown in
+func respondUnconvertible(w http.ResponseWriter) {
+	utils.RespondWithError(w, http.StatusUnprocessableEntity,
+		"Some of this ledger's amounts are in a currency with no exchange rate to the base currency they are reported in; load the missing rates")
 }
 
-// Returns all recurring transactions for the authenticated user
-func listRecurringHandler(w http.ResponseWriter, r *http.Request) {
+// respondSignInRequired tells an account without a password to sign in again before an
+// irreversible change, or to set a password
+func respondSignInRequired(w http.ResponseWriter) {
+	utils.RespondWithForbidden(w, fmt.Sprintf(
+		"This account has no password: sign in again (within %d minutes) to confirm, or set a password through /password/forgot",
+		int(constants.RecentSignInWindow.Minutes())))
+}
+
+// isTokenRevoked is the revocation check used by middleware.RequireAuth
+func isTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return handlers.IsAccessTokenRevoked(ctx, db, jti)
+}
+
+// lookupPersonalToken resolves personal access tokens for middleware.AcceptPersonalToken
+func lookupPersonalToken(ctx context.Context, token string) (int, []string, bool, error) {
+	return handlers.LookupPersonalToken(ctx, db, token)
+}
+
+// lookupLedger resolves the ledger a request works on for middleware.RequireLedger
+func lookupLedger(ctx context.Context, userID, ledgerID int) (int, string, bool, error) {
+	return handlers.LookupLedger(ctx, db, userID, ledgerID)
+}
+
+// Creates a personal access token (POST 'name', 'scopes': comma-separated, optional 'expires_in_days').
+// The token is returned only in this response.
+func addPersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
 		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-	recurrings, err := handlers.ListRecurringTransactions(r.Context(), db, userID)
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > 100 {
+		utils.RespondWithValidationError(w, "name is required (max 100 characters)")
+		return
+	}
+	scopes, err := handlers.ParseScopes(r.FormValue("scopes"))
 	if err != nil {
-		utils.RespondWithInternalError(w, err, "List recurring transactions")
+		utils.RespondWithValidationError(w, err.Error())
 		return
 	}
-	json.NewEncoder(w).Encode(recurrings)
+	days := constants.DefaultPersonalTokenDays
+	if v := r.FormValue("expires_in_days"); v != "" {
+		days, err = strconv.Atoi(v)
+		if err != nil || days < 1 || days > constants.MaxPersonalTokenDays {
+			utils.RespondWithValidationError(w, fmt.Sprintf("expires_in_days must be between 1 and %d", constants.MaxPersonalTokenDays))
+			return
+		}
+	}
+
+	token, pt, err := handlers.CreatePersonalToken(r.Context(), db, userID, name, scopes, days)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusCreated, "Token created. Copy it now; it won't be shown again.",
+			map[string]interface{}{"token": token, "personal_token": pt})
+	case handlers.ErrPersonalTokenExists:
+		utils.RespondWithConflict(w, "You already have a token with this name")
+	case handlers.ErrTooManyPersonalTokens:
+		utils.RespondWithValidationError(w, fmt.Sprintf("You can have at most %d tokens; delete one first", constants.MaxPersonalTokens))
+	default:
+		utils.RespondWithInternalError(w, err, "Create personal token")
+	}
 }
 
-func editRecurringHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		utils.RespondWithMethodNotAllowed(w, "POST")
+// Lists the user's personal access tokens (without the tokens themselves)
+func listPersonalTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
 		return
 	}
 	userID, ok := middleware.GetUserID(r)
@@ -984,29 +1294,20 @@ func editRecurringHandler(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-	id, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil {
-		utils.RespondWithValidationError(w, "Valid id is required")
-		return
-	}
-	amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
-	if err != nil || amount <= 0 {
-		utils.RespondWithValidationError(w, "Amount must be a positive number")
-		return
-	}
-	description := r.FormValue("description")
-	startDate := r.FormValue("start_date")
-	recurrence := strings.ToLower(strings.TrimSpace(r.FormValue("recurrence")))
 
-	err = handlers.EditRecurringTransaction(r.Context(), db, userID, id, amount, description, startDate, recurrence)
+	tokens, err := handlers.ListPersonalTokens(r.Context(), db, userID)
 	if err != nil {
-		utils.RespondWithInternalError(w, err, "Edit recurring transaction")
+		utils.RespondWithInternalError(w, err, "List personal tokens")
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "Recurring transaction updated successfully", nil)
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"tokens":  tokens,
+	})
 }
 
-func deleteRecurringHandler(w http.ResponseWriter, r *http.Request) {
+// Revokes a personal access token (expects 'id')
+func deletePersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
@@ -1016,267 +1317,429 @@ func deleteRecurringHandler(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithUnauthorized(w, "")
 		return
 	}
-	id, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil {
-		utils.RespondWithValidationError(w, "Valid id is required")
+
+	tokenID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || tokenID <= 0 {
+		utils.RespondWithValidationError(w, "Valid token ID is required (must be a positive number)")
 		return
 	}
-	err = handlers.DeleteRecurringTransaction(r.Context(), db, id, userID)
-	if err != nil {
-		utils.RespondWithInternalError(w, err, "Delete recurring transaction")
-		return
+
+	switch err := handlers.DeletePersonalToken(r.Context(), db, userID, tokenID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Token revoked", nil)
+	case handlers.ErrPersonalTokenNotFound:
+		utils.RespondWithNotFound(w, "Token")
+	default:
+		utils.RespondWithInternalError(w, err, "Delete personal token")
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "Recurring transaction deleted successfully", nil)
 }
 
-func searchAndFilterTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+// Creates a ledger owned by the user (POST 'name')
+func addLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		utils.RespondWithUnauthorized(w, "User not authenticated")
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
 
-	// Pagination with validation
-	limit := 20 // default
-	if l := r.URL.Query().Get("limit"); l != "" {
-		v, err := strconv.Atoi(l)
-		if err != nil {
-			utils.RespondWithValidationError(w, "Invalid limit parameter: must be a number")
-			return
-		}
-		limit = v
-	}
-	offset := 0
-	if o := r.URL.Query().Get("offset"); o != "" {
-		v, err := strconv.Atoi(o)
-		if err != nil {
-			utils.RespondWithValidationError(w, "Invalid offset parameter: must be a number")
-			return
-		}
-		offset = v
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > constants.MaxLedgerNameLength {
+		utils.RespondWithValidationError(w, fmt.Sprintf("name is required (max %d characters)", constants.MaxLedgerNameLength))
+		return
 	}
 
-	// Validate pagination parameters
-	if err := utils.ValidatePaginationParams(limit, offset); err != nil {
-		utils.RespondWithValidationError(w, err.Error())
-		return
+	ledger, err := handlers.CreateLedger(r.Context(), db, userID, name)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusCreated, "Ledger created", map[string]interface{}{"ledger": ledger})
+	case handlers.ErrTooManyLedgers:
+		utils.RespondWithValidationError(w, fmt.Sprintf("You can create at most %d ledgers; delete one first", constants.MaxLedgersPerUser))
+	default:
+		utils.RespondWithInternalError(w, err, "Create ledger")
 	}
+}
 
-	// Sorting
-	sortParam := r.URL.Query().Get("sort")
-	allowedSorts := map[string]string{
-		"date_asc":    "t.date ASC, t.created_at DESC",
-		"date_desc":   "t.date DESC, t.created_at DESC",
-		"amount_asc":  "t.amount ASC, t.created_at DESC",
-		"amount_desc": "t.amount DESC, t.created_at DESC",
+// Lists the ledgers the user is a member of, with their role in each
+func listLedgersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
 	}
-	// Default: Sort by when transaction was created (most recent first)
-	orderBy := "t.created_at DESC"
-	if s, ok := allowedSorts[sortParam]; ok {
-		orderBy = s
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
 	}
 
-	// Filters
-	keyword := r.URL.Query().Get("q")
-	categoryID, _ := strconv.Atoi(r.URL.Query().Get("category_id"))
-	dateFrom := r.URL.Query().Get("from")
-	dateTo := r.URL.Query().Get("to")
-	amountMin, _ := strconv.ParseFloat(r.URL.Query().Get("min_amount"), 64)
-	amountMax, _ := strconv.ParseFloat(r.URL.Query().Get("max_amount"), 64)
-
-	list, err := handlers.FilterTransactionsPaginated(
-		r.Context(), db, userID, keyword, categoryID, dateFrom, dateTo, amountMin, amountMax, orderBy, limit, offset,
-	)
+	ledgers, err := handlers.ListLedgers(r.Context(), db, userID)
 	if err != nil {
-		utils.RespondWithInternalError(w, err, "Search transactions")
+		utils.RespondWithInternalError(w, err, "List ledgers")
 		return
 	}
-
 	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success":      true,
-		"transactions": list,
-		"limit":        limit,
-		"offset":       offset,
+		"success": true,
+		"ledgers": ledgers,
 	})
 }
 
-// Budget handlers
-func addBudgetHandler(w http.ResponseWriter, r *http.Request) {
+// Renames the selected ledger (POST 'name'; owners only)
+func renameLedgerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-
-	userID, ok := middleware.GetUserID(r)
+	ledgerID, ok := middleware.GetLedgerID(r)
 	if !ok {
-		utils.RespondWithUnauthorized(w, "User not authenticated")
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
 
-	// Validate category_id (0 means overall budget, > 0 means category-specific)
-	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
-	if err != nil || categoryID < 0 {
-		utils.RespondWithValidationError(w, "Valid category_id is required (0 for overall budget, or a positive number for category-specific budget)")
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > constants.MaxLedgerNameLength {
+		utils.RespondWithValidationError(w, fmt.Sprintf("name is required (max %d characters)", constants.MaxLedgerNameLength))
 		return
 	}
 
-	// Validate amount
-	amountStr := r.FormValue("amount")
-	if amountStr == "" {
-		utils.RespondWithValidationError(w, "Amount is required")
-		return
+	switch err := handlers.RenameLedger(r.Context(), db, ledgerID, name); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Ledger renamed", nil)
+	case handlers.ErrLedgerNotFound:
+		utils.RespondWithNotFound(w, "Ledger")
+	default:
+		utils.RespondWithInternalError(w, err, "Rename ledger")
 	}
-	amount, err := strconv.ParseFloat(amountStr, 64)
-	if err != nil {
-		utils.RespondWithValidationError(w, "Amount must be a valid number")
+}
+
+// Deletes the selected ledger and everything in it, for every member
+// (POST 'confirm' = the ledger's name; owners only)
+func deleteLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-	if err := utils.ValidateAmount(amount); err != nil {
-		utils.RespondWithValidationError(w, err.Error())
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
+	ledgerID, _ := middleware.GetLedgerID(r)
 
-	// Validate period
-	period := strings.ToLower(strings.TrimSpace(r.FormValue("period")))
-	if period == "" {
-		period = "monthly"
+	ledger, err := handlers.GetLedger(r.Context(), db, userID, ledgerID)
+	if err == handlers.ErrLedgerNotFound {
+		utils.RespondWithNotFound(w, "Ledger")
+		return
 	}
-	if period != "monthly" && period != "yearly" {
-		utils.RespondWithValidationError(w, "Period must be 'monthly' or 'yearly'")
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Delete ledger")
 		return
 	}
-
-	// Validate alert threshold
-	alertThreshold := 80 // default
-	alertThresholdStr := r.FormValue("alert_threshold")
-	if alertThresholdStr != "" {
-		threshold, err := strconv.Atoi(alertThresholdStr)
-		if err != nil {
-			utils.RespondWithValidationError(w, "Alert threshold must be a valid number")
-			return
-		}
-		if threshold < 0 || threshold > 100 {
-			utils.RespondWithValidationError(w, "Alert threshold must be between 0 and 100")
-			return
-		}
-		alertThreshold = threshold
+	if r.FormValue("confirm") != ledger.Name {
+		utils.RespondWithValidationError(w, "confirm must be the ledger's name to delete it")
+		return
 	}
 
-	budget := models.Budget{
-		UserID:         userID,
-		CategoryID:     categoryID,
-		Amount:         amount,
-		Period:         period,
-		AlertThreshold: alertThreshold,
+	switch err := handlers.DeleteLedger(r.Context(), db, ledgerID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Ledger deleted", nil)
+	case handlers.ErrLedgerNotFound:
+		utils.RespondWithNotFound(w, "Ledger")
+	default:
+		utils.RespondWithInternalError(w, err, "Delete ledger")
 	}
+}
 
-	err = handlers.AddBudget(r.Context(), db, budget)
-	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
-			utils.RespondWithConflict(w, err.Error())
-			return
-		}
-		utils.RespondWithInternalError(w, err, "Add budget")
+// Makes the selected ledger the one used when requests don't send X-Ledger-ID
+func defaultLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
+	ledgerID, _ := middleware.GetLedgerID(r)
 
-	utils.RespondWithSuccess(w, http.StatusCreated, "Budget added successfully", nil)
+	switch err := handlers.SetDefaultLedger(r.Context(), db, userID, ledgerID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Default ledger updated", nil)
+	case handlers.ErrLedgerNotFound:
+		utils.RespondWithNotFound(w, "Ledger")
+	default:
+		utils.RespondWithInternalError(w, err, "Set default ledger")
+	}
 }
 
-func listBudgetHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	userID, ok := middleware.GetUserID(r)
+// Lists the selected ledger's members and their roles
+func listLedgerMembersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
 	if !ok {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Unauthorized",
-		})
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
 
-	budgets, err := handlers.ListBudgets(r.Context(), db, userID)
+	members, err := handlers.ListLedgerMembers(r.Context(), db, ledgerID)
 	if err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		utils.RespondWithInternalError(w, err, "List ledger members")
 		return
 	}
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"budgets": budgets,
+		"members": members,
 	})
 }
 
-func updateBudgetHandler(w http.ResponseWriter, r *http.Request) {
+// validLedgerRole reports whether role is one of models.LedgerRoles
+func validLedgerRole(role string) bool {
+	for _, known := range models.LedgerRoles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Changes a member's role in the selected ledger (POST 'user_id', 'role'; owners only)
+func updateLedgerMemberHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-
-	userID, ok := middleware.GetUserID(r)
+	ledgerID, ok := middleware.GetLedgerID(r)
 	if !ok {
-		utils.RespondWithUnauthorized(w, "User not authenticated")
-		return
-	}
-
-	// Validate budget ID
-	budgetID, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil || budgetID <= 0 {
-		utils.RespondWithValidationError(w, "Valid budget ID is required (must be a positive number)")
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
 
-	// Validate amount
-	amountStr := r.FormValue("amount")
-	if amountStr == "" {
-		utils.RespondWithValidationError(w, "Amount is required")
+	memberID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil || memberID <= 0 {
+		utils.RespondWithValidationError(w, "Valid user ID is required (must be a positive number)")
 		return
 	}
-	amount, err := strconv.ParseFloat(amountStr, 64)
-	if err != nil {
-		utils.RespondWithValidationError(w, "Amount must be a valid number")
+	role := r.FormValue("role")
+	if !validLedgerRole(role) {
+		utils.RespondWithValidationError(w, "role must be one of: "+strings.Join(models.LedgerRoles, ", "))
 		return
 	}
-	if err := utils.ValidateAmount(amount); err != nil {
-		utils.RespondWithValidationError(w, err.Error())
+
+	switch err := handlers.SetLedgerMemberRole(r.Context(), db, ledgerID, memberID, role); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Member role updated", nil)
+	case handlers.ErrLedgerMemberNotFound:
+		utils.RespondWithNotFound(w, "Member")
+	case handlers.ErrLastLedgerOwner:
+		utils.RespondWithConflict(w, "A ledger needs at least one owner; make another member an owner first")
+	default:
+		utils.RespondWithInternalError(w, err, "Update ledger member")
+	}
+}
+
+// Removes a member from the selected ledger (POST 'user_id'; owners only).
+// The rows they added stay in the ledger.
+func removeLedgerMemberHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
 
-	// Validate alert threshold
-	alertThresholdStr := r.FormValue("alert_threshold")
-	if alertThresholdStr == "" {
-		utils.RespondWithValidationError(w, "Alert threshold is required")
+	memberID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil || memberID <= 0 {
+		utils.RespondWithValidationError(w, "Valid user ID is required (must be a positive number)")
 		return
 	}
-	alertThreshold, err := strconv.Atoi(alertThresholdStr)
-	if err != nil {
-		utils.RespondWithValidationError(w, "Alert threshold must be a valid number")
+
+	switch err := handlers.RemoveLedgerMember(r.Context(), db, ledgerID, memberID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Member removed", nil)
+	case handlers.ErrLedgerMemberNotFound:
+		utils.RespondWithNotFound(w, "Member")
+	case handlers.ErrLastLedgerOwner:
+		utils.RespondWithConflict(w, "A ledger needs at least one owner; make another member an owner or delete the ledger")
+	default:
+		utils.RespondWithInternalError(w, err, "Remove ledger member")
+	}
+}
+
+// Leaves the selected ledger. The only owner has to hand over ownership or delete it instead.
+func leaveLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
 		return
 	}
-	if alertThreshold < 0 || alertThreshold > 100 {
-		utils.RespondWithValidationError(w, "Alert threshold must be between 0 and 100")
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	switch err := handlers.RemoveLedgerMember(r.Context(), db, ledgerID, userID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "You left the ledger", nil)
+	case handlers.ErrLedgerMemberNotFound:
+		utils.RespondWithNotFound(w, "Ledger")
+	case handlers.ErrLastLedgerOwner:
+		utils.RespondWithConflict(w, "You are the ledger's only owner; make another member an owner or delete the ledger")
+	default:
+		utils.RespondWithInternalError(w, err, "Leave ledger")
+	}
+}
+
+// Invites someone to the selected ledger by email (POST 'email', optional 'role', default editor;
+// owners only). The invitation link is emailed to them.
+func addLedgerInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	if _, err := mail.ParseAddress(email); err != nil {
+		utils.RespondWithValidationError(w, "Invalid email format")
+		return
+	}
+	role := r.FormValue("role")
+	if role == "" {
+		role = models.LedgerRoleEditor
+	}
+	if !validLedgerRole(role) {
+		utils.RespondWithValidationError(w, "role must be one of: "+strings.Join(models.LedgerRoles, ", "))
+		return
+	}
+	if !emailEnabled() {
+		respondEmailDisabled(w)
+		return
+	}
+
+	token, inv, err := handlers.InviteToLedger(r.Context(), db, ledgerID, userID, email, role, jwtSecret)
+	switch err {
+	case nil:
+		sendEmail(ledgerInvitationEmail(inv, token))
+		utils.RespondWithSuccess(w, http.StatusCreated, "Invitation sent", map[string]interface{}{"invitation": inv})
+	case handlers.ErrAlreadyLedgerMember:
+		utils.RespondWithConflict(w, "That person is already a member of this ledger")
+	case handlers.ErrLedgerNotFound:
+		utils.RespondWithNotFound(w, "Ledger")
+	default:
+		utils.RespondWithInternalError(w, err, "Invite to ledger")
+	}
+}
+
+// Lists the selected ledger's pending invitations (owners only)
+func listLedgerInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
 
-	err = handlers.UpdateBudget(r.Context(), db, userID, budgetID, amount, alertThreshold)
+	invitations, err := handlers.ListLedgerInvitations(r.Context(), db, ledgerID)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			utils.RespondWithNotFound(w, "Budget")
-			return
-		}
-		utils.RespondWithInternalError(w, err, "Update budget")
+		utils.RespondWithInternalError(w, err, "List ledger invitations")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"invitations": invitations,
+	})
+}
+
+// Withdraws a pending invitation to the selected ledger (POST 'id'; owners only)
+func revokeLedgerInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
 		return
 	}
 
-	utils.RespondWithSuccess(w, http.StatusOK, "Budget updated successfully", nil)
+	invitationID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || invitationID <= 0 {
+		utils.RespondWithValidationError(w, "Valid invitation ID is required (must be a positive number)")
+		return
+	}
+
+	switch err := handlers.RevokeLedgerInvitation(r.Context(), db, ledgerID, invitationID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Invitation revoked", nil)
+	case handlers.ErrLedgerInvitationNotFound:
+		utils.RespondWithNotFound(w, "Invitation")
+	default:
+		utils.RespondWithInternalError(w, err, "Revoke ledger invitation")
+	}
 }
 
-func deleteBudgetHandler(w http.ResponseWriter, r *http.Request) {
+// Joins a ledger with the token from an invitation email (POST 'token'). The invitation must
+// have been sent to the signed-in account's email address.
+func acceptLedgerInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		utils.RespondWithValidationError(w, "token is required")
+		return
+	}
+
+	ledger, err := handlers.AcceptLedgerInvitation(r.Context(), db, userID, token, jwtSecret)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "You joined the ledger", map[string]interface{}{"ledger": ledger})
+	case handlers.ErrInvalidLedgerInvitation:
+		utils.RespondWithValidationError(w, "Invitation link is invalid or has expired")
+	case handlers.ErrLedgerInvitationEmail:
+		utils.RespondWithForbidden(w, "This invitation was sent to a different email address")
+	case handlers.ErrAlreadyLedgerMember:
+		utils.RespondWithConflict(w, "You are already a member of this ledger")
+	case handlers.ErrNoExchangeRate:
+		utils.RespondWithValidationError(w, "No exchange rate is loaded between one of this ledger's currencies and your base currency")
+	case handlers.ErrUserNotFound:
+		utils.RespondWithNotFound(w, "User")
+	default:
+		utils.RespondWithInternalError(w, err, "Accept ledger invitation")
+	}
+}
+
+// AddCategoryHandler creates a category for an authenticated user.
+func addCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+
 	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
 			"error":   "Only POST allowed",
@@ -1286,59 +1749,3268 @@ func deleteBudgetHandler(w http.ResponseWriter, r *http.Request) {
 
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Unauthorized",
+			"error":   "User not authenticated",
 		})
 		return
 	}
+	ledgerID, _ := middleware.GetLedgerID(r)
 
-	budgetID, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil || budgetID <= 0 {
+	name := utils.SanitizeCategoryName(r.FormValue("name"))
+	ctype := strings.ToLower(strings.TrimSpace(r.FormValue("type")))
+
+	if name == "" {
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Valid budget ID is required",
+			"error":   "Category name is required",
+		})
+		return
+	}
+	if len(name) > constants.MaxCategoryNameLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("Category name must be %d characters or less", constants.MaxCategoryNameLength),
+		})
+		return
+	}
+	if ctype != "expense" && ctype != "income" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Category type must be 'expense' or 'income'",
 		})
 		return
 	}
 
-	err = handlers.DeleteBudget(r.Context(), db, budgetID, userID)
+	// Optional parent category (0 or empty means top-level)
+	parentID := 0
+	if v := r.FormValue("parent_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "parent_id must be a positive category ID",
+			})
+			return
+		}
+		parentID = id
+	}
+
+	categoryID, err := handlers.AddCategory(r.Context(), db, ledgerID, userID, name, ctype, parentID)
+	switch err {
+	case handlers.ErrParentNotFound:
+		utils.RespondWithValidationError(w, "Parent category not found")
+		return
+	case handlers.ErrCategoryTypeMismatch:
+		utils.RespondWithValidationError(w, "Parent category must have the same type")
+		return
+	}
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   err.Error(),
+			"error":   "Add category failed: " + err.Error(),
 		})
 		return
 	}
 
+	// Return JSON of the newly created category
+	newCategory := map[string]interface{}{
+		"id":   categoryID,
+		"name": name,
+		"type": ctype,
+	}
+	if parentID > 0 {
+		newCategory["parent_id"] = parentID
+	}
+
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Budget deleted successfully",
+		"success":  true,
+		"category": newCategory,
 	})
 }
 
-func budgetAlertsHandler(w http.ResponseWriter, r *http.Request) {
+// Handles listing all categories for a user (expects 'user_id' as a URL query parameter)
+func listCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	userID, ok := middleware.GetUserID(r)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Only GET allowed",
+		})
+		return
+	}
+
+	ledgerID, ok := middleware.GetLedgerID(r)
 	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Unauthorized",
+			"error":   "User not authenticated",
 		})
 		return
 	}
 
-	alerts, err := handlers.GetBudgetAlerts(r.Context(), db, userID)
+	cats, err := handlers.ListCategories(r.Context(), db, ledgerID)
 	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   err.Error(),
+			"error":   "Failed to list categories: " + err.Error(),
 		})
 		return
 	}
 
-	json.NewEncoder(w).Encode(alerts)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"categories": cats,
+	})
+}
+
+// Renames a category (expects 'id', 'name')
+func updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "User not authenticated")
+		return
+	}
+
+	categoryID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || categoryID <= 0 {
+		utils.RespondWithValidationError(w, "Valid category ID is required (must be a positive number)")
+		return
+	}
+
+	name := utils.SanitizeCategoryName(r.FormValue("name"))
+	if name == "" {
+		utils.RespondWithValidationError(w, "Category name is required")
+		return
+	}
+	if len(name) > constants.MaxCategoryNameLength {
+		utils.RespondWithValidationError(w, fmt.Sprintf("Category name must be %d characters or less", constants.MaxCategoryNameLength))
+		return
+	}
+
+	// Optional parent change: omitted leaves it unchanged, 0 makes the category top-level
+	var parentID *int
+	if v := r.FormValue("parent_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			utils.RespondWithValidationError(w, "parent_id must be a category ID, or 0 for a top-level category")
+			return
+		}
+		parentID = &id
+	}
+
+	err = handlers.UpdateCategory(r.Context(), db, ledgerID, categoryID, name, parentID)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Category updated successfully", nil)
+	case handlers.ErrCategoryNotFound:
+		utils.RespondWithNotFound(w, "Category")
+	case handlers.ErrCategoryExists:
+		utils.RespondWithConflict(w, "A category with this name and type already exists")
+	case handlers.ErrParentNotFound:
+		utils.RespondWithValidationError(w, "Parent category not found")
+	case handlers.ErrCategoryTypeMismatch:
+		utils.RespondWithValidationError(w, "Parent category must have the same type")
+	case handlers.ErrCategoryCycle:
+		utils.RespondWithValidationError(w, "A category cannot be moved under itself or one of its subcategories")
+	default:
+		utils.RespondWithInternalError(w, err, "Update category")
+	}
+}
+
+// Deletes a category (expects 'id', optional 'reassign_to')
+// Categories still used by transactions or recurring rules require 'reassign_to'
+func deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "User not authenticated")
+		return
+	}
+
+	categoryID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || categoryID <= 0 {
+		utils.RespondWithValidationError(w, "Valid category ID is required (must be a positive number)")
+		return
+	}
+
+	reassignTo := 0
+	if v := r.FormValue("reassign_to"); v != "" {
+		reassignTo, err = strconv.Atoi(v)
+		if err != nil || reassignTo <= 0 {
+			utils.RespondWithValidationError(w, "reassign_to must be a positive category ID")
+			return
+		}
+	}
+
+	result, err := handlers.DeleteCategory(r.Context(), db, ledgerID, categoryID, reassignTo)
+	if err != nil {
+		respondWithCategoryMergeError(w, err, "Delete category")
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Category deleted successfully", result)
+}
+
+// Merges one category into another (expects 'source_id', 'target_id')
+// Transactions, recurring rules and budgets move to the target and the source is deleted
+func mergeCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "User not authenticated")
+		return
+	}
+
+	sourceID, err := strconv.Atoi(r.FormValue("source_id"))
+	if err != nil || sourceID <= 0 {
+		utils.RespondWithValidationError(w, "Valid source_id is required (must be a positive number)")
+		return
+	}
+	targetID, err := strconv.Atoi(r.FormValue("target_id"))
+	if err != nil || targetID <= 0 {
+		utils.RespondWithValidationError(w, "Valid target_id is required (must be a positive number)")
+		return
+	}
+
+	result, err := handlers.MergeCategories(r.Context(), db, ledgerID, sourceID, targetID)
+	if err != nil {
+		respondWithCategoryMergeError(w, err, "Merge categories")
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Categories merged successfully", result)
+}
+
+// respondWithCategoryMergeError maps category delete/merge errors to HTTP responses
+func respondWithCategoryMergeError(w http.ResponseWriter, err error, context string) {
+	switch err {
+	case handlers.ErrCategoryNotFound:
+		utils.RespondWithNotFound(w, "Category")
+	case handlers.ErrCategoryInUse:
+		utils.RespondWithConflict(w, "Category is used by transactions or recurring rules. Provide reassign_to to move them to another category.")
+	case handlers.ErrCategoryTypeMismatch:
+		utils.RespondWithValidationError(w, "Both categories must have the same type")
+	case handlers.ErrCategorySameAsTarget:
+		utils.RespondWithValidationError(w, "Source and target categories must be different")
+	default:
+		utils.RespondWithInternalError(w, err, context)
+	}
+}
+
+// Add a new transaction via POST
+func addTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "User not authenticated")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	// Optional category_id; without one, categorization rules pick a category of the given type
+	categoryID := 0
+	txType := ""
+	if v := r.FormValue("category_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			utils.RespondWithValidationError(w, "category_id must be a positive number")
+			return
+		}
+		categoryID = id
+	} else {
+		txType = strings.ToLower(strings.TrimSpace(r.FormValue("type")))
+		if txType == "" {
+			txType = "expense"
+		}
+		if txType != "expense" && txType != "income" {
+			utils.RespondWithValidationError(w, "type must be 'expense' or 'income'")
+			return
+		}
+	}
+
+	// Validate amount
+	amountStr := r.FormValue("amount")
+	if amountStr == "" {
+		utils.RespondWithValidationError(w, "Amount is required")
+		return
+	}
+	amount, err := models.ParseMoney(strings.TrimSpace(amountStr))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Amount must be a valid number with at most two decimal places")
+		return
+	}
+	if err := utils.ValidateAmount(amount); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	// Validate date format; "today" is the user's today
+	loc, err := handlers.UserLocation(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Get time zone")
+		return
+	}
+	date := r.FormValue("date")
+	if err := utils.ValidateTransactionDateIn(date, loc); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	description := utils.SanitizeDescription(r.FormValue("description"))
+
+	// Validate optional currency (defaults to the account's currency, or the user's base currency)
+	currency, err := parseCurrencyParam(r.FormValue("currency"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	accountID, err := parseAccountParam(r.FormValue("account_id"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	tx := models.Transaction{
+		LedgerID:     ledgerID,
+		UserID:       userID,
+		CategoryID:   categoryID,
+		CategoryType: txType,
+		Amount:       amount,
+		Currency:     currency,
+		Description:  description,
+		Date:         date,
+		AccountID:    accountID,
+	}
+
+	categoryID, err = handlers.AddTransaction(r.Context(), db, tx)
+	if err != nil {
+		if err == handlers.ErrNoExchangeRate {
+			respondNoExchangeRate(w, currency)
+			return
+		}
+		if err == handlers.ErrAccountNotFound {
+			utils.RespondWithValidationError(w, "Invalid account_id or the account is in another ledger")
+			return
+		}
+		if err == handlers.ErrAccountCurrency {
+			utils.RespondWithValidationError(w, "The currency must be the account's currency")
+			return
+		}
+		// Check if it's a category ownership error
+		if err.Error() == "category not found or unauthorized" {
+			utils.RespondWithValidationError(w, "Invalid category or you don't have permission to use this category")
+			return
+		}
+		utils.RespondWithInternalError(w, err, "Add transaction")
+		return
+	}
+	budgetAlerts.Trigger(ledgerID)
+
+	utils.RespondWithSuccess(w, http.StatusCreated, "Transaction added successfully", map[string]int{"category_id": categoryID})
+}
+
+// List all transactions for a user (GET)
+func listTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Only GET allowed",
+		})
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "User not authenticated",
+		})
+		return
+	}
+	list, err := handlers.ListTransactions(r.Context(), db, ledgerID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Failed to fetch transactions: " + err.Error(),
+		})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"transactions": list,
+	})
+}
+
+// Update an existing transaction (POST)
+func updateTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "User not authenticated")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	// Validate transaction ID
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		utils.RespondWithValidationError(w, "Valid transaction ID is required (must be a positive number)")
+		return
+	}
+
+	// Optional category_id; without one, categorization rules pick a category of the given type
+	categoryID := 0
+	txType := ""
+	if v := r.FormValue("category_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			utils.RespondWithValidationError(w, "category_id must be a positive number")
+			return
+		}
+		categoryID = id
+	} else {
+		txType = strings.ToLower(strings.TrimSpace(r.FormValue("type")))
+		if txType == "" {
+			txType = "expense"
+		}
+		if txType != "expense" && txType != "income" {
+			utils.RespondWithValidationError(w, "type must be 'expense' or 'income'")
+			return
+		}
+	}
+
+	// Validate amount
+	amountStr := r.FormValue("amount")
+	if amountStr == "" {
+		utils.RespondWithValidationError(w, "Amount is required")
+		return
+	}
+	amount, err := models.ParseMoney(strings.TrimSpace(amountStr))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Amount must be a valid number with at most two decimal places")
+		return
+	}
+	if err := utils.ValidateAmount(amount); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	// Validate date format; "today" is the user's today
+	loc, err := handlers.UserLocation(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Get time zone")
+		return
+	}
+	date := r.FormValue("date")
+	if err := utils.ValidateTransactionDateIn(date, loc); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	description := utils.SanitizeDescription(r.FormValue("description"))
+
+	// Validate optional currency and account (each kept as they are when omitted)
+	currency, err := parseCurrencyParam(r.FormValue("currency"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	accountID, err := parseAccountParam(r.FormValue("account_id"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	tx := models.Transaction{
+		ID:          id,
+		LedgerID:    ledgerID,
+		UserID:      userID,
+		CategoryID:  categoryID,
+		Amount:      amount,
+		Currency:    currency,
+		Description: description,
+		Date:        date,
+		AccountID:   accountID,
+	}
+
+	err = handlers.UpdateTransaction(r.Context(), db, tx)
+	if err != nil {
+		if err == handlers.ErrNoExchangeRate {
+			respondNoExchangeRate(w, currency)
+			return
+		}
+		if err == handlers.ErrAccountNotFound {
+			utils.RespondWithValidationError(w, "Invalid account_id or the account is in another ledger")
+			return
+		}
+		if err == handlers.ErrAccountCurrency {
+			utils.RespondWithValidationError(w, "The currency must be the account's currency")
+			return
+		}
+		if err == handlers.ErrSettlementTransaction {
+			utils.RespondWithConflict(w, "This transaction records a settlement; delete the settlement and record it again instead")
+			return
+		}
+		if err == handlers.ErrSplitExactAmount {
+			utils.RespondWithConflict(w, "This expense is split by exact amounts; set the split again or remove it before changing the amount")
+			return
+		}
+		if err.Error() == "category not found or unauthorized" {
+			utils.RespondWithValidationError(w, "Invalid category or you don't have permission to use this category")
+			return
+		}
+		utils.RespondWithInternalError(w, err, "Update transaction")
+		return
+	}
+	budgetAlerts.Trigger(ledgerID)
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Transaction updated successfully", nil)
+}
+
+// Delete a transaction (POST)
+func deleteTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Only POST allowed",
+		})
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "User not found in context",
+		})
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Valid transaction ID is required",
+		})
+		return
+	}
+
+	err = handlers.DeleteTransaction(r.Context(), db, id, ledgerID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Failed to delete transaction: " + err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Transaction deleted",
+	})
+}
+
+// Splits an expense between ledger members (POST 'transaction_id', 'method', 'participants', optional
+// 'paid_by', default the current user). Replaces any earlier split of the expense.
+func setSplitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	transactionID, err := strconv.Atoi(r.FormValue("transaction_id"))
+	if err != nil || transactionID <= 0 {
+		utils.RespondWithValidationError(w, "Valid transaction ID is required (must be a positive number)")
+		return
+	}
+	paidBy := userID
+	if v := r.FormValue("paid_by"); v != "" {
+		paidBy, err = strconv.Atoi(v)
+		if err != nil || paidBy <= 0 {
+			utils.RespondWithValidationError(w, "paid_by must be a user ID")
+			return
+		}
+	}
+	method := r.FormValue("method")
+	parts, err := handlers.ParseSplitParts(method, r.FormValue("participants"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	split, err := handlers.SetSplit(r.Context(), db, ledgerID, transactionID, paidBy, method, parts)
+	switch {
+	case err == nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Expense split", map[string]interface{}{"split": split})
+	case err == handlers.ErrTransactionNotFound:
+		utils.RespondWithNotFound(w, "Transaction")
+	case err == handlers.ErrSplitNotExpense:
+		utils.RespondWithValidationError(w, "Only expenses can be split")
+	case err == handlers.ErrSplitNotMember:
+		utils.RespondWithValidationError(w, "The payer and every participant must be members of this ledger")
+	case errors.Is(err, handlers.ErrSplitTotal):
+		utils.RespondWithValidationError(w, err.Error())
+	default:
+		utils.RespondWithInternalError(w, err, "Split expense")
+	}
+}
+
+// Returns how an expense is split (expects 'transaction_id' as a URL query parameter)
+func getSplitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	transactionID, err := strconv.Atoi(r.URL.Query().Get("transaction_id"))
+	if err != nil || transactionID <= 0 {
+		utils.RespondWithValidationError(w, "Valid transaction ID is required (must be a positive number)")
+		return
+	}
+
+	split, err := handlers.GetSplit(r.Context(), db, ledgerID, transactionID)
+	switch err {
+	case nil:
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"split":   split,
+		})
+	case handlers.ErrSplitNotFound:
+		utils.RespondWithNotFound(w, "Split")
+	default:
+		utils.RespondWithInternalError(w, err, "Get split")
+	}
+}
+
+// Stops an expense from being split (POST 'transaction_id')
+func deleteSplitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	transactionID, err := strconv.Atoi(r.FormValue("transaction_id"))
+	if err != nil || transactionID <= 0 {
+		utils.RespondWithValidationError(w, "Valid transaction ID is required (must be a positive number)")
+		return
+	}
+
+	switch err := handlers.DeleteSplit(r.Context(), db, ledgerID, transactionID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Split removed", nil)
+	case handlers.ErrSplitNotFound:
+		utils.RespondWithNotFound(w, "Split")
+	default:
+		utils.RespondWithInternalError(w, err, "Delete split")
+	}
+}
+
+// Returns who owes whom in the ledger and the fewest payments that would settle up
+func splitBalancesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	balances, settleUp, err := handlers.GetSplitBalances(r.Context(), db, ledgerID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Get split balances")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"balances":  balances,
+		"settle_up": settleUp,
+	})
+}
+
+// Records a payment that pays back a debt (POST 'to_user_id', and 'amount' or 'full' = true for
+// everything owed; optional 'from_user_id' (default the current user), 'currency', 'date' and 'note')
+func addSettlementHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	fromUserID := userID
+	if v := r.FormValue("from_user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			utils.RespondWithValidationError(w, "from_user_id must be a user ID")
+			return
+		}
+		fromUserID = id
+	}
+	toUserID, err := strconv.Atoi(r.FormValue("to_user_id"))
+	if err != nil || toUserID <= 0 {
+		utils.RespondWithValidationError(w, "Valid to_user_id is required")
+		return
+	}
+	if fromUserID == toUserID {
+		utils.RespondWithValidationError(w, "A settlement must be between two different members")
+		return
+	}
+
+	full := false
+	if v := r.FormValue("full"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			utils.RespondWithValidationError(w, "full must be true or false")
+			return
+		}
+		full = parsed
+	}
+	var amount models.Money
+	amountText := strings.TrimSpace(r.FormValue("amount"))
+	switch {
+	case full && amountText != "":
+		utils.RespondWithValidationError(w, "Give either amount or full=true, not both")
+		return
+	case !full && amountText == "":
+		utils.RespondWithValidationError(w, "Amount is required, or full=true to settle everything owed")
+		return
+	case !full:
+		amount, err = models.ParseMoney(amountText)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Amount must be a valid number with at most two decimal places")
+			return
+		}
+		if err := utils.ValidateAmount(amount); err != nil {
+			utils.RespondWithValidationError(w, err.Error())
+			return
+		}
+	}
+	currency, err := parseCurrencyParam(r.FormValue("currency"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	loc, err := handlers.UserLocation(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Get time zone")
+		return
+	}
+	date := r.FormValue("date")
+	if date == "" {
+		date = utils.TodayIn(loc).Format("2006-01-02")
+	}
+	if err := utils.ValidateTransactionDateIn(date, loc); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	settlement, err := handlers.AddSettlement(r.Context(), db, models.Settlement{
+		LedgerID:   ledgerID,
+		FromUserID: fromUserID,
+		ToUserID:   toUserID,
+		Amount:     amount,
+		Currency:   currency,
+		Date:       date,
+		Note:       utils.SanitizeDescription(r.FormValue("note")),
+		CreatedBy:  &userID,
+	}, full)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusCreated, "Settlement recorded", map[string]interface{}{"settlement": settlement})
+	case handlers.ErrSplitNotMember:
+		utils.RespondWithValidationError(w, "Both people must be members of this ledger")
+	case handlers.ErrNothingToSettle:
+		utils.RespondWithValidationError(w, "Nothing is owed in this currency; give an amount to record a payment anyway")
+	case handlers.ErrNoExchangeRate:
+		respondNoExchangeRate(w, currency)
+	default:
+		utils.RespondWithInternalError(w, err, "Add settlement")
+	}
+}
+
+// Lists the ledger's settlements, newest first
+func listSettlementsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	settlements, err := handlers.ListSettlements(r.Context(), db, ledgerID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "List settlements")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"settlements": settlements,
+	})
+}
+
+// Deletes a settlement recorded by mistake (POST 'id')
+func deleteSettlementHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	settlementID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || settlementID <= 0 {
+		utils.RespondWithValidationError(w, "Valid settlement ID is required (must be a positive number)")
+		return
+	}
+
+	switch err := handlers.DeleteSettlement(r.Context(), db, ledgerID, settlementID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Settlement deleted", nil)
+	case handlers.ErrSettlementNotFound:
+		utils.RespondWithNotFound(w, "Settlement")
+	default:
+		utils.RespondWithInternalError(w, err, "Delete settlement")
+	}
+}
+
+// parseAccountForm reads the name, type and opening balance of an account (POST 'name', 'type' and
+// optional 'opening_balance', which may be negative)
+func parseAccountForm(r *http.Request) (name, accountType string, openingBalance models.Money, err error) {
+	name = strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > constants.MaxAccountNameLength {
+		return "", "", 0, fmt.Errorf("name is required (max %d characters)", constants.MaxAccountNameLength)
+	}
+	accountType = strings.ToLower(strings.TrimSpace(r.FormValue("type")))
+	if !handlers.ValidAccountType(accountType) {
+		return "", "", 0, fmt.Errorf("type must be one of: %s", strings.Join(models.AccountTypes, ", "))
+	}
+	if v := strings.TrimSpace(r.FormValue("opening_balance")); v != "" {
+		openingBalance, err = models.ParseMoney(v)
+		if err != nil {
+			return "", "", 0, fmt.Errorf("opening_balance must be a valid number with at most two decimal places")
+		}
+		limit := models.Money(constants.MaxAmount).MulInt(100)
+		if openingBalance > limit || openingBalance < -limit {
+			return "", "", 0, fmt.Errorf("opening_balance must be between -%d and %d", constants.MaxAmount, constants.MaxAmount)
+		}
+	}
+	return name, accountType, openingBalance, nil
+}
+
+// Creates an account in the ledger (POST 'name', 'type', optional 'currency' (default the user's base
+// currency) and 'opening_balance')
+func addAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	name, accountType, openingBalance, err := parseAccountForm(r)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	currency, err := parseCurrencyParam(r.FormValue("currency"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	account, err := handlers.AddAccount(r.Context(), db, models.Account{
+		LedgerID:       ledgerID,
+		UserID:         userID,
+		Name:           name,
+		Type:           accountType,
+		Currency:       currency,
+		OpeningBalance: openingBalance,
+	})
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusCreated, "Account created", map[string]interface{}{"account": account})
+	case handlers.ErrAccountExists:
+		utils.RespondWithConflict(w, "An account with this name already exists")
+	case handlers.ErrTooManyAccounts:
+		utils.RespondWithValidationError(w, fmt.Sprintf("A ledger can have at most %d accounts; delete one first", constants.MaxAccountsPerLedger))
+	case handlers.ErrNoExchangeRate:
+		respondNoExchangeRate(w, currency)
+	default:
+		utils.RespondWithInternalError(w, err, "Add account")
+	}
+}
+
+// Lists the ledger's accounts with their balances, and their total in the user's base currency
+// (net_worth, null when an account's currency has no exchange rate)
+func listAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	accounts, err := handlers.ListAccounts(r.Context(), db, ledgerID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "List accounts")
+		return
+	}
+	var netWorth *models.Money
+	switch total, err := handlers.NetWorth(r.Context(), db, ledgerID, userID); err {
+	case nil:
+		netWorth = &total
+	case handlers.ErrNoExchangeRate:
+	default:
+		utils.RespondWithInternalError(w, err, "Net worth")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"accounts":  accounts,
+		"net_worth": netWorth,
+	})
+}
+
+// Renames an account and changes its type and opening balance (POST 'id', 'name', 'type' and
+// optional 'opening_balance'); its currency stays the same
+func updateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	accountID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || accountID <= 0 {
+		utils.RespondWithValidationError(w, "Valid account ID is required (must be a positive number)")
+		return
+	}
+	name, accountType, openingBalance, err := parseAccountForm(r)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	switch err := handlers.UpdateAccount(r.Context(), db, ledgerID, accountID, name, accountType, openingBalance); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Account updated", nil)
+	case handlers.ErrAccountNotFound:
+		utils.RespondWithNotFound(w, "Account")
+	case handlers.ErrAccountExists:
+		utils.RespondWithConflict(w, "An account with this name already exists")
+	default:
+		utils.RespondWithInternalError(w, err, "Update account")
+	}
+}
+
+// Deletes an account without transfers (POST 'id'); its transactions are kept without an account
+func removeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	accountID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || accountID <= 0 {
+		utils.RespondWithValidationError(w, "Valid account ID is required (must be a positive number)")
+		return
+	}
+
+	switch err := handlers.RemoveAccount(r.Context(), db, ledgerID, accountID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Account deleted", nil)
+	case handlers.ErrAccountNotFound:
+		utils.RespondWithNotFound(w, "Account")
+	case handlers.ErrAccountHasTransfers:
+		utils.RespondWithConflict(w, "Account still has transfers; delete them first")
+	default:
+		utils.RespondWithInternalError(w, err, "Delete account")
+	}
+}
+
+// Returns an account's transactions and transfers with its running balance after each (GET 'id',
+// optional 'from' and 'to' dates)
+func accountRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	accountID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || accountID <= 0 {
+		utils.RespondWithValidationError(w, "Valid account ID is required (must be a positive number)")
+		return
+	}
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			utils.RespondWithValidationError(w, "from and to must be dates in YYYY-MM-DD format")
+			return
+		}
+	}
+
+	account, entries, err := handlers.AccountRegister(r.Context(), db, ledgerID, accountID, from, to)
+	switch err {
+	case nil:
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"account": account,
+			"entries": entries,
+		})
+	case handlers.ErrAccountNotFound:
+		utils.RespondWithNotFound(w, "Account")
+	default:
+		utils.RespondWithInternalError(w, err, "Account register")
+	}
+}
+
+// Moves money between two accounts (POST 'from_account_id', 'to_account_id', 'amount', optional
+// 'to_amount' (default the amount, converted when the accounts' currencies differ), 'date' and 'description')
+func addTransferHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	fromAccountID, err := strconv.Atoi(r.FormValue("from_account_id"))
+	if err != nil || fromAccountID <= 0 {
+		utils.RespondWithValidationError(w, "Valid from_account_id is required")
+		return
+	}
+	toAccountID, err := strconv.Atoi(r.FormValue("to_account_id"))
+	if err != nil || toAccountID <= 0 {
+		utils.RespondWithValidationError(w, "Valid to_account_id is required")
+		return
+	}
+	if fromAccountID == toAccountID {
+		utils.RespondWithValidationError(w, "A transfer must be between two different accounts")
+		return
+	}
+
+	amount, err := models.ParseMoney(strings.TrimSpace(r.FormValue("amount")))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Amount must be a valid number with at most two decimal places")
+		return
+	}
+	if err := utils.ValidateAmount(amount); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	var toAmount models.Money
+	if v := strings.TrimSpace(r.FormValue("to_amount")); v != "" {
+		toAmount, err = models.ParseMoney(v)
+		if err != nil {
+			utils.RespondWithValidationError(w, "to_amount must be a valid number with at most two decimal places")
+			return
+		}
+		if err := utils.ValidateAmount(toAmount); err != nil {
+			utils.RespondWithValidationError(w, err.Error())
+			return
+		}
+	}
+
+	loc, err := handlers.UserLocation(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Get time zone")
+		return
+	}
+	date := r.FormValue("date")
+	if date == "" {
+		date = utils.TodayIn(loc).Format("2006-01-02")
+	}
+	if err := utils.ValidateTransactionDateIn(date, loc); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	transfer, err := handlers.AddTransfer(r.Context(), db, models.Transfer{
+		LedgerID:      ledgerID,
+		UserID:        userID,
+		FromAccountID: fromAccountID,
+		ToAccountID:   toAccountID,
+		Amount:        amount,
+		ToAmount:      toAmount,
+		Description:   utils.SanitizeDescription(r.FormValue("description")),
+		Date:          date,
+	})
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusCreated, "Transfer recorded", map[string]interface{}{"transfer": transfer})
+	case handlers.ErrAccountNotFound:
+		utils.RespondWithNotFound(w, "Account")
+	case handlers.ErrNoExchangeRate:
+		utils.RespondWithValidationError(w, "No exchange rate is loaded between the accounts' currencies; give a to_amount")
+	default:
+		utils.RespondWithInternalError(w, err, "Add transfer")
+	}
+}
+
+// Lists the ledger's transfers, newest first (GET, optional 'account_id' for one account's transfers)
+func listTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	accountID := 0
+	if v := r.URL.Query().Get("account_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			utils.RespondWithValidationError(w, "account_id must be a positive number")
+			return
+		}
+		accountID = id
+	}
+
+	transfers, err := handlers.ListTransfers(r.Context(), db, ledgerID, accountID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "List transfers")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"transfers": transfers,
+	})
+}
+
+// Deletes a transfer (POST 'id')
+func deleteTransferHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	transferID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || transferID <= 0 {
+		utils.RespondWithValidationError(w, "Valid transfer ID is required (must be a positive number)")
+		return
+	}
+
+	switch err := handlers.DeleteTransfer(r.Context(), db, ledgerID, transferID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Transfer deleted", nil)
+	case handlers.ErrTransferNotFound:
+		utils.RespondWithNotFound(w, "Transfer")
+	default:
+		utils.RespondWithInternalError(w, err, "Delete transfer")
+	}
+}
+
+// Returns overall totals for this user
+func summaryTotalsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+	expenses, income, err := handlers.GetTotals(r.Context(), db, ledgerID, userID)
+	if err == handlers.ErrNoExchangeRate {
+		respondUnconvertible(w)
+		return
+	}
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Summary totals")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]models.Money{
+		"total_expenses": expenses,
+		"total_income":   income,
+	})
+}
+
+// Returns monthly group totals for this user
+func summaryMonthlyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+	summary, err := handlers.GetMonthlyTotals(r.Context(), db, ledgerID, userID)
+	if err == handlers.ErrNoExchangeRate {
+		respondUnconvertible(w)
+		return
+	}
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Summary monthly")
+		return
+	}
+	json.NewEncoder(w).Encode(summary)
+}
+
+// Returns current month summary with normalized monthly recurring
+func summaryCurrentMonthHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+	summary, err := handlers.GetCurrentMonthSummary(r.Context(), db, ledgerID, userID)
+	if err == handlers.ErrNoExchangeRate {
+		respondUnconvertible(w)
+		return
+	}
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Summary current month")
+		return
+	}
+	json.NewEncoder(w).Encode(summary)
+}
+
+// Returns category-wise breakdown for this user for a date range
+func summaryCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	tree := r.URL.Query().Get("tree") == "true"
+	result, err := handlers.GetCategoryBreakdown(r.Context(), db, ledgerID, userID, from, to, tree)
+	if err == handlers.ErrNoExchangeRate {
+		respondUnconvertible(w)
+		return
+	}
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Summary category")
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// Group by period endpoint
+func summaryGroupHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+	granularity := r.URL.Query().Get("by")
+	summary, err := handlers.GetGroupTotals(r.Context(), db, ledgerID, userID, granularity)
+	if err == handlers.ErrNoExchangeRate {
+		respondUnconvertible(w)
+		return
+	}
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Summary group")
+		return
+	}
+	json.NewEncoder(w).Encode(summary)
+}
+
+// Category-wise summary for given year/month
+func summaryCategoryMonthHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+	year, _ := strconv.Atoi(r.URL.Query().Get("year"))
+	month, _ := strconv.Atoi(r.URL.Query().Get("month"))
+	if year == 0 || month == 0 {
+		utils.RespondWithValidationError(w, "year and month required")
+		return
+	}
+	tree := r.URL.Query().Get("tree") == "true"
+	result, err := handlers.GetCategoryMonthSummary(r.Context(), db, ledgerID, userID, year, month, tree)
+	if err == handlers.ErrNoExchangeRate {
+		respondUnconvertible(w)
+		return
+	}
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Summary category month")
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// Export transactions to CSV or JSON
+func exportTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	transactions, err := handlers.ListTransactions(r.Context(), db, ledgerID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Export transactions")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "csv" {
+		w.Header().Set("Content-Disposition", "attachment;filename=transactions.csv")
+		w.Header().Set("Content-Type", "text/csv")
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"ID", "CategoryID", "Amount", "Currency", "Description", "Date", "CreatedAt"}); err != nil {
+			utils.RespondWithInternalError(w, err, "CSV header write")
+			return
+		}
+		for _, tx := range transactions {
+			if err := writer.Write([]string{
+				strconv.Itoa(tx.ID),
+				strconv.Itoa(tx.CategoryID),
+				tx.Amount.String(),
+				tx.Currency,
+				tx.Description,
+				tx.Date,
+				tx.CreatedAt,
+			}); err != nil {
+				utils.RespondWithInternalError(w, err, "CSV row write")
+				return
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			utils.RespondWithInternalError(w, err, "CSV flush")
+			return
+		}
+		return
+	}
+	// Default: JSON
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(transactions); err != nil {
+		utils.RespondWithInternalError(w, err, "JSON encode")
+		return
+	}
+}
+
+// parseRecurrenceForm reads the schedule of a recurring transaction: 'rrule' (an RFC 5545 RRULE such as
+// FREQ=MONTHLY;BYMONTHDAY=1,15) or 'recurrence' (daily, weekly, monthly or yearly), optionally narrowed by
+// 'interval', 'end_date' (YYYY-MM-DD, inclusive) and 'max_occurrences'
+func parseRecurrenceForm(r *http.Request, startDate string) (rrule.Rule, error) {
+	var rule rrule.Rule
+	if v := strings.TrimSpace(r.FormValue("rrule")); v != "" {
+		parsed, err := rrule.Parse(v)
+		if err != nil {
+			return rule, fmt.Errorf("invalid rrule: %w", err)
+		}
+		rule = parsed
+	} else {
+		recurrence := strings.TrimSpace(r.FormValue("recurrence"))
+		if recurrence == "" {
+			return rule, fmt.Errorf("recurrence or rrule is required")
+		}
+		freq, err := rrule.ParseFrequency(recurrence)
+		if err != nil {
+			return rule, fmt.Errorf("recurrence must be one of: daily, weekly, monthly, yearly")
+		}
+		rule = rrule.Simple(freq)
+	}
+
+	if v := strings.TrimSpace(r.FormValue("interval")); v != "" {
+		interval, err := strconv.Atoi(v)
+		if err != nil || interval < 1 || interval > rrule.MaxInterval {
+			return rule, fmt.Errorf("interval must be a number between 1 and %d", rrule.MaxInterval)
+		}
+		rule.Interval = interval
+	}
+	if v := strings.TrimSpace(r.FormValue("end_date")); v != "" {
+		endDate, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return rule, fmt.Errorf("end_date must be in YYYY-MM-DD format")
+		}
+		if v < startDate {
+			return rule, fmt.Errorf("end_date cannot be before start_date")
+		}
+		rule.Until = endDate
+	}
+	if v := strings.TrimSpace(r.FormValue("max_occurrences")); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count < 1 || count > rrule.MaxCount {
+			return rule, fmt.Errorf("max_occurrences must be a number between 1 and %d", rrule.MaxCount)
+		}
+		rule.Count = count
+	}
+	if err := rule.Validate(); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+// User to add a recurring transaction.
+func addRecurringHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "User not authenticated")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	// Optional category_id; without one, categorization rules pick a category of the given type
+	categoryID := 0
+	txType := ""
+	if v := r.FormValue("category_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			utils.RespondWithValidationError(w, "category_id must be a positive number")
+			return
+		}
+		categoryID = id
+	} else {
+		txType = strings.ToLower(strings.TrimSpace(r.FormValue("type")))
+		if txType == "" {
+			txType = "expense"
+		}
+		if txType != "expense" && txType != "income" {
+			utils.RespondWithValidationError(w, "type must be 'expense' or 'income'")
+			return
+		}
+	}
+
+	// Validate amount
+	amountStr := r.FormValue("amount")
+	if amountStr == "" {
+		utils.RespondWithValidationError(w, "Amount is required")
+		return
+	}
+	amount, err := models.ParseMoney(strings.TrimSpace(amountStr))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Amount must be a valid number with at most two decimal places")
+		return
+	}
+	if err := utils.ValidateAmount(amount); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	// Validate start date format; "today" is the user's today
+	loc, err := handlers.UserLocation(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Get time zone")
+		return
+	}
+	startDate := r.FormValue("start_date")
+	if err := utils.ValidateRecurringDateIn(startDate, loc); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	// Validate recurrence
+	rule, err := parseRecurrenceForm(r, startDate)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	description := utils.SanitizeDescription(r.FormValue("description"))
+
+	// Validate optional currency (defaults to the account's currency, or the user's base currency)
+	currency, err := parseCurrencyParam(r.FormValue("currency"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	accountID, err := parseAccountParam(r.FormValue("account_id"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	rt := models.RecurringTransaction{
+		LedgerID:    ledgerID,
+		UserID:      userID,
+		CategoryID:  categoryID,
+		Amount:      amount,
+		Currency:    currency,
+		AccountID:   accountID,
+		Description: description,
+		StartDate:   startDate,
+		Recurrence:  strings.ToLower(rule.Freq.String()),
+		RRule:       rule.String(),
+	}
+
+	err = handlers.AddRecurringTransaction(r.Context(), db, rt)
+	if err != nil {
+		if err == handlers.ErrNoExchangeRate {
+			respondNoExchangeRate(w, currency)
+			return
+		}
+		if err == handlers.ErrAccountNotFound {
+			utils.RespondWithValidationError(w, "Invalid account_id or the account is in another ledger")
+			return
+		}
+		if err == handlers.ErrAccountCurrency {
+			utils.RespondWithValidationError(w, "The currency must be the account's currency")
+			return
+		}
+		if err.Error() == "category not found or unauthorized" {
+			utils.RespondWithValidationError(w, "Invalid category or you don't have permission to use this category")
+			return
+		}
+		utils.RespondWithInternalError(w, err, "Add recurring transaction")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusCreated, "Recurring transaction added successfully", nil)
+}
+
+// Returns all recurring transactions for the authenticated user
+func listRecurringHandler(w http.ResponseWriter, r *http.Request) {
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	recurrings, err := handlers.ListRecurringTransactions(r.Context(), db, ledgerID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "List recurring transactions")
+		return
+	}
+	json.NewEncoder(w).Encode(recurrings)
+}
+
+func editRecurringHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Valid id is required")
+		return
+	}
+	amount, err := models.ParseMoney(strings.TrimSpace(r.FormValue("amount")))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Amount must be a valid number with at most two decimal places")
+		return
+	}
+	if err := utils.ValidateAmount(amount); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	description := r.FormValue("description")
+	startDate := r.FormValue("start_date")
+	rule, err := parseRecurrenceForm(r, startDate)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	currency, err := parseCurrencyParam(r.FormValue("currency"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	accountID, err := parseAccountParam(r.FormValue("account_id"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	err = handlers.EditRecurringTransaction(r.Context(), db, ledgerID, userID, id, amount, currency, description, startDate, "", rule.String(), accountID)
+	if err != nil {
+		if err == handlers.ErrNoExchangeRate {
+			respondNoExchangeRate(w, currency)
+			return
+		}
+		if err == handlers.ErrAccountNotFound {
+			utils.RespondWithValidationError(w, "Invalid account_id or the account is in another ledger")
+			return
+		}
+		if err == handlers.ErrAccountCurrency {
+			utils.RespondWithValidationError(w, "The currency must be the account's currency")
+			return
+		}
+		utils.RespondWithInternalError(w, err, "Edit recurring transaction")
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Recurring transaction updated successfully", nil)
+}
+
+func deleteRecurringHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Valid id is required")
+		return
+	}
+	err = handlers.DeleteRecurringTransaction(r.Context(), db, id, ledgerID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Delete recurring transaction")
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Recurring transaction deleted successfully", nil)
+}
+
+// Pauses a recurring transaction ('id'); nothing is created until it's resumed
+func pauseRecurringHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Valid id is required")
+		return
+	}
+
+	switch err := handlers.PauseRecurringTransaction(r.Context(), db, ledgerID, id); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Recurring transaction paused", nil)
+	case handlers.ErrRecurringNotFound:
+		utils.RespondWithNotFound(w, "Recurring transaction")
+	default:
+		utils.RespondWithInternalError(w, err, "Pause recurring transaction")
+	}
+}
+
+// Resumes a paused recurring transaction ('id'); occurrences missed while paused are skipped
+func resumeRecurringHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Valid id is required")
+		return
+	}
+
+	today, err := handlers.UserToday(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Resume recurring transaction")
+		return
+	}
+
+	switch err := handlers.ResumeRecurringTransaction(r.Context(), db, ledgerID, id, today); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Recurring transaction resumed", nil)
+	case handlers.ErrRecurringNotFound:
+		utils.RespondWithNotFound(w, "Recurring transaction")
+	default:
+		utils.RespondWithInternalError(w, err, "Resume recurring transaction")
+	}
+}
+
+// Skips the next due occurrence of a recurring transaction ('id') and returns the skipped date
+func skipRecurringHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Valid id is required")
+		return
+	}
+
+	skipped, err := handlers.SkipNextRecurringOccurrence(r.Context(), db, ledgerID, id)
+	switch err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Next occurrence skipped",
+			map[string]string{"skipped_date": skipped.Format("2006-01-02")})
+	case handlers.ErrRecurringNotFound:
+		utils.RespondWithNotFound(w, "Recurring transaction")
+	case handlers.ErrRecurringPaused:
+		utils.RespondWithValidationError(w, "Recurring transaction is paused; resume it before skipping an occurrence")
+	case handlers.ErrNoNextOccurrence:
+		utils.RespondWithValidationError(w, "Recurring transaction has no upcoming occurrence")
+	default:
+		utils.RespondWithInternalError(w, err, "Skip recurring occurrence")
+	}
+}
+
+// parseRecurringExceptionForm reads 'id' and 'date' (YYYY-MM-DD) for the exception endpoints
+func parseRecurringExceptionForm(r *http.Request) (int, time.Time, error) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("valid id is required")
+	}
+	date, err := time.Parse("2006-01-02", strings.TrimSpace(r.FormValue("date")))
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("date is required in YYYY-MM-DD format")
+	}
+	return id, date, nil
+}
+
+// Skips one occurrence ('date') of a recurring transaction ('id')
+func addRecurringExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	id, date, err := parseRecurringExceptionForm(r)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	switch err := handlers.AddRecurringException(r.Context(), db, ledgerID, id, date); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusCreated, "Occurrence will be skipped", nil)
+	case handlers.ErrRecurringNotFound:
+		utils.RespondWithNotFound(w, "Recurring transaction")
+	case handlers.ErrNotAnOccurrence:
+		utils.RespondWithValidationError(w, "date is not an upcoming occurrence of this recurring transaction")
+	default:
+		utils.RespondWithInternalError(w, err, "Add recurring exception")
+	}
+}
+
+// Stops skipping an occurrence ('date') of a recurring transaction ('id')
+func removeRecurringExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	id, date, err := parseRecurringExceptionForm(r)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	switch err := handlers.RemoveRecurringException(r.Context(), db, ledgerID, id, date); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Occurrence is no longer skipped", nil)
+	case handlers.ErrRecurringExceptionNotFound:
+		utils.RespondWithNotFound(w, "Recurring exception")
+	default:
+		utils.RespondWithInternalError(w, err, "Remove recurring exception")
+	}
+}
+
+func searchAndFilterTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "User not authenticated")
+		return
+	}
+
+	// Pagination with validation
+	limit := 20 // default
+	if l := r.URL.Query().Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Invalid limit parameter: must be a number")
+			return
+		}
+		limit = v
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		v, err := strconv.Atoi(o)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Invalid offset parameter: must be a number")
+			return
+		}
+		offset = v
+	}
+
+	// Validate pagination parameters
+	if err := utils.ValidatePaginationParams(limit, offset); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	// Sorting
+	sortParam := r.URL.Query().Get("sort")
+	allowedSorts := map[string]string{
+		"date_asc":    "t.date ASC, t.created_at DESC",
+		"date_desc":   "t.date DESC, t.created_at DESC",
+		"amount_asc":  "t.amount ASC, t.created_at DESC",
+		"amount_desc": "t.amount DESC, t.created_at DESC",
+	}
+	// Default: Sort by when transaction was created (most recent first)
+	orderBy := "t.created_at DESC"
+	if s, ok := allowedSorts[sortParam]; ok {
+		orderBy = s
+	}
+
+	// Filters
+	keyword := r.URL.Query().Get("q")
+	categoryID, _ := strconv.Atoi(r.URL.Query().Get("category_id"))
+	dateFrom := r.URL.Query().Get("from")
+	dateTo := r.URL.Query().Get("to")
+	amountMin, _ := models.ParseMoney(r.URL.Query().Get("min_amount"))
+	amountMax, _ := models.ParseMoney(r.URL.Query().Get("max_amount"))
+
+	list, err := handlers.FilterTransactionsPaginated(
+		r.Context(), db, ledgerID, keyword, categoryID, dateFrom, dateTo, amountMin, amountMax, orderBy, limit, offset,
+	)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Search transactions")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"transactions": list,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// Budget handlers
+func addBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "User not authenticated")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	// Validate category_id (0 means overall budget, > 0 means category-specific)
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil || categoryID < 0 {
+		utils.RespondWithValidationError(w, "Valid category_id is required (0 for overall budget, or a positive number for category-specific budget)")
+		return
+	}
+
+	// Validate amount
+	amountStr := r.FormValue("amount")
+	if amountStr == "" {
+		utils.RespondWithValidationError(w, "Amount is required")
+		return
+	}
+	amount, err := models.ParseMoney(strings.TrimSpace(amountStr))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Amount must be a valid number with at most two decimal places")
+		return
+	}
+	if err := utils.ValidateAmount(amount); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	// Validate period
+	period := strings.ToLower(strings.TrimSpace(r.FormValue("period")))
+	if period == "" {
+		period = "monthly"
+	}
+
+	// Validate alert threshold
+	alertThreshold := 80 // default
+	alertThresholdStr := r.FormValue("alert_threshold")
+	if alertThresholdStr != "" {
+		threshold, err := strconv.Atoi(alertThresholdStr)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Alert threshold must be a valid number")
+			return
+		}
+		if threshold < 0 || threshold > 100 {
+			utils.RespondWithValidationError(w, "Alert threshold must be between 0 and 100")
+			return
+		}
+		alertThreshold = threshold
+	}
+
+	// Optional rollover (carry unused or overspent amounts into the next period)
+	rollover := false
+	if v := r.FormValue("rollover"); v != "" {
+		rollover, err = strconv.ParseBool(v)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Rollover must be true or false")
+			return
+		}
+	}
+
+	budget := models.Budget{
+		LedgerID:       ledgerID,
+		UserID:         userID,
+		CategoryID:     categoryID,
+		Amount:         amount,
+		Period:         period,
+		StartDate:      strings.TrimSpace(r.FormValue("start_date")),
+		EndDate:        strings.TrimSpace(r.FormValue("end_date")),
+		AlertThreshold: alertThreshold,
+		Rollover:       rollover,
+	}
+	if err := handlers.ValidateBudgetPeriod(budget); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	err = handlers.AddBudget(r.Context(), db, budget)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			utils.RespondWithConflict(w, err.Error())
+			return
+		}
+		utils.RespondWithInternalError(w, err, "Add budget")
+		return
+	}
+	budgetAlerts.Trigger(ledgerID)
+
+	utils.RespondWithSuccess(w, http.StatusCreated, "Budget added successfully", nil)
+}
+
+func listBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Unauthorized",
+		})
+		return
+	}
+
+	budgets, err := handlers.ListBudgets(r.Context(), db, ledgerID)
+	if err == handlers.ErrNoExchangeRate {
+		respondUnconvertible(w)
+		return
+	}
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"budgets": budgets,
+	})
+}
+
+func updateBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "User not authenticated")
+		return
+	}
+
+	// Validate budget ID
+	budgetID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || budgetID <= 0 {
+		utils.RespondWithValidationError(w, "Valid budget ID is required (must be a positive number)")
+		return
+	}
+
+	// Validate amount
+	amountStr := r.FormValue("amount")
+	if amountStr == "" {
+		utils.RespondWithValidationError(w, "Amount is required")
+		return
+	}
+	amount, err := models.ParseMoney(strings.TrimSpace(amountStr))
+	if err != nil {
+		utils.RespondWithValidationError(w, "Amount must be a valid number with at most two decimal places")
+		return
+	}
+	if err := utils.ValidateAmount(amount); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	// Validate alert threshold
+	alertThresholdStr := r.FormValue("alert_threshold")
+	if alertThresholdStr == "" {
+		utils.RespondWithValidationError(w, "Alert threshold is required")
+		return
+	}
+	alertThreshold, err := strconv.Atoi(alertThresholdStr)
+	if err != nil {
+		utils.RespondWithValidationError(w, "Alert threshold must be a valid number")
+		return
+	}
+	if alertThreshold < 0 || alertThreshold > 100 {
+		utils.RespondWithValidationError(w, "Alert threshold must be between 0 and 100")
+		return
+	}
+
+	// Optional rollover change; omitted leaves it unchanged
+	var rollover *bool
+	if v := r.FormValue("rollover"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Rollover must be true or false")
+			return
+		}
+		rollover = &parsed
+	}
+
+	err = handlers.UpdateBudget(r.Context(), db, ledgerID, budgetID, amount, alertThreshold, rollover)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.RespondWithNotFound(w, "Budget")
+			return
+		}
+		utils.RespondWithInternalError(w, err, "Update budget")
+		return
+	}
+	budgetAlerts.Trigger(ledgerID)
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Budget updated successfully", nil)
+}
+
+func deleteBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Only POST allowed",
+		})
+		return
+	}
+
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Unauthorized",
+		})
+		return
+	}
+
+	budgetID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || budgetID <= 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Valid budget ID is required",
+		})
+		return
+	}
+
+	err = handlers.DeleteBudget(r.Context(), db, budgetID, ledgerID)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Budget deleted successfully",
+	})
+}
+
+func budgetAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Unauthorized",
+		})
+		return
+	}
+
+	alerts, err := handlers.GetBudgetAlerts(r.Context(), db, ledgerID)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(alerts)
+}
+
+// Returns planned vs actual spending over the last N periods (?periods=, default 6) for one
+// budget (?id=) or all budgets, with the current period last
+func budgetPerformanceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	budgetID := 0
+	if v := r.URL.Query().Get("id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			utils.RespondWithValidationError(w, "id must be a positive budget ID")
+			return
+		}
+		budgetID = id
+	}
+	periods := constants.DefaultBudgetPerformancePeriods
+	if v := r.URL.Query().Get("periods"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > constants.MaxBudgetPerformancePeriods {
+			utils.RespondWithValidationError(w, fmt.Sprintf("periods must be between 1 and %d", constants.MaxBudgetPerformancePeriods))
+			return
+		}
+		periods = n
+	}
+
+	reports, err := handlers.GetBudgetPerformance(r.Context(), db, ledgerID, budgetID, periods)
+	if err != nil {
+		if err == handlers.ErrBudgetNotFound {
+			utils.RespondWithNotFound(w, "Budget")
+			return
+		}
+		utils.RespondWithInternalError(w, err, "Budget performance")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"budgets": reports,
+	})
+}
+
+// parseAccountParam validates an optional account_id form value: nil means "not provided", 0 means no account
+func parseAccountParam(value string) (*int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return nil, fmt.Errorf("account_id must be an account ID, or 0 for no account")
+	}
+	return &id, nil
+}
+
+// parseCurrencyParam validates an optional currency form value; empty means "not provided"
+func parseCurrencyParam(value string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", nil
+	}
+	return utils.NormalizeCurrency(value)
+}
+
+// Returns (GET) or changes (POST 'currency') the user's base currency for summaries and budgets
+func baseCurrencyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		currency, err := handlers.GetBaseCurrency(r.Context(), db, userID)
+		if err != nil {
+			utils.RespondWithInternalError(w, err, "Get base currency")
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success":       true,
+			"base_currency": currency,
+		})
+	case http.MethodPost:
+		currency, err := utils.NormalizeCurrency(r.FormValue("currency"))
+		if err != nil {
+			utils.RespondWithValidationError(w, err.Error())
+			return
+		}
+		err = handlers.SetBaseCurrency(r.Context(), db, userID, currency)
+		if err != nil {
+			if err == handlers.ErrNoExchangeRate {
+				utils.RespondWithValidationError(w, "Some of your transactions use a currency with no exchange rate to "+currency)
+				return
+			}
+			utils.RespondWithInternalError(w, err, "Set base currency")
+			return
+		}
+		utils.RespondWithSuccess(w, http.StatusOK, "Base currency updated successfully", map[string]string{"base_currency": currency})
+	default:
+		utils.RespondWithMethodNotAllowed(w, "GET, POST")
+	}
+}
+
+// Returns (GET) or changes (POST 'month_start_day') the day of the month the user's budget months start on
+func monthStartDayHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		day, err := handlers.GetMonthStartDay(r.Context(), db, userID)
+		if err != nil {
+			utils.RespondWithInternalError(w, err, "Get month start day")
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success":         true,
+			"month_start_day": day,
+		})
+	case http.MethodPost:
+		day, err := strconv.Atoi(strings.TrimSpace(r.FormValue("month_start_day")))
+		if err != nil || day < 1 || day > constants.MaxMonthStartDay {
+			utils.RespondWithValidationError(w, fmt.Sprintf("month_start_day must be between 1 and %d", constants.MaxMonthStartDay))
+			return
+		}
+		if err := handlers.SetMonthStartDay(r.Context(), db, userID, day); err != nil {
+			utils.RespondWithInternalError(w, err, "Set month start day")
+			return
+		}
+		utils.RespondWithSuccess(w, http.StatusOK, "Month start day updated successfully", map[string]int{"month_start_day": day})
+	default:
+		utils.RespondWithMethodNotAllowed(w, "GET, POST")
+	}
+}
+
+// Gets (GET) or sets (POST 'balance_floor') the balance below which /forecast warns
+func balanceFloorHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		floor, err := handlers.GetBalanceFloor(r.Context(), db, userID)
+		if err != nil {
+			utils.RespondWithInternalError(w, err, "Get balance floor")
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success":       true,
+			"balance_floor": floor,
+		})
+	case http.MethodPost:
+		floor, err := models.ParseMoney(strings.TrimSpace(r.FormValue("balance_floor")))
+		if err != nil {
+			utils.RespondWithValidationError(w, "balance_floor must be a valid number with at most two decimal places")
+			return
+		}
+		if limit := models.Money(constants.MaxAmount).MulInt(100); floor > limit || floor < -limit {
+			utils.RespondWithValidationError(w, fmt.Sprintf("balance_floor must be between -%d and %d", constants.MaxAmount, constants.MaxAmount))
+			return
+		}
+		if err := handlers.SetBalanceFloor(r.Context(), db, userID, floor); err != nil {
+			utils.RespondWithInternalError(w, err, "Set balance floor")
+			return
+		}
+		utils.RespondWithSuccess(w, http.StatusOK, "Balance floor updated successfully", map[string]models.Money{"balance_floor": floor})
+	default:
+		utils.RespondWithMethodNotAllowed(w, "GET, POST")
+	}
+}
+
+// Gets (GET) or sets (POST 'timezone') the IANA time zone that decides the user's "today"
+func timezoneHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		name, err := handlers.GetTimezone(r.Context(), db, userID)
+		if err != nil {
+			utils.RespondWithInternalError(w, err, "Get time zone")
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success":  true,
+			"timezone": name,
+		})
+	case http.MethodPost:
+		name := strings.TrimSpace(r.FormValue("timezone"))
+		if _, err := utils.LoadTimezone(name); err != nil {
+			utils.RespondWithValidationError(w, err.Error())
+			return
+		}
+		if err := handlers.SetTimezone(r.Context(), db, userID, name); err != nil {
+			utils.RespondWithInternalError(w, err, "Set time zone")
+			return
+		}
+		utils.RespondWithSuccess(w, http.StatusOK, "Time zone updated successfully", map[string]string{"timezone": name})
+	default:
+		utils.RespondWithMethodNotAllowed(w, "GET, POST")
+	}
+}
+
+// Projects the balance day by day for ?days= (default 90, max 365) days from tomorrow
+func forecastHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	days := constants.DefaultForecastDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > constants.MaxForecastDays {
+			utils.RespondWithValidationError(w, fmt.Sprintf("days must be between 1 and %d", constants.MaxForecastDays))
+			return
+		}
+		days = n
+	}
+
+	today, err := handlers.UserToday(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Forecast")
+		return
+	}
+	forecast, err := handlers.GetForecast(r.Context(), db, ledgerID, userID, days, today)
+	if err == handlers.ErrNoExchangeRate {
+		respondUnconvertible(w)
+		return
+	}
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Forecast")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, forecast)
+}
+
+// Lists loaded exchange rates, optionally filtered by ?currency=EUR
+func listExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	currency, err := parseCurrencyParam(r.URL.Query().Get("currency"))
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	rates, err := handlers.ListExchangeRates(r.Context(), db, currency)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "List exchange rates")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":        true,
+		"exchange_rates": rates,
+	})
+}
+
+// Lists recent runs of the recurring transaction processor (admin only), with limit/offset paging
+func recurringJobRunsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+
+	limit := 20 // default
+	if l := r.URL.Query().Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Invalid limit parameter: must be a number")
+			return
+		}
+		limit = v
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		v, err := strconv.Atoi(o)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Invalid offset parameter: must be a number")
+			return
+		}
+		offset = v
+	}
+	if err := utils.ValidatePaginationParams(limit, offset); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	runs, err := handlers.ListRecurringJobRuns(r.Context(), db, limit, offset)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "List recurring job runs")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"runs":    runs,
+	})
+}
+
+// Loads exchange rates from CSV (admin only). Accepts a multipart 'file' field or a raw text/csv body.
+func importExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxExchangeRateUploadBytes)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			utils.RespondWithValidationError(w, "CSV file is required in the 'file' field")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	rates, err := handlers.ParseExchangeRatesCSV(body)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	count, err := handlers.ImportExchangeRates(r.Context(), db, rates)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Import exchange rates")
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Exchange rates imported successfully", map[string]int{"imported": count})
+}
+
+// smtpConfig returns the SMTP server address and credentials, or ok=false when SMTP_HOST is unset
+func smtpConfig() (addr string, auth smtp.Auth, ok bool) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return "", nil, false
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return net.JoinHostPort(host, port), auth, true
+}
+
+// newNotifier builds the channels budget alerts are delivered through: always the in-app inbox,
+// plus email when SMTP_HOST is set and a webhook when NOTIFY_WEBHOOK_URL is set
+func newNotifier() notify.Notifier {
+	notifiers := []notify.Notifier{notify.InAppNotifier{DB: db}}
+
+	if addr, auth, ok := smtpConfig(); ok {
+		notifiers = append(notifiers, notify.SMTPNotifier{
+			Addr: addr,
+			From: os.Getenv("SMTP_FROM"),
+			Auth: auth,
+		})
+		slog.Info("Email notifications enabled", "smtp_addr", addr)
+	}
+
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, notify.WebhookNotifier{
+			URL:    url,
+			Secret: os.Getenv("NOTIFY_WEBHOOK_SECRET"),
+			Client: &http.Client{Timeout: constants.NotificationTimeout},
+		})
+		slog.Info("Webhook notifications enabled")
+	}
+
+	return notify.Multi(notifiers...)
+}
+
+// newMailer sends account email through SMTP when SMTP_HOST is set. Otherwise messages go to files in
+// MAIL_OUTBOX_DIR for local development when that is set, and nowhere at all when it isn't: the
+// endpoints that exist to send a link then fail (see emailEnabled).
+func newMailer() notify.Mailer {
+	from := os.Getenv("SMTP_FROM")
+	if addr, auth, ok := smtpConfig(); ok {
+		return notify.SMTPMailer{Addr: addr, From: from, Auth: auth}
+	}
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	dir := os.Getenv("MAIL_OUTBOX_DIR")
+	if dir == "" {
+		slog.Warn("Neither SMTP_HOST nor MAIL_OUTBOX_DIR is set, account email is disabled: password resets, verification emails and ledger invitations are unavailable.")
+		return notify.DisabledMailer{}
+	}
+	slog.Warn("SMTP_HOST not set, account emails are written to the outbox instead of being delivered. Set SMTP_HOST in production.", "outbox_dir", dir)
+	return notify.OutboxMailer{Dir: dir, From: from}
+}
+
+// loadOIDCProvider configures single sign-on from OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET
+// (empty for a public client), OIDC_REDIRECT_URL (default APP_URL + "/auth/callback") and
+// OIDC_SCOPES (space-separated). Returns nil when OIDC_ISSUER isn't set.
+func loadOIDCProvider() (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(issuer); err != nil || !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("OIDC_ISSUER must be an absolute URL, got %q", issuer)
+	}
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = appURL + "/auth/callback"
+	}
+
+	slog.Info("Single sign-on enabled", "issuer", issuer, "redirect_url", redirectURL)
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	}, &http.Client{Timeout: constants.OIDCTimeout}), nil
+}
+
+// loadEmailVerificationPolicy reads EMAIL_VERIFICATION ("optional", the default, or "required")
+// and EMAIL_VERIFICATION_GRACE, how long new accounts may sign in before verifying (e.g. "72h")
+func loadEmailVerificationPolicy() (handlers.EmailVerificationPolicy, error) {
+	var policy handlers.EmailVerificationPolicy
+	switch mode := os.Getenv("EMAIL_VERIFICATION"); mode {
+	case "", "optional":
+	case "required":
+		policy.Required = true
+	default:
+		return policy, fmt.Errorf("EMAIL_VERIFICATION must be 'optional' or 'required', got %q", mode)
+	}
+	if grace := os.Getenv("EMAIL_VERIFICATION_GRACE"); grace != "" {
+		d, err := time.ParseDuration(grace)
+		if err != nil || d < 0 {
+			return policy, fmt.Errorf("EMAIL_VERIFICATION_GRACE must be a duration such as 72h, got %q", grace)
+		}
+		policy.GracePeriod = d
+	}
+	return policy, nil
+}
+
+// loadExchangeRatesFile imports exchange rates from a CSV file at startup; failures are logged, not fatal
+func loadExchangeRatesFile(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		slog.Error("Failed to open exchange rates file", "path", path, "error", err)
+		return
+	}
+	defer file.Close()
+
+	rates, err := handlers.ParseExchangeRatesCSV(file)
+	if err != nil {
+		slog.Error("Invalid exchange rates file", "path", path, "error", err)
+		return
+	}
+	count, err := handlers.ImportExchangeRates(context.Background(), db, rates)
+	if err != nil {
+		slog.Error("Failed to import exchange rates file", "path", path, "error", err)
+		return
+	}
+	slog.Info("Loaded exchange rates from file", "path", path, "count", count)
+}
+
+// Parses an uploaded bank statement (multipart 'file') and returns the rows with duplicate flags.
+// Nothing is saved; the client sends the selected rows to /import/commit.
+func importPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxImportUploadBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.RespondWithValidationError(w, "Statement file is required in the 'file' field")
+		return
+	}
+	defer file.Close()
+
+	format, err := importer.DetectFormat(r.FormValue("format"), header.Filename)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	var rows []importer.Row
+	switch format {
+	case importer.FormatCSV:
+		mapping, err := parseCSVMapping(r)
+		if err != nil {
+			utils.RespondWithValidationError(w, err.Error())
+			return
+		}
+		rows, err = importer.ParseCSV(file, mapping)
+	case importer.FormatOFX, importer.FormatQFX:
+		rows, err = importer.ParseOFX(file)
+	case importer.FormatQIF:
+		rows, err = importer.ParseQIF(file, r.FormValue("date_format"))
+	}
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	if len(rows) == 0 {
+		utils.RespondWithValidationError(w, "No transactions found in the file")
+		return
+	}
+	if len(rows) > constants.MaxImportRows {
+		utils.RespondWithValidationError(w, fmt.Sprintf("Too many rows: at most %d transactions per import", constants.MaxImportRows))
+		return
+	}
+
+	preview, err := handlers.PreviewImport(r.Context(), db, ledgerID, userID, rows)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Preview import")
+		return
+	}
+
+	duplicates, invalid := 0, 0
+	for _, row := range preview {
+		if row.Duplicate {
+			duplicates++
+		}
+		if row.Error != "" {
+			invalid++
+		}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"format":     format,
+		"total":      len(preview),
+		"duplicates": duplicates,
+		"errors":     invalid,
+		"rows":       preview,
+	})
+}
+
+// parseCSVMapping reads the CSV column mapping from the preview form fields
+func parseCSVMapping(r *http.Request) (importer.CSVMapping, error) {
+	mapping := importer.CSVMapping{
+		Date:        r.FormValue("date_column"),
+		Amount:      r.FormValue("amount_column"),
+		Debit:       r.FormValue("debit_column"),
+		Credit:      r.FormValue("credit_column"),
+		Description: r.FormValue("description_column"),
+		Currency:    r.FormValue("currency_column"),
+		DateFormat:  r.FormValue("date_format"),
+	}
+
+	switch delimiter := r.FormValue("delimiter"); delimiter {
+	case "":
+	case "tab", "\\t":
+		mapping.Delimiter = '\t'
+	default:
+		runes := []rune(delimiter)
+		if len(runes) != 1 || runes[0] == '"' || runes[0] == '\n' || runes[0] == '\r' {
+			return mapping, fmt.Errorf("delimiter must be a single character or 'tab'")
+		}
+		mapping.Delimiter = runes[0]
+	}
+
+	flags := map[string]*bool{
+		"decimal_comma": &mapping.DecimalComma,
+		"invert_sign":   &mapping.InvertSign,
+	}
+	for name, target := range flags {
+		if value := r.FormValue(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return mapping, fmt.Errorf("%s must be true or false", name)
+			}
+			*target = parsed
+		}
+	}
+	if value := r.FormValue("has_header"); value != "" {
+		hasHeader, err := strconv.ParseBool(value)
+		if err != nil {
+			return mapping, fmt.Errorf("has_header must be true or false")
+		}
+		mapping.NoHeader = !hasHeader
+	}
+	return mapping, nil
+}
+
+// Imports the rows selected from a preview (JSON body {"rows": [...]}) in one database transaction.
+// Responds 422 with a per-row report, and saves nothing, if any row is invalid.
+func importCommitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxImportUploadBytes)
+	var req struct {
+		Rows []handlers.ImportCommitRow `json:"rows"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithValidationError(w, "Invalid JSON body: amounts must be numbers with at most two decimal places")
+		return
+	}
+	if len(req.Rows) == 0 {
+		utils.RespondWithValidationError(w, "At least one row is required")
+		return
+	}
+	if len(req.Rows) > constants.MaxImportRows {
+		utils.RespondWithValidationError(w, fmt.Sprintf("Too many rows: at most %d transactions per import", constants.MaxImportRows))
+		return
+	}
+
+	result, err := handlers.CommitImport(r.Context(), db, ledgerID, userID, req.Rows)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Commit import")
+		return
+	}
+	if !result.Committed {
+		utils.RespondWithJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"success": false,
+			"error":   "Some rows are invalid; nothing was imported",
+			"result":  result,
+		})
+		return
+	}
+	budgetAlerts.Trigger(ledgerID)
+	utils.RespondWithSuccess(w, http.StatusOK, "Import completed successfully", result)
+}
+
+// parseRuleForm reads a categorization rule from form fields: category_id, match_type, pattern,
+// and optional min_amount, max_amount, weekday (0 = Sunday) and priority
+func parseRuleForm(r *http.Request) (models.CategorizationRule, error) {
+	var rule models.CategorizationRule
+
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil || categoryID <= 0 {
+		return rule, fmt.Errorf("valid category_id is required (must be a positive number)")
+	}
+	rule.CategoryID = categoryID
+	rule.MatchType = strings.ToLower(strings.TrimSpace(r.FormValue("match_type")))
+	rule.Pattern = r.FormValue("pattern")
+
+	for name, target := range map[string]**models.Money{"min_amount": &rule.MinAmount, "max_amount": &rule.MaxAmount} {
+		if v := strings.TrimSpace(r.FormValue(name)); v != "" {
+			amount, err := models.ParseMoney(v)
+			if err != nil {
+				return rule, fmt.Errorf("%s must be a valid number with at most two decimal places", name)
+			}
+			*target = &amount
+		}
+	}
+	if v := strings.TrimSpace(r.FormValue("weekday")); v != "" {
+		weekday, err := strconv.Atoi(v)
+		if err != nil {
+			return rule, fmt.Errorf("weekday must be a number between 0 (Sunday) and 6 (Saturday)")
+		}
+		rule.Weekday = &weekday
+	}
+	if v := strings.TrimSpace(r.FormValue("priority")); v != "" {
+		priority, err := strconv.Atoi(v)
+		if err != nil {
+			return rule, fmt.Errorf("priority must be a whole number")
+		}
+		rule.Priority = priority
+	}
+	return rule, handlers.ValidateRule(rule)
+}
+
+// Creates a categorization rule (see parseRuleForm for fields)
+func addRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+	ledgerID, _ := middleware.GetLedgerID(r)
+
+	rule, err := parseRuleForm(r)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	rule.LedgerID = ledgerID
+	rule.UserID = userID
+
+	id, err := handlers.AddRule(r.Context(), db, rule)
+	if err != nil {
+		if err == handlers.ErrCategoryNotFound {
+			utils.RespondWithValidationError(w, "Invalid category or you don't have permission to use this category")
+			return
+		}
+		utils.RespondWithInternalError(w, err, "Add rule")
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusCreated, "Rule added successfully", map[string]int{"id": id})
+}
+
+// Lists the user's categorization rules in the order they are evaluated
+func listRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	rules, err := handlers.ListRules(r.Context(), db, ledgerID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "List rules")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"rules":   rules,
+	})
+}
+
+// Replaces a categorization rule (expects 'id' plus the parseRuleForm fields)
+func updateRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	ruleID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || ruleID <= 0 {
+		utils.RespondWithValidationError(w, "Valid rule ID is required (must be a positive number)")
+		return
+	}
+	rule, err := parseRuleForm(r)
+	if err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+	rule.ID = ruleID
+	rule.LedgerID = ledgerID
+
+	switch err := handlers.UpdateRule(r.Context(), db, rule); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Rule updated successfully", nil)
+	case handlers.ErrRuleNotFound:
+		utils.RespondWithNotFound(w, "Rule")
+	case handlers.ErrCategoryNotFound:
+		utils.RespondWithValidationError(w, "Invalid category or you don't have permission to use this category")
+	default:
+		utils.RespondWithInternalError(w, err, "Update rule")
+	}
+}
+
+// Deletes a categorization rule (expects 'id')
+func deleteRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	ruleID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || ruleID <= 0 {
+		utils.RespondWithValidationError(w, "Valid rule ID is required (must be a positive number)")
+		return
+	}
+
+	switch err := handlers.DeleteRule(r.Context(), db, ledgerID, ruleID); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Rule deleted successfully", nil)
+	case handlers.ErrRuleNotFound:
+		utils.RespondWithNotFound(w, "Rule")
+	default:
+		utils.RespondWithInternalError(w, err, "Delete rule")
+	}
+}
+
+// Re-runs categorization rules over existing transactions. Optional 'transaction_ids'
+// (comma-separated) limits the run to those transactions; otherwise every transaction in
+// an "Uncategorized" category is considered. 'dry_run=true' returns the changes without saving.
+func applyRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	ledgerID, ok := middleware.GetLedgerID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	var ids []int
+	if v := strings.TrimSpace(r.FormValue("transaction_ids")); v != "" {
+		for _, part := range strings.Split(v, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id <= 0 {
+				utils.RespondWithValidationError(w, "transaction_ids must be a comma-separated list of positive numbers")
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) > constants.MaxRuleApplyTransactions {
+			utils.RespondWithValidationError(w, fmt.Sprintf("At most %d transaction_ids per request", constants.MaxRuleApplyTransactions))
+			return
+		}
+	}
+
+	dryRun := false
+	if v := r.FormValue("dry_run"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			utils.RespondWithValidationError(w, "dry_run must be true or false")
+			return
+		}
+		dryRun = parsed
+	}
+
+	changes, err := handlers.ApplyRules(r.Context(), db, ledgerID, ids, dryRun)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Apply rules")
+		return
+	}
+	if !dryRun && len(changes) > 0 {
+		budgetAlerts.Trigger(ledgerID)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"dry_run": dryRun,
+		"changed": len(changes),
+		"changes": changes,
+	})
+}
+
+// Lists the user's notifications, newest first; ?unread=true for unread only, with limit/offset paging
+func listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	limit := 20 // default
+	if l := r.URL.Query().Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Invalid limit parameter: must be a number")
+			return
+		}
+		limit = v
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		v, err := strconv.Atoi(o)
+		if err != nil {
+			utils.RespondWithValidationError(w, "Invalid offset parameter: must be a number")
+			return
+		}
+		offset = v
+	}
+	if err := utils.ValidatePaginationParams(limit, offset); err != nil {
+		utils.RespondWithValidationError(w, err.Error())
+		return
+	}
+
+	unreadOnly := false
+	if v := r.URL.Query().Get("unread"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			utils.RespondWithValidationError(w, "unread must be true or false")
+			return
+		}
+		unreadOnly = parsed
+	}
+
+	notifications, err := handlers.ListNotifications(r.Context(), db, userID, unreadOnly, limit, offset)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "List notifications")
+		return
+	}
+	unread, err := handlers.UnreadNotificationCount(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "List notifications")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"notifications": notifications,
+		"unread_count":  unread,
+		"limit":         limit,
+		"offset":        offset,
+	})
+}
+
+// Returns just the number of unread notifications, for the header badge
+func unreadNotificationCountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondWithMethodNotAllowed(w, "GET")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	unread, err := handlers.UnreadNotificationCount(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Unread notification count")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"unread_count": unread,
+	})
+}
+
+func markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		utils.RespondWithValidationError(w, "Valid notification ID is required (must be a positive number)")
+		return
+	}
+
+	switch err := handlers.MarkNotificationRead(r.Context(), db, userID, id); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Notification marked as read", nil)
+	case handlers.ErrNotificationNotFound:
+		utils.RespondWithNotFound(w, "Notification")
+	default:
+		utils.RespondWithInternalError(w, err, "Mark notification read")
+	}
+}
+
+func markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	updated, err := handlers.MarkAllNotificationsRead(r.Context(), db, userID)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Mark all notifications read")
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "All notifications marked as read", map[string]int64{"updated": updated})
+}
+
+func deleteNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithMethodNotAllowed(w, "POST")
+		return
+	}
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "")
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		utils.RespondWithValidationError(w, "Valid notification ID is required (must be a positive number)")
+		return
+	}
+
+	switch err := handlers.DeleteNotification(r.Context(), db, userID, id); err {
+	case nil:
+		utils.RespondWithSuccess(w, http.StatusOK, "Notification deleted successfully", nil)
+	case handlers.ErrNotificationNotFound:
+		utils.RespondWithNotFound(w, "Notification")
+	default:
+		utils.RespondWithInternalError(w, err, "Delete notification")
+	}
 }
 
 func jsonError(w http.ResponseWriter, msg string, code int) {
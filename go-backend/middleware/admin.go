@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// AdminKeyHeader is the request header carrying the operator API key
+const AdminKeyHeader = "X-Admin-Key"
+
+// RequireAdminKey protects operator-only endpoints (e.g. loading exchange rates) with a shared
+// secret sent in the X-Admin-Key header. When adminKey is empty the endpoints are disabled.
+func RequireAdminKey(adminKey string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminKey == "" {
+			utils.RespondWithForbidden(w, "Admin endpoints are disabled. Set ADMIN_API_KEY to enable them.")
+			return
+		}
+
+		provided := r.Header.Get(AdminKeyHeader)
+		if provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) != 1 {
+			utils.RespondWithUnauthorized(w, "Invalid or missing admin key")
+			return
+		}
+
+		next(w, r)
+	}
+}
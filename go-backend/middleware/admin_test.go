@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdminKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminKey   string
+		header     string
+		wantStatus int
+	}{
+		{name: "valid key", adminKey: "secret", header: "secret", wantStatus: http.StatusOK},
+		{name: "wrong key", adminKey: "secret", header: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "missing key", adminKey: "secret", header: "", wantStatus: http.StatusUnauthorized},
+		{name: "admin disabled", adminKey: "", header: "", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireAdminKey(tt.adminKey, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/exchange-rates", nil)
+			if tt.header != "" {
+				req.Header.Set(AdminKeyHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
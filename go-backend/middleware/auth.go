@@ -7,61 +7,172 @@ import (
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/vidya381/myspendo-backend/constants"
 	"github.com/vidya381/myspendo-backend/utils"
 )
 
 // Key type for setting/retrieving user ID in context
 type contextKey string
 
-const userIDKey contextKey = "user_id"
+const (
+	userIDKey        contextKey = "user_id"
+	tokenIDKey       contextKey = "token_id"
+	personalTokenKey contextKey = "personal_token"
+)
 
-// RequireAuth is a middleware that validates JWT tokens and extracts user ID.
-// Protects routes by requiring a valid Bearer token in the Authorization header.
-// The user ID from the token is stored in the request context for use by handlers.
-func RequireAuth(jwtSecret string, next http.HandlerFunc) http.HandlerFunc {
+// RevocationCheck reports whether the access token with the given jti has been revoked.
+type RevocationCheck func(ctx context.Context, jti string) (bool, error)
+
+// PersonalTokenLookup returns the user and scopes of a personal access token; ok is false for
+// unknown, revoked or expired tokens.
+type PersonalTokenLookup func(ctx context.Context, token string) (userID int, scopes []string, ok bool, err error)
+
+// AcceptPersonalToken lets a route wrapped in RequireAuth also be called with a personal access
+// token that carries scope. Requests with any other kind of token are passed on to RequireAuth.
+// Routes without it only accept session tokens.
+func AcceptPersonalToken(lookup PersonalTokenLookup, scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Extract token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			utils.RespondWithUnauthorized(w, "Missing or invalid Authorization header")
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !strings.HasPrefix(token, constants.PersonalTokenPrefix) {
+			next(w, r)
 			return
 		}
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-		// Parse and verify JWT
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Ensure token signing method is HMAC
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			utils.RespondWithUnauthorized(w, "Invalid token")
+
+		userID, scopes, ok, err := lookup(r.Context(), token)
+		if err != nil {
+			utils.RespondWithInternalError(w, err, "Personal token lookup")
 			return
 		}
-
-		// Extract user ID from claims
-		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			utils.RespondWithUnauthorized(w, "Invalid token claims")
+			utils.RespondWithUnauthorized(w, "Invalid or expired token")
 			return
 		}
+		if !hasScope(scopes, scope) {
+			utils.RespondWithForbidden(w, fmt.Sprintf("This token does not have the %s scope", scope))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDKey, userID)
+		ctx = context.WithValue(ctx, personalTokenKey, true)
+		next(w, r.WithContext(ctx))
+	}
+}
 
-		userIDFloat, ok := claims["user_id"].(float64)
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireAuth is a middleware that validates JWT tokens and extracts user ID.
+// Protects routes by requiring a valid Bearer token in the Authorization header.
+// Tokens must carry a jti claim, which is checked against the revocation list via isRevoked.
+// Tokens from a password login that still await the second factor are rejected.
+// The user ID and jti from the token are stored in the request context for use by handlers.
+// Requests already authenticated by AcceptPersonalToken are passed through; they have no jti.
+func RequireAuth(jwtSecret string, isRevoked RevocationCheck, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isPersonalToken(r) {
+			next(w, r)
+			return
+		}
+		ctx, pending, ok := authenticate(w, r, jwtSecret, isRevoked)
 		if !ok {
-			utils.RespondWithUnauthorized(w, "Invalid user_id in token")
 			return
 		}
-		userID := int(userIDFloat)
+		if pending {
+			utils.RespondWithUnauthorized(w, "Two-factor authentication required")
+			return
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
 
-		// Pass user ID in context to the next handler
-		ctx := context.WithValue(r.Context(), userIDKey, userID)
+// RequireTwoFactorChallenge is like RequireAuth, but only accepts the partially-authenticated
+// token a password login returns to accounts with two-factor authentication enabled.
+func RequireTwoFactorChallenge(jwtSecret string, isRevoked RevocationCheck, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, pending, ok := authenticate(w, r, jwtSecret, isRevoked)
+		if !ok {
+			return
+		}
+		if !pending {
+			utils.RespondWithUnauthorized(w, "Invalid token")
+			return
+		}
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// authenticate verifies the request's Bearer token and returns a context carrying its user ID
+// and jti, and whether the token still awaits a second factor. On failure it writes the error
+// response and returns ok=false.
+func authenticate(w http.ResponseWriter, r *http.Request, jwtSecret string, isRevoked RevocationCheck) (ctx context.Context, pending, ok bool) {
+	// Extract token from Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		utils.RespondWithUnauthorized(w, "Missing or invalid Authorization header")
+		return nil, false, false
+	}
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if strings.HasPrefix(tokenString, constants.PersonalTokenPrefix) {
+		utils.RespondWithForbidden(w, "Personal access tokens can't be used for this endpoint")
+		return nil, false, false
+	}
+
+	// Parse and verify JWT
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Ensure token signing method is HMAC
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return []byte(jwtSecret), nil
+	})
+
+	if err != nil || !token.Valid {
+		utils.RespondWithUnauthorized(w, "Invalid token")
+		return nil, false, false
+	}
+
+	// Extract user ID from claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "Invalid token claims")
+		return nil, false, false
+	}
+
+	userIDFloat, ok := claims["user_id"].(float64)
+	if !ok {
+		utils.RespondWithUnauthorized(w, "Invalid user_id in token")
+		return nil, false, false
+	}
+	userID := int(userIDFloat)
+
+	// Tokens without a jti cannot be revoked, so they are not accepted
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		utils.RespondWithUnauthorized(w, "Invalid token")
+		return nil, false, false
+	}
+	revoked, err := isRevoked(r.Context(), jti)
+	if err != nil {
+		utils.RespondWithInternalError(w, err, "Token revocation check")
+		return nil, false, false
+	}
+	if revoked {
+		utils.RespondWithUnauthorized(w, "Token has been revoked")
+		return nil, false, false
+	}
+
+	// Pass user ID and token ID in context to the next handler
+	ctx = context.WithValue(r.Context(), userIDKey, userID)
+	ctx = context.WithValue(ctx, tokenIDKey, jti)
+	return ctx, claims[constants.TwoFactorClaim] == constants.TwoFactorPending, true
+}
+
 // GetUserID retrieves the authenticated user's ID from the request context.
 // Returns the user ID and true if found, or 0 and false if not authenticated.
 // Should be called from handlers that are protected by RequireAuth middleware.
@@ -69,3 +180,17 @@ func GetUserID(r *http.Request) (int, bool) {
 	userID, ok := r.Context().Value(userIDKey).(int)
 	return userID, ok
 }
+
+// GetTokenID retrieves the jti of the access token used to authenticate the request.
+// Returns the token ID and true if found, or "" and false if not authenticated.
+func GetTokenID(r *http.Request) (string, bool) {
+	jti, ok := r.Context().Value(tokenIDKey).(string)
+	return jti, ok
+}
+
+// isPersonalToken reports whether the request was authenticated with a personal access token
+// rather than a session.
+func isPersonalToken(r *http.Request) bool {
+	personal, _ := r.Context().Value(personalTokenKey).(bool)
+	return personal
+}
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vidya381/myspendo-backend/constants"
+)
+
+const testSecret = "test-secret"
+
+func signTestToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestRequireAuth(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	notRevoked := func(ctx context.Context, jti string) (bool, error) { return false, nil }
+	revoked := func(ctx context.Context, jti string) (bool, error) { return jti == "revoked-jti", nil }
+	failing := func(ctx context.Context, jti string) (bool, error) { return false, errors.New("db down") }
+
+	tests := []struct {
+		name       string
+		header     string
+		check      RevocationCheck
+		wantStatus int
+	}{
+		{
+			name:       "valid token",
+			header:     "Bearer " + signTestToken(t, jwt.MapClaims{"user_id": 7, "jti": "abc", "exp": exp}),
+			check:      notRevoked,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing header",
+			header:     "",
+			check:      notRevoked,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token without jti",
+			header:     "Bearer " + signTestToken(t, jwt.MapClaims{"user_id": 7, "exp": exp}),
+			check:      notRevoked,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "revoked token",
+			header:     "Bearer " + signTestToken(t, jwt.MapClaims{"user_id": 7, "jti": "revoked-jti", "exp": exp}),
+			check:      revoked,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "expired token",
+			header:     "Bearer " + signTestToken(t, jwt.MapClaims{"user_id": 7, "jti": "abc", "exp": time.Now().Add(-time.Minute).Unix()}),
+			check:      notRevoked,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "revocation check failure",
+			header:     "Bearer " + signTestToken(t, jwt.MapClaims{"user_id": 7, "jti": "abc", "exp": exp}),
+			check:      failing,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID int
+			var gotJTI string
+			handler := RequireAuth(testSecret, tt.check, func(w http.ResponseWriter, r *http.Request) {
+				gotUserID, _ = GetUserID(r)
+				gotJTI, _ = GetTokenID(r)
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && (gotUserID != 7 || gotJTI != "abc") {
+				t.Errorf("context = (%d, %q), want (7, \"abc\")", gotUserID, gotJTI)
+			}
+		})
+	}
+}
+
+func TestTwoFactorPendingTokens(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	notRevoked := func(ctx context.Context, jti string) (bool, error) { return false, nil }
+	full := "Bearer " + signTestToken(t, jwt.MapClaims{"user_id": 7, "jti": "abc", "exp": exp})
+	pending := "Bearer " + signTestToken(t, jwt.MapClaims{"user_id": 7, "jti": "abc", "exp": exp, constants.TwoFactorClaim: constants.TwoFactorPending})
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		header     string
+		wantStatus int
+	}{
+		{name: "full token on a protected route", handler: RequireAuth(testSecret, notRevoked, ok), header: full, wantStatus: http.StatusOK},
+		{name: "pending token on a protected route", handler: RequireAuth(testSecret, notRevoked, ok), header: pending, wantStatus: http.StatusUnauthorized},
+		{name: "pending token on the challenge route", handler: RequireTwoFactorChallenge(testSecret, notRevoked, ok), header: pending, wantStatus: http.StatusOK},
+		{name: "full token on the challenge route", handler: RequireTwoFactorChallenge(testSecret, notRevoked, ok), header: full, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAcceptPersonalToken(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	notRevoked := func(ctx context.Context, jti string) (bool, error) { return false, nil }
+	lookup := func(ctx context.Context, token string) (int, []string, bool, error) {
+		switch token {
+		case constants.PersonalTokenPrefix + "good":
+			return 9, []string{constants.ScopeTransactionsRead}, true, nil
+		case constants.PersonalTokenPrefix + "broken":
+			return 0, nil, false, errors.New("db down")
+		}
+		return 0, nil, false, nil
+	}
+	session := "Bearer " + signTestToken(t, jwt.MapClaims{"user_id": 7, "jti": "abc", "exp": exp})
+
+	tests := []struct {
+		name       string
+		scoped     bool // route accepts personal tokens with the transactions:read scope
+		header     string
+		wantStatus int
+		wantUserID int
+	}{
+		{name: "session on a scoped route", scoped: true, header: session, wantStatus: http.StatusOK, wantUserID: 7},
+		{name: "token with the scope", scoped: true, header: "Bearer " + constants.PersonalTokenPrefix + "good", wantStatus: http.StatusOK, wantUserID: 9},
+		{name: "unknown token", scoped: true, header: "Bearer " + constants.PersonalTokenPrefix + "nope", wantStatus: http.StatusUnauthorized},
+		{name: "lookup failure", scoped: true, header: "Bearer " + constants.PersonalTokenPrefix + "broken", wantStatus: http.StatusInternalServerError},
+		{name: "token on a session-only route", header: "Bearer " + constants.PersonalTokenPrefix + "good", wantStatus: http.StatusForbidden},
+		{name: "session on a session-only route", header: session, wantStatus: http.StatusOK, wantUserID: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID int
+			handler := RequireAuth(testSecret, notRevoked, func(w http.ResponseWriter, r *http.Request) {
+				gotUserID, _ = GetUserID(r)
+				w.WriteHeader(http.StatusOK)
+			})
+			if tt.scoped {
+				handler = AcceptPersonalToken(lookup, constants.ScopeTransactionsRead, handler)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if gotUserID != tt.wantUserID {
+				t.Errorf("user ID = %d, want %d", gotUserID, tt.wantUserID)
+			}
+		})
+	}
+
+	t.Run("token without the scope", func(t *testing.T) {
+		handler := AcceptPersonalToken(lookup, constants.ScopeBudgetsWrite, RequireAuth(testSecret, notRevoked, func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler called without the required scope")
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+constants.PersonalTokenPrefix+"good")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vidya381/myspendo-backend/models"
+	"github.com/vidya381/myspendo-backend/utils"
+)
+
+// LedgerHeader is the request header selecting the ledger a request works on
+const LedgerHeader = "X-Ledger-ID"
+
+const (
+	ledgerIDKey   contextKey = "ledger_id"
+	ledgerRoleKey contextKey = "ledger_role"
+)
+
+// LedgerLookup returns the ID of a ledger the user is a member of and their role in it.
+// A ledgerID of 0 asks for the user's default ledger. ok is false if the user isn't a member.
+type LedgerLookup func(ctx context.Context, userID, ledgerID int) (id int, role string, ok bool, err error)
+
+// RequireLedger resolves the ledger selected by the X-Ledger-ID header, or the user's default
+// ledger without it, and requires the user to have at least the given role in it. The ledger ID
+// and role are stored in the request context. It must run after RequireAuth.
+func RequireLedger(lookup LedgerLookup, role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := GetUserID(r)
+		if !ok {
+			utils.RespondWithUnauthorized(w, "Unauthorized")
+			return
+		}
+
+		requested := 0
+		if header := strings.TrimSpace(r.Header.Get(LedgerHeader)); header != "" {
+			id, err := strconv.Atoi(header)
+			if err != nil || id <= 0 {
+				utils.RespondWithValidationError(w, LedgerHeader+" must be a positive ledger ID")
+				return
+			}
+			requested = id
+		}
+
+		ledgerID, memberRole, ok, err := lookup(r.Context(), userID, requested)
+		if err != nil {
+			utils.RespondWithInternalError(w, err, "Ledger lookup")
+			return
+		}
+		if !ok {
+			utils.RespondWithNotFound(w, "Ledger")
+			return
+		}
+		if !models.LedgerRoleAllows(memberRole, role) {
+			utils.RespondWithForbidden(w, "Your role in this ledger doesn't allow this")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ledgerIDKey, ledgerID)
+		ctx = context.WithValue(ctx, ledgerRoleKey, memberRole)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// GetLedgerID retrieves the ID of the ledger the request works on.
+// Should be called from handlers that are protected by RequireLedger middleware.
+func GetLedgerID(r *http.Request) (int, bool) {
+	ledgerID, ok := r.Context().Value(ledgerIDKey).(int)
+	return ledgerID, ok
+}
+
+// GetLedgerRole retrieves the user's role in the ledger the request works on.
+func GetLedgerRole(r *http.Request) (string, bool) {
+	role, ok := r.Context().Value(ledgerRoleKey).(string)
+	return role, ok
+}
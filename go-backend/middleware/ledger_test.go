@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+func TestRequireLedger(t *testing.T) {
+	notRevoked := func(ctx context.Context, jti string) (bool, error) { return false, nil }
+	// User 7 owns ledger 1 (their default) and views ledger 2; ledger 3 fails to load
+	lookup := func(ctx context.Context, userID, ledgerID int) (int, string, bool, error) {
+		switch {
+		case userID != 7:
+			return 0, "", false, nil
+		case ledgerID == 0 || ledgerID == 1:
+			return 1, models.LedgerRoleOwner, true, nil
+		case ledgerID == 2:
+			return 2, models.LedgerRoleViewer, true, nil
+		case ledgerID == 3:
+			return 0, "", false, errors.New("db down")
+		}
+		return 0, "", false, nil
+	}
+	session := "Bearer " + signTestToken(t, jwt.MapClaims{"user_id": 7, "jti": "abc", "exp": time.Now().Add(time.Hour).Unix()})
+
+	tests := []struct {
+		name       string
+		header     string
+		role       string
+		wantStatus int
+		wantLedger int
+	}{
+		{name: "default ledger", role: models.LedgerRoleEditor, wantStatus: http.StatusOK, wantLedger: 1},
+		{name: "selected ledger", header: "2", role: models.LedgerRoleViewer, wantStatus: http.StatusOK, wantLedger: 2},
+		{name: "role too low", header: "2", role: models.LedgerRoleEditor, wantStatus: http.StatusForbidden},
+		{name: "not a member", header: "4", role: models.LedgerRoleViewer, wantStatus: http.StatusNotFound},
+		{name: "invalid header", header: "abc", role: models.LedgerRoleViewer, wantStatus: http.StatusBadRequest},
+		{name: "lookup failure", header: "3", role: models.LedgerRoleViewer, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotLedger int
+			handler := RequireAuth(testSecret, notRevoked, RequireLedger(lookup, tt.role, func(w http.ResponseWriter, r *http.Request) {
+				gotLedger, _ = GetLedgerID(r)
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", session)
+			if tt.header != "" {
+				req.Header.Set(LedgerHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if gotLedger != tt.wantLedger {
+				t.Errorf("ledger ID = %d, want %d", gotLedger, tt.wantLedger)
+			}
+		})
+	}
+}
+
+func TestLedgerRoleAllows(t *testing.T) {
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{models.LedgerRoleOwner, models.LedgerRoleEditor, true},
+		{models.LedgerRoleEditor, models.LedgerRoleEditor, true},
+		{models.LedgerRoleViewer, models.LedgerRoleEditor, false},
+		{models.LedgerRoleEditor, models.LedgerRoleOwner, false},
+		{"admin", models.LedgerRoleViewer, false},
+		{"", models.LedgerRoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := models.LedgerRoleAllows(tt.role, tt.required); got != tt.want {
+			t.Errorf("LedgerRoleAllows(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
@@ -1,14 +1,24 @@
+//go:build ignore
+
+// Database migration tool. Run from the go-backend directory:
+//
+//	go run migrate.go [status|up|down N|redo]
+//
+// With no subcommand, pending migrations are applied (same as "up").
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
 	"os"
-	"strings"
+	"strconv"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/joho/godotenv"
+	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/migrator"
 	"github.com/vidya381/myspendo-backend/utils"
 )
 
@@ -19,6 +29,24 @@ func main() {
 	// Load .env file (silently ignore if not found - normal in production)
 	_ = godotenv.Load()
 
+	command := "up"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	steps := 1
+	if command == "down" && len(os.Args) > 2 {
+		n, err := strconv.Atoi(os.Args[2])
+		if err != nil || n <= 0 {
+			slog.Error("down requires a positive number of migrations", "value", os.Args[2])
+			os.Exit(1)
+		}
+		steps = n
+	}
+	if command != "status" && command != "up" && command != "down" && command != "redo" {
+		fmt.Fprintln(os.Stderr, "usage: go run migrate.go [status|up|down N|redo]")
+		os.Exit(2)
+	}
+
 	// Validate required database environment variables
 	if err := utils.ValidateDBConfig(); err != nil {
 		slog.Error("Configuration validation failed", "error", err)
@@ -42,41 +70,74 @@ func main() {
 	slog.Info("Connected to PostgreSQL successfully")
 
 	// Read all migration files from the migrations directory
-	migrationDir := "migrations"
-	entries, err := os.ReadDir(migrationDir)
+	migrations, err := migrator.Load(os.DirFS("migrations"))
 	if err != nil {
-		slog.Error("Failed to read migrations directory", "error", err)
+		slog.Error("Failed to load migrations", "error", err)
 		os.Exit(1)
 	}
 
-	// Execute each migration file in order (sorted by filename)
-	migrationCount := 0
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
-			continue
+	if err := run(context.Background(), db, command, steps, migrations); err != nil {
+		slog.Error("Migration command failed", "command", command, "error", err)
+		os.Exit(1)
+	}
+}
+
+// run executes a migration command on a dedicated connection holding the advisory lock,
+// so concurrent deploys wait for each other instead of racing.
+func run(ctx context.Context, db *sql.DB, command string, steps int, migrations []migrator.Migration) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	slog.Info("Waiting for migration lock")
+	if err := migrator.Lock(ctx, conn, constants.MigrationLockID); err != nil {
+		return err
+	}
+	defer func() {
+		if err := migrator.Unlock(ctx, conn, constants.MigrationLockID); err != nil {
+			slog.Error("Failed to release migration lock", "error", err)
 		}
+	}()
 
-		migrationFile := fmt.Sprintf("%s/%s", migrationDir, entry.Name())
-		slog.Info("Applying migration", "file", entry.Name())
+	if err := migrator.EnsureTable(ctx, conn); err != nil {
+		return err
+	}
 
-		sqlBytes, err := os.ReadFile(migrationFile)
+	switch command {
+	case "status":
+		entries, err := migrator.Status(ctx, conn, migrations)
 		if err != nil {
-			slog.Error("Failed to read migration file", "file", migrationFile, "error", err)
-			os.Exit(1)
+			return err
 		}
-
-		sqlStatement := string(sqlBytes)
-		_, err = db.Exec(sqlStatement)
+		for _, e := range entries {
+			appliedAt := "-"
+			if e.AppliedAt != nil {
+				appliedAt = e.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%03d  %-9s  %-19s  %s\n", e.Version, e.State, appliedAt, e.Name)
+		}
+	case "up":
+		count, err := migrator.Up(ctx, conn, migrations)
 		if err != nil {
-			slog.Error("Failed to execute migration", "file", entry.Name(), "error", err)
-			os.Exit(1)
+			return err
 		}
-
-		slog.Info("Migration applied successfully", "file", entry.Name())
-		migrationCount++
+		slog.Info("All migrations completed", "count", count)
+	case "down":
+		count, err := migrator.Down(ctx, conn, migrations, steps)
+		if err != nil {
+			return err
+		}
+		slog.Info("Rolled back migrations", "count", count)
+	case "redo":
+		m, err := migrator.Redo(ctx, conn, migrations)
+		if err != nil {
+			return err
+		}
+		slog.Info("Migration redone", "version", m.Version, "name", m.Name)
 	}
-
-	slog.Info("All migrations completed", "count", migrationCount)
+	return nil
 }
 
 func getDBConnURL() string {
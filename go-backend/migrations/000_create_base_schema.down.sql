@@ -0,0 +1,5 @@
+-- Drop base schema (destroys all user data)
+DROP TABLE IF EXISTS recurring_transactions;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,2 @@
+-- Drop budgets table
+DROP TABLE IF EXISTS budgets;
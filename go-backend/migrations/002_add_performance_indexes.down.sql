@@ -0,0 +1,8 @@
+-- Drop indexes introduced by this migration
+-- Single-column indexes are also created by 000/001 and are left in place
+DROP INDEX IF EXISTS idx_transactions_user_date;
+DROP INDEX IF EXISTS idx_transactions_user_category;
+DROP INDEX IF EXISTS idx_categories_user_type;
+DROP INDEX IF EXISTS idx_budgets_user_category;
+DROP INDEX IF EXISTS idx_recurring_start_date;
+DROP INDEX IF EXISTS idx_recurring_last_occurrence;
@@ -0,0 +1,9 @@
+ALTER TABLE recurring_transactions DROP CONSTRAINT IF EXISTS recurring_transactions_category_id_fkey;
+ALTER TABLE recurring_transactions
+    ADD CONSTRAINT recurring_transactions_category_id_fkey
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE;
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_category_id_fkey;
+ALTER TABLE transactions
+    ADD CONSTRAINT transactions_category_id_fkey
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE;
@@ -0,0 +1,12 @@
+-- Stop category deletes from cascading into transaction history.
+-- NO ACTION (checked at end of statement) still lets ON DELETE CASCADE from users
+-- remove a user's categories and transactions together.
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_category_id_fkey;
+ALTER TABLE transactions
+    ADD CONSTRAINT transactions_category_id_fkey
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE NO ACTION;
+
+ALTER TABLE recurring_transactions DROP CONSTRAINT IF EXISTS recurring_transactions_category_id_fkey;
+ALTER TABLE recurring_transactions
+    ADD CONSTRAINT recurring_transactions_category_id_fkey
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE NO ACTION;
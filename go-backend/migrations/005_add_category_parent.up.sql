@@ -0,0 +1,6 @@
+-- Optional parent category for hierarchies like "Transport > Fuel".
+-- Same-type and no-cycle rules are enforced in handlers/category.go.
+ALTER TABLE categories
+    ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES categories(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories(parent_id);
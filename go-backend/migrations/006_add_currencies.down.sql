@@ -0,0 +1,5 @@
+DROP FUNCTION IF EXISTS convert_currency(NUMERIC, CHAR(3), CHAR(3), DATE);
+DROP TABLE IF EXISTS exchange_rates;
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS currency;
+ALTER TABLE transactions DROP COLUMN IF EXISTS currency;
+ALTER TABLE users DROP COLUMN IF EXISTS base_currency;
@@ -0,0 +1,58 @@
+-- Multi-currency support: every user has a base currency that summaries and budgets
+-- are reported in, and each transaction / recurring rule records the currency it was
+-- entered in. Existing rows keep the previous implicit currency (USD).
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS base_currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+ALTER TABLE recurring_transactions
+    ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+-- Locally maintained exchange rates: 1 unit of from_currency = rate units of to_currency,
+-- effective from effective_date until a newer rate for the same pair is loaded.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    from_currency CHAR(3) NOT NULL,
+    to_currency CHAR(3) NOT NULL,
+    effective_date DATE NOT NULL,
+    rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (from_currency, to_currency, effective_date),
+    CHECK (from_currency <> to_currency)
+);
+
+-- convert_currency converts an amount using the rate effective on on_date: the most recent
+-- rate dated on or before it, or the earliest known rate when on_date precedes all loaded
+-- rates. The inverse of the opposite pair is used when no direct rate exists. The result is
+-- rounded to cents per row so aggregates stay exact. Raises no_data_found (P0002) when the
+-- pair has no rates at all.
+CREATE OR REPLACE FUNCTION convert_currency(amount NUMERIC, from_ccy CHAR(3), to_ccy CHAR(3), on_date DATE)
+RETURNS NUMERIC
+LANGUAGE plpgsql STABLE
+AS $$
+DECLARE
+    r NUMERIC;
+BEGIN
+    IF from_ccy = to_ccy THEN
+        RETURN amount;
+    END IF;
+
+    SELECT CASE WHEN er.from_currency = from_ccy THEN er.rate ELSE 1 / er.rate END
+    INTO r
+    FROM exchange_rates er
+    WHERE (er.from_currency = from_ccy AND er.to_currency = to_ccy)
+       OR (er.from_currency = to_ccy AND er.to_currency = from_ccy)
+    ORDER BY er.effective_date > on_date,
+             ABS(er.effective_date - on_date),
+             er.from_currency = from_ccy DESC
+    LIMIT 1;
+
+    IF r IS NULL THEN
+        RAISE EXCEPTION 'no exchange rate between % and %', from_ccy, to_ccy
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN ROUND(amount * r, 2);
+END;
+$$;
@@ -0,0 +1,19 @@
+-- User-defined rules that pick a category from a transaction's description, amount and
+-- weekday. Rules are evaluated by priority (highest first, then oldest first); the first
+-- match wins. Rules are configuration, not history, so they go with their category.
+CREATE TABLE IF NOT EXISTS categorization_rules (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    match_type VARCHAR(10) NOT NULL CHECK (match_type IN ('contains', 'regex')),
+    pattern TEXT NOT NULL,
+    min_amount DECIMAL(12, 2) CHECK (min_amount >= 0),
+    max_amount DECIMAL(12, 2) CHECK (max_amount >= 0),
+    weekday SMALLINT CHECK (weekday BETWEEN 0 AND 6), -- 0 = Sunday
+    priority INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (min_amount IS NULL OR max_amount IS NULL OR min_amount <= max_amount)
+);
+
+CREATE INDEX IF NOT EXISTS idx_categorization_rules_user_priority
+    ON categorization_rules(user_id, priority DESC, id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS budget_periods;
+ALTER TABLE budgets DROP COLUMN IF EXISTS rollover;
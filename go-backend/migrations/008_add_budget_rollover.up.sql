@@ -0,0 +1,22 @@
+-- Rollover (envelope) budgets carry the unused or overspent amount of each period into the next.
+ALTER TABLE budgets
+    ADD COLUMN IF NOT EXISTS rollover BOOLEAN NOT NULL DEFAULT false;
+
+-- One row per completed budget period: what was planned, what was carried in from the
+-- previous period (0 unless the budget rolls over) and what was actually spent, all in the
+-- user's base currency. Rows are written once the period has ended (see handlers/budget_period.go).
+CREATE TABLE IF NOT EXISTS budget_periods (
+    id SERIAL PRIMARY KEY,
+    budget_id INTEGER NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    planned DECIMAL(12, 2) NOT NULL,
+    carried_in DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    actual DECIMAL(12, 2) NOT NULL,
+    closed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (budget_id, period_start),
+    CHECK (period_end >= period_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_budget_periods_user_id ON budget_periods(user_id);
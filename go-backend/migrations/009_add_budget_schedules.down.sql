@@ -0,0 +1,18 @@
+-- Budgets using the new periods cannot be represented by the old schema
+DELETE FROM budgets WHERE period NOT IN ('monthly', 'yearly');
+
+DROP INDEX IF EXISTS idx_budgets_user_category_range;
+DROP INDEX IF EXISTS idx_budgets_user_category_period;
+ALTER TABLE budgets
+    ADD CONSTRAINT budgets_user_id_category_id_period_key UNIQUE (user_id, category_id, period);
+
+ALTER TABLE budgets DROP CONSTRAINT IF EXISTS budgets_period_dates_check;
+ALTER TABLE budgets DROP CONSTRAINT IF EXISTS budgets_period_check;
+ALTER TABLE budgets
+    ADD CONSTRAINT budgets_period_check CHECK (period IN ('monthly', 'yearly'));
+
+ALTER TABLE budgets
+    DROP COLUMN IF EXISTS end_date,
+    DROP COLUMN IF EXISTS start_date;
+
+ALTER TABLE users DROP COLUMN IF EXISTS month_start_day;
@@ -0,0 +1,33 @@
+-- Budgets can repeat weekly, biweekly, monthly, quarterly or yearly, or cover a single custom
+-- date range. Weekly and biweekly periods are laid out every 7 / 14 days from start_date;
+-- a custom budget covers start_date..end_date once. Monthly, quarterly and yearly periods
+-- begin on the user's month_start_day (e.g. 25 for a budget that follows payday).
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS month_start_day SMALLINT NOT NULL DEFAULT 1
+    CHECK (month_start_day BETWEEN 1 AND 28);
+
+ALTER TABLE budgets
+    ADD COLUMN IF NOT EXISTS start_date DATE,
+    ADD COLUMN IF NOT EXISTS end_date DATE;
+
+ALTER TABLE budgets DROP CONSTRAINT IF EXISTS budgets_period_check;
+ALTER TABLE budgets
+    ADD CONSTRAINT budgets_period_check
+    CHECK (period IN ('weekly', 'biweekly', 'monthly', 'quarterly', 'yearly', 'custom'));
+
+ALTER TABLE budgets DROP CONSTRAINT IF EXISTS budgets_period_dates_check;
+ALTER TABLE budgets
+    ADD CONSTRAINT budgets_period_dates_check
+    CHECK (CASE period
+        WHEN 'custom' THEN start_date IS NOT NULL AND end_date IS NOT NULL AND end_date >= start_date
+        WHEN 'weekly' THEN start_date IS NOT NULL AND end_date IS NULL
+        WHEN 'biweekly' THEN start_date IS NOT NULL AND end_date IS NULL
+        ELSE start_date IS NULL AND end_date IS NULL
+    END);
+
+-- Recurring budgets stay unique per (user, category, period); custom ones per date range
+ALTER TABLE budgets DROP CONSTRAINT IF EXISTS budgets_user_id_category_id_period_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_user_category_period
+    ON budgets(user_id, category_id, period) WHERE period <> 'custom';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_user_category_range
+    ON budgets(user_id, category_id, start_date, end_date) WHERE period = 'custom';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS budget_alerts_fired;
+DROP TABLE IF EXISTS notifications;
@@ -0,0 +1,2 @@
+-- The header badge polls the unread count, so keep unread notifications cheap to count.
+CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON notifications(user_id) WHERE read_at IS NULL;
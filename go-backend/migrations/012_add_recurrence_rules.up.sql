@@ -0,0 +1,9 @@
+-- Recurring transactions follow an RFC 5545 recurrence rule (e.g. FREQ=WEEKLY;INTERVAL=2 or
+-- FREQ=MONTHLY;BYMONTHDAY=1,15;COUNT=12). recurrence keeps the rule's frequency for display.
+ALTER TABLE recurring_transactions
+    ADD COLUMN IF NOT EXISTS rrule VARCHAR(500);
+
+UPDATE recurring_transactions SET rrule = 'FREQ=' || UPPER(recurrence) WHERE rrule IS NULL;
+
+ALTER TABLE recurring_transactions
+    ALTER COLUMN rrule SET NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS recurring_exceptions;
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS status;
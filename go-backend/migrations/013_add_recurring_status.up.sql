@@ -0,0 +1,14 @@
+-- Recurring transactions can be paused; the processor skips paused rules, and occurrences that
+-- fall while a rule is paused are not created after it resumes.
+ALTER TABLE recurring_transactions
+    ADD COLUMN IF NOT EXISTS status VARCHAR(10) NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'paused'));
+
+-- Occurrence dates of a recurring transaction that should not create a transaction
+-- (the "skip next" action adds the next due date here).
+CREATE TABLE IF NOT EXISTS recurring_exceptions (
+    recurring_id INTEGER NOT NULL REFERENCES recurring_transactions(id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (recurring_id, date)
+);
@@ -0,0 +1,3 @@
+-- The /forecast endpoint warns when the projected balance drops below this amount
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS balance_floor DECIMAL(12, 2) NOT NULL DEFAULT 0;
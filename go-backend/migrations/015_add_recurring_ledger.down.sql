@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS recurring_job_runs;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_recurring_occurrence_key;
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS occurrence_date,
+    DROP COLUMN IF EXISTS recurring_id;
@@ -0,0 +1,22 @@
+-- Transactions created by the recurring processor point at their rule and occurrence date, so an
+-- occurrence can only ever be created once, even if a run is retried after a crash.
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS recurring_id INTEGER REFERENCES recurring_transactions(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS occurrence_date DATE;
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_recurring_occurrence_key;
+ALTER TABLE transactions
+    ADD CONSTRAINT transactions_recurring_occurrence_key UNIQUE (recurring_id, occurrence_date);
+
+-- One row per run of the recurring processor that acquired the lock
+CREATE TABLE IF NOT EXISTS recurring_job_runs (
+    id SERIAL PRIMARY KEY,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP,
+    rules_processed INTEGER NOT NULL DEFAULT 0,
+    transactions_created INTEGER NOT NULL DEFAULT 0,
+    failed_rules INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_recurring_job_runs_started ON recurring_job_runs(started_at DESC);
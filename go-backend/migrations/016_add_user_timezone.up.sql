@@ -0,0 +1,4 @@
+-- IANA time zone used to decide a user's "today": transaction date checks, the current month,
+-- budget periods and when recurring occurrences are due.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,31 @@
+-- Rows go back to being keyed by the user who created them. Restoring the per-user unique
+-- constraints fails if members of a shared ledger created categories or budgets that now collide.
+DROP INDEX IF EXISTS idx_categorization_rules_ledger_priority;
+DROP INDEX IF EXISTS idx_budgets_ledger_id;
+DROP INDEX IF EXISTS idx_recurring_ledger_id;
+DROP INDEX IF EXISTS idx_transactions_ledger_category;
+DROP INDEX IF EXISTS idx_transactions_ledger_date;
+DROP INDEX IF EXISTS idx_categories_ledger_id;
+
+DROP INDEX IF EXISTS idx_budgets_ledger_category_range;
+DROP INDEX IF EXISTS idx_budgets_ledger_category_period;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_user_category_period
+    ON budgets(user_id, category_id, period) WHERE period <> 'custom';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_user_category_range
+    ON budgets(user_id, category_id, start_date, end_date) WHERE period = 'custom';
+
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_ledger_id_name_type_key;
+ALTER TABLE categories
+    ADD CONSTRAINT categories_user_id_name_type_key UNIQUE (user_id, name, type);
+
+ALTER TABLE categorization_rules DROP COLUMN IF EXISTS ledger_id;
+ALTER TABLE budgets DROP COLUMN IF EXISTS ledger_id;
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS ledger_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS ledger_id;
+ALTER TABLE categories DROP COLUMN IF EXISTS ledger_id;
+
+ALTER TABLE users DROP COLUMN IF EXISTS default_ledger_id;
+
+DROP TABLE IF EXISTS ledger_invitations;
+DROP TABLE IF EXISTS ledger_members;
+DROP TABLE IF EXISTS ledgers;
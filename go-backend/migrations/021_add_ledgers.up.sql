@@ -0,0 +1,94 @@
+-- Shared ledgers (household workspaces)
+
+-- Categories, transactions, recurring rules, budgets and categorization rules now belong to a
+-- ledger that several users can be members of. user_id on those tables records who created the row.
+CREATE TABLE IF NOT EXISTS ledgers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Owners manage the ledger and its members, editors change its data, viewers only read it.
+CREATE TABLE IF NOT EXISTS ledger_members (
+    ledger_id INTEGER NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    joined_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (ledger_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_members_user_id ON ledger_members(user_id);
+
+-- Invitations are accepted with a link emailed to the invitee. Only a SHA-256 hash of the token is stored.
+CREATE TABLE IF NOT EXISTS ledger_invitations (
+    id SERIAL PRIMARY KEY,
+    ledger_id INTEGER NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    email VARCHAR(100) NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_invitations_ledger_id ON ledger_invitations(ledger_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_invitations_expires_at ON ledger_invitations(expires_at);
+
+-- The ledger used when a request doesn't select one
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS default_ledger_id INTEGER REFERENCES ledgers(id) ON DELETE SET NULL;
+
+-- Every existing user gets a personal ledger that takes over their data
+INSERT INTO ledgers (name, created_by)
+SELECT 'Personal', id FROM users WHERE default_ledger_id IS NULL;
+
+UPDATE users u SET default_ledger_id = l.id
+FROM ledgers l
+WHERE l.created_by = u.id AND u.default_ledger_id IS NULL;
+
+INSERT INTO ledger_members (ledger_id, user_id, role)
+SELECT default_ledger_id, id, 'owner' FROM users
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS ledger_id INTEGER REFERENCES ledgers(id) ON DELETE CASCADE;
+UPDATE categories t SET ledger_id = u.default_ledger_id FROM users u WHERE u.id = t.user_id AND t.ledger_id IS NULL;
+ALTER TABLE categories ALTER COLUMN ledger_id SET NOT NULL;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS ledger_id INTEGER REFERENCES ledgers(id) ON DELETE CASCADE;
+UPDATE transactions t SET ledger_id = u.default_ledger_id FROM users u WHERE u.id = t.user_id AND t.ledger_id IS NULL;
+ALTER TABLE transactions ALTER COLUMN ledger_id SET NOT NULL;
+
+ALTER TABLE recurring_transactions ADD COLUMN IF NOT EXISTS ledger_id INTEGER REFERENCES ledgers(id) ON DELETE CASCADE;
+UPDATE recurring_transactions t SET ledger_id = u.default_ledger_id FROM users u WHERE u.id = t.user_id AND t.ledger_id IS NULL;
+ALTER TABLE recurring_transactions ALTER COLUMN ledger_id SET NOT NULL;
+
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS ledger_id INTEGER REFERENCES ledgers(id) ON DELETE CASCADE;
+UPDATE budgets t SET ledger_id = u.default_ledger_id FROM users u WHERE u.id = t.user_id AND t.ledger_id IS NULL;
+ALTER TABLE budgets ALTER COLUMN ledger_id SET NOT NULL;
+
+ALTER TABLE categorization_rules ADD COLUMN IF NOT EXISTS ledger_id INTEGER REFERENCES ledgers(id) ON DELETE CASCADE;
+UPDATE categorization_rules t SET ledger_id = u.default_ledger_id FROM users u WHERE u.id = t.user_id AND t.ledger_id IS NULL;
+ALTER TABLE categorization_rules ALTER COLUMN ledger_id SET NOT NULL;
+
+-- Names and budgets are unique per ledger rather than per user
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_user_id_name_type_key;
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_ledger_id_name_type_key;
+ALTER TABLE categories
+    ADD CONSTRAINT categories_ledger_id_name_type_key UNIQUE (ledger_id, name, type);
+
+DROP INDEX IF EXISTS idx_budgets_user_category_period;
+DROP INDEX IF EXISTS idx_budgets_user_category_range;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_ledger_category_period
+    ON budgets(ledger_id, category_id, period) WHERE period <> 'custom';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_ledger_category_range
+    ON budgets(ledger_id, category_id, start_date, end_date) WHERE period = 'custom';
+
+CREATE INDEX IF NOT EXISTS idx_categories_ledger_id ON categories(ledger_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_ledger_date ON transactions(ledger_id, date DESC);
+CREATE INDEX IF NOT EXISTS idx_transactions_ledger_category ON transactions(ledger_id, category_id);
+CREATE INDEX IF NOT EXISTS idx_recurring_ledger_id ON recurring_transactions(ledger_id);
+CREATE INDEX IF NOT EXISTS idx_budgets_ledger_id ON budgets(ledger_id);
+CREATE INDEX IF NOT EXISTS idx_categorization_rules_ledger_priority
+    ON categorization_rules(ledger_id, priority DESC, id);
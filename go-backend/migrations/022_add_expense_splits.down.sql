@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS settlements;
+DROP TABLE IF EXISTS expense_split_shares;
+DROP TABLE IF EXISTS expense_splits;
@@ -0,0 +1,41 @@
+-- Expense splitting and settle-up between ledger members
+
+-- An expense divided between members: who paid it and how it was divided. A transaction has at
+-- most one split, which goes away with it.
+CREATE TABLE IF NOT EXISTS expense_splits (
+    transaction_id INTEGER PRIMARY KEY REFERENCES transactions(id) ON DELETE CASCADE,
+    paid_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    method VARCHAR(10) NOT NULL CHECK (method IN ('equal', 'exact', 'percentage', 'shares')),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Each participant's part of a split expense. weight is what the amount was worked out from
+-- (1 for equal splits, cents for exact amounts, hundredths of a percent for percentages, the
+-- number of shares for shares), so parts can be worked out again when the expense's amount changes.
+-- A participant other than the payer owes the payer their amount.
+CREATE TABLE IF NOT EXISTS expense_split_shares (
+    transaction_id INTEGER NOT NULL REFERENCES expense_splits(transaction_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weight BIGINT NOT NULL CHECK (weight > 0),
+    amount DECIMAL(10,2) NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (transaction_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_expense_split_shares_user_id ON expense_split_shares(user_id);
+
+-- Payments between members that pay back what one owes the other
+CREATE TABLE IF NOT EXISTS settlements (
+    id SERIAL PRIMARY KEY,
+    ledger_id INTEGER NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    from_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    currency CHAR(3) NOT NULL,
+    date DATE NOT NULL,
+    note VARCHAR(500) NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_settlements_ledger_date ON settlements(ledger_id, date DESC);
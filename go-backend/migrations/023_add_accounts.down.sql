@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS transfers;
+DROP INDEX IF EXISTS idx_transactions_account_id;
+ALTER TABLE recurring_transactions DROP COLUMN IF EXISTS account_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS account_id;
+DROP TABLE IF EXISTS accounts;
@@ -0,0 +1,44 @@
+-- Accounts (cash, bank accounts, cards) that money is paid from or into, and transfers between them
+
+-- opening_balance is the balance before any of the account's transactions and transfers; it may be
+-- negative, e.g. a credit card that already carries debt.
+CREATE TABLE IF NOT EXISTS accounts (
+    id SERIAL PRIMARY KEY,
+    ledger_id INTEGER NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('cash', 'checking', 'savings', 'credit_card', 'investment', 'other')),
+    currency CHAR(3) NOT NULL,
+    opening_balance DECIMAL(10,2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (ledger_id, name)
+);
+
+-- Transactions and recurring rules may name the account they're paid from or into; deleting the
+-- account leaves them unassigned.
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS account_id INTEGER REFERENCES accounts(id) ON DELETE SET NULL;
+ALTER TABLE recurring_transactions
+    ADD COLUMN IF NOT EXISTS account_id INTEGER REFERENCES accounts(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions(account_id);
+
+-- Money moved from one account to another. Transfers are neither income nor expense. amount is in
+-- the from account's currency and to_amount in the to account's currency (the same unless they differ).
+CREATE TABLE IF NOT EXISTS transfers (
+    id SERIAL PRIMARY KEY,
+    ledger_id INTEGER NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    to_account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    to_amount DECIMAL(10,2) NOT NULL CHECK (to_amount > 0),
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    date DATE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (from_account_id <> to_account_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfers_from_account_id ON transfers(from_account_id);
+CREATE INDEX IF NOT EXISTS idx_transfers_to_account_id ON transfers(to_account_id);
+CREATE INDEX IF NOT EXISTS idx_transfers_ledger_date ON transfers(ledger_id, date DESC);
@@ -0,0 +1,6 @@
+-- Single sign-on logins are bound to the client that started them: it keeps a random binding
+-- (stored here as a SHA-256 hash) and must present it with the code and state to finish the login.
+-- Logins in progress without one can't be finished any more.
+DELETE FROM oidc_login_states;
+
+ALTER TABLE oidc_login_states ADD COLUMN IF NOT EXISTS binding_hash CHAR(64) NOT NULL;
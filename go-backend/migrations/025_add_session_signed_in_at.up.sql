@@ -0,0 +1,12 @@
+-- When the session a refresh token belongs to was signed in; carried over on every refresh.
+-- Accounts without a password confirm account deletion and turning off two-factor
+-- authentication by having signed in recently.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS signed_in_at TIMESTAMPTZ;
+
+UPDATE refresh_tokens r
+SET signed_in_at = COALESCE(
+    (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = r.family_id),
+    'epoch')
+WHERE signed_in_at IS NULL;
+
+ALTER TABLE refresh_tokens ALTER COLUMN signed_in_at SET NOT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE transfers
+    DROP CONSTRAINT IF EXISTS transfers_from_account_id_fkey,
+    DROP CONSTRAINT IF EXISTS transfers_to_account_id_fkey,
+    ADD CONSTRAINT transfers_from_account_id_fkey FOREIGN KEY (from_account_id) REFERENCES accounts(id) ON DELETE CASCADE,
+    ADD CONSTRAINT transfers_to_account_id_fkey FOREIGN KEY (to_account_id) REFERENCES accounts(id) ON DELETE CASCADE;
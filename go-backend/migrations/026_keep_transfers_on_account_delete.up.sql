@@ -0,0 +1,7 @@
+-- An account that still has transfers can't be deleted: removing its transfers would change the
+-- balance of the account on the other side. Deleting a ledger deletes its transfers first.
+ALTER TABLE transfers
+    DROP CONSTRAINT IF EXISTS transfers_from_account_id_fkey,
+    DROP CONSTRAINT IF EXISTS transfers_to_account_id_fkey,
+    ADD CONSTRAINT transfers_from_account_id_fkey FOREIGN KEY (from_account_id) REFERENCES accounts(id),
+    ADD CONSTRAINT transfers_to_account_id_fkey FOREIGN KEY (to_account_id) REFERENCES accounts(id);
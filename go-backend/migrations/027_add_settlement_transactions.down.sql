@@ -0,0 +1,3 @@
+DELETE FROM transactions WHERE settlement_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_transactions_settlement_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS settlement_id;
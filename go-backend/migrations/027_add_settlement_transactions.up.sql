@@ -0,0 +1,26 @@
+-- A settlement is recorded in the ledger's history as a pair of transactions in its "Settlements"
+-- categories: an expense for the member who paid and an income for the member who was paid, so
+-- the ledger's balance is unchanged. They are deleted with the settlement.
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS settlement_id INTEGER REFERENCES settlements(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_settlement_id ON transactions(settlement_id);
+
+-- Settlements recorded before get their transactions
+INSERT INTO categories (ledger_id, user_id, name, type)
+SELECT DISTINCT ON (s.ledger_id, ct.type) s.ledger_id, COALESCE(s.created_by, s.from_user_id), 'Settlements', ct.type
+FROM settlements s
+CROSS JOIN (VALUES ('expense'), ('income')) AS ct(type)
+ORDER BY s.ledger_id, ct.type, s.id
+ON CONFLICT (ledger_id, name, type) DO NOTHING;
+
+INSERT INTO transactions (user_id, ledger_id, category_id, amount, currency, description, date, settlement_id)
+SELECT COALESCE(s.created_by, s.from_user_id), s.ledger_id, c.id, s.amount, s.currency,
+       'Settlement from ' || fu.username || ' to ' || tu.username
+           || CASE WHEN s.note <> '' THEN ': ' || s.note ELSE '' END,
+       s.date, s.id
+FROM settlements s
+JOIN categories c ON c.ledger_id = s.ledger_id AND c.name = 'Settlements'
+JOIN users fu ON fu.id = s.from_user_id
+JOIN users tu ON tu.id = s.to_user_id
+WHERE NOT EXISTS (SELECT 1 FROM transactions t WHERE t.settlement_id = s.id);
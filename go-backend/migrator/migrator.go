@@ -0,0 +1,400 @@
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is a single versioned schema change loaded from the migrations directory.
+// Files are named NNN_name.up.sql / NNN_name.down.sql; a plain NNN_name.sql is treated
+// as an up-only migration (the format used before versioning was introduced).
+type Migration struct {
+	Version  int
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	Checksum string
+}
+
+// HasDown reports whether the migration ships a paired down-migration.
+func (m Migration) HasDown() bool {
+	return strings.TrimSpace(m.DownSQL) != ""
+}
+
+// AppliedMigration is a row from the schema_migrations table.
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// StatusEntry describes the state of one migration version for the status command.
+// State is one of "applied", "pending", "modified" (checksum mismatch) or "missing"
+// (recorded in the database but no longer present on disk).
+type StatusEntry struct {
+	Version   int
+	Name      string
+	State     string
+	AppliedAt *time.Time
+}
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration has been modified on disk")
+	ErrNoDownMigration  = errors.New("migration has no down file")
+	ErrNothingApplied   = errors.New("no applied migrations to roll back")
+)
+
+// Load reads all migration files from fsys and returns them sorted by version.
+// Returns an error for malformed file names, duplicate versions, or down files without an up file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		version, name, direction, err := parseFileName(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("duplicate migration version %d (%s and %s)", version, m.Name, name)
+		}
+
+		if direction == "down" {
+			if m.DownSQL != "" {
+				return nil, fmt.Errorf("duplicate down migration for version %d", version)
+			}
+			m.DownSQL = string(contents)
+			continue
+		}
+		if m.UpSQL != "" {
+			return nil, fmt.Errorf("duplicate up migration for version %d", version)
+		}
+		m.UpSQL = string(contents)
+		m.Checksum = Checksum(m.UpSQL)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpSQL == "" {
+			return nil, fmt.Errorf("migration %d (%s) has a down file but no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parseFileName splits "003_add_index.up.sql" into (3, "add_index", "up").
+// Files without an .up/.down marker are treated as up migrations.
+func parseFileName(fileName string) (int, string, string, error) {
+	base := strings.TrimSuffix(fileName, ".sql")
+	direction := "up"
+	if strings.HasSuffix(base, ".down") {
+		direction = "down"
+		base = strings.TrimSuffix(base, ".down")
+	} else {
+		base = strings.TrimSuffix(base, ".up")
+	}
+
+	prefix, name, found := strings.Cut(base, "_")
+	if !found || name == "" {
+		return 0, "", "", fmt.Errorf("invalid migration file name %q: expected NNN_name[.up|.down].sql", fileName)
+	}
+	version, err := strconv.Atoi(prefix)
+	if err != nil || version < 0 {
+		return 0, "", "", fmt.Errorf("invalid migration file name %q: version must be a non-negative number", fileName)
+	}
+	return version, name, direction, nil
+}
+
+// Checksum returns the hex-encoded SHA-256 of a migration's up SQL.
+func Checksum(sqlText string) string {
+	sum := sha256.Sum256([]byte(sqlText))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lock acquires the migration advisory lock on conn, blocking until it is available.
+// The lock is session-scoped, so all migration work must run on the same connection.
+func Lock(ctx context.Context, conn *sql.Conn, lockID int64) error {
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	return nil
+}
+
+// Unlock releases the migration advisory lock held by conn.
+func Unlock(ctx context.Context, conn *sql.Conn, lockID int64) error {
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+		return fmt.Errorf("failed to release migration lock: %w", err)
+	}
+	return nil
+}
+
+// EnsureTable creates the schema_migrations tracking table if it does not exist.
+func EnsureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// Applied returns all migrations recorded in schema_migrations, sorted by version.
+func Applied(ctx context.Context, conn *sql.Conn) ([]AppliedMigration, error) {
+	rows, err := conn.QueryContext(ctx,
+		"SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var applied []AppliedMigration
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied = append(applied, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// Status compares the migrations on disk with those recorded in the database.
+func Status(ctx context.Context, conn *sql.Conn, migrations []Migration) ([]StatusEntry, error) {
+	applied, err := Applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return buildStatus(migrations, applied), nil
+}
+
+// buildStatus merges on-disk and applied migrations into a single version-ordered list.
+func buildStatus(migrations []Migration, applied []AppliedMigration) []StatusEntry {
+	appliedByVersion := make(map[int]AppliedMigration, len(applied))
+	for _, a := range applied {
+		appliedByVersion[a.Version] = a
+	}
+
+	entries := make([]StatusEntry, 0, len(migrations))
+	onDisk := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		onDisk[m.Version] = true
+		entry := StatusEntry{Version: m.Version, Name: m.Name, State: "pending"}
+		if a, ok := appliedByVersion[m.Version]; ok {
+			appliedAt := a.AppliedAt
+			entry.AppliedAt = &appliedAt
+			entry.State = "applied"
+			if a.Checksum != m.Checksum {
+				entry.State = "modified"
+			}
+		}
+		entries = append(entries, entry)
+	}
+	for _, a := range applied {
+		if onDisk[a.Version] {
+			continue
+		}
+		appliedAt := a.AppliedAt
+		entries = append(entries, StatusEntry{Version: a.Version, Name: a.Name, State: "missing", AppliedAt: &appliedAt})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Version < entries[j].Version })
+	return entries
+}
+
+// Up applies every pending migration in version order, each inside its own transaction.
+// Refuses to run if an already-applied migration has been modified on disk.
+// Returns the number of migrations applied.
+func Up(ctx context.Context, conn *sql.Conn, migrations []Migration) (int, error) {
+	applied, err := Applied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	pending, err := pendingMigrations(migrations, applied)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, m := range pending {
+		if err := apply(ctx, conn, m); err != nil {
+			return i, err
+		}
+	}
+	return len(pending), nil
+}
+
+// pendingMigrations returns the migrations that have not been applied yet.
+// Fails with ErrChecksumMismatch if an applied migration's file has changed.
+func pendingMigrations(migrations []Migration, applied []AppliedMigration) ([]Migration, error) {
+	appliedByVersion := make(map[int]AppliedMigration, len(applied))
+	for _, a := range applied {
+		appliedByVersion[a.Version] = a
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		a, ok := appliedByVersion[m.Version]
+		if !ok {
+			pending = append(pending, m)
+			continue
+		}
+		if a.Checksum != m.Checksum {
+			return nil, fmt.Errorf("%w: %03d_%s", ErrChecksumMismatch, m.Version, m.Name)
+		}
+	}
+	return pending, nil
+}
+
+// Down rolls back the last n applied migrations in reverse order, each inside its own transaction.
+// Every migration to be rolled back must have a down file; this is checked before anything runs.
+// Returns the number of migrations rolled back.
+func Down(ctx context.Context, conn *sql.Conn, migrations []Migration, n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("number of migrations to roll back must be positive")
+	}
+
+	applied, err := Applied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	targets, err := rollbackTargets(migrations, applied, n)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, m := range targets {
+		if err := revert(ctx, conn, m); err != nil {
+			return i, err
+		}
+	}
+	return len(targets), nil
+}
+
+// rollbackTargets picks the newest n applied migrations and verifies each can be reverted.
+func rollbackTargets(migrations []Migration, applied []AppliedMigration, n int) ([]Migration, error) {
+	if len(applied) == 0 {
+		return nil, ErrNothingApplied
+	}
+
+	byVersion := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	if n > len(applied) {
+		n = len(applied)
+	}
+	targets := make([]Migration, 0, n)
+	for i := len(applied) - 1; i >= len(applied)-n; i-- {
+		a := applied[i]
+		m, ok := byVersion[a.Version]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %03d_%s is missing on disk", a.Version, a.Name)
+		}
+		if !m.HasDown() {
+			return nil, fmt.Errorf("%w: %03d_%s", ErrNoDownMigration, m.Version, m.Name)
+		}
+		targets = append(targets, m)
+	}
+	return targets, nil
+}
+
+// Redo rolls back the most recently applied migration and applies it again.
+// Useful while iterating on a migration during development.
+func Redo(ctx context.Context, conn *sql.Conn, migrations []Migration) (Migration, error) {
+	applied, err := Applied(ctx, conn)
+	if err != nil {
+		return Migration{}, err
+	}
+	targets, err := rollbackTargets(migrations, applied, 1)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	m := targets[0]
+	if err := revert(ctx, conn, m); err != nil {
+		return m, err
+	}
+	if err := apply(ctx, conn, m); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// apply runs a migration's up SQL and records it, atomically.
+func apply(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for %03d_%s: %w", m.Version, m.Name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.UpSQL); err != nil {
+		return fmt.Errorf("failed to apply %03d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+		m.Version, m.Name, m.Checksum); err != nil {
+		return fmt.Errorf("failed to record %03d_%s: %w", m.Version, m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit %03d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+// revert runs a migration's down SQL and removes its record, atomically.
+func revert(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for %03d_%s: %w", m.Version, m.Name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.DownSQL); err != nil {
+		return fmt.Errorf("failed to roll back %03d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version); err != nil {
+		return fmt.Errorf("failed to unrecord %03d_%s: %w", m.Version, m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rollback of %03d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
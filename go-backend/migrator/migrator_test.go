@@ -0,0 +1,248 @@
+package migrator
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseFileName(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileName      string
+		wantVersion   int
+		wantName      string
+		wantDirection string
+		wantErr       bool
+	}{
+		{
+			name:          "legacy up-only file",
+			fileName:      "000_create_base_schema.sql",
+			wantVersion:   0,
+			wantName:      "create_base_schema",
+			wantDirection: "up",
+		},
+		{
+			name:          "explicit up file",
+			fileName:      "003_add_index.up.sql",
+			wantVersion:   3,
+			wantName:      "add_index",
+			wantDirection: "up",
+		},
+		{
+			name:          "down file",
+			fileName:      "003_add_index.down.sql",
+			wantVersion:   3,
+			wantName:      "add_index",
+			wantDirection: "down",
+		},
+		{
+			name:     "missing version",
+			fileName: "add_index.sql",
+			wantErr:  true,
+		},
+		{
+			name:     "missing name",
+			fileName: "003.sql",
+			wantErr:  true,
+		},
+		{
+			name:     "negative version",
+			fileName: "-1_bad.sql",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, name, direction, err := parseFileName(tt.fileName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFileName(%q) error = %v, wantErr %v", tt.fileName, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if version != tt.wantVersion || name != tt.wantName || direction != tt.wantDirection {
+				t.Errorf("parseFileName(%q) = (%d, %q, %q), want (%d, %q, %q)",
+					tt.fileName, version, name, direction, tt.wantVersion, tt.wantName, tt.wantDirection)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_index.up.sql":         {Data: []byte("CREATE INDEX a ON t(x);")},
+		"002_add_index.down.sql":       {Data: []byte("DROP INDEX a;")},
+		"000_create_base_schema.sql":   {Data: []byte("CREATE TABLE t (x INT);")},
+		"001_create_budgets_table.sql": {Data: []byte("CREATE TABLE b (y INT);")},
+		"README.md":                    {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(migrations) != 3 {
+		t.Fatalf("Load() returned %d migrations, want 3", len(migrations))
+	}
+	for i, want := range []int{0, 1, 2} {
+		if migrations[i].Version != want {
+			t.Errorf("migrations[%d].Version = %d, want %d", i, migrations[i].Version, want)
+		}
+	}
+	if migrations[0].HasDown() {
+		t.Errorf("legacy migration should not have a down file")
+	}
+	if !migrations[2].HasDown() {
+		t.Errorf("migration 002 should have a down file")
+	}
+	if migrations[2].Checksum != Checksum("CREATE INDEX a ON t(x);") {
+		t.Errorf("checksum should be computed from the up SQL")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "duplicate version with different names",
+			fsys: fstest.MapFS{
+				"001_one.sql": {Data: []byte("SELECT 1;")},
+				"001_two.sql": {Data: []byte("SELECT 2;")},
+			},
+		},
+		{
+			name: "legacy and explicit up for same version",
+			fsys: fstest.MapFS{
+				"001_one.sql":    {Data: []byte("SELECT 1;")},
+				"001_one.up.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{
+				"001_one.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			name: "malformed name",
+			fsys: fstest.MapFS{
+				"one.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.fsys); err == nil {
+				t.Errorf("Load() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	migrations := []Migration{
+		{Version: 0, Name: "base", Checksum: "aaa"},
+		{Version: 1, Name: "budgets", Checksum: "bbb"},
+		{Version: 2, Name: "indexes", Checksum: "ccc"},
+	}
+
+	t.Run("returns unapplied versions", func(t *testing.T) {
+		applied := []AppliedMigration{{Version: 0, Name: "base", Checksum: "aaa"}}
+		pending, err := pendingMigrations(migrations, applied)
+		if err != nil {
+			t.Fatalf("pendingMigrations() error = %v", err)
+		}
+		if len(pending) != 2 || pending[0].Version != 1 || pending[1].Version != 2 {
+			t.Errorf("pendingMigrations() = %+v, want versions 1 and 2", pending)
+		}
+	})
+
+	t.Run("rejects modified migration", func(t *testing.T) {
+		applied := []AppliedMigration{{Version: 0, Name: "base", Checksum: "changed"}}
+		_, err := pendingMigrations(migrations, applied)
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("pendingMigrations() error = %v, want ErrChecksumMismatch", err)
+		}
+	})
+}
+
+func TestRollbackTargets(t *testing.T) {
+	migrations := []Migration{
+		{Version: 0, Name: "base", DownSQL: "DROP TABLE t;"},
+		{Version: 1, Name: "budgets"},
+		{Version: 2, Name: "indexes", DownSQL: "DROP INDEX a;"},
+		{Version: 3, Name: "columns", DownSQL: "ALTER TABLE t DROP COLUMN y;"},
+	}
+	applied := []AppliedMigration{
+		{Version: 0, Name: "base"},
+		{Version: 1, Name: "budgets"},
+		{Version: 2, Name: "indexes"},
+		{Version: 3, Name: "columns"},
+	}
+
+	t.Run("newest first", func(t *testing.T) {
+		targets, err := rollbackTargets(migrations, applied, 2)
+		if err != nil {
+			t.Fatalf("rollbackTargets() error = %v", err)
+		}
+		if len(targets) != 2 || targets[0].Version != 3 || targets[1].Version != 2 {
+			t.Errorf("rollbackTargets() = %+v, want versions 3 then 2", targets)
+		}
+	})
+
+	t.Run("refuses when a down file is missing", func(t *testing.T) {
+		_, err := rollbackTargets(migrations, applied, 3)
+		if !errors.Is(err, ErrNoDownMigration) {
+			t.Errorf("rollbackTargets() error = %v, want ErrNoDownMigration", err)
+		}
+	})
+
+	t.Run("nothing applied", func(t *testing.T) {
+		_, err := rollbackTargets(migrations, nil, 1)
+		if !errors.Is(err, ErrNothingApplied) {
+			t.Errorf("rollbackTargets() error = %v, want ErrNothingApplied", err)
+		}
+	})
+}
+
+func TestBuildStatus(t *testing.T) {
+	appliedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	migrations := []Migration{
+		{Version: 0, Name: "base", Checksum: "aaa"},
+		{Version: 1, Name: "budgets", Checksum: "bbb"},
+		{Version: 3, Name: "columns", Checksum: "ddd"},
+	}
+	applied := []AppliedMigration{
+		{Version: 0, Name: "base", Checksum: "aaa", AppliedAt: appliedAt},
+		{Version: 1, Name: "budgets", Checksum: "old", AppliedAt: appliedAt},
+		{Version: 2, Name: "removed", Checksum: "ccc", AppliedAt: appliedAt},
+	}
+
+	entries := buildStatus(migrations, applied)
+	want := []struct {
+		version int
+		state   string
+	}{
+		{0, "applied"},
+		{1, "modified"},
+		{2, "missing"},
+		{3, "pending"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("buildStatus() returned %d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		if entries[i].Version != w.version || entries[i].State != w.state {
+			t.Errorf("entries[%d] = (%d, %s), want (%d, %s)", i, entries[i].Version, entries[i].State, w.version, w.state)
+		}
+	}
+	if entries[3].AppliedAt != nil {
+		t.Errorf("pending migration should not have an applied_at time")
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+// Kinds of account
+const (
+	AccountCash       = "cash"
+	AccountChecking   = "checking"
+	AccountSavings    = "savings"
+	AccountCreditCard = "credit_card"
+	AccountInvestment = "investment"
+	AccountOther      = "other"
+)
+
+// AccountTypes lists the kinds of account.
+var AccountTypes = []string{AccountCash, AccountChecking, AccountSavings, AccountCreditCard, AccountInvestment, AccountOther}
+
+// Account is somewhere money is kept (cash, a bank account, a card) that transactions are paid from or into.
+type Account struct {
+	ID             int    `json:"id"`
+	LedgerID       int    `json:"ledger_id"`
+	UserID         int    `json:"user_id"` // who created it
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Currency       string `json:"currency"`
+	OpeningBalance Money  `json:"opening_balance"` // the balance before any transactions; negative for debt
+	Balance        Money  `json:"balance"`         // the opening balance plus everything paid into it, less everything paid from it
+	CreatedAt      string `json:"created_at"`
+}
+
+// Transfer moves money from one account to another. It is neither income nor expense.
+type Transfer struct {
+	ID            int    `json:"id"`
+	LedgerID      int    `json:"ledger_id"`
+	UserID        int    `json:"user_id"` // who recorded it
+	FromAccountID int    `json:"from_account_id"`
+	FromAccount   string `json:"from_account"`
+	ToAccountID   int    `json:"to_account_id"`
+	ToAccount     string `json:"to_account"`
+	Amount        Money  `json:"amount"`    // taken from the from account, in its currency
+	ToAmount      Money  `json:"to_amount"` // paid into the to account, in its currency
+	Description   string `json:"description"`
+	Date          string `json:"date"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// Kinds of account register entry
+const (
+	EntryTransaction = "transaction"
+	EntryTransfer    = "transfer"
+)
+
+// AccountEntry is one line of an account's register: a transaction or a transfer, with the
+// account's balance after it.
+type AccountEntry struct {
+	Kind        string `json:"kind"` // "transaction" or "transfer"
+	ID          int    `json:"id"`   // the transaction or transfer ID
+	Date        string `json:"date"`
+	Description string `json:"description"`
+	Counterpart string `json:"counterpart"` // the category of a transaction, or the other account of a transfer
+	Amount      Money  `json:"amount"`      // positive when money came in, negative when it went out
+	Balance     Money  `json:"balance"`
+}
@@ -1,13 +1,35 @@
 package models
 
 type Budget struct {
-	ID              int     `json:"id"`
-	UserID          int     `json:"user_id" validate:"required,gt=0"`
-	CategoryID      int     `json:"category_id" validate:"gte=0"` // 0 means overall budget
-	CategoryName    string  `json:"category_name,omitempty"`
-	Amount          float64 `json:"amount" validate:"required,gt=0"`
-	Period          string  `json:"period" validate:"required,oneof=monthly yearly"`
-	AlertThreshold  int     `json:"alert_threshold" validate:"required,gte=0,lte=100"` // percentage (e.g., 80 means alert at 80%)
-	CurrentSpending float64 `json:"current_spending"`                                   // calculated, not stored
-	CreatedAt       string  `json:"created_at"`
+	ID              int    `json:"id"`
+	LedgerID        int    `json:"ledger_id"`
+	UserID          int    `json:"user_id" validate:"required,gt=0"`
+	CategoryID      int    `json:"category_id" validate:"gte=0"` // 0 means overall budget
+	CategoryName    string `json:"category_name,omitempty"`
+	Amount          Money  `json:"amount" validate:"required,gt=0"`
+	Period          string `json:"period" validate:"required,oneof=weekly biweekly monthly quarterly yearly custom"`
+	StartDate       string `json:"start_date,omitempty"`                              // weekly/biweekly: first day of any period; custom: first day of the range
+	EndDate         string `json:"end_date,omitempty"`                                // custom: last day of the range
+	AlertThreshold  int    `json:"alert_threshold" validate:"required,gte=0,lte=100"` // percentage (e.g., 80 means alert at 80%)
+	Rollover        bool   `json:"rollover"`                                          // carry unused or overspent amounts into the next period
+	CarriedOver     Money  `json:"carried_over"`                                      // calculated: carried in from the previous period (negative if overspent)
+	Available       Money  `json:"available"`                                         // calculated: Amount + CarriedOver
+	CurrentSpending Money  `json:"current_spending"`                                  // calculated, not stored
+	PeriodStart     string `json:"period_start"`                                      // calculated: current period, YYYY-MM-DD
+	PeriodEnd       string `json:"period_end"`
+	CreatedAt       string `json:"created_at"`
+}
+
+// BudgetPeriod is a budget's planned vs actual spending for one period.
+// Available = Planned + CarriedIn and Remaining = Available - Actual; for rollover budgets
+// Remaining is carried into the next period.
+type BudgetPeriod struct {
+	PeriodStart string `json:"period_start"`
+	PeriodEnd   string `json:"period_end"`
+	Planned     Money  `json:"planned"`
+	CarriedIn   Money  `json:"carried_in"`
+	Available   Money  `json:"available"`
+	Actual      Money  `json:"actual"`
+	Remaining   Money  `json:"remaining"`
+	InProgress  bool   `json:"in_progress"` // the current, not yet closed period
 }
@@ -0,0 +1,20 @@
+package models
+
+// CategorizationRule assigns CategoryID to transactions whose description matches Pattern
+// (a case-insensitive substring for "contains", a Go regular expression for "regex") and
+// that satisfy the optional amount range and weekday.
+type CategorizationRule struct {
+	ID           int    `json:"id"`
+	LedgerID     int    `json:"ledger_id"`
+	UserID       int    `json:"user_id"`
+	CategoryID   int    `json:"category_id"`
+	CategoryName string `json:"category_name,omitempty"`
+	CategoryType string `json:"category_type,omitempty"`
+	MatchType    string `json:"match_type"` // "contains" or "regex"
+	Pattern      string `json:"pattern"`
+	MinAmount    *Money `json:"min_amount"` // inclusive; nil for no lower bound
+	MaxAmount    *Money `json:"max_amount"` // inclusive; nil for no upper bound
+	Weekday      *int   `json:"weekday"`    // 0 = Sunday ... 6 = Saturday; nil for any day
+	Priority     int    `json:"priority"`   // higher runs first
+	CreatedAt    string `json:"created_at"`
+}
@@ -2,7 +2,9 @@ package models
 
 type Category struct {
 	ID        int    `json:"id"`
+	LedgerID  int    `json:"ledger_id"`
 	UserID    int    `json:"user_id" validate:"required,gt=0"`
+	ParentID  *int   `json:"parent_id"` // nil for top-level categories
 	Name      string `json:"name" validate:"required,min=1,max=100"`
 	Type      string `json:"type" validate:"required,oneof=income expense"`
 	CreatedAt string `json:"created_at"`
@@ -0,0 +1,10 @@
+package models
+
+// ExchangeRate states that 1 unit of FromCurrency equals Rate units of ToCurrency,
+// effective from EffectiveDate until a newer rate for the same pair.
+type ExchangeRate struct {
+	FromCurrency  string `json:"from_currency"`
+	ToCurrency    string `json:"to_currency"`
+	EffectiveDate string `json:"effective_date"`
+	Rate          string `json:"rate"` // exact decimal, e.g. "1.0850"
+}
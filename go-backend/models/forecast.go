@@ -0,0 +1,52 @@
+package models
+
+// Forecast is a day-by-day projection of a user's balance, in their base currency.
+type Forecast struct {
+	From                 string            `json:"from"` // first projected day (tomorrow)
+	To                   string            `json:"to"`
+	Currency             string            `json:"currency"`
+	StartingBalance      Money             `json:"starting_balance"` // income minus expenses up to today
+	BalanceFloor         Money             `json:"balance_floor"`
+	AverageDailySpending Money             `json:"average_daily_spending"` // discretionary spending per day
+	EndingBalance        Money             `json:"ending_balance"`
+	LowestBalance        Money             `json:"lowest_balance"`
+	LowestBalanceDate    string            `json:"lowest_balance_date"`
+	Upcoming             []ForecastItem    `json:"upcoming"`
+	Days                 []ForecastDay     `json:"days"`
+	Warnings             []ForecastWarning `json:"warnings"`
+}
+
+// Forecast item sources
+const (
+	ForecastRecurring = "recurring" // an occurrence of a recurring transaction
+	ForecastScheduled = "scheduled" // a transaction dated in the future
+)
+
+// ForecastItem is a known future income or expense.
+type ForecastItem struct {
+	Date        string `json:"date"` // due date; overdue recurring occurrences count on the first projected day
+	Source      string `json:"source"`
+	SourceID    int    `json:"source_id"` // recurring transaction or transaction ID
+	CategoryID  int    `json:"category_id"`
+	Type        string `json:"type"` // expense or income
+	Description string `json:"description"`
+	Amount      Money  `json:"amount"`
+}
+
+// ForecastDay is the projection for one day.
+type ForecastDay struct {
+	Date          string `json:"date"`
+	Income        Money  `json:"income"`
+	Expenses      Money  `json:"expenses"`      // upcoming expenses due that day
+	Discretionary Money  `json:"discretionary"` // average daily spending
+	Balance       Money  `json:"balance"`       // projected balance at the end of the day
+}
+
+// ForecastWarning marks a stretch of days where the projected balance is below the floor.
+type ForecastWarning struct {
+	Date              string `json:"date"` // first day below the floor
+	Days              int    `json:"days"`
+	LowestBalance     Money  `json:"lowest_balance"`
+	LowestBalanceDate string `json:"lowest_balance_date"`
+	Message           string `json:"message"`
+}
@@ -0,0 +1,57 @@
+package models
+
+// Ledger member roles, from least to most access
+const (
+	LedgerRoleViewer = "viewer" // reads the ledger's data
+	LedgerRoleEditor = "editor" // also adds, changes and deletes it
+	LedgerRoleOwner  = "owner"  // also renames or deletes the ledger and manages members and invitations
+)
+
+// LedgerRoles lists the roles in order of increasing access.
+var LedgerRoles = []string{LedgerRoleViewer, LedgerRoleEditor, LedgerRoleOwner}
+
+// LedgerRoleAllows reports whether role grants at least the access of required.
+// Unknown roles grant nothing.
+func LedgerRoleAllows(role, required string) bool {
+	rank := func(r string) int {
+		for i, known := range LedgerRoles {
+			if r == known {
+				return i
+			}
+		}
+		return -1
+	}
+	have := rank(role)
+	return have >= 0 && have >= rank(required)
+}
+
+// Ledger is a shared set of categories, transactions, recurring rules and budgets, as seen by one member.
+type Ledger struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`    // the member's role
+	Default   bool   `json:"default"` // used when a request doesn't select a ledger
+	Members   int    `json:"members"`
+	CreatedAt string `json:"created_at"`
+}
+
+// LedgerMember is a user's membership of a ledger.
+type LedgerMember struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joined_at"`
+}
+
+// LedgerInvitation is an invitation to join a ledger that hasn't been accepted yet.
+type LedgerInvitation struct {
+	ID         int    `json:"id"`
+	LedgerID   int    `json:"ledger_id"`
+	LedgerName string `json:"ledger_name"`
+	Email      string `json:"email"`
+	Role       string `json:"role"`
+	InvitedBy  *int   `json:"invited_by"` // nil once the inviting user has deleted their account
+	ExpiresAt  string `json:"expires_at"`
+	CreatedAt  string `json:"created_at"`
+}
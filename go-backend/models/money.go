@@ -0,0 +1,177 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact monetary amount stored in minor units (cents).
+// It maps to the DECIMAL(10,2) columns in the database and encodes to JSON as a
+// number with two decimal places, e.g. 12.30.
+type Money int64
+
+var (
+	ErrInvalidMoney    = errors.New("invalid amount: expected a number like 12.34")
+	ErrTooManyDecimals = errors.New("invalid amount: at most two decimal places are allowed")
+	ErrMoneyOutOfRange = errors.New("invalid amount: value is out of range")
+	maxWholeUnits      = int64(math.MaxInt64 / 100)
+)
+
+// ParseMoney strictly parses a decimal string such as "12", "12.3" or "-12.34".
+// Exponents, thousands separators, signs other than a leading '-', and more than
+// two fractional digits are rejected.
+func ParseMoney(s string) (Money, error) {
+	return parseMoney(s, true)
+}
+
+// parseMoney parses a decimal string. When strict is false, extra fractional digits
+// are rounded half away from zero instead of rejected (used for database aggregates).
+func parseMoney(s string, strict bool) (Money, error) {
+	if s == "" {
+		return 0, ErrInvalidMoney
+	}
+
+	negative := false
+	if s[0] == '-' {
+		negative = true
+		s = s[1:]
+	}
+
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" || !isDigits(whole) || (hasPoint && (frac == "" || !isDigits(frac))) {
+		return 0, ErrInvalidMoney
+	}
+
+	roundUp := false
+	if len(frac) > 2 {
+		if strict {
+			return 0, ErrTooManyDecimals
+		}
+		roundUp = frac[2] >= '5'
+		frac = frac[:2]
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units >= maxWholeUnits {
+		return 0, ErrMoneyOutOfRange
+	}
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+
+	value := units*100 + cents
+	if roundUp {
+		value++
+	}
+	if negative {
+		value = -value
+	}
+	return Money(value), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the amount with exactly two decimal places, e.g. "-0.05".
+func (m Money) String() string {
+	value := int64(m)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, value/100, value%100)
+}
+
+// Float64 returns the amount in major units. Only use for ratios and display, never for sums.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// MulInt multiplies the amount by an integer factor.
+func (m Money) MulInt(n int64) Money {
+	return m * Money(n)
+}
+
+// DivRound divides the amount by n, rounding half away from zero to the nearest cent.
+func (m Money) DivRound(n int64) Money {
+	if n == 0 {
+		return 0
+	}
+	q := int64(m) / n
+	r := int64(m) % n
+	if r < 0 {
+		r = -r
+	}
+	d := n
+	if d < 0 {
+		d = -d
+	}
+	if r*2 >= d {
+		if (int64(m) < 0) != (n < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Money(q)
+}
+
+// MarshalJSON encodes the amount as a JSON number with two decimal places.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or string and parses it strictly.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, sending the amount as a decimal string so
+// PostgreSQL stores it exactly.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan implements sql.Scanner for NUMERIC/DECIMAL columns and aggregates.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case string:
+		parsed, err := parseMoney(v, false)
+		if err != nil {
+			return fmt.Errorf("cannot scan %q into Money: %w", v, err)
+		}
+		*m = parsed
+		return nil
+	case []byte:
+		return m.Scan(string(v))
+	case int64:
+		*m = Money(v * 100)
+		return nil
+	case float64:
+		*m = Money(math.Round(v * 100))
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr error
+	}{
+		{input: "12", want: 1200},
+		{input: "12.3", want: 1230},
+		{input: "12.34", want: 1234},
+		{input: "0.01", want: 1},
+		{input: "-0.05", want: -5},
+		{input: "0.1", want: 10},
+		{input: "1.234", wantErr: ErrTooManyDecimals},
+		{input: "", wantErr: ErrInvalidMoney},
+		{input: "1e3", wantErr: ErrInvalidMoney},
+		{input: "+1", wantErr: ErrInvalidMoney},
+		{input: "1,000", wantErr: ErrInvalidMoney},
+		{input: ".5", wantErr: ErrInvalidMoney},
+		{input: "5.", wantErr: ErrInvalidMoney},
+		{input: "abc", wantErr: ErrInvalidMoney},
+		{input: "NaN", wantErr: ErrInvalidMoney},
+		{input: "99999999999999999999", wantErr: ErrMoneyOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseMoney(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := map[Money]string{
+		0:      "0.00",
+		5:      "0.05",
+		-5:     "-0.05",
+		1230:   "12.30",
+		-12345: "-123.45",
+	}
+	for m, want := range tests {
+		if got := m.String(); got != want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(m), got, want)
+		}
+	}
+}
+
+func TestMoneyDivRound(t *testing.T) {
+	tests := []struct {
+		m    Money
+		n    int64
+		want Money
+	}{
+		{m: 1200, n: 12, want: 100},
+		{m: 1000, n: 12, want: 83}, // 10.00 / 12 = 0.8333
+		{m: 1000, n: 3, want: 333}, // 10.00 / 3 = 3.3333
+		{m: 2000, n: 3, want: 667}, // 20.00 / 3 = 6.6667
+		{m: 6, n: 12, want: 1},     // half a cent rounds away from zero
+		{m: -6, n: 12, want: -1},   // half a cent rounds away from zero
+		{m: -1000, n: 3, want: -333},
+		{m: 100, n: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.DivRound(tt.n); got != tt.want {
+			t.Errorf("Money(%d).DivRound(%d) = %d, want %d", int64(tt.m), tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var payload struct {
+		Amount Money `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 19.9}`), &payload); err != nil {
+		t.Fatalf("unmarshal number: %v", err)
+	}
+	if payload.Amount != 1990 {
+		t.Errorf("amount = %d, want 1990", payload.Amount)
+	}
+	if err := json.Unmarshal([]byte(`{"amount": "0.10"}`), &payload); err != nil || payload.Amount != 10 {
+		t.Errorf("unmarshal string: amount = %d, err = %v", payload.Amount, err)
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 1.005}`), &payload); err == nil {
+		t.Errorf("expected error for three decimal places")
+	}
+
+	out, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(out) != `{"amount":0.10}` {
+		t.Errorf("marshal = %s, want {\"amount\":0.10}", out)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Money
+	}{
+		{src: nil, want: 0},
+		{src: "12.34", want: 1234},
+		{src: []byte("0.10"), want: 10},
+		{src: "3.3333333333333333", want: 333}, // aggregates like AVG are rounded
+		{src: "0.005", want: 1},
+		{src: "-0.005", want: -1},
+		{src: int64(7), want: 700},
+		{src: float64(0.1) + float64(0.2), want: 30},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.src); err != nil {
+			t.Fatalf("Scan(%v) error: %v", tt.src, err)
+		}
+		if m != tt.want {
+			t.Errorf("Scan(%v) = %d, want %d", tt.src, m, tt.want)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(true); err == nil {
+		t.Errorf("expected error scanning bool")
+	}
+}
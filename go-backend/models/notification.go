@@ -0,0 +1,21 @@
+package models
+
+import "encoding/json"
+
+// Notification kinds
+const (
+	NotificationBudgetAlert     = "budget_alert"      // a budget reached its alert threshold or was used up
+	NotificationBudgetOverspent = "budget_overspent"  // a budget period ended over budget
+	NotificationRecurringPosted = "recurring_created" // the recurring job created transactions
+)
+
+// Notification is an entry in a user's in-app inbox.
+type Notification struct {
+	ID        int             `json:"id"`
+	Kind      string          `json:"kind"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data"`    // kind-specific details, e.g. budget_id
+	ReadAt    *string         `json:"read_at"` // nil while unread
+	CreatedAt string          `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// PersonalToken is a long-lived credential a user creates for scripts and integrations.
+// Only a hash of the token is stored; Prefix is its first characters, to tell tokens apart.
+type PersonalToken struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  string   `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"` // nil if never used
+	CreatedAt  string   `json:"created_at"`
+}
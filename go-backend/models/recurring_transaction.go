@@ -2,14 +2,38 @@ package models
 
 import "time"
 
+// Recurring transaction statuses
+const (
+	RecurringActive = "active"
+	RecurringPaused = "paused" // the processor creates nothing until the rule is resumed
+)
+
 type RecurringTransaction struct {
 	ID             int        `json:"id"`
+	LedgerID       int        `json:"ledger_id"`
 	UserID         int        `json:"user_id" validate:"required,gt=0"`
 	CategoryID     int        `json:"category_id" validate:"required,gt=0"`
-	Amount         float64    `json:"amount" validate:"required,gt=0"`
+	Amount         Money      `json:"amount" validate:"required,gt=0"`
+	Currency       string     `json:"currency"`   // ISO 4217 code, defaults to the user's base currency
+	AccountID      *int       `json:"account_id"` // the account its transactions are paid from or into, if any
 	Description    string     `json:"description" validate:"max=500"`
 	StartDate      string     `json:"start_date" validate:"required"`
 	Recurrence     string     `json:"recurrence" validate:"required,oneof=daily weekly monthly yearly"`
+	RRule          string     `json:"rrule"` // RFC 5545 recurrence rule, e.g. FREQ=MONTHLY;BYMONTHDAY=1,15
+	Status         string     `json:"status"`
+	Exceptions     []string   `json:"exceptions"` // occurrence dates (YYYY-MM-DD) that are skipped
+	NextDue        *string    `json:"next_due"`   // next occurrence to be created; nil when paused or ended
 	LastOccurrence *time.Time `json:"last_occurrence,omitempty"`
 	CreatedAt      string     `json:"created_at"`
 }
+
+// RecurringJobRun is one run of the recurring transaction processor.
+type RecurringJobRun struct {
+	ID                  int     `json:"id"`
+	StartedAt           string  `json:"started_at"`
+	FinishedAt          *string `json:"finished_at"` // nil while running, or if the run was interrupted
+	RulesProcessed      int     `json:"rules_processed"`
+	TransactionsCreated int     `json:"transactions_created"`
+	FailedRules         int     `json:"failed_rules"`
+	Error               string  `json:"error,omitempty"`
+}
@@ -0,0 +1,61 @@
+package models
+
+// Ways an expense can be split between members
+const (
+	SplitEqual      = "equal"      // everyone pays the same
+	SplitExact      = "exact"      // each participant's amount is given
+	SplitPercentage = "percentage" // each participant pays a percentage
+	SplitShares     = "shares"     // the amount is divided in proportion to each participant's shares
+)
+
+// SplitMethods lists the ways an expense can be split.
+var SplitMethods = []string{SplitEqual, SplitExact, SplitPercentage, SplitShares}
+
+// ExpenseSplit divides an expense between ledger members. Every participant other than the
+// payer owes the payer their part.
+type ExpenseSplit struct {
+	TransactionID int          `json:"transaction_id"`
+	PaidBy        int          `json:"paid_by"`
+	Method        string       `json:"method"`
+	Amount        Money        `json:"amount"`   // the expense's amount
+	Currency      string       `json:"currency"` // the expense's currency
+	Shares        []SplitShare `json:"shares"`
+	CreatedAt     string       `json:"created_at"`
+}
+
+// SplitShare is one participant's part of a split expense. For exact splits Amount is the
+// amount given for the participant.
+type SplitShare struct {
+	UserID     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Percentage string `json:"percentage,omitempty"` // percentage splits only, as a decimal ("33.33")
+	Shares     int    `json:"shares,omitempty"`     // share splits only
+	Amount     Money  `json:"amount"`
+}
+
+// Debt is an amount one member owes another.
+type Debt struct {
+	FromUserID   int    `json:"from_user_id"` // who owes
+	FromUsername string `json:"from_username"`
+	ToUserID     int    `json:"to_user_id"` // who is owed
+	ToUsername   string `json:"to_username"`
+	Amount       Money  `json:"amount"`
+	Currency     string `json:"currency"`
+}
+
+// Settlement is a payment from one member to another that pays back what they owe. It appears in
+// the ledger's history as an expense of the payer and an income of the member paid.
+type Settlement struct {
+	ID                   int    `json:"id"`
+	LedgerID             int    `json:"ledger_id"`
+	FromUserID           int    `json:"from_user_id"` // who paid
+	ToUserID             int    `json:"to_user_id"`   // who was paid
+	Amount               Money  `json:"amount"`
+	Currency             string `json:"currency"`
+	Date                 string `json:"date"`
+	Note                 string `json:"note"`
+	ExpenseTransactionID int    `json:"expense_transaction_id"` // the payer's expense
+	IncomeTransactionID  int    `json:"income_transaction_id"`  // the income of the member paid
+	CreatedBy            *int   `json:"created_by"`             // nil once the recording user has deleted their account
+	CreatedAt            string `json:"created_at"`
+}
@@ -1,13 +1,17 @@
 package models
 
 type Transaction struct {
-	ID           int     `json:"id"`
-	UserID       int     `json:"user_id" validate:"required,gt=0"`
-	CategoryID   int     `json:"category_id" validate:"required,gt=0"`
-	CategoryName string  `json:"category"`
-	CategoryType string  `json:"category_type"` // "income" or "expense"
-	Amount       float64 `json:"amount" validate:"required,gt=0"`
-	Description  string  `json:"description" validate:"max=500"`
-	Date         string  `json:"date" validate:"required"`
-	CreatedAt    string  `json:"created_at"`
+	ID           int    `json:"id"`
+	LedgerID     int    `json:"ledger_id"`
+	UserID       int    `json:"user_id" validate:"required,gt=0"`
+	CategoryID   int    `json:"category_id" validate:"required,gt=0"`
+	CategoryName string `json:"category"`
+	CategoryType string `json:"category_type"` // "income" or "expense"
+	Amount       Money  `json:"amount" validate:"required,gt=0"`
+	Currency     string `json:"currency"` // ISO 4217 code, defaults to the user's base currency
+	Description  string `json:"description" validate:"max=500"`
+	Date         string `json:"date" validate:"required"`
+	RecurringID  *int   `json:"recurring_id"` // the recurring transaction that created it, if any
+	AccountID    *int   `json:"account_id"`   // the account it was paid from or into, if any
+	CreatedAt    string `json:"created_at"`
 }
@@ -1,9 +1,13 @@
 package models
 
 type User struct {
-	ID        int    `json:"id"`
-	Username  string `json:"username" validate:"required,min=3,max=50"`
-	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password,omitempty" validate:"required,min=8"`
-	CreatedAt string `json:"created_at"`
+	ID               int    `json:"id"`
+	Username         string `json:"username" validate:"required,min=3,max=50"`
+	Email            string `json:"email" validate:"required,email"`
+	EmailVerified    bool   `json:"email_verified"`
+	Password         string `json:"password,omitempty" validate:"required,min=8"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	BaseCurrency     string `json:"base_currency"` // currency summaries and budgets are reported in
+	Timezone         string `json:"timezone"`      // IANA time zone that decides the user's "today"
+	CreatedAt        string `json:"created_at"`
 }
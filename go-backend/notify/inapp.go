@@ -0,0 +1,18 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vidya381/myspendo-backend/handlers"
+)
+
+// InAppNotifier stores notifications in the user's inbox (the notifications table).
+type InAppNotifier struct {
+	DB *sql.DB
+}
+
+// Notify adds the notification to the user's inbox.
+func (a InAppNotifier) Notify(ctx context.Context, n Notification) error {
+	return handlers.AddNotification(ctx, a.DB, n.UserID, n.Kind, n.Title, n.Body, n.Data)
+}
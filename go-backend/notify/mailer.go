@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Email is a plain-text message to one address, such as an email verification or password reset link.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+	Date    time.Time // defaults to the time of sending
+}
+
+// Mailer sends transactional email. Unlike notifications, these messages are addressed by email
+// rather than by user, since they may go to an address that isn't verified yet.
+type Mailer interface {
+	Send(ctx context.Context, e Email) error
+}
+
+// ErrMailDisabled is returned by DisabledMailer.
+var ErrMailDisabled = errors.New("account email is not configured")
+
+// DisabledMailer is the Mailer used when neither SMTP nor an outbox is configured. It sends nothing,
+// so links in account email are never exposed anywhere else.
+type DisabledMailer struct{}
+
+// Send always returns ErrMailDisabled.
+func (DisabledMailer) Send(ctx context.Context, e Email) error {
+	return ErrMailDisabled
+}
+
+// OutboxMailer is a Mailer for local development: instead of delivering messages it writes each one
+// to a file in Dir. Message bodies carry sign-in links, so they are never logged.
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+var outboxSeq atomic.Int64
+
+// Send writes the email to the outbox. Returns ErrNoRecipient if it has no address.
+func (o OutboxMailer) Send(ctx context.Context, e Email) error {
+	if e.To == "" {
+		return ErrNoRecipient
+	}
+	if o.Dir == "" {
+		return fmt.Errorf("outbox directory is not set")
+	}
+
+	if err := os.MkdirAll(o.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create outbox: %w", err)
+	}
+	name := fmt.Sprintf("%s-%d-%s.eml", time.Now().UTC().Format("20060102T150405"), outboxSeq.Add(1), outboxName(e.To))
+	path := filepath.Join(o.Dir, name)
+	if err := os.WriteFile(path, buildEmail(o.From, e), 0o600); err != nil {
+		return fmt.Errorf("failed to write outbox email: %w", err)
+	}
+	slog.Info("Outbox email written", "to", e.To, "subject", e.Subject, "path", path)
+	return nil
+}
+
+// outboxName turns an address into a safe file name component.
+func outboxName(addr string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '@', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, addr)
+}
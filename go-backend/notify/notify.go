@@ -0,0 +1,53 @@
+// Package notify delivers user notifications (such as budget alerts) through pluggable channels:
+// SMTP email, a generic webhook and the in-app inbox. It also provides Mailer, which sends
+// transactional email such as verification and password reset links.
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Notification is a message for one user.
+type Notification struct {
+	UserID    int            `json:"user_id"`
+	Email     string         `json:"-"`    // recipient address for email delivery
+	Kind      string         `json:"kind"` // one of the models.Notification* kinds
+	Title     string         `json:"title"`
+	Body      string         `json:"body"`
+	Data      map[string]any `json:"data,omitempty"` // kind-specific details, e.g. budget_id
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Notifier delivers a notification through one channel.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// ErrNoRecipient is returned by channels that cannot address the notification's user.
+var ErrNoRecipient = errors.New("notification has no recipient for this channel")
+
+type multi []Notifier
+
+// Multi returns a Notifier that delivers through every channel, attempting all of them even
+// when some fail, and returns the failures joined.
+func Multi(notifiers ...Notifier) Notifier {
+	return multi(notifiers)
+}
+
+func (m multi) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// headerSafe removes line breaks so user-controlled text cannot inject mail headers.
+func headerSafe(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,255 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vidya381/myspendo-backend/models"
+)
+
+var testNotification = Notification{
+	UserID: 7,
+	Email:  "sam@example.com",
+	Kind:   models.NotificationBudgetAlert,
+	Title:  "Groceries budget at 85%",
+	Body:   "You've spent 425.00 of 500.00.\nStay on track!",
+	Data:   map[string]any{"budget_id": 3},
+}
+
+// smtpStandIn accepts one SMTP session on a local port and reports the envelope and message.
+type smtpStandIn struct {
+	addr    string
+	from    string
+	to      string
+	message string
+	done    chan struct{}
+}
+
+func startSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &smtpStandIn{addr: ln.Addr().String(), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP stand-in")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				s.from = strings.Trim(strings.TrimPrefix(cmd, "MAIL FROM:"), "<>")
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				s.to = strings.Trim(strings.TrimPrefix(cmd, "RCPT TO:"), "<>")
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var msg strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					msg.WriteString(l)
+				}
+				s.message = msg.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return s
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	server := startSMTPStandIn(t)
+	notifier := SMTPNotifier{Addr: server.addr, From: "alerts@myspendo.test"}
+
+	if err := notifier.Notify(context.Background(), testNotification); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	<-server.done
+
+	if server.from != "alerts@myspendo.test" || server.to != "sam@example.com" {
+		t.Errorf("envelope = %q -> %q", server.from, server.to)
+	}
+	for _, want := range []string{
+		"To: sam@example.com\r\n",
+		"Subject: Groceries budget at 85%\r\n",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"You've spent 425.00 of 500.00.\r\nStay on track!\r\n",
+	} {
+		if !strings.Contains(server.message, want) {
+			t.Errorf("message missing %q:\n%s", want, server.message)
+		}
+	}
+}
+
+func TestSMTPNotifierWithoutEmail(t *testing.T) {
+	n := testNotification
+	n.Email = ""
+	if err := (SMTPNotifier{Addr: "127.0.0.1:1"}).Notify(context.Background(), n); err != ErrNoRecipient {
+		t.Errorf("err = %v, want ErrNoRecipient", err)
+	}
+}
+
+func TestBuildMessageStripsHeaderInjection(t *testing.T) {
+	n := testNotification
+	n.Title = "Alert\r\nBcc: victim@example.com"
+	msg := string(buildMessage("alerts@myspendo.test", n))
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Errorf("title injected a header:\n%s", msg)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notifier := WebhookNotifier{URL: server.URL, Secret: "s3cret"}
+	if err := notifier.Notify(context.Background(), testNotification); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if payload["kind"] != models.NotificationBudgetAlert || payload["user_id"] != float64(7) {
+		t.Errorf("payload = %v", payload)
+	}
+	if _, ok := payload["Email"]; ok || strings.Contains(string(body), "sam@example.com") {
+		t.Error("webhook payload must not include the user's email")
+	}
+	if signature != "sha256="+Sign("s3cret", body) {
+		t.Errorf("signature = %q", signature)
+	}
+}
+
+func TestWebhookNotifierRejectsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	if err := (WebhookNotifier{URL: server.URL}).Notify(context.Background(), testNotification); err == nil {
+		t.Error("expected an error for a 502 response")
+	}
+}
+
+type recordingNotifier struct {
+	err   error
+	calls int
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n Notification) error {
+	r.calls++
+	return r.err
+}
+
+func TestMultiDeliversToEveryChannel(t *testing.T) {
+	failing := &recordingNotifier{err: errors.New("smtp down")}
+	ok := &recordingNotifier{}
+
+	err := Multi(failing, ok).Notify(context.Background(), testNotification)
+	if err == nil || !strings.Contains(err.Error(), "smtp down") {
+		t.Errorf("err = %v, want the failing channel's error", err)
+	}
+	if failing.calls != 1 || ok.calls != 1 {
+		t.Errorf("calls = %d, %d; want every channel attempted once", failing.calls, ok.calls)
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := startSMTPStandIn(t)
+	mailer := SMTPMailer{Addr: server.addr, From: "no-reply@myspendo.test"}
+
+	err := mailer.Send(context.Background(), Email{To: "new@example.com", Subject: "Verify your email", Body: "Open this link"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	<-server.done
+
+	if server.from != "no-reply@myspendo.test" || server.to != "new@example.com" {
+		t.Errorf("envelope = %q -> %q", server.from, server.to)
+	}
+	if !strings.Contains(server.message, "Subject: Verify your email\r\n") {
+		t.Errorf("message missing subject:\n%s", server.message)
+	}
+}
+
+func TestOutboxMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := OutboxMailer{Dir: dir, From: "no-reply@myspendo.test"}
+
+	if err := mailer.Send(context.Background(), Email{To: "sam@example.com", Subject: "Reset", Body: "token=abc"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := mailer.Send(context.Background(), Email{To: "../sam@example.com", Subject: "Reset", Body: "token=def"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("outbox files = %v, %v; want 2", files, err)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: sam@example.com\r\n") || !strings.Contains(string(data), "token=abc") {
+		t.Errorf("outbox email:\n%s", data)
+	}
+	if err := mailer.Send(context.Background(), Email{Subject: "No one"}); err != ErrNoRecipient {
+		t.Errorf("err = %v, want ErrNoRecipient", err)
+	}
+	if err := (OutboxMailer{}).Send(context.Background(), Email{To: "sam@example.com", Body: "token=ghi"}); err == nil {
+		t.Error("outbox without a directory: err = nil")
+	}
+}
+
+func TestDisabledMailer(t *testing.T) {
+	if err := (DisabledMailer{}).Send(context.Background(), Email{To: "sam@example.com", Body: "token=abc"}); err != ErrMailDisabled {
+		t.Errorf("err = %v, want ErrMailDisabled", err)
+	}
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier emails notifications to the user's address through an SMTP server.
+// STARTTLS is used whenever the server offers it.
+type SMTPNotifier struct {
+	Addr string    // host:port of the SMTP server
+	From string    // sender address
+	Auth smtp.Auth // nil for servers that don't require authentication
+}
+
+// Notify sends the notification as a plain-text email. Returns ErrNoRecipient if it has no email address.
+func (s SMTPNotifier) Notify(ctx context.Context, n Notification) error {
+	if n.Email == "" {
+		return ErrNoRecipient
+	}
+	return sendMail(ctx, s.Addr, s.From, s.Auth, n.Email, buildMessage(s.From, n))
+}
+
+// SMTPMailer sends transactional email through an SMTP server, like SMTPNotifier.
+type SMTPMailer struct {
+	Addr string    // host:port of the SMTP server
+	From string    // sender address
+	Auth smtp.Auth // nil for servers that don't require authentication
+}
+
+// Send delivers the email. Returns ErrNoRecipient if it has no address.
+func (s SMTPMailer) Send(ctx context.Context, e Email) error {
+	if e.To == "" {
+		return ErrNoRecipient
+	}
+	return sendMail(ctx, s.Addr, s.From, s.Auth, e.To, buildEmail(s.From, e))
+}
+
+// sendMail delivers one message in its own SMTP session, using STARTTLS when the server offers it.
+func sendMail(ctx context.Context, addr, from string, auth smtp.Auth, to string, msg []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address: %w", err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO failed: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return c.Quit()
+}
+
+// buildMessage formats a notification as an RFC 5322 plain-text message.
+func buildMessage(from string, n Notification) []byte {
+	return buildEmail(from, Email{To: n.Email, Subject: n.Title, Body: n.Body, Date: n.CreatedAt})
+}
+
+// buildEmail formats an email as an RFC 5322 plain-text message.
+func buildEmail(from string, e Email) []byte {
+	date := e.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerSafe(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", headerSafe(e.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerSafe(e.Subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	body := strings.ReplaceAll(e.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
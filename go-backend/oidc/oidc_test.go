@@ -0,0 +1,175 @@
+package oidc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vidya381/myspendo-backend/oidc/oidctest"
+)
+
+var testUser = oidctest.User{
+	Subject:           "user-123",
+	Email:             "jane@example.com",
+	EmailVerified:     true,
+	Name:              "Jane Doe",
+	PreferredUsername: "jane",
+}
+
+func newTestProvider(t *testing.T, secret string) (*oidctest.Server, *Provider) {
+	t.Helper()
+	idp := oidctest.NewServer("myspendo", secret, testUser)
+	t.Cleanup(idp.Close)
+	p := NewProvider(Config{
+		Issuer:       idp.URL,
+		ClientID:     "myspendo",
+		ClientSecret: secret,
+		RedirectURL:  "http://localhost:3000/auth/callback",
+	}, nil)
+	return idp, p
+}
+
+// login runs the browser part of the flow and returns the authorization code.
+func login(t *testing.T, p *Provider, state, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	back, err := oidctest.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if got := back.Query().Get("state"); got != state {
+		t.Fatalf("state = %q, want %q", got, state)
+	}
+	if e := back.Query().Get("error"); e != "" {
+		t.Fatalf("authorization error %q", e)
+	}
+	return back.Query().Get("code")
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636, appendix B
+	got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("Challenge = %q, want %q", got, want)
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	for _, secret := range []string{"", "s3cret"} {
+		_, p := newTestProvider(t, secret)
+		ctx := context.Background()
+
+		verifier, err := NewVerifier()
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := login(t, p, "state-1", "nonce-1", verifier)
+
+		raw, err := p.Exchange(ctx, code, verifier)
+		if err != nil {
+			t.Fatalf("Exchange (secret %q): %v", secret, err)
+		}
+		claims, err := p.Verify(ctx, raw, "nonce-1")
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		want := Claims{
+			Issuer:            p.Issuer(),
+			Subject:           testUser.Subject,
+			Email:             testUser.Email,
+			EmailVerified:     true,
+			Name:              testUser.Name,
+			PreferredUsername: testUser.PreferredUsername,
+		}
+		if claims != want {
+			t.Errorf("claims = %+v, want %+v", claims, want)
+		}
+
+		if _, err := p.Exchange(ctx, code, verifier); err == nil {
+			t.Error("an authorization code must only work once")
+		}
+	}
+}
+
+func TestExchangeRequiresVerifier(t *testing.T) {
+	_, p := newTestProvider(t, "")
+	verifier, _ := NewVerifier()
+	code := login(t, p, "state", "nonce", verifier)
+
+	other, _ := NewVerifier()
+	if _, err := p.Exchange(context.Background(), code, other); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Exchange with the wrong verifier = %v, want invalid_grant", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	idp, p := newTestProvider(t, "")
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		nonce  string
+	}{
+		{name: "wrong nonce", claims: jwt.MapClaims{"sub": "u", "nonce": "other"}, nonce: "nonce"},
+		{name: "missing nonce", claims: jwt.MapClaims{"sub": "u"}, nonce: "nonce"},
+		{name: "other audience", claims: jwt.MapClaims{"sub": "u", "nonce": "nonce", "aud": "someone-else"}, nonce: "nonce"},
+		{name: "other issuer", claims: jwt.MapClaims{"sub": "u", "nonce": "nonce", "iss": "https://evil.example.com"}, nonce: "nonce"},
+		{name: "expired", claims: jwt.MapClaims{"sub": "u", "nonce": "nonce", "exp": now.Add(-time.Hour).Unix()}, nonce: "nonce"},
+		{name: "no subject", claims: jwt.MapClaims{"nonce": "nonce"}, nonce: "nonce"},
+		{name: "issued to another client", claims: jwt.MapClaims{"sub": "u", "nonce": "nonce", "aud": []string{"myspendo", "other"}, "azp": "other"}, nonce: "nonce"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := idp.SignIDToken(tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.Verify(ctx, raw, tt.nonce); err == nil {
+				t.Error("Verify accepted the token")
+			}
+		})
+	}
+
+	t.Run("tampered signature", func(t *testing.T) {
+		raw, _ := idp.SignIDToken(jwt.MapClaims{"sub": "u", "nonce": "nonce"})
+		forged, _ := idp.SignIDToken(jwt.MapClaims{"sub": "admin", "nonce": "nonce"})
+		sig := raw[strings.LastIndex(raw, "."):]
+		if _, err := p.Verify(ctx, forged[:strings.LastIndex(forged, ".")]+sig, "nonce"); err == nil {
+			t.Error("Verify accepted a token with another token's signature")
+		}
+	})
+}
+
+func TestVerifyAfterKeyRotation(t *testing.T) {
+	idp, p := newTestProvider(t, "")
+	ctx := context.Background()
+
+	raw, _ := idp.SignIDToken(jwt.MapClaims{"sub": "u", "nonce": "n", "email_verified": "true"})
+	claims, err := p.Verify(ctx, raw, "n")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !claims.EmailVerified {
+		t.Error(`email_verified "true" should count as verified`)
+	}
+
+	// The new key is unknown until the key set is refetched, which is rate limited
+	idp.RotateKey()
+	raw, _ = idp.SignIDToken(jwt.MapClaims{"sub": "u", "nonce": "n"})
+	if _, err := p.Verify(ctx, raw, "n"); err == nil {
+		t.Fatal("Verify accepted a token signed with a key fetched less than a minute ago")
+	}
+	p.mu.Lock()
+	p.keysFetched = time.Now().Add(-keyRefreshInterval)
+	p.mu.Unlock()
+	if _, err := p.Verify(ctx, raw, "n"); err != nil {
+		t.Errorf("Verify after the provider rotated its key: %v", err)
+	}
+}
@@ -0,0 +1,566 @@
+// Package rrule parses and evaluates the subset of RFC 5545 recurrence rules (RRULE) used for
+// recurring transactions. Occurrences are calendar dates; times of day are ignored.
+//
+// Supported parts: FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, COUNT, UNTIL, BYDAY
+// (with ordinals such as 1MO or -1FR in MONTHLY and YEARLY rules), BYMONTHDAY (negative values
+// count from the end of the month), BYMONTH, BYSETPOS and WKST. Examples:
+//
+//	FREQ=WEEKLY;INTERVAL=2                       every other week
+//	FREQ=MONTHLY;BYMONTHDAY=1,15                 the 1st and 15th
+//	FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1 the last business day of the month
+//	FREQ=MONTHLY;COUNT=12                        twelve monthly payments
+//
+// One deliberate difference from RFC 5545: a MONTHLY or YEARLY rule without BYDAY or BYMONTHDAY
+// repeats on the start date's day, moved to the last day of shorter months (Jan 31 -> Feb 28)
+// instead of skipping those months.
+package rrule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the unit a rule repeats in.
+type Frequency int
+
+const (
+	Daily Frequency = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencyNames = []string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}
+
+func (f Frequency) String() string {
+	return frequencyNames[f]
+}
+
+// Limits on rule parts, to keep evaluation bounded.
+const (
+	MaxInterval = 1000
+	MaxCount    = 10000
+
+	// maxEmptyPeriods stops a rule that can never match again (e.g. BYMONTH=2;BYMONTHDAY=30)
+	maxEmptyPeriods = 1000
+)
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// WeekdayNum is a BYDAY entry: a weekday and an optional ordinal within the month or year
+// (1 for the first, -1 for the last, 0 for every such weekday).
+type WeekdayNum struct {
+	Weekday time.Weekday
+	N       int
+}
+
+func (w WeekdayNum) String() string {
+	if w.N == 0 {
+		return weekdayNames[w.Weekday]
+	}
+	return strconv.Itoa(w.N) + weekdayNames[w.Weekday]
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq       Frequency
+	Interval   int       // repeat every Interval units; at least 1
+	Count      int       // total number of occurrences; 0 for no limit
+	Until      time.Time // last possible occurrence date (inclusive); zero for no end
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	BySetPos   []int
+	WeekStart  time.Weekday // WKST, Monday unless set
+}
+
+// Simple returns the rule that repeats every day, week, month or year.
+func Simple(freq Frequency) Rule {
+	return Rule{Freq: freq, Interval: 1, WeekStart: time.Monday}
+}
+
+// ParseFrequency parses "daily", "weekly", "monthly" or "yearly" (any case).
+func ParseFrequency(s string) (Frequency, error) {
+	for i, name := range frequencyNames {
+		if strings.EqualFold(s, name) {
+			return Frequency(i), nil
+		}
+	}
+	return 0, fmt.Errorf("frequency must be daily, weekly, monthly or yearly")
+}
+
+// Parse parses an RRULE value such as "FREQ=MONTHLY;BYMONTHDAY=1,15". A leading "RRULE:" is allowed.
+func Parse(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 6 && strings.EqualFold(s[:6], "RRULE:") {
+		s = s[6:]
+	}
+	if s == "" {
+		return Rule{}, fmt.Errorf("rule is empty")
+	}
+
+	r := Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	hasFreq := false
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || key == "" || value == "" {
+			return Rule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[key] {
+			return Rule{}, fmt.Errorf("%s is given more than once", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			r.Freq, err = ParseFrequency(value)
+			hasFreq = err == nil
+		case "INTERVAL":
+			r.Interval, err = parseInt(value, 1, MaxInterval)
+		case "COUNT":
+			r.Count, err = parseInt(value, 1, MaxCount)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseIntList(value, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseIntList(value, 1, 12)
+			for _, m := range months {
+				r.ByMonth = append(r.ByMonth, time.Month(m))
+			}
+		case "BYSETPOS":
+			r.BySetPos, err = parseIntList(value, -366, 366)
+		case "WKST":
+			day, ok := weekdayCodes[value]
+			if !ok {
+				err = fmt.Errorf("must be a weekday code such as MO")
+			}
+			r.WeekStart = day
+		default:
+			return Rule{}, fmt.Errorf("%s is not supported", key)
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	if !hasFreq {
+		return Rule{}, fmt.Errorf("FREQ is required")
+	}
+	if err := r.Validate(); err != nil {
+		return Rule{}, err
+	}
+	return r, nil
+}
+
+// Validate checks combinations of parts that the evaluator doesn't support or that RFC 5545 forbids.
+func (r Rule) Validate() error {
+	if r.Interval < 1 || r.Interval > MaxInterval {
+		return fmt.Errorf("INTERVAL must be between 1 and %d", MaxInterval)
+	}
+	if r.Count < 0 || r.Count > MaxCount {
+		return fmt.Errorf("COUNT must be between 1 and %d", MaxCount)
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return fmt.Errorf("COUNT and UNTIL cannot both be set")
+	}
+	if r.Freq == Weekly && len(r.ByMonthDay) > 0 {
+		return fmt.Errorf("BYMONTHDAY cannot be used with FREQ=WEEKLY")
+	}
+	for _, d := range r.ByMonthDay {
+		if d == 0 {
+			return fmt.Errorf("BYMONTHDAY values must not be 0")
+		}
+	}
+	for _, p := range r.BySetPos {
+		if p == 0 {
+			return fmt.Errorf("BYSETPOS values must not be 0")
+		}
+	}
+	for _, wd := range r.ByDay {
+		if wd.N == 0 {
+			continue
+		}
+		if r.Freq != Monthly && r.Freq != Yearly {
+			return fmt.Errorf("BYDAY ordinals such as %s need FREQ=MONTHLY or FREQ=YEARLY", wd)
+		}
+		if r.Freq == Yearly && len(r.ByMonth) == 0 {
+			return fmt.Errorf("BYDAY ordinals in a yearly rule need BYMONTH")
+		}
+		if wd.N < -5 || wd.N > 5 {
+			return fmt.Errorf("BYDAY ordinals must be between -5 and 5")
+		}
+	}
+	if len(r.BySetPos) > 0 && len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 && len(r.ByMonth) == 0 {
+		return fmt.Errorf("BYSETPOS needs BYDAY, BYMONTHDAY or BYMONTH")
+	}
+	return nil
+}
+
+// IsSimple reports whether the rule just repeats every day, week, month or year, forever.
+func (r Rule) IsSimple() bool {
+	return r.Interval == 1 && r.Count == 0 && r.Until.IsZero() && len(r.ByDay) == 0 &&
+		len(r.ByMonthDay) == 0 && len(r.ByMonth) == 0 && len(r.BySetPos) == 0
+}
+
+// String returns the rule in canonical RRULE form (without the "RRULE:" prefix).
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq.String()}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = strconv.Itoa(int(m))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.BySetPos) > 0 {
+		parts = append(parts, "BYSETPOS="+joinInts(r.BySetPos))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// Iterator yields a rule's occurrences in order.
+type Iterator struct {
+	rule    Rule
+	start   time.Time
+	period  int // index of the next period to expand
+	pending []time.Time
+	emitted int
+	done    bool
+}
+
+// Iter returns an iterator over the rule's occurrences on or after start (the rule's DTSTART).
+func (r Rule) Iter(start time.Time) *Iterator {
+	return &Iterator{rule: r, start: dateOf(start)}
+}
+
+// Next returns the next occurrence, or false once the rule has ended.
+func (it *Iterator) Next() (time.Time, bool) {
+	empty := 0
+	for !it.done {
+		if len(it.pending) > 0 {
+			t := it.pending[0]
+			it.pending = it.pending[1:]
+			if !it.rule.Until.IsZero() && t.After(it.rule.Until) {
+				it.done = true
+				break
+			}
+			it.emitted++
+			if it.rule.Count > 0 && it.emitted >= it.rule.Count {
+				it.done = true
+			}
+			return t, true
+		}
+
+		periodStart, candidates := it.rule.expand(it.start, it.period)
+		it.period++
+		if !it.rule.Until.IsZero() && periodStart.After(it.rule.Until) {
+			it.done = true
+			break
+		}
+		for _, c := range candidates {
+			if !c.Before(it.start) {
+				it.pending = append(it.pending, c)
+			}
+		}
+		if len(it.pending) == 0 {
+			if empty++; empty > maxEmptyPeriods {
+				it.done = true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Between returns the occurrences from start (DTSTART) that fall within [from, to], at most limit of them.
+func (r Rule) Between(start, from, to time.Time, limit int) []time.Time {
+	from, to = dateOf(from), dateOf(to)
+	var dates []time.Time
+	it := r.Iter(start)
+	for len(dates) < limit {
+		t, ok := it.Next()
+		if !ok || t.After(to) {
+			break
+		}
+		if !t.Before(from) {
+			dates = append(dates, t)
+		}
+	}
+	return dates
+}
+
+// expand returns the first day of the n-th period after start (counting INTERVAL) and the
+// occurrences in it, sorted, before filtering by start, UNTIL and COUNT.
+func (r Rule) expand(start time.Time, n int) (time.Time, []time.Time) {
+	var periodStart time.Time
+	var days []time.Time
+
+	switch r.Freq {
+	case Daily:
+		periodStart = start.AddDate(0, 0, n*r.Interval)
+		if r.matchesDay(periodStart) {
+			days = []time.Time{periodStart}
+		}
+	case Weekly:
+		offset := (int(start.Weekday()) - int(r.WeekStart) + 7) % 7
+		periodStart = start.AddDate(0, 0, -offset+7*n*r.Interval)
+		for i := 0; i < 7; i++ {
+			d := periodStart.AddDate(0, 0, i)
+			if len(r.ByDay) == 0 && d.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchesDay(d) {
+				days = append(days, d)
+			}
+		}
+	case Monthly:
+		periodStart = time.Date(start.Year(), start.Month()+time.Month(n*r.Interval), 1, 0, 0, 0, 0, time.UTC)
+		if len(r.ByMonth) == 0 || containsMonth(r.ByMonth, periodStart.Month()) {
+			days = r.monthDays(periodStart, start)
+		}
+	case Yearly:
+		periodStart = time.Date(start.Year()+n*r.Interval, 1, 1, 0, 0, 0, 0, time.UTC)
+		months := r.ByMonth
+		if len(months) == 0 {
+			if len(r.ByDay) > 0 || len(r.ByMonthDay) > 0 {
+				months = []time.Month{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+			} else {
+				months = []time.Month{start.Month()}
+			}
+		}
+		sorted := append([]time.Month(nil), months...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		for _, m := range sorted {
+			days = append(days, r.monthDays(time.Date(periodStart.Year(), m, 1, 0, 0, 0, 0, time.UTC), start)...)
+		}
+	}
+	return periodStart, r.applySetPos(days)
+}
+
+// matchesDay applies BYMONTH, BYMONTHDAY and BYDAY (without ordinals) as filters on a single day,
+// as they act in DAILY and WEEKLY rules.
+func (r Rule) matchesDay(d time.Time) bool {
+	if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, d.Month()) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 && !matchesMonthDay(r.ByMonthDay, d) {
+		return false
+	}
+	if len(r.ByDay) > 0 {
+		for _, wd := range r.ByDay {
+			if wd.Weekday == d.Weekday() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// monthDays returns the sorted days of the month starting at first selected by BYMONTHDAY and
+// BYDAY (their intersection when both are set), or start's day of the month when neither is.
+func (r Rule) monthDays(first, start time.Time) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+		return []time.Time{first.AddDate(0, 0, min(start.Day(), last)-1)}
+	}
+
+	selected := make([]bool, last+1)
+	if len(r.ByMonthDay) > 0 {
+		for _, v := range r.ByMonthDay {
+			if day := monthDay(v, last); day >= 1 && day <= last {
+				selected[day] = true
+			}
+		}
+	}
+	if len(r.ByDay) > 0 {
+		byDay := make([]bool, last+1)
+		for _, wd := range r.ByDay {
+			var matches []int
+			for day := 1; day <= last; day++ {
+				if first.AddDate(0, 0, day-1).Weekday() == wd.Weekday {
+					matches = append(matches, day)
+				}
+			}
+			switch {
+			case wd.N == 0:
+				for _, day := range matches {
+					byDay[day] = true
+				}
+			case wd.N > 0 && wd.N <= len(matches):
+				byDay[matches[wd.N-1]] = true
+			case wd.N < 0 && -wd.N <= len(matches):
+				byDay[matches[len(matches)+wd.N]] = true
+			}
+		}
+		if len(r.ByMonthDay) > 0 {
+			for day := range selected {
+				selected[day] = selected[day] && byDay[day]
+			}
+		} else {
+			selected = byDay
+		}
+	}
+
+	var days []time.Time
+	for day := 1; day <= last; day++ {
+		if selected[day] {
+			days = append(days, first.AddDate(0, 0, day-1))
+		}
+	}
+	return days
+}
+
+// applySetPos keeps the BYSETPOS-th entries of a period's sorted occurrences.
+func (r Rule) applySetPos(days []time.Time) []time.Time {
+	if len(r.BySetPos) == 0 || len(days) == 0 {
+		return days
+	}
+	keep := make([]bool, len(days))
+	for _, pos := range r.BySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(days) + pos
+		}
+		if i >= 0 && i < len(days) {
+			keep[i] = true
+		}
+	}
+	var kept []time.Time
+	for i, d := range days {
+		if keep[i] {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+func monthDay(v, last int) int {
+	if v < 0 {
+		return last + v + 1
+	}
+	return v
+}
+
+func matchesMonthDay(values []int, d time.Time) bool {
+	last := time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, v := range values {
+		if monthDay(v, last) == d.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMonth(months []time.Month, m time.Month) bool {
+	for _, month := range months {
+		if month == m {
+			return true
+		}
+	}
+	return false
+}
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func parseInt(s string, lo, hi int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("must be a number between %d and %d", lo, hi)
+	}
+	return n, nil
+}
+
+func parseIntList(s string, lo, hi int) ([]int, error) {
+	var values []int
+	for _, item := range strings.Split(s, ",") {
+		n, err := parseInt(strings.TrimSpace(item), lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+func joinInts(values []int) string {
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = strconv.Itoa(v)
+	}
+	return strings.Join(items, ",")
+}
+
+// parseUntil accepts a date (20250131) or an RFC 5545 date-time (20250131T000000Z); the time is ignored.
+func parseUntil(s string) (time.Time, error) {
+	if len(s) < 8 {
+		return time.Time{}, fmt.Errorf("must be a date such as 20251231")
+	}
+	t, err := time.Parse("20060102", s[:8])
+	if err != nil || (len(s) > 8 && s[8] != 'T') {
+		return time.Time{}, fmt.Errorf("must be a date such as 20251231")
+	}
+	return t, nil
+}
+
+func parseByDay(s string) ([]WeekdayNum, error) {
+	var days []WeekdayNum
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) < 2 {
+			return nil, fmt.Errorf("%q is not a weekday such as MO or -1FR", item)
+		}
+		day, ok := weekdayCodes[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("%q is not a weekday such as MO or -1FR", item)
+		}
+		wd := WeekdayNum{Weekday: day}
+		if prefix := item[:len(item)-2]; prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("%q has an invalid ordinal", item)
+			}
+			wd.N = n
+		}
+		days = append(days, wd)
+	}
+	return days, nil
+}
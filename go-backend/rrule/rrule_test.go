@@ -0,0 +1,120 @@
+package rrule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParseDate(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// first returns the first n occurrences of rule from start, formatted as dates.
+func first(t *testing.T, rule, start string, n int) []string {
+	t.Helper()
+	r, err := Parse(rule)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", rule, err)
+	}
+	var dates []string
+	it := r.Iter(mustParseDate(start))
+	for len(dates) < n {
+		d, ok := it.Next()
+		if !ok {
+			break
+		}
+		dates = append(dates, d.Format("2006-01-02"))
+	}
+	return dates
+}
+
+func TestOccurrences(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		start string
+		want  string
+		ends  bool
+	}{
+		{name: "daily", rule: "FREQ=DAILY", start: "2025-02-27", want: "2025-02-27 2025-02-28 2025-03-01"},
+		{name: "every other week", rule: "FREQ=WEEKLY;INTERVAL=2", start: "2025-03-05", want: "2025-03-05 2025-03-19 2025-04-02"},
+		{name: "weekdays of a week", rule: "FREQ=WEEKLY;BYDAY=TU,TH", start: "2025-03-06", want: "2025-03-06 2025-03-11 2025-03-13 2025-03-18"},
+		{name: "monthly keeps the start day", rule: "FREQ=MONTHLY", start: "2025-01-31", want: "2025-01-31 2025-02-28 2025-03-31 2025-04-30"},
+		{name: "1st and 15th", rule: "FREQ=MONTHLY;BYMONTHDAY=1,15", start: "2025-01-10", want: "2025-01-15 2025-02-01 2025-02-15 2025-03-01"},
+		{name: "last day of month", rule: "FREQ=MONTHLY;BYMONTHDAY=-1", start: "2024-01-05", want: "2024-01-31 2024-02-29 2024-03-31"},
+		{name: "last business day", rule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", start: "2025-05-01", want: "2025-05-30 2025-06-30 2025-07-31 2025-08-29"},
+		{name: "second Tuesday", rule: "FREQ=MONTHLY;BYDAY=2TU", start: "2025-01-01", want: "2025-01-14 2025-02-11 2025-03-11"},
+		{name: "quarterly", rule: "FREQ=MONTHLY;INTERVAL=3", start: "2025-01-15", want: "2025-01-15 2025-04-15 2025-07-15"},
+		{name: "yearly on Feb 29", rule: "FREQ=YEARLY", start: "2024-02-29", want: "2024-02-29 2025-02-28 2026-02-28 2027-02-28 2028-02-29"},
+		{name: "yearly in chosen months", rule: "FREQ=YEARLY;BYMONTH=1,7;BYMONTHDAY=1", start: "2025-03-01", want: "2025-07-01 2026-01-01 2026-07-01"},
+		{name: "count", rule: "FREQ=MONTHLY;COUNT=2", start: "2025-01-01", want: "2025-01-01 2025-02-01", ends: true},
+		{name: "until is inclusive", rule: "FREQ=WEEKLY;UNTIL=20250315", start: "2025-03-01", want: "2025-03-01 2025-03-08 2025-03-15", ends: true},
+		{name: "never matches", rule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", start: "2025-01-01", want: "", ends: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := strings.Fields(tt.want)
+			n := len(want)
+			if tt.ends {
+				n += 2 // nothing may follow the expected occurrences
+			}
+			got := first(t, tt.rule, tt.start, n)
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCountIncludesOccurrencesBeforeLaterStart(t *testing.T) {
+	r, _ := Parse("FREQ=DAILY;COUNT=3")
+	got := r.Between(mustParseDate("2025-01-01"), mustParseDate("2025-01-02"), mustParseDate("2025-01-31"), 10)
+	if len(got) != 2 || got[1].Format("2006-01-02") != "2025-01-03" {
+		t.Errorf("Between = %v, want Jan 2 and Jan 3", got)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=3;UNTIL=20250101",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=YEARLY;BYDAY=-1FR",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYSETPOS=1",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=MONTHLY;UNTIL=2025-01-01",
+		"FREQ=MONTHLY;BYHOUR=9",
+	} {
+		if _, err := Parse(rule); err == nil {
+			t.Errorf("Parse(%q) should fail", rule)
+		}
+	}
+}
+
+func TestStringRoundTrips(t *testing.T) {
+	r, err := Parse("rrule:freq=monthly;byday=mo,tu,we,th,fr;bysetpos=-1;until=20261231T000000Z;interval=2")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := "FREQ=MONTHLY;INTERVAL=2;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;UNTIL=20261231"
+	if got := r.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if again, err := Parse(r.String()); err != nil || again.String() != want {
+		t.Errorf("round trip = %q, %v", again.String(), err)
+	}
+	if Simple(Weekly).String() != "FREQ=WEEKLY" || !Simple(Weekly).IsSimple() {
+		t.Error("Simple(Weekly) should be the plain weekly rule")
+	}
+}
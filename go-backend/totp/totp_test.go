@@ -0,0 +1,78 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors of RFC 6238, appendix B.
+func TestRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		if got := hotp(key, Counter(time.Unix(tt.unix, 0)), 8); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	code, err := Code(secret, now)
+	if err != nil || code != "081804" {
+		t.Fatalf("Code = %q, %v; want 081804", code, err)
+	}
+
+	if step, ok := Validate(secret, code, now, 1); !ok || step != Counter(now) {
+		t.Errorf("Validate(current) = %d, %v", step, ok)
+	}
+	if _, ok := Validate(strings.ToLower(secret), "081 804", now.Add(Period), 1); !ok {
+		t.Error("a code from the previous step should be accepted with skew 1")
+	}
+	if _, ok := Validate(secret, code, now.Add(2*Period), 1); ok {
+		t.Error("a code two steps old should be rejected")
+	}
+	for _, bad := range []string{"", "81804", "0818040", "abcdef"} {
+		if _, ok := Validate(secret, bad, now, 1); ok {
+			t.Errorf("Validate(%q) should fail", bad)
+		}
+	}
+	if _, ok := Validate("not base32!", code, now, 1); ok {
+		t.Error("an invalid secret should never validate")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	b, _ := GenerateSecret()
+	if len(a) != 32 || a == b {
+		t.Errorf("secrets %q and %q should be distinct 32-character base32 strings", a, b)
+	}
+	if _, err := Code(a, time.Now()); err != nil {
+		t.Errorf("generated secret doesn't decode: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("JBSWY3DPEHPK3PXP", "MySpendo", "sam@example.com")
+	want := "otpauth://totp/MySpendo:sam@example.com?algorithm=SHA1&digits=6&issuer=MySpendo&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Errorf("URI = %q\nwant %q", got, want)
+	}
+}
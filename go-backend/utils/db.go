@@ -6,6 +6,15 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgreSQL error codes checked by handlers
+const (
+	PgUniqueViolation     = "23505"
+	PgForeignKeyViolation = "23503"
+	PgNoDataFound         = "P0002"
 )
 
 // IsConnectionError checks if an error is related to database connectivity issues
@@ -44,6 +53,22 @@ func IsConnectionError(err error) bool {
 	return false
 }
 
+// IsPgError reports whether err is (or wraps) a PostgreSQL error with the given SQLSTATE code
+func IsPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+// PgConstraintName returns the constraint a PostgreSQL error (or an error wrapping one) is about,
+// or "" if there is none
+func PgConstraintName(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.ConstraintName
+	}
+	return ""
+}
+
 // RetryableDBOperation executes a database operation with retry logic for connection failures
 // maxRetries: maximum number of retry attempts (typically 3)
 // operation: the database operation to execute
@@ -72,16 +97,16 @@ func RetryableDBOperation(maxRetries int, operation func() error) error {
 	return errors.New("database connection unavailable. Please try again later")
 }
 
-// VerifyCategoryOwnership checks if a category belongs to the specified user.
-// Returns nil if the category is valid and belongs to the user, or if categoryID is 0 (no category).
-// Returns an error if the category doesn't exist or belongs to another user.
-func VerifyCategoryOwnership(db *sql.DB, userID, categoryID int) error {
+// VerifyCategoryOwnership checks if a category belongs to the specified ledger.
+// Returns nil if the category is valid and in the ledger, or if categoryID is 0 (no category).
+// Returns an error if the category doesn't exist or belongs to another ledger.
+func VerifyCategoryOwnership(db *sql.DB, ledgerID, categoryID int) error {
 	if categoryID == 0 {
 		return nil // Allow no category
 	}
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM categories WHERE id = $1 AND user_id = $2",
-		categoryID, userID).Scan(&count)
+	err := db.QueryRow("SELECT COUNT(*) FROM categories WHERE id = $1 AND ledger_id = $2",
+		categoryID, ledgerID).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("failed to verify category ownership: %w", err)
 	}
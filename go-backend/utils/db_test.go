@@ -3,7 +3,10 @@ package utils
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func TestIsConnectionError(t *testing.T) {
@@ -109,6 +112,41 @@ func TestIsConnectionError(t *testing.T) {
 	}
 }
 
+func TestIsPgError(t *testing.T) {
+	uniqueErr := &pgconn.PgError{Code: PgUniqueViolation, Message: "duplicate key value violates unique constraint"}
+
+	tests := []struct {
+		name string
+		err  error
+		code string
+		want bool
+	}{
+		{name: "matching code", err: uniqueErr, code: PgUniqueViolation, want: true},
+		{name: "wrapped error", err: fmt.Errorf("insert failed: %w", uniqueErr), code: PgUniqueViolation, want: true},
+		{name: "different code", err: uniqueErr, code: PgNoDataFound, want: false},
+		{name: "plain error", err: errors.New("duplicate key value violates unique constraint"), code: PgUniqueViolation, want: false},
+		{name: "nil error", err: nil, code: PgUniqueViolation, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPgError(tt.err, tt.code); got != tt.want {
+				t.Errorf("IsPgError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPgConstraintName(t *testing.T) {
+	uniqueErr := &pgconn.PgError{Code: PgUniqueViolation, ConstraintName: "users_email_key"}
+	if got := PgConstraintName(fmt.Errorf("update failed: %w", uniqueErr)); got != "users_email_key" {
+		t.Errorf("PgConstraintName() = %q, want %q", got, "users_email_key")
+	}
+	if got := PgConstraintName(errors.New("users_email_key")); got != "" {
+		t.Errorf("PgConstraintName(plain error) = %q, want \"\"", got)
+	}
+}
+
 func TestRetryableDBOperation(t *testing.T) {
 	tests := []struct {
 		name          string
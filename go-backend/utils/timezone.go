@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoadTimezone returns the location for an IANA time zone name such as "America/Los_Angeles".
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("time zone must be an IANA name such as America/New_York")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q; use an IANA name such as America/New_York", name)
+	}
+	return loc, nil
+}
+
+// DateIn returns the calendar date of t in loc as midnight UTC, the same form as a date parsed
+// from YYYY-MM-DD, so it can be compared with stored dates.
+func DateIn(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// TodayIn returns today's date in loc (see DateIn).
+func TodayIn(loc *time.Location) time.Time {
+	return DateIn(time.Now(), loc)
+}
+
+// LocationOrUTC loads a stored time zone name, falling back to UTC if it isn't known.
+func LocationOrUTC(name string) *time.Location {
+	loc, err := LoadTimezone(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadTimezone(t *testing.T) {
+	if _, err := LoadTimezone("America/Los_Angeles"); err != nil {
+		t.Errorf("LoadTimezone(America/Los_Angeles) = %v", err)
+	}
+	for _, name := range []string{"", "Local", "Mars/Olympus_Mons"} {
+		if _, err := LoadTimezone(name); err == nil {
+			t.Errorf("LoadTimezone(%q) should fail", name)
+		}
+	}
+}
+
+func TestDateIn(t *testing.T) {
+	la, _ := LoadTimezone("America/Los_Angeles")
+	tokyo, _ := LoadTimezone("Asia/Tokyo")
+	instant := time.Date(2025, 3, 1, 2, 0, 0, 0, time.UTC) // 6pm Feb 28 in Los Angeles, 11am Mar 1 in Tokyo
+
+	if got := DateIn(instant, la).Format("2006-01-02"); got != "2025-02-28" {
+		t.Errorf("DateIn(Los Angeles) = %s, want 2025-02-28", got)
+	}
+	if got := DateIn(instant, tokyo); !got.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("DateIn(Tokyo) = %v, want midnight UTC on 2025-03-01", got)
+	}
+}
+
+func TestValidateTransactionDateIn(t *testing.T) {
+	// UTC+14: its date is ahead of UTC for most of the day
+	kiritimati, _ := LoadTimezone("Pacific/Kiritimati")
+	today := TodayIn(kiritimati)
+
+	if err := ValidateTransactionDateIn(today.Format("2006-01-02"), kiritimati); err != nil {
+		t.Errorf("today in the user's time zone should be valid: %v", err)
+	}
+	if err := ValidateTransactionDateIn(today.AddDate(0, 0, 1).Format("2006-01-02"), kiritimati); err == nil {
+		t.Error("tomorrow in the user's time zone should be rejected")
+	}
+}
@@ -2,9 +2,11 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/vidya381/myspendo-backend/constants"
+	"github.com/vidya381/myspendo-backend/models"
 )
 
 // ValidateDate checks if a date string is in YYYY-MM-DD format and is a valid date
@@ -38,8 +40,13 @@ func ValidateDate(dateStr string) error {
 	return nil
 }
 
-// ValidateTransactionDate validates date for transactions - only allows past dates up to today
+// ValidateTransactionDate validates date for transactions - only allows past dates up to today (UTC)
 func ValidateTransactionDate(dateStr string) error {
+	return ValidateTransactionDateIn(dateStr, time.UTC)
+}
+
+// ValidateTransactionDateIn validates date for transactions - only allows past dates up to today in the user's time zone
+func ValidateTransactionDateIn(dateStr string, loc *time.Location) error {
 	if dateStr == "" {
 		return fmt.Errorf("date is required")
 	}
@@ -50,9 +57,8 @@ func ValidateTransactionDate(dateStr string) error {
 		return fmt.Errorf("invalid date format. Expected YYYY-MM-DD (e.g., 2025-12-25)")
 	}
 
-	// Use UTC and truncate to date-only for consistent comparison across timezones
-	now := time.Now().UTC()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// Compare calendar dates: today in the user's time zone, as midnight UTC like parsedDate
+	today := TodayIn(loc)
 
 	// Check if the date is in the future
 	if parsedDate.After(today) {
@@ -68,8 +74,13 @@ func ValidateTransactionDate(dateStr string) error {
 	return nil
 }
 
-// ValidateRecurringDate validates date for recurring transactions
+// ValidateRecurringDate validates date for recurring transactions (relative to today in UTC)
 func ValidateRecurringDate(dateStr string) error {
+	return ValidateRecurringDateIn(dateStr, time.UTC)
+}
+
+// ValidateRecurringDateIn validates date for recurring transactions relative to today in the user's time zone
+func ValidateRecurringDateIn(dateStr string, loc *time.Location) error {
 	if dateStr == "" {
 		return fmt.Errorf("start date is required")
 	}
@@ -80,9 +91,8 @@ func ValidateRecurringDate(dateStr string) error {
 		return fmt.Errorf("invalid start date format. Expected YYYY-MM-DD (e.g., 2025-12-25)")
 	}
 
-	// Use UTC and truncate to date-only for consistent comparison across timezones
-	now := time.Now().UTC()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// Compare calendar dates: today in the user's time zone, as midnight UTC like parsedDate
+	today := TodayIn(loc)
 
 	// Start date should not be too far in the future (more than 1 year)
 	oneYearFromNow := today.AddDate(1, 0, 0)
@@ -100,18 +110,32 @@ func ValidateRecurringDate(dateStr string) error {
 }
 
 // ValidateAmount checks if an amount is valid (positive and reasonable)
-func ValidateAmount(amount float64) error {
+func ValidateAmount(amount models.Money) error {
 	if amount <= 0 {
 		return fmt.Errorf("amount must be greater than 0")
 	}
 
-	if amount > constants.MaxAmount {
-		return fmt.Errorf("amount is too large. Maximum allowed is %.0f", float64(constants.MaxAmount))
+	if amount > models.Money(constants.MaxAmount).MulInt(100) {
+		return fmt.Errorf("amount is too large. Maximum allowed is %d", constants.MaxAmount)
 	}
 
 	return nil
 }
 
+// NormalizeCurrency validates a 3-letter ISO 4217 currency code and returns it upper-cased
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("currency must be a 3-letter ISO 4217 code (e.g., USD, EUR)")
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < 'A' || code[i] > 'Z' {
+			return "", fmt.Errorf("currency must be a 3-letter ISO 4217 code (e.g., USD, EUR)")
+		}
+	}
+	return code, nil
+}
+
 // ValidatePaginationParams validates limit and offset for pagination
 func ValidatePaginationParams(limit, offset int) error {
 	if limit < 1 {
@@ -3,6 +3,8 @@ package utils
 import (
 	"testing"
 	"time"
+
+	"github.com/vidya381/myspendo-backend/models"
 )
 
 func TestValidateDate(t *testing.T) {
@@ -177,22 +179,27 @@ func TestValidateRecurringDate(t *testing.T) {
 func TestValidateAmount(t *testing.T) {
 	tests := []struct {
 		name    string
-		amount  float64
+		amount  models.Money
 		wantErr bool
 	}{
 		{
 			name:    "valid amount - small",
-			amount:  0.01,
+			amount:  1, // 0.01
 			wantErr: false,
 		},
 		{
 			name:    "valid amount - medium",
-			amount:  100.50,
+			amount:  10050, // 100.50
 			wantErr: false,
 		},
 		{
 			name:    "valid amount - large",
-			amount:  999999999,
+			amount:  99999999900, // 999999999.00
+			wantErr: false,
+		},
+		{
+			name:    "valid amount - maximum",
+			amount:  100000000000, // 1000000000.00
 			wantErr: false,
 		},
 		{
@@ -202,17 +209,17 @@ func TestValidateAmount(t *testing.T) {
 		},
 		{
 			name:    "invalid amount - negative",
-			amount:  -10.50,
+			amount:  -1050, // -10.50
 			wantErr: true,
 		},
 		{
 			name:    "invalid amount - too large",
-			amount:  1000000001,
+			amount:  100000000100, // 1000000001.00
 			wantErr: true,
 		},
 		{
 			name:    "invalid amount - extremely large",
-			amount:  9999999999999,
+			amount:  999999999999900, // 9999999999999.00
 			wantErr: true,
 		},
 	}
@@ -227,6 +234,34 @@ func TestValidateAmount(t *testing.T) {
 	}
 }
 
+func TestNormalizeCurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "upper case", input: "EUR", want: "EUR"},
+		{name: "lower case with spaces", input: " inr ", want: "INR"},
+		{name: "empty", input: "", wantErr: true},
+		{name: "too short", input: "EU", wantErr: true},
+		{name: "too long", input: "EURO", wantErr: true},
+		{name: "digits", input: "E1R", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeCurrency(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeCurrency(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeCurrency(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestValidatePaginationParams(t *testing.T) {
 	tests := []struct {
 		name    string